@@ -9,7 +9,6 @@ import (
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server"
 	"github.com/peer-calls/peer-calls/v4/server/cli"
-	"github.com/peer-calls/peer-calls/v4/server/logformatter"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/multierr"
 	"github.com/spf13/pflag"
@@ -40,11 +39,19 @@ func mustSub(dir fs.FS, path string) fs.FS {
 	return fs
 }
 
-func start(ctx context.Context, log logger.Logger, args []string) error {
+func start(
+	ctx context.Context,
+	log logger.Logger,
+	logConfig *logger.AtomicConfig,
+	logFormatter *logger.AtomicFormatter,
+	args []string,
+) error {
 	err := cli.Exec(ctx, cli.Props{
-		Log:     log,
-		Version: GitDescribe,
-		Args:    args,
+		Log:          log,
+		LogConfig:    logConfig,
+		LogFormatter: logFormatter,
+		Version:      GitDescribe,
+		Args:         args,
 		Embed: server.Embed{
 			Resources: mustSub(resourcesFS, "res"),
 			Templates: mustSub(templatesFS, "server/templates"),
@@ -56,24 +63,33 @@ func start(ctx context.Context, log logger.Logger, args []string) error {
 }
 
 func main() {
+	logConfig := logger.NewAtomicConfig(
+		logger.NewConfig(logger.ConfigMap{
+			"**:sdp":          logger.LevelError,
+			"**:ws":           logger.LevelError,
+			"**:nack":         logger.LevelError,
+			"**:signaller:**": logger.LevelError,
+			"**:pion:**":      logger.LevelWarn,
+			"**:pubsub":       logger.LevelTrace,
+			"**:factory":      logger.LevelTrace,
+			"":                logger.LevelInfo,
+		}),
+	)
+
+	// The config might also be set in the config file, but it is not read
+	// yet.
+	logConfig.Store(logger.NewConfigFromString(os.Getenv("PEERCALLS_LOG")))
+
+	logFormatter := logger.NewAtomicFormatter(
+		server.NewLogFormatter(server.LogFormat(os.Getenv("PEERCALLS_LOG_FORMAT"))),
+	)
+
 	log := logger.New().
-		WithConfig(
-			logger.NewConfig(logger.ConfigMap{
-				"**:sdp":          logger.LevelError,
-				"**:ws":           logger.LevelError,
-				"**:nack":         logger.LevelError,
-				"**:signaller:**": logger.LevelError,
-				"**:pion:**":      logger.LevelWarn,
-				"**:pubsub":       logger.LevelTrace,
-				"**:factory":      logger.LevelTrace,
-				"":                logger.LevelInfo,
-			}),
-		).
-		WithConfig(logger.NewConfigFromString(os.Getenv("PEERCALLS_LOG"))).
-		WithFormatter(logformatter.New()).
+		WithConfig(logConfig).
+		WithFormatter(logFormatter).
 		WithNamespaceAppended("main")
 
-	err := start(context.Background(), log, os.Args[1:])
+	err := start(context.Background(), log, logConfig, logFormatter, os.Args[1:])
 
 	if multierr.Is(err, pflag.ErrHelp) {
 		os.Exit(1)
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -25,7 +26,7 @@ func TestStartMissingConfig(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	err := start(ctx, log, []string{"-c", "/missing/file.yml"})
+	err := start(ctx, log, logger.NewAtomicConfig(logger.LevelDisabled), newLogFormatter(), []string{"-c", "/missing/file.yml"})
 	require.Error(t, err)
 	fmt.Printf("error %+v", err)
 	assert.Contains(t, err.Error(), "read config")
@@ -41,7 +42,7 @@ func TestStartWrongPort(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	err := start(ctx, log, []string{})
+	err := start(ctx, log, logger.NewAtomicConfig(logger.LevelDisabled), newLogFormatter(), []string{})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid port")
 }
@@ -73,7 +74,7 @@ func TestStart(t *testing.T) {
 
 	go func() {
 		defer close(errCh)
-		err := start(ctx, log, []string{})
+		err := start(ctx, log, logger.NewAtomicConfig(logger.LevelDisabled), newLogFormatter(), []string{})
 		errCh <- err
 	}()
 
@@ -107,3 +108,7 @@ func TestStart(t *testing.T) {
 		require.Fail(t, "timed out")
 	}
 }
+
+func newLogFormatter() *logger.AtomicFormatter {
+	return logger.NewAtomicFormatter(logger.NewStringFormatter(logger.StringFormatterParams{}))
+}
@@ -1,31 +1,57 @@
 package server
 
 import (
+	"context"
 	"net"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/go-redis/redis/v7"
 	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
 	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/peer-calls/peer-calls/v4/server/quota"
+)
+
+const (
+	// quotaTTL is the duration after which the quota members of a node that
+	// stopped refreshing them, for example because it crashed, expire.
+	quotaTTL = time.Minute
+	// quotaRefreshInterval is the interval at which the members acquired by
+	// this node are refreshed.
+	quotaRefreshInterval = quotaTTL / 3
 )
 
 type AdapterFactory struct {
-	pubClient *redis.Client
-	subClient *redis.Client
+	log         logger.Logger
+	pubClient   *redis.Client
+	subClient   *redis.Client
+	redisPrefix string
+	redisQuota  *quota.Redis
+
+	closeChan chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
 
 	NewAdapter func(room identifiers.RoomID) Adapter
 }
 
 func NewAdapterFactory(log logger.Logger, c StoreConfig) *AdapterFactory {
 	log = log.WithNamespaceAppended("adapterfactory")
-	f := AdapterFactory{}
+	f := AdapterFactory{
+		log:       log,
+		closeChan: make(chan struct{}),
+	}
 
 	switch c.Type {
 	case StoreTypeRedis:
 		addr := net.JoinHostPort(c.Redis.Host, strconv.Itoa(c.Redis.Port))
 		prefix := c.Redis.Prefix
 
+		f.redisPrefix = prefix
+
 		log.Info("Using RedisAdapter", logger.Ctx{
 			"remote_addr": addr,
 			"prefix":      prefix,
@@ -42,6 +68,21 @@ func NewAdapterFactory(log logger.Logger, c StoreConfig) *AdapterFactory {
 		f.NewAdapter = func(room identifiers.RoomID) Adapter {
 			return NewRedisAdapter(log, f.pubClient, f.subClient, prefix, room)
 		}
+
+		f.redisQuota = quota.NewRedis(quota.RedisParams{
+			Client: f.pubClient,
+			Prefix: prefix,
+			Clock:  clock.New(),
+			TTL:    quotaTTL,
+		})
+
+		f.wg.Add(1)
+
+		go func() {
+			defer f.wg.Done()
+
+			f.refreshQuota()
+		}()
 	default:
 		log.Info("Using MemoryAdapter", nil)
 
@@ -53,7 +94,80 @@ func NewAdapterFactory(log logger.Logger, c StoreConfig) *AdapterFactory {
 	return &f
 }
 
+// RedisClient returns the client used for publishing to Redis. It will be nil
+// when the store type is not redis.
+func (a *AdapterFactory) RedisClient() *redis.Client {
+	return a.pubClient
+}
+
+// RedisPrefix returns the prefix for Redis keys.
+func (a *AdapterFactory) RedisPrefix() string {
+	return a.redisPrefix
+}
+
+// NewQuota returns the quota for the room limits. It is shared by all nodes
+// when the store type is redis.
+func (a *AdapterFactory) NewQuota() quota.Quota {
+	if a.pubClient == nil {
+		return quota.NewMemory()
+	}
+
+	return a.redisQuota
+}
+
+// refreshQuota keeps the quota members acquired by this node from expiring
+// until the factory is closed.
+func (a *AdapterFactory) refreshQuota() {
+	ticker := time.NewTicker(quotaRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.redisQuota.Refresh(); err != nil {
+				a.log.Error("Refresh quota", errors.Trace(err), nil)
+			}
+		case <-a.closeChan:
+			return
+		}
+	}
+}
+
+// RegisterHealthChecks registers the Redis connectivity check when the
+// store type is redis.
+func (a *AdapterFactory) RegisterHealthChecks(health *Health) {
+	if a.pubClient == nil {
+		return
+	}
+
+	health.Register(HealthCheck{
+		Name:  "redis",
+		Type:  HealthCheckTypeReadiness,
+		Check: a.checkRedis,
+	})
+}
+
+// checkRedis pings both the client used for publishing and the one used for
+// subscribing.
+func (a *AdapterFactory) checkRedis(ctx context.Context) error {
+	if err := a.pubClient.WithContext(ctx).Ping().Err(); err != nil {
+		return errors.Annotatef(err, "ping redis pub")
+	}
+
+	if err := a.subClient.WithContext(ctx).Ping().Err(); err != nil {
+		return errors.Annotatef(err, "ping redis sub")
+	}
+
+	return nil
+}
+
 func (a *AdapterFactory) Close() (err error) {
+	a.closeOnce.Do(func() {
+		close(a.closeChan)
+	})
+
+	a.wg.Wait()
+
 	var errs MultiErrorHandler
 
 	if a.pubClient != nil {
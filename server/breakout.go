@@ -0,0 +1,454 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/peer-calls/peer-calls/v4/server/message"
+	"nhooyr.io/websocket"
+)
+
+const (
+	maxBreakoutDuration = 24 * time.Hour
+
+	// breakoutRoomSeparator separates the parent room from the breakout room
+	// name in the IDs of the breakout rooms.
+	breakoutRoomSeparator = "~"
+)
+
+var (
+	// ErrBreakoutExists is returned when the room already has breakout rooms.
+	ErrBreakoutExists = errors.New("breakout already exists")
+	// ErrBreakoutNotFound is returned when the room has no breakout rooms.
+	ErrBreakoutNotFound = errors.New("breakout not found")
+	// ErrInvalidBreakout is returned when the breakout rooms are not valid.
+	ErrInvalidBreakout = errors.New("invalid breakout")
+)
+
+type BreakoutsParams struct {
+	Log logger.Logger
+	// Rooms is used for sending the breakout messages to the clients.
+	Rooms RoomManager
+	// NewAdapter creates the adapters of the rooms which are not active on
+	// this node, so that the clients connected to the other nodes are moved
+	// too. Those rooms are skipped when it is nil.
+	NewAdapter NewAdapterFunc
+	// Clock is used for ending the breakouts.
+	Clock clock.Clock
+}
+
+// Breakouts moves the clients of a room to breakout rooms, and brings them
+// back to the parent room when the breakout ends. The breakout messages are
+// broadcast through the adapter of the room, so they reach the clients on
+// all nodes. The node of each moved client closes its connection, which hangs
+// up its SFU or mesh participation and removes it from the adapter, and the
+// client reconnects to the other room. The breakouts are tracked per node.
+type Breakouts struct {
+	params *BreakoutsParams
+
+	mu sync.Mutex
+	// breakouts contains the active breakouts by the parent room.
+	breakouts map[identifiers.RoomID]*breakout
+}
+
+type breakout struct {
+	// rooms contains the clients assigned to each breakout room.
+	rooms  map[identifiers.RoomID][]identifiers.ClientID
+	endsAt time.Time
+	// cancelEnd stops the pending end of the breakout.
+	cancelEnd chan struct{}
+}
+
+// BreakoutState describes an active breakout.
+type BreakoutState struct {
+	// Room is the parent room.
+	Room   identifiers.RoomID  `json:"room"`
+	Rooms  []BreakoutRoomState `json:"rooms"`
+	EndsAt time.Time           `json:"endsAt"`
+}
+
+// BreakoutRoomState describes a breakout room.
+type BreakoutRoomState struct {
+	Room identifiers.RoomID `json:"room"`
+	// Assigned contains the clients moved to the room.
+	Assigned []identifiers.ClientID `json:"assigned"`
+	// Clients contains the clients connected to the room.
+	Clients []identifiers.ClientID `json:"clients"`
+}
+
+func NewBreakouts(params BreakoutsParams) *Breakouts {
+	params.Log = params.Log.WithNamespaceAppended("breakouts")
+
+	return &Breakouts{
+		params: &params,
+
+		mu:        sync.Mutex{},
+		breakouts: map[identifiers.RoomID]*breakout{},
+	}
+}
+
+// BreakoutRoomID returns the ID of the breakout room with the name in the
+// parent room.
+func BreakoutRoomID(parent identifiers.RoomID, name string) identifiers.RoomID {
+	return identifiers.RoomID(parent.String() + breakoutRoomSeparator + name)
+}
+
+// Start tells the clients in rooms to move from the parent room to the
+// breakout rooms, which are keyed by name. The clients are brought back to
+// the parent room after duration.
+func (b *Breakouts) Start(
+	parent identifiers.RoomID,
+	rooms map[string][]identifiers.ClientID,
+	duration time.Duration,
+) (BreakoutState, error) {
+	if err := validateBreakout(parent, rooms, duration); err != nil {
+		return BreakoutState{}, errors.Trace(err)
+	}
+
+	b.mu.Lock()
+
+	if _, ok := b.breakouts[parent]; ok {
+		b.mu.Unlock()
+
+		return BreakoutState{}, errors.Annotatef(ErrBreakoutExists, "room: %s", parent)
+	}
+
+	cancelEnd := make(chan struct{})
+	timer := b.params.Clock.NewTimer(duration)
+
+	bo := &breakout{
+		rooms:     make(map[identifiers.RoomID][]identifiers.ClientID, len(rooms)),
+		endsAt:    b.params.Clock.Now().Add(duration),
+		cancelEnd: cancelEnd,
+	}
+
+	for name, clientIDs := range rooms {
+		bo.rooms[BreakoutRoomID(parent, name)] = clientIDs
+	}
+
+	b.breakouts[parent] = bo
+
+	b.mu.Unlock()
+
+	b.params.Log.Info("Breakout started", logger.Ctx{
+		"room_id": parent,
+		"rooms":   len(rooms),
+		"ends_at": bo.endsAt,
+	})
+
+	go func() {
+		defer timer.Stop()
+
+		select {
+		case <-timer.C():
+			// The breakout might have just been ended by End.
+			if err := b.end(parent, cancelEnd); err != nil && errors.Cause(err) != ErrBreakoutNotFound {
+				b.params.Log.Error("End breakout", errors.Trace(err), logger.Ctx{
+					"room_id": parent,
+				})
+			}
+		case <-cancelEnd:
+		}
+	}()
+
+	endsAt := bo.endsAt.UnixMilli()
+
+	for room, clientIDs := range bo.rooms {
+		// A breakout message without clients would move all of them.
+		if len(clientIDs) == 0 {
+			continue
+		}
+
+		b.broadcast(parent, message.Breakout{
+			Room:    room,
+			Parent:  parent,
+			EndsAt:  endsAt,
+			Clients: clientIDs,
+		})
+	}
+
+	return b.state(parent, bo), nil
+}
+
+// End brings the clients in the breakout rooms back to the parent room.
+func (b *Breakouts) End(parent identifiers.RoomID) error {
+	return errors.Trace(b.end(parent, nil))
+}
+
+// end ends the breakout of the parent room. When cancelEnd is set, the
+// breakout is only ended when it was scheduled by the same Start.
+func (b *Breakouts) end(parent identifiers.RoomID, cancelEnd chan struct{}) error {
+	b.mu.Lock()
+
+	bo, ok := b.breakouts[parent]
+	if !ok || (cancelEnd != nil && bo.cancelEnd != cancelEnd) {
+		b.mu.Unlock()
+
+		return errors.Annotatef(ErrBreakoutNotFound, "room: %s", parent)
+	}
+
+	delete(b.breakouts, parent)
+
+	if cancelEnd == nil {
+		close(bo.cancelEnd)
+	}
+
+	b.mu.Unlock()
+
+	b.params.Log.Info("Breakout ended", logger.Ctx{
+		"room_id": parent,
+	})
+
+	// All clients in the breakout rooms are moved, including those which
+	// were not assigned to them.
+	for room := range bo.rooms {
+		b.broadcast(room, message.Breakout{
+			Room:    parent,
+			Parent:  parent,
+			EndsAt:  0,
+			Clients: nil,
+		})
+	}
+
+	return nil
+}
+
+// State returns the active breakouts, ordered by the parent room.
+func (b *Breakouts) State() []BreakoutState {
+	b.mu.Lock()
+
+	breakouts := make(map[identifiers.RoomID]*breakout, len(b.breakouts))
+	for parent, bo := range b.breakouts {
+		breakouts[parent] = bo
+	}
+
+	b.mu.Unlock()
+
+	states := make([]BreakoutState, 0, len(breakouts))
+
+	for parent, bo := range breakouts {
+		states = append(states, b.state(parent, bo))
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Room < states[j].Room
+	})
+
+	return states
+}
+
+// Close stops the pending ends of the breakouts, without moving the clients.
+func (b *Breakouts) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for parent, bo := range b.breakouts {
+		close(bo.cancelEnd)
+		delete(b.breakouts, parent)
+	}
+}
+
+func (b *Breakouts) state(parent identifiers.RoomID, bo *breakout) BreakoutState {
+	rooms := make([]BreakoutRoomState, 0, len(bo.rooms))
+
+	for room, clientIDs := range bo.rooms {
+		rooms = append(rooms, BreakoutRoomState{
+			Room:     room,
+			Assigned: clientIDs,
+			Clients:  b.clients(room),
+		})
+	}
+
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].Room < rooms[j].Room
+	})
+
+	return BreakoutState{
+		Room:   parent,
+		Rooms:  rooms,
+		EndsAt: bo.endsAt,
+	}
+}
+
+// clients returns the sorted IDs of the clients connected to the room on all
+// nodes. It is empty when the room is not active on this node and no adapter
+// can be created for it.
+func (b *Breakouts) clients(room identifiers.RoomID) []identifiers.ClientID {
+	adapter, release, ok := b.adapter(room)
+	if !ok {
+		return []identifiers.ClientID{}
+	}
+
+	defer release()
+
+	clients, err := adapter.Clients()
+	if err != nil {
+		b.params.Log.Error("Retrieve clients", errors.Trace(err), logger.Ctx{
+			"room_id": room,
+		})
+	}
+
+	clientIDs := make([]identifiers.ClientID, 0, len(clients))
+
+	for clientID := range clients {
+		clientIDs = append(clientIDs, clientID)
+	}
+
+	sort.Slice(clientIDs, func(i, j int) bool {
+		return clientIDs[i] < clientIDs[j]
+	})
+
+	return clientIDs
+}
+
+// broadcast sends the breakout message to the clients of the room on all
+// nodes. Only the moved clients receive it, see breakoutWriter.
+func (b *Breakouts) broadcast(room identifiers.RoomID, breakout message.Breakout) {
+	adapter, release, ok := b.adapter(room)
+	if !ok {
+		b.params.Log.Warn("Room not active on this node", logger.Ctx{
+			"room_id": room,
+		})
+
+		return
+	}
+
+	defer release()
+
+	if err := adapter.Broadcast(message.NewBreakout(room, breakout)); err != nil {
+		b.params.Log.Error("Broadcast breakout", errors.Trace(err), logger.Ctx{
+			"room_id": room,
+		})
+	}
+}
+
+// adapter returns the adapter of the room and a function which releases it.
+// The room is not entered: the adapter of the active room is used, or a new
+// one is created when the room is not active on this node. It returns false
+// when the room is not active and NewAdapter is not set.
+func (b *Breakouts) adapter(room identifiers.RoomID) (Adapter, func(), bool) {
+	if adapter, ok := b.params.Rooms.Get(room); ok {
+		return adapter, func() {}, true
+	}
+
+	if b.params.NewAdapter == nil {
+		return nil, nil, false
+	}
+
+	adapter := b.params.NewAdapter(room)
+
+	return adapter, func() {
+		if err := adapter.Close(); err != nil {
+			b.params.Log.Error("Close adapter", errors.Trace(err), logger.Ctx{
+				"room_id": room,
+			})
+		}
+	}, true
+}
+
+// breakoutWriter writes the breakout messages only to the client they move.
+// The connection of a moved client is closed after the message is written,
+// so the handler hangs up its SFU or mesh participation and removes it from
+// the adapter, just like when it disconnects.
+type breakoutWriter struct {
+	*Client
+	log logger.Logger
+}
+
+func newBreakoutWriter(log logger.Logger, client *Client) breakoutWriter {
+	return breakoutWriter{
+		Client: client,
+		log:    log,
+	}
+}
+
+func (w breakoutWriter) Write(msg message.Message) error {
+	if msg.Type != message.TypeBreakout {
+		return errors.Trace(w.Client.Write(msg))
+	}
+
+	breakout := *msg.Payload.Breakout
+
+	if !breakoutMovesClient(breakout, w.ID()) {
+		return nil
+	}
+
+	// The other clients moved by the message are not shared with the client.
+	breakout.Clients = nil
+	msg.Payload.Breakout = &breakout
+
+	if err := w.Client.Write(msg); err != nil {
+		return errors.Trace(err)
+	}
+
+	w.log.Info("Close connection after breakout", logger.Ctx{
+		"breakout_room": breakout.Room,
+	})
+
+	// The message is written while the adapter broadcasts, and closing the
+	// connection waits for the client.
+	go func() {
+		if err := w.Client.Close(websocket.StatusNormalClosure, "breakout"); err != nil {
+			w.log.Error("Close after breakout", errors.Trace(err), nil)
+		}
+	}()
+
+	return nil
+}
+
+// breakoutMovesClient returns true when the breakout moves the client.
+func breakoutMovesClient(breakout message.Breakout, clientID identifiers.ClientID) bool {
+	if len(breakout.Clients) == 0 {
+		return true
+	}
+
+	for _, id := range breakout.Clients {
+		if id == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateBreakout(
+	parent identifiers.RoomID,
+	rooms map[string][]identifiers.ClientID,
+	duration time.Duration,
+) error {
+	if strings.Contains(parent.String(), breakoutRoomSeparator) {
+		return errors.Annotatef(ErrInvalidBreakout, "room is a breakout room: %s", parent)
+	}
+
+	if duration <= 0 || duration > maxBreakoutDuration {
+		return errors.Annotatef(ErrInvalidBreakout, "duration must be between 0 and %s", maxBreakoutDuration)
+	}
+
+	if len(rooms) == 0 {
+		return errors.Annotate(ErrInvalidBreakout, "no rooms")
+	}
+
+	assigned := map[identifiers.ClientID]struct{}{}
+
+	for name, clientIDs := range rooms {
+		if name == "" || strings.ContainsAny(name, "/"+breakoutRoomSeparator) {
+			return errors.Annotatef(ErrInvalidBreakout, "room name: %q", name)
+		}
+
+		for _, clientID := range clientIDs {
+			if _, ok := assigned[clientID]; ok {
+				return errors.Annotatef(ErrInvalidBreakout, "client assigned twice: %s", clientID)
+			}
+
+			assigned[clientID] = struct{}{}
+		}
+	}
+
+	return nil
+}
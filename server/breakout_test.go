@@ -0,0 +1,269 @@
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/peer-calls/peer-calls/v4/server/message"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// breakoutClient receives the breakout messages which move it, like the
+// websocket client does.
+type breakoutClient struct {
+	id        identifiers.ClientID
+	breakouts chan message.Breakout
+}
+
+func newBreakoutClient(id identifiers.ClientID) *breakoutClient {
+	return &breakoutClient{
+		id:        id,
+		breakouts: make(chan message.Breakout, 10),
+	}
+}
+
+func (c *breakoutClient) ID() identifiers.ClientID {
+	return c.id
+}
+
+func (c *breakoutClient) Write(msg message.Message) error {
+	if msg.Type != message.TypeBreakout {
+		return nil
+	}
+
+	breakout := *msg.Payload.Breakout
+
+	if len(breakout.Clients) == 0 {
+		c.breakouts <- breakout
+
+		return nil
+	}
+
+	for _, clientID := range breakout.Clients {
+		if clientID == c.id {
+			c.breakouts <- breakout
+		}
+	}
+
+	return nil
+}
+
+func (c *breakoutClient) Metadata() string {
+	return ""
+}
+
+func (c *breakoutClient) SetMetadata(metadata string) {}
+
+func (c *breakoutClient) mustReadBreakout(t *testing.T) message.Breakout {
+	t.Helper()
+
+	select {
+	case breakout := <-c.breakouts:
+		return breakout
+	case <-time.After(timeout):
+		require.FailNow(t, "timed out waiting for breakout")
+
+		return message.Breakout{}
+	}
+}
+
+func TestBreakouts(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clk := clock.NewMock()
+
+	rooms := server.NewAdapterRoomManager(func(room identifiers.RoomID) server.Adapter {
+		return server.NewMemoryAdapter(room)
+	})
+
+	breakouts := server.NewBreakouts(server.BreakoutsParams{
+		Log:        test.NewLogger(),
+		Rooms:      rooms,
+		NewAdapter: nil,
+		Clock:      clk,
+	})
+	defer breakouts.Close()
+
+	const parent = identifiers.RoomID("class")
+
+	a := newBreakoutClient("a")
+	b := newBreakoutClient("b")
+	c := newBreakoutClient("c")
+
+	adapter, _ := rooms.Enter(parent)
+	defer rooms.Exit(parent)
+
+	for _, client := range []*breakoutClient{a, b, c} {
+		require.NoError(t, adapter.Add(client))
+	}
+
+	state, err := breakouts.Start(parent, map[string][]identifiers.ClientID{
+		"g1": {"a"},
+		"g2": {"b"},
+	}, 10*time.Minute)
+	require.NoError(t, err)
+
+	endsAt := clk.Now().Add(10 * time.Minute)
+
+	assert.Equal(t, server.BreakoutState{
+		Room: parent,
+		Rooms: []server.BreakoutRoomState{{
+			Room:     "class~g1",
+			Assigned: []identifiers.ClientID{"a"},
+			Clients:  []identifiers.ClientID{},
+		}, {
+			Room:     "class~g2",
+			Assigned: []identifiers.ClientID{"b"},
+			Clients:  []identifiers.ClientID{},
+		}},
+		EndsAt: endsAt,
+	}, state)
+
+	// The rooms are only looked up, not entered.
+	assert.Equal(t, 1, rooms.Len())
+
+	assert.Equal(t, message.Breakout{
+		Room:    "class~g1",
+		Parent:  parent,
+		EndsAt:  endsAt.UnixMilli(),
+		Clients: []identifiers.ClientID{"a"},
+	}, a.mustReadBreakout(t))
+	assert.Equal(t, identifiers.RoomID("class~g2"), b.mustReadBreakout(t).Room)
+	assert.Empty(t, c.breakouts)
+
+	_, err = breakouts.Start(parent, map[string][]identifiers.ClientID{
+		"g1": {"c"},
+	}, time.Minute)
+	assert.Equal(t, server.ErrBreakoutExists, errors.Cause(err))
+
+	// The client reconnects to the breakout room.
+	g1, _ := rooms.Enter("class~g1")
+	defer rooms.Exit("class~g1")
+
+	a2 := newBreakoutClient("a")
+	require.NoError(t, g1.Add(a2))
+
+	states := breakouts.State()
+	require.Len(t, states, 1)
+	assert.Equal(t, []identifiers.ClientID{"a"}, states[0].Rooms[0].Clients)
+
+	clk.Add(10 * time.Minute)
+
+	assert.Equal(t, message.Breakout{
+		Room:    parent,
+		Parent:  parent,
+		EndsAt:  0,
+		Clients: nil,
+	}, a2.mustReadBreakout(t))
+
+	// The state is removed before the clients are moved.
+	assert.Empty(t, breakouts.State())
+
+	err = breakouts.End(parent)
+	assert.Equal(t, server.ErrBreakoutNotFound, errors.Cause(err))
+
+	// The breakout can be ended before the timer.
+	_, err = breakouts.Start(parent, map[string][]identifiers.ClientID{
+		"g1": {"a"},
+	}, time.Minute)
+	require.NoError(t, err)
+
+	assert.Equal(t, identifiers.RoomID("class~g1"), a.mustReadBreakout(t).Room)
+
+	require.NoError(t, breakouts.End(parent))
+	assert.Equal(t, parent, a2.mustReadBreakout(t).Room)
+	assert.Empty(t, breakouts.State())
+}
+
+func TestBreakouts_redis(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	pub, sub, stop := configureRedis(t)
+	defer stop()
+
+	log := test.NewLogger()
+
+	newAdapter := func(room identifiers.RoomID) server.Adapter {
+		return server.NewRedisAdapter(log, pub, sub, "peercalls", room)
+	}
+
+	// The client is connected to the first node.
+	rooms1 := server.NewAdapterRoomManager(newAdapter)
+
+	const parent = identifiers.RoomID("breakout-redis")
+
+	adapter, _ := rooms1.Enter(parent)
+	defer rooms1.Exit(parent)
+
+	a := newBreakoutClient("a")
+	require.NoError(t, adapter.Add(a))
+
+	defer func() {
+		assert.NoError(t, adapter.Remove("a"))
+	}()
+
+	// The breakout is started on the second node, where the room is not
+	// active.
+	rooms2 := server.NewAdapterRoomManager(newAdapter)
+
+	breakouts := server.NewBreakouts(server.BreakoutsParams{
+		Log:        log,
+		Rooms:      rooms2,
+		NewAdapter: newAdapter,
+		Clock:      clock.NewMock(),
+	})
+	defer breakouts.Close()
+
+	_, err := breakouts.Start(parent, map[string][]identifiers.ClientID{
+		"g1": {"a"},
+	}, time.Minute)
+	require.NoError(t, err)
+
+	assert.Equal(t, identifiers.RoomID("breakout-redis~g1"), a.mustReadBreakout(t).Room)
+	assert.Equal(t, 0, rooms2.Len())
+}
+
+func TestBreakouts_invalid(t *testing.T) {
+	breakouts := server.NewBreakouts(server.BreakoutsParams{
+		Log: test.NewLogger(),
+		Rooms: server.NewAdapterRoomManager(func(room identifiers.RoomID) server.Adapter {
+			return server.NewMemoryAdapter(room)
+		}),
+		NewAdapter: nil,
+		Clock:      clock.NewMock(),
+	})
+	defer breakouts.Close()
+
+	type testCase struct {
+		name     string
+		room     identifiers.RoomID
+		rooms    map[string][]identifiers.ClientID
+		duration time.Duration
+	}
+
+	testCases := []testCase{
+		{"no rooms", "class", nil, time.Minute},
+		{"no duration", "class", map[string][]identifiers.ClientID{"g1": {"a"}}, 0},
+		{"long duration", "class", map[string][]identifiers.ClientID{"g1": {"a"}}, 25 * time.Hour},
+		{"empty name", "class", map[string][]identifiers.ClientID{"": {"a"}}, time.Minute},
+		{"nested name", "class", map[string][]identifiers.ClientID{"g1~g2": {"a"}}, time.Minute},
+		{"nested room", "class~g1", map[string][]identifiers.ClientID{"g2": {"a"}}, time.Minute},
+		{"assigned twice", "class", map[string][]identifiers.ClientID{"g1": {"a"}, "g2": {"a"}}, time.Minute},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := breakouts.Start(tc.room, tc.rooms, tc.duration)
+			assert.Equal(t, server.ErrInvalidBreakout, errors.Cause(err))
+		})
+	}
+
+	assert.Empty(t, breakouts.State())
+}
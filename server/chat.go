@@ -0,0 +1,169 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/peer-calls/peer-calls/v4/server/message"
+)
+
+const (
+	defaultChatHistorySize    = 100
+	defaultChatHistoryMaxAge  = 24 * time.Hour
+	defaultChatMaxMessageSize = 4096
+	defaultChatRateLimit      = 10
+	defaultChatRateInterval   = 10 * time.Second
+)
+
+var (
+	// ErrChatMessageTooLarge is returned when a chat message exceeds the
+	// maximum message size.
+	ErrChatMessageTooLarge = errors.New("chat message too large")
+	// ErrChatRateLimited is returned when a client sends more chat messages
+	// than the rate limit allows.
+	ErrChatRateLimited = errors.New("too many chat messages")
+)
+
+// Chat relays the chat messages of a single client to its room and stores
+// them in the history of the room.
+type Chat struct {
+	log      logger.Logger
+	clock    clock.Clock
+	adapter  Adapter
+	roomID   identifiers.RoomID
+	clientID identifiers.ClientID
+	config   ChatConfig
+
+	mu sync.Mutex
+	// windowStart is the start of the current rate limit window.
+	windowStart time.Time
+	// windowCount is the number of messages sent in the current window.
+	windowCount int
+}
+
+// ChatParams are parameters for Chat.
+type ChatParams struct {
+	Log      logger.Logger
+	Clock    clock.Clock
+	Adapter  Adapter
+	RoomID   identifiers.RoomID
+	ClientID identifiers.ClientID
+	Config   ChatConfig
+}
+
+func NewChat(params ChatParams) *Chat {
+	return &Chat{
+		log:         params.Log.WithNamespaceAppended("chat"),
+		clock:       params.Clock,
+		adapter:     params.Adapter,
+		roomID:      params.RoomID,
+		clientID:    params.ClientID,
+		config:      params.Config,
+		mu:          sync.Mutex{},
+		windowStart: time.Time{},
+		windowCount: 0,
+	}
+}
+
+// SendHistory sends the chat history of the room to the client. Nothing is
+// sent when the history is disabled or empty.
+func (c *Chat) SendHistory() error {
+	if c.config.HistorySize == 0 {
+		return nil
+	}
+
+	history, err := c.adapter.ChatHistory()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// The stored messages are only removed when a new message is added, so
+	// they might be older than the max age.
+	if maxAge := c.config.HistoryMaxAge; maxAge > 0 {
+		minTimestamp := c.clock.Now().Add(-maxAge).UnixMilli()
+
+		for len(history) > 0 && history[0].Timestamp < minTimestamp {
+			history = history[1:]
+		}
+	}
+
+	if len(history) == 0 {
+		return nil
+	}
+
+	err = c.adapter.Emit(c.clientID, message.NewChatHistory(c.roomID, message.ChatHistory{
+		Messages: history,
+	}))
+
+	return errors.Annotate(err, "emit chat history")
+}
+
+// HandleChat broadcasts the chat message to the room and adds it to the
+// history.
+func (c *Chat) HandleChat(chat message.Chat) error {
+	if chat.Message == "" {
+		return errors.Annotate(ErrInvalidMessage, "empty chat message")
+	}
+
+	if maxSize := c.config.MaxMessageSize; maxSize > 0 && len(chat.Message) > maxSize {
+		return errors.Annotatef(ErrChatMessageTooLarge, "size %d: limit %d", len(chat.Message), maxSize)
+	}
+
+	now := c.clock.Now()
+
+	if err := c.checkRate(now); err != nil {
+		return errors.Trace(err)
+	}
+
+	nickname, _ := c.adapter.Metadata(c.clientID)
+
+	chat = message.Chat{
+		ClientID:  c.clientID,
+		Nickname:  nickname,
+		Message:   chat.Message,
+		Timestamp: now.UnixMilli(),
+	}
+
+	prometheusChatMessagesTotal.Inc()
+
+	if c.config.HistorySize > 0 {
+		// The message is still sent to the room when it could not be stored.
+		if err := c.adapter.AddChat(chat, c.config.HistorySize, c.config.HistoryMaxAge); err != nil {
+			c.log.Warn("Add chat to history", logger.Ctx{
+				"err": err,
+			})
+		}
+	}
+
+	err := c.adapter.Broadcast(message.NewChat(c.roomID, chat))
+
+	return errors.Annotate(err, "broadcast chat")
+}
+
+// checkRate counts the message in the rate limit window that contains now.
+func (c *Chat) checkRate(now time.Time) error {
+	limit := c.config.RateLimit
+	if limit == 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.windowStart) >= c.config.RateInterval {
+		c.windowStart = now
+		c.windowCount = 0
+	}
+
+	if c.windowCount >= limit {
+		return errors.Annotatef(ErrChatRateLimited, "limit %d per %s", limit, c.config.RateInterval)
+	}
+
+	c.windowCount++
+
+	return nil
+}
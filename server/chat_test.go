@@ -0,0 +1,95 @@
+package server_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/message"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"nhooyr.io/websocket"
+)
+
+func TestChat(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	newAdapter := server.NewAdapterFactory(test.NewLogger(), server.StoreConfig{})
+	defer newAdapter.Close()
+
+	srv, url := setupMeshServerWithParams(server.WSSParams{
+		Rooms: server.NewAdapterRoomManager(newAdapter.NewAdapter),
+		Chat: server.ChatConfig{
+			HistorySize:    2,
+			HistoryMaxAge:  0,
+			MaxMessageSize: 5,
+			RateLimit:      3,
+			RateInterval:   time.Minute,
+		},
+	})
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ws1 := mustDialWS(t, ctx, url)
+	defer ws1.Close(websocket.StatusNormalClosure, "")
+
+	mustWriteWS(t, ctx, ws1, message.NewReady(roomName, message.Ready{
+		Nickname: "one",
+	}))
+	mustReadWSType(t, ctx, ws1, message.TypeUsers)
+
+	sendChat := func(requestID string, msg string) {
+		t.Helper()
+
+		chat := message.NewChat(roomName, message.Chat{
+			ClientID:  "",
+			Nickname:  "",
+			Message:   msg,
+			Timestamp: 0,
+		})
+		chat.RequestID = requestID
+
+		mustWriteWS(t, ctx, ws1, chat)
+	}
+
+	readError := func() message.ErrorCode {
+		t.Helper()
+
+		return mustReadWSType(t, ctx, ws1, message.TypeError).Payload.Error.Code
+	}
+
+	sendChat("1", "too large")
+	assert.Equal(t, message.ErrorCodeInvalidMessage, readError())
+
+	for _, msg := range []string{"a", "b", "c"} {
+		sendChat("", msg)
+
+		chat := mustReadWSType(t, ctx, ws1, message.TypeChat).Payload.Chat
+		assert.Equal(t, clientID, chat.ClientID)
+		assert.Equal(t, "one", chat.Nickname)
+		assert.Equal(t, msg, chat.Message)
+		assert.NotZero(t, chat.Timestamp)
+	}
+
+	sendChat("2", "d")
+	assert.Equal(t, message.ErrorCodeQuotaExceeded, readError())
+
+	// The late joiner receives the last messages.
+	ws2 := mustDialWS(t, ctx, strings.TrimSuffix(url, clientID.String())+clientID2.String())
+	defer ws2.Close(websocket.StatusNormalClosure, "")
+
+	history := mustReadWSType(t, ctx, ws2, message.TypeChatHistory).Payload.ChatHistory
+
+	var messages []string
+
+	for _, chat := range history.Messages {
+		messages = append(messages, chat.Message)
+	}
+
+	assert.Equal(t, []string{"b", "c"}, messages)
+}
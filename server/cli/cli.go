@@ -9,10 +9,16 @@ import (
 )
 
 type Props struct {
-	Log     logger.Logger
-	Version string
-	Args    []string
-	Embed   server.Embed
+	Log logger.Logger
+	// LogConfig is the config used by Log. It is replaced when the server
+	// config is loaded or reloaded.
+	LogConfig *logger.AtomicConfig
+	// LogFormatter is the formatter used by Log. It is replaced when the
+	// server config is loaded or reloaded.
+	LogFormatter *logger.AtomicFormatter
+	Version      string
+	Args         []string
+	Embed        server.Embed
 }
 
 func Exec(ctx context.Context, props Props) error {
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/command"
+	"github.com/spf13/pflag"
+)
+
+type logHandler struct {
+	args struct {
+		url         string
+		accessToken string
+		insecure    bool
+		ttl         time.Duration
+		reset       bool
+	}
+
+	props Props
+}
+
+func (h *logHandler) RegisterFlags(c *command.Command, flags *pflag.FlagSet) {
+	flags.StringVarP(&h.args.url, "url", "u", "http://localhost:3000", "server URL, including the base URL")
+	flags.StringVarP(&h.args.accessToken, "access-token", "t", os.Getenv("PEERCALLS_ADMIN_ACCESS_TOKEN"), "admin access token")
+	flags.BoolVarP(&h.args.insecure, "insecure", "k", false, "do not validate TLS certificates")
+	flags.DurationVar(&h.args.ttl, "ttl", 0, "duration after which the levels from the config are restored (server default when 0)")
+	flags.BoolVar(&h.args.reset, "reset", false, "restore the levels from the config")
+}
+
+// Handle prints the active log levels. When a config argument is provided,
+// the levels are overridden first.
+func (h *logHandler) Handle(ctx context.Context, args []string) error {
+	var (
+		method = http.MethodGet
+		body   io.Reader
+	)
+
+	switch {
+	case h.args.reset:
+		method = http.MethodDelete
+	case len(args) > 0:
+		var ttl string
+		if h.args.ttl > 0 {
+			ttl = h.args.ttl.String()
+		}
+
+		b, err := json.Marshal(server.LogLevelsRequest{
+			Config: strings.Join(args, ","),
+			TTL:    ttl,
+		})
+		if err != nil {
+			return errors.Annotate(err, "marshal request")
+		}
+
+		method = http.MethodPut
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(h.args.url, "/")+"/admin/log", body)
+	if err != nil {
+		return errors.Annotate(err, "create request")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+h.args.accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+
+	if h.args.insecure {
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, // nolint:gosec
+			},
+		}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Annotate(err, "request")
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(res.Body)
+
+		return errors.Errorf("unexpected status: %s: %s", res.Status, strings.TrimSpace(string(b)))
+	}
+
+	var state server.LogLevelsState
+
+	if err := json.NewDecoder(res.Body).Decode(&state); err != nil {
+		return errors.Annotate(err, "decode response")
+	}
+
+	fmt.Println("config:", state.Config)
+	fmt.Println("default:", state.Default)
+
+	if state.ExpiresAt != nil {
+		fmt.Println("expires at:", state.ExpiresAt.Local().Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+func newLogCmd(props Props) *command.Command {
+	h := &logHandler{
+		props: props,
+	}
+
+	return command.New(command.Params{
+		Name:         "log",
+		Desc:         "Shows or temporarily overrides the log levels of a running server",
+		FlagRegistry: h,
+		Handler:      h,
+	})
+}
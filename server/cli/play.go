@@ -304,7 +304,7 @@ func (h *playHandler) handleMessages(ctx context.Context, wsClient *server.Clien
 							continue
 						}
 
-						signaller, err := server.NewSignaller(h.log, initiator, pc)
+						signaller, err := server.NewSignaller(ctx, h.log, initiator, false, pc)
 						if err != nil {
 							pc.Close()
 							h.log.Error("Create signaller connection", errors.Trace(err), nil)
@@ -628,6 +628,7 @@ func (h *playHandler) Handle(ctx context.Context, args []string) error {
 	}
 
 	ws, _, err := websocket.Dial(ctx, h.wsURL, &websocket.DialOptions{
+		Subprotocols: server.Subprotocols,
 		HTTPClient: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{
@@ -640,7 +641,7 @@ func (h *playHandler) Handle(ctx context.Context, args []string) error {
 		return errors.Annotatef(err, "dial WS: %s", h.wsURL)
 	}
 
-	wsClient := server.NewClientWithID(ws, h.clientID)
+	wsClient := server.NewClientWithWireFormat(ws, h.clientID, server.NewWireFormat(ws.Subprotocol()))
 
 	h.wg.Add(1)
 
@@ -33,6 +33,7 @@ func NewRootCommand(props Props) *command.Command {
 		SubCommands: []*command.Command{
 			newServerCmd(props),
 			newPlayCmd(props),
+			newLogCmd(props),
 			newVersionCmd(props),
 		},
 	})
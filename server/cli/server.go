@@ -5,14 +5,19 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
 	"path"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
 	"github.com/peer-calls/peer-calls/v4/server/command"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/sfu"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/pflag"
 )
 
@@ -27,8 +32,17 @@ type serverHandler struct {
 	props  Props
 	server *server.Server
 	mux    *server.Mux
+	drain  *server.Drain
+	nodes  *server.NodeManager
+
+	reloader *server.ConfigReloader
+	tracing  *server.Tracing
 }
 
+// tracingShutdownTimeout is the time given to the exporter to send the
+// remaining spans after the server stops.
+const tracingShutdownTimeout = 5 * time.Second
+
 func (h *serverHandler) RegisterFlags(c *command.Command, flags *pflag.FlagSet) {
 	flags.StringVarP(&h.args.config, "config", "c", "", "config file to use")
 	flags.StringVar(&h.args.pprofAddr, "pprof-addr", "", "when set, will enable pprof server (example: 127.0.0.1:6060)")
@@ -39,6 +53,8 @@ func (h *serverHandler) Handle(ctx context.Context, args []string) error {
 		return errors.Trace(err)
 	}
 
+	defer h.shutdownTracing()
+
 	if pprofAddr := h.args.pprofAddr; pprofAddr != "" {
 		pprofListener, err := net.Listen("tcp", h.args.pprofAddr)
 		if err != nil {
@@ -52,6 +68,19 @@ func (h *serverHandler) Handle(ctx context.Context, args []string) error {
 		go server.NewPProf().Start(ctx, pprofListener)
 	}
 
+	if h.config.TURN.Enabled {
+		turnServer, err := server.NewTURNServer(server.TURNServerParams{
+			Log:    h.log,
+			Clock:  clock.New(),
+			Config: h.config.TURN,
+		})
+		if err != nil {
+			return errors.Annotate(err, "new turn server")
+		}
+
+		defer turnServer.Close()
+	}
+
 	listener, err := net.Listen("tcp", net.JoinHostPort(
 		h.config.BindHost,
 		strconv.Itoa(h.config.BindPort),
@@ -72,11 +101,95 @@ func (h *serverHandler) Handle(ctx context.Context, args []string) error {
 		"local_addr": addr,
 	})
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The wait for the active calls is stopped by a second signal.
+	waitCtx, stopWaiting := context.WithCancel(ctx)
+	defer stopWaiting()
+
+	go h.handleSignals(ctx, stopWaiting)
+	go h.drain.Run(waitCtx, func() {
+		h.shutdown(cancel)
+	})
+	go h.handleReloadSignals(ctx)
+	go h.reloader.Watch(ctx)
+
 	err = h.server.Start(ctx, listener)
 
 	return errors.Trace(err)
 }
 
+// shutdownTracing exports the spans which have not been exported yet.
+func (h *serverHandler) shutdownTracing() {
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+
+	if err := h.tracing.Shutdown(ctx); err != nil {
+		h.log.Error("Shutdown tracing", errors.Trace(err), nil)
+	}
+}
+
+// handleReloadSignals reloads the config on SIGHUP.
+func (h *serverHandler) handleReloadSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-signals:
+			if err := h.reloader.Reload(); err != nil {
+				h.log.Error("Reload config after SIGHUP", errors.Trace(err), nil)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleSignals starts the drain on SIGTERM or SIGINT. A second signal stops
+// waiting for the active calls to end.
+func (h *serverHandler) handleSignals(ctx context.Context, stopWaiting context.CancelFunc) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	defer signal.Stop(signals)
+
+	for draining := false; ; draining = true {
+		select {
+		case sig := <-signals:
+			h.log.Info("Received signal", logger.Ctx{
+				"signal": sig,
+			})
+		case <-ctx.Done():
+			return
+		}
+
+		if draining {
+			stopWaiting()
+
+			return
+		}
+
+		h.drain.Start()
+	}
+}
+
+// shutdown lets the other nodes know this node is going away and cancels the
+// server context. It is called once a drain started by a signal or by the
+// admin endpoint has finished.
+func (h *serverHandler) shutdown(cancel context.CancelFunc) {
+	if h.nodes != nil {
+		if err := h.nodes.Close(); err != nil {
+			h.log.Error("Close node manager", errors.Trace(err), nil)
+		}
+	}
+
+	cancel()
+}
+
 func newServerCmd(props Props) *command.Command {
 	h := &serverHandler{
 		log:   props.Log,
@@ -106,8 +219,29 @@ func (h *serverHandler) configure() (err error) {
 
 	c := h.config
 
+	h.props.LogFormatter.Store(server.NewLogFormatter(c.LogFormat))
+
+	logLevels := server.NewLogLevels(server.LogLevelsParams{
+		Log:       log,
+		LogConfig: h.props.LogConfig,
+		Clock:     clock.New(),
+		Config:    c.Log,
+	})
+
 	log.Info(fmt.Sprintf("Using config: %+v", c), nil)
 
+	h.tracing, err = server.NewTracing(server.TracingParams{
+		Log:     log,
+		Config:  c.Tracing,
+		Version: h.props.Version,
+		Stdout:  os.Stdout,
+	})
+	if err != nil {
+		return errors.Annotate(err, "new tracing")
+	}
+
+	h.tracing.SetGlobal()
+
 	if c.FS != "" {
 		h.props.Embed = server.Embed{
 			Templates: os.DirFS(path.Join(c.FS, "server", "templates")),
@@ -116,18 +250,85 @@ func (h *serverHandler) configure() (err error) {
 		}
 	}
 
-	tracks := sfu.NewTracksManager(log, c.Network.SFU.JitterBuffer)
+	health := server.NewHealth(log, c.Health)
+
+	adapterFactory := server.NewAdapterFactory(log, c.Store)
+	adapterFactory.RegisterHealthChecks(health)
+
+	q := adapterFactory.NewQuota()
+
+	tracks := sfu.NewTracksManager(log, c.Network.SFU.JitterBuffer, sfu.Limits{
+		MaxPublishers:      c.Limits.MaxPublishersPerRoom,
+		MaxTracksPerClient: c.Limits.MaxTracksPerClient,
+	}, q)
+
+	if c.Quality.TopK > 0 {
+		qualityCollector := sfu.NewQualityCollector(sfu.QualityCollectorParams{
+			Stats:     tracks.Stats,
+			TopK:      c.Quality.TopK,
+			RoomLabel: c.Quality.RoomLabel,
+		})
+
+		// Replace the collector of a server previously started in the same
+		// process, like in tests.
+		prometheus.Unregister(qualityCollector)
+
+		if err := prometheus.Register(qualityCollector); err != nil {
+			log.Error("Register quality collector", errors.Trace(err), nil)
+		}
+	}
 
 	roomManagerFactory := server.NewRoomManagerFactory(server.RoomManagerFactoryParams{
-		AdapterFactory: server.NewAdapterFactory(log, c.Store),
+		AdapterFactory: adapterFactory,
 		Log:            log,
 		TracksManager:  tracks,
+		Health:         health,
+		MaxRooms:       c.Health.MaxRooms,
 	})
-	rooms, _ := roomManagerFactory.NewRoomManager(c.Network)
+	rooms, nodes := roomManagerFactory.NewRoomManager(c.Network)
 
-	encodedInsertableStreams := c.Frontend.EncodedInsertableStreams
+	h.nodes = nodes
+	h.drain = server.NewDrain(log, c.Drain)
+
+	health.Register(server.HealthCheck{
+		Name:  "drain",
+		Type:  server.HealthCheckTypeReadiness,
+		Check: h.drain.CheckHealth,
+	})
 
-	h.mux = server.NewMux(log, c.BaseURL, h.props.Version, c.Network, c.ICEServers, encodedInsertableStreams, rooms, tracks, c.Prometheus, h.props.Embed)
+	h.mux = server.NewMux(server.MuxParams{
+		Log:        log,
+		BaseURL:    c.BaseURL,
+		Version:    h.props.Version,
+		Network:    c.Network,
+		ICEServers: server.ICEServersWithTURN(c.ICEServers, c.TURN),
+		Frontend:   c.Frontend,
+		Rooms:      rooms,
+		NewAdapter: adapterFactory.NewAdapter,
+		Tracks:     tracks,
+		Prometheus: c.Prometheus,
+		Admin:      c.Admin,
+		Drain:      h.drain,
+		Heartbeat:  c.Heartbeat,
+		Limits:     c.Limits,
+		Webinar:    c.Webinar,
+		Chat:       c.Chat,
+		Quota:      q,
+		Health:     health,
+		LogLevels:  logLevels,
+		Embed:      h.props.Embed,
+	})
+
+	h.reloader = server.NewConfigReloader(server.ConfigReloaderParams{
+		Log:          log,
+		Files:        configFiles,
+		Config:       c,
+		Mux:          h.mux,
+		LogLevels:    logLevels,
+		LogFormatter: h.props.LogFormatter,
+		Clock:        clock.New(),
+		PollInterval: 0,
+	})
 
 	return nil
 }
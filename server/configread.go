@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/juju/errors"
 	"gopkg.in/yaml.v2"
@@ -36,7 +37,26 @@ func ReadConfigFiles(filenames []string, c *Config) (err error) {
 
 func InitConfig(c *Config) {
 	c.BindPort = 3000
+	c.Drain.Timeout = 30 * time.Second
+	c.Health.Timeout = defaultHealthCheckTimeout
+	c.Heartbeat.Interval = defaultHeartbeatInterval
+	c.Heartbeat.Timeout = defaultHeartbeatTimeout
+	c.Chat.HistorySize = defaultChatHistorySize
+	c.Chat.HistoryMaxAge = defaultChatHistoryMaxAge
+	c.Chat.MaxMessageSize = defaultChatMaxMessageSize
+	c.Chat.RateLimit = defaultChatRateLimit
+	c.Chat.RateInterval = defaultChatRateInterval
+	c.TURN.ListenAddr = defaultTURNListenAddr
+	c.TURN.Realm = defaultTURNRealm
+	c.TURN.Username = defaultTURNUsername
+	c.TURN.MaxAllocationsPerUser = defaultTURNMaxAllocationsPerUser
+	c.Tracing.SampleRatio = 1
+	c.Quality.TopK = defaultQualityTopK
+	c.LogFormat = LogFormatText
+	c.Frontend.Signaling = SignalingTransportAuto
 	c.Network.Type = NetworkTypeMesh
+	c.Network.Hybrid.SFUThreshold = defaultHybridSFUThreshold
+	c.Network.Hybrid.MeshThreshold = defaultHybridMeshThreshold
 	c.Store.Type = StoreTypeMemory
 	c.ICEServers = []ICEServer{{
 		URLs: []string{"stun:stun.l.google.com:19302"},
@@ -77,13 +97,29 @@ func ReadConfigFromEnv(prefix string, c *Config) {
 	setEnvString(&c.Store.Redis.Prefix, prefix+"STORE_REDIS_PREFIX")
 
 	setEnvNetworkType(&c.Network.Type, prefix+"NETWORK_TYPE")
+	setEnvInt(&c.Network.Hybrid.SFUThreshold, prefix+"NETWORK_HYBRID_SFU_THRESHOLD")
+	setEnvInt(&c.Network.Hybrid.MeshThreshold, prefix+"NETWORK_HYBRID_MESH_THRESHOLD")
 	setEnvString(&c.Network.SFU.TCPBindAddr, prefix+"NETWORK_SFU_TCP_BIND_ADDR")
 	setEnvInt(&c.Network.SFU.TCPListenPort, prefix+"NETWORK_SFU_TCP_LISTEN_PORT")
 	setEnvStringArray(&c.Network.SFU.Protocols, prefix+"NETWORK_SFU_PROTOCOLS")
 	setEnvStringArray(&c.Network.SFU.Interfaces, prefix+"NETWORK_SFU_INTERFACES")
 	setEnvBool(&c.Network.SFU.JitterBuffer, prefix+"NETWORK_SFU_JITTER_BUFFER")
+	setEnvTransportType(&c.Network.SFU.Transport.Type, prefix+"NETWORK_SFU_TRANSPORT_TYPE")
 	setEnvStringArray(&c.Network.SFU.Transport.Nodes, prefix+"NETWORK_SFU_TRANSPORT_NODES")
 	setEnvString(&c.Network.SFU.Transport.ListenAddr, prefix+"NETWORK_SFU_TRANSPORT_LISTEN_ADDR")
+	setEnvString(&c.Network.SFU.Transport.AdvertiseAddr, prefix+"NETWORK_SFU_TRANSPORT_ADVERTISE_ADDR")
+	setEnvDiscoveryType(&c.Network.SFU.Transport.Discovery.Type, prefix+"NETWORK_SFU_TRANSPORT_DISCOVERY_TYPE")
+	setEnvDuration(&c.Network.SFU.Transport.Discovery.Interval, prefix+"NETWORK_SFU_TRANSPORT_DISCOVERY_INTERVAL")
+	setEnvString(&c.Network.SFU.Transport.Discovery.DNS.Name, prefix+"NETWORK_SFU_TRANSPORT_DISCOVERY_DNS_NAME")
+	setEnvInt(&c.Network.SFU.Transport.Discovery.DNS.Port, prefix+"NETWORK_SFU_TRANSPORT_DISCOVERY_DNS_PORT")
+	setEnvBool(&c.Network.SFU.Transport.Discovery.DNS.SRV, prefix+"NETWORK_SFU_TRANSPORT_DISCOVERY_DNS_SRV")
+	setEnvString(&c.Network.SFU.Transport.Discovery.File, prefix+"NETWORK_SFU_TRANSPORT_DISCOVERY_FILE")
+	setEnvBool(&c.Network.SFU.Transport.DTLS.Enabled, prefix+"NETWORK_SFU_TRANSPORT_DTLS_ENABLED")
+	setEnvString(&c.Network.SFU.Transport.DTLS.Identity, prefix+"NETWORK_SFU_TRANSPORT_DTLS_IDENTITY")
+	setEnvStringMap(&c.Network.SFU.Transport.DTLS.PSK, prefix+"NETWORK_SFU_TRANSPORT_DTLS_PSK")
+	setEnvString(&c.Network.SFU.Transport.DTLS.Cert, prefix+"NETWORK_SFU_TRANSPORT_DTLS_CERT")
+	setEnvString(&c.Network.SFU.Transport.DTLS.Key, prefix+"NETWORK_SFU_TRANSPORT_DTLS_KEY")
+	setEnvString(&c.Network.SFU.Transport.DTLS.CA, prefix+"NETWORK_SFU_TRANSPORT_DTLS_CA")
 	setEnvUint16(&c.Network.SFU.UDP.PortMin, prefix+"NETWORK_SFU_UDP_PORT_MIN")
 	setEnvUint16(&c.Network.SFU.UDP.PortMax, prefix+"NETWORK_SFU_UDP_PORT_MAX")
 
@@ -104,8 +140,44 @@ func ReadConfigFromEnv(prefix string, c *Config) {
 	}
 
 	setEnvString(&c.Prometheus.AccessToken, prefix+"PROMETHEUS_ACCESS_TOKEN")
+	setEnvString(&c.Admin.AccessToken, prefix+"ADMIN_ACCESS_TOKEN")
+	setEnvDuration(&c.Drain.Timeout, prefix+"DRAIN_TIMEOUT")
+	setEnvString(&c.Drain.AlternateURL, prefix+"DRAIN_ALTERNATE_URL")
+	setEnvDuration(&c.Health.Timeout, prefix+"HEALTH_TIMEOUT")
+	setEnvInt(&c.Health.MaxGoroutines, prefix+"HEALTH_MAX_GOROUTINES")
+	setEnvInt(&c.Health.MaxRooms, prefix+"HEALTH_MAX_ROOMS")
+	setEnvDuration(&c.Heartbeat.Interval, prefix+"HEARTBEAT_INTERVAL")
+	setEnvDuration(&c.Heartbeat.Timeout, prefix+"HEARTBEAT_TIMEOUT")
+	setEnvInt(&c.Limits.MaxRooms, prefix+"LIMITS_MAX_ROOMS")
+	setEnvInt(&c.Limits.MaxClientsPerRoom, prefix+"LIMITS_MAX_CLIENTS_PER_ROOM")
+	setEnvInt(&c.Limits.MaxPublishersPerRoom, prefix+"LIMITS_MAX_PUBLISHERS_PER_ROOM")
+	setEnvInt(&c.Limits.MaxTracksPerClient, prefix+"LIMITS_MAX_TRACKS_PER_CLIENT")
+	setEnvInt(&c.Chat.HistorySize, prefix+"CHAT_HISTORY_SIZE")
+	setEnvDuration(&c.Chat.HistoryMaxAge, prefix+"CHAT_HISTORY_MAX_AGE")
+	setEnvInt(&c.Chat.MaxMessageSize, prefix+"CHAT_MAX_MESSAGE_SIZE")
+	setEnvInt(&c.Chat.RateLimit, prefix+"CHAT_RATE_LIMIT")
+	setEnvDuration(&c.Chat.RateInterval, prefix+"CHAT_RATE_INTERVAL")
+
+	setEnvBool(&c.TURN.Enabled, prefix+"TURN_ENABLED")
+	setEnvString(&c.TURN.ListenAddr, prefix+"TURN_LISTEN_ADDR")
+	setEnvString(&c.TURN.PublicIP, prefix+"TURN_PUBLIC_IP")
+	setEnvStringArray(&c.TURN.URLs, prefix+"TURN_URLS")
+	setEnvString(&c.TURN.Realm, prefix+"TURN_REALM")
+	setEnvString(&c.TURN.Username, prefix+"TURN_USERNAME")
+	setEnvString(&c.TURN.Secret, prefix+"TURN_SECRET")
+	setEnvUint16(&c.TURN.RelayPortMin, prefix+"TURN_RELAY_PORT_MIN")
+	setEnvUint16(&c.TURN.RelayPortMax, prefix+"TURN_RELAY_PORT_MAX")
+	setEnvInt(&c.TURN.MaxAllocationsPerUser, prefix+"TURN_MAX_ALLOCATIONS_PER_USER")
+	setEnvTracingExporter(&c.Tracing.Exporter, prefix+"TRACING_EXPORTER")
+	setEnvString(&c.Tracing.Endpoint, prefix+"TRACING_ENDPOINT")
+	setEnvFloat64(&c.Tracing.SampleRatio, prefix+"TRACING_SAMPLE_RATIO")
+	setEnvInt(&c.Quality.TopK, prefix+"QUALITY_TOP_K")
+	setEnvBool(&c.Quality.RoomLabel, prefix+"QUALITY_ROOM_LABEL")
+	setEnvString(&c.Log, prefix+"LOG")
+	setEnvLogFormat(&c.LogFormat, prefix+"LOG_FORMAT")
 
 	setEnvBool(&c.Frontend.EncodedInsertableStreams, prefix+"FRONTEND_ENCODED_INSERTABLE_STREAMS")
+	setEnvSignalingTransport(&c.Frontend.Signaling, prefix+"FRONTEND_SIGNALING")
 }
 
 func setEnvSlice(dest *[]string, name string) {
@@ -121,6 +193,24 @@ func setSlice(dest *[]string, value string) {
 	}
 }
 
+// setEnvStringMap reads comma-separated key:value pairs.
+func setEnvStringMap(dest *map[string]string, name string) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+
+	m := map[string]string{}
+
+	for _, pair := range strings.Split(value, ",") {
+		if k, v, ok := strings.Cut(pair, ":"); ok {
+			m[k] = v
+		}
+	}
+
+	*dest = m
+}
+
 func setEnvString(dest *string, name string) {
 	value := os.Getenv(name)
 	if value != "" {
@@ -142,6 +232,20 @@ func setEnvUint16(dest *uint16, name string) {
 	}
 }
 
+func setEnvDuration(dest *time.Duration, name string) {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err == nil {
+		*dest = value
+	}
+}
+
+func setEnvFloat64(dest *float64, name string) {
+	value, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err == nil {
+		*dest = value
+	}
+}
+
 func setEnvBool(dest *bool, name string) {
 	val := os.Getenv(name)
 
@@ -166,6 +270,38 @@ func setEnvAuthType(authType *AuthType, name string) {
 	}
 }
 
+func setEnvLogFormat(logFormat *LogFormat, name string) {
+	value := os.Getenv(name)
+	switch LogFormat(value) {
+	case LogFormatText:
+		*logFormat = LogFormatText
+	case LogFormatJSON:
+		*logFormat = LogFormatJSON
+	}
+}
+
+func setEnvSignalingTransport(transport *SignalingTransport, name string) {
+	value := os.Getenv(name)
+	switch SignalingTransport(value) {
+	case SignalingTransportAuto:
+		*transport = SignalingTransportAuto
+	case SignalingTransportWebSocket:
+		*transport = SignalingTransportWebSocket
+	case SignalingTransportSSE:
+		*transport = SignalingTransportSSE
+	}
+}
+
+func setEnvTracingExporter(exporter *TracingExporter, name string) {
+	value := os.Getenv(name)
+	switch TracingExporter(value) {
+	case TracingExporterOTLP:
+		*exporter = TracingExporterOTLP
+	case TracingExporterStdout:
+		*exporter = TracingExporterStdout
+	}
+}
+
 func setEnvNetworkType(networkType *NetworkType, name string) {
 	value := os.Getenv(name)
 	switch NetworkType(value) {
@@ -173,6 +309,32 @@ func setEnvNetworkType(networkType *NetworkType, name string) {
 		*networkType = NetworkTypeMesh
 	case NetworkTypeSFU:
 		*networkType = NetworkTypeSFU
+	case NetworkTypeHybrid:
+		*networkType = NetworkTypeHybrid
+	}
+}
+
+func setEnvDiscoveryType(discoveryType *DiscoveryType, name string) {
+	value := os.Getenv(name)
+	switch DiscoveryType(value) {
+	case DiscoveryTypeStatic:
+		*discoveryType = DiscoveryTypeStatic
+	case DiscoveryTypeDNS:
+		*discoveryType = DiscoveryTypeDNS
+	case DiscoveryTypeRedis:
+		*discoveryType = DiscoveryTypeRedis
+	case DiscoveryTypeFile:
+		*discoveryType = DiscoveryTypeFile
+	}
+}
+
+func setEnvTransportType(transportType *TransportType, name string) {
+	value := os.Getenv(name)
+	switch TransportType(value) {
+	case TransportTypeUDP:
+		*transportType = TransportTypeUDP
+	case TransportTypeQUIC:
+		*transportType = TransportTypeQUIC
 	}
 }
 
@@ -4,8 +4,10 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 	"github.com/peer-calls/peer-calls/v4/server/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -60,6 +62,32 @@ func TestReadYAML_error(t *testing.T) {
 	assert.Regexp(t, "decode yaml", err.Error())
 }
 
+func TestReadYAML_webinar(t *testing.T) {
+	yaml := `
+webinar:
+  rooms:
+    all-hands:
+      presenters:
+        ceo: ceo-secret
+        cto: cto-secret
+      presenter_access_token: secret
+`
+	var c server.Config
+	err := server.ReadConfigYAML(strings.NewReader(yaml), &c)
+	require.NoError(t, err)
+	assert.Equal(t, server.WebinarConfig{
+		Rooms: map[identifiers.RoomID]server.WebinarRoomConfig{
+			"all-hands": {
+				Presenters: map[identifiers.ClientID]string{
+					"ceo": "ceo-secret",
+					"cto": "cto-secret",
+				},
+				PresenterAccessToken: "secret",
+			},
+		},
+	}, c.Webinar)
+}
+
 func TestReadFromEnv(t *testing.T) {
 	prefix := "PEERCALLSTEST_"
 	defer test.UnsetEnvPrefix(prefix)
@@ -81,9 +109,60 @@ func TestReadFromEnv(t *testing.T) {
 	os.Setenv(prefix+"NETWORK_SFU_JITTER_BUFFER", "true")
 	os.Setenv(prefix+"NETWORK_SFU_UDP_PORT_MIN", "9000")
 	os.Setenv(prefix+"NETWORK_SFU_UDP_PORT_MAX", "9010")
+	os.Setenv(prefix+"NETWORK_HYBRID_SFU_THRESHOLD", "5")
+	os.Setenv(prefix+"NETWORK_HYBRID_MESH_THRESHOLD", "3")
 	os.Setenv(prefix+"PROMETHEUS_ACCESS_TOKEN", "at1234")
+	os.Setenv(prefix+"ADMIN_ACCESS_TOKEN", "admin1234")
+	os.Setenv(prefix+"DRAIN_TIMEOUT", "1m")
+	os.Setenv(prefix+"DRAIN_ALTERNATE_URL", "https://node2.example.com")
+	os.Setenv(prefix+"HEALTH_TIMEOUT", "2s")
+	os.Setenv(prefix+"HEALTH_MAX_GOROUTINES", "10000")
+	os.Setenv(prefix+"HEALTH_MAX_ROOMS", "100")
+	os.Setenv(prefix+"HEARTBEAT_INTERVAL", "10s")
+	os.Setenv(prefix+"HEARTBEAT_TIMEOUT", "1m")
+	os.Setenv(prefix+"LIMITS_MAX_ROOMS", "50")
+	os.Setenv(prefix+"LIMITS_MAX_CLIENTS_PER_ROOM", "20")
+	os.Setenv(prefix+"LIMITS_MAX_PUBLISHERS_PER_ROOM", "5")
+	os.Setenv(prefix+"LIMITS_MAX_TRACKS_PER_CLIENT", "3")
+	os.Setenv(prefix+"CHAT_HISTORY_SIZE", "50")
+	os.Setenv(prefix+"CHAT_HISTORY_MAX_AGE", "24h")
+	os.Setenv(prefix+"CHAT_MAX_MESSAGE_SIZE", "1024")
+	os.Setenv(prefix+"CHAT_RATE_LIMIT", "5")
+	os.Setenv(prefix+"CHAT_RATE_INTERVAL", "1m")
+	os.Setenv(prefix+"TURN_ENABLED", "true")
+	os.Setenv(prefix+"TURN_LISTEN_ADDR", "0.0.0.0:3479")
+	os.Setenv(prefix+"TURN_PUBLIC_IP", "10.0.0.1")
+	os.Setenv(prefix+"TURN_URLS", "turn:turn.example.com")
+	os.Setenv(prefix+"TURN_REALM", "example.com")
+	os.Setenv(prefix+"TURN_USERNAME", "user")
+	os.Setenv(prefix+"TURN_SECRET", "turn-secret")
+	os.Setenv(prefix+"TURN_RELAY_PORT_MIN", "50000")
+	os.Setenv(prefix+"TURN_RELAY_PORT_MAX", "50100")
+	os.Setenv(prefix+"TURN_MAX_ALLOCATIONS_PER_USER", "4")
+	os.Setenv(prefix+"TRACING_EXPORTER", "otlp")
+	os.Setenv(prefix+"TRACING_ENDPOINT", "http://localhost:4318/v1/traces")
+	os.Setenv(prefix+"TRACING_SAMPLE_RATIO", "0.25")
+	os.Setenv(prefix+"QUALITY_TOP_K", "5")
+	os.Setenv(prefix+"QUALITY_ROOM_LABEL", "true")
+	os.Setenv(prefix+"LOG", "**:sdp:trace")
+	os.Setenv(prefix+"LOG_FORMAT", "json")
+	os.Setenv(prefix+"FRONTEND_SIGNALING", "sse")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_TYPE", "quic")
 	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_NODES", "127.0.0.1:3005,127.0.0.1:3006")
 	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_LISTEN_ADDR", "127.0.0.1:3004")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_ADVERTISE_ADDR", "10.0.0.1:3004")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_DISCOVERY_TYPE", "dns")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_DISCOVERY_INTERVAL", "5s")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_DISCOVERY_DNS_NAME", "_peercalls._udp.example.com")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_DISCOVERY_DNS_PORT", "3004")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_DISCOVERY_DNS_SRV", "true")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_DISCOVERY_FILE", "/etc/peercalls/nodes")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_DTLS_ENABLED", "true")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_DTLS_IDENTITY", "node1")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_DTLS_PSK", "node2:0a0b,node3:0c0d")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_DTLS_CERT", "node.pem")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_DTLS_KEY", "node.key")
+	os.Setenv(prefix+"NETWORK_SFU_TRANSPORT_DTLS_CA", "ca.pem")
 	var c server.Config
 	server.ReadConfigFromEnv(prefix, &c)
 	assert.Equal(t, "/test", c.BaseURL)
@@ -115,8 +194,73 @@ func TestReadFromEnv(t *testing.T) {
 	assert.Equal(t, uint16(9000), c.Network.SFU.UDP.PortMin)
 	assert.Equal(t, uint16(9010), c.Network.SFU.UDP.PortMax)
 	assert.Equal(t, "at1234", c.Prometheus.AccessToken)
+	assert.Equal(t, "admin1234", c.Admin.AccessToken)
+	assert.Equal(t, time.Minute, c.Drain.Timeout)
+	assert.Equal(t, "https://node2.example.com", c.Drain.AlternateURL)
+	assert.Equal(t, 2*time.Second, c.Health.Timeout)
+	assert.Equal(t, 10000, c.Health.MaxGoroutines)
+	assert.Equal(t, 100, c.Health.MaxRooms)
+	assert.Equal(t, server.NetworkConfigHybrid{
+		SFUThreshold:  5,
+		MeshThreshold: 3,
+	}, c.Network.Hybrid)
+	assert.Equal(t, server.HeartbeatConfig{
+		Interval: 10 * time.Second,
+		Timeout:  time.Minute,
+	}, c.Heartbeat)
+	assert.Equal(t, server.LimitsConfig{
+		MaxRooms:             50,
+		MaxClientsPerRoom:    20,
+		MaxPublishersPerRoom: 5,
+		MaxTracksPerClient:   3,
+	}, c.Limits)
+	assert.Equal(t, server.ChatConfig{
+		HistorySize:    50,
+		HistoryMaxAge:  24 * time.Hour,
+		MaxMessageSize: 1024,
+		RateLimit:      5,
+		RateInterval:   time.Minute,
+	}, c.Chat)
+	assert.Equal(t, server.TURNConfig{
+		Enabled:               true,
+		ListenAddr:            "0.0.0.0:3479",
+		PublicIP:              "10.0.0.1",
+		URLs:                  []string{"turn:turn.example.com"},
+		Realm:                 "example.com",
+		Username:              "user",
+		Secret:                "turn-secret",
+		RelayPortMin:          50000,
+		RelayPortMax:          50100,
+		MaxAllocationsPerUser: 4,
+	}, c.TURN)
+	assert.Equal(t, server.TracingConfig{
+		Exporter:    server.TracingExporterOTLP,
+		Endpoint:    "http://localhost:4318/v1/traces",
+		SampleRatio: 0.25,
+	}, c.Tracing)
+	assert.Equal(t, server.QualityConfig{
+		TopK:      5,
+		RoomLabel: true,
+	}, c.Quality)
+	assert.Equal(t, "**:sdp:trace", c.Log)
+	assert.Equal(t, server.LogFormatJSON, c.LogFormat)
+	assert.Equal(t, server.SignalingTransportSSE, c.Frontend.Signaling)
+	assert.Equal(t, server.TransportTypeQUIC, c.Network.SFU.Transport.Type)
 	assert.Equal(t, "127.0.0.1:3004", c.Network.SFU.Transport.ListenAddr)
 	assert.Equal(t, []string{"127.0.0.1:3005", "127.0.0.1:3006"}, c.Network.SFU.Transport.Nodes)
+	assert.Equal(t, "10.0.0.1:3004", c.Network.SFU.Transport.AdvertiseAddr)
+	assert.Equal(t, server.DiscoveryTypeDNS, c.Network.SFU.Transport.Discovery.Type)
+	assert.Equal(t, 5*time.Second, c.Network.SFU.Transport.Discovery.Interval)
+	assert.Equal(t, "_peercalls._udp.example.com", c.Network.SFU.Transport.Discovery.DNS.Name)
+	assert.Equal(t, 3004, c.Network.SFU.Transport.Discovery.DNS.Port)
+	assert.Equal(t, true, c.Network.SFU.Transport.Discovery.DNS.SRV)
+	assert.Equal(t, "/etc/peercalls/nodes", c.Network.SFU.Transport.Discovery.File)
+	assert.Equal(t, true, c.Network.SFU.Transport.DTLS.Enabled)
+	assert.Equal(t, "node1", c.Network.SFU.Transport.DTLS.Identity)
+	assert.Equal(t, map[string]string{"node2": "0a0b", "node3": "0c0d"}, c.Network.SFU.Transport.DTLS.PSK)
+	assert.Equal(t, "node.pem", c.Network.SFU.Transport.DTLS.Cert)
+	assert.Equal(t, "node.key", c.Network.SFU.Transport.DTLS.Key)
+	assert.Equal(t, "ca.pem", c.Network.SFU.Transport.DTLS.CA)
 
 	t.Run("disable default ICE servers", func(t *testing.T) {
 		prefix := "PEERCALLSTEST_"
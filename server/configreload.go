@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+)
+
+const defaultConfigPollInterval = 5 * time.Second
+
+// reloadableConfigFields contains the yaml names of the Config fields that
+// can be changed without a restart.
+// nolint:gochecknoglobals
+var reloadableConfigFields = map[string]struct{}{
+	"ice_servers": {},
+	"prometheus":  {},
+	"admin":       {},
+	"log":         {},
+	"log_format":  {},
+	"frontend":    {},
+}
+
+type ConfigReloaderParams struct {
+	Log logger.Logger
+	// Files are the config files to read, and to watch for changes.
+	Files []string
+	// Config is the currently applied config.
+	Config Config
+	// Mux receives the new ICE servers, access tokens and frontend flags.
+	Mux *Mux
+	// LogLevels receives the new log levels.
+	LogLevels *LogLevels
+	// LogFormatter receives the formatter for the new log format.
+	LogFormatter *logger.AtomicFormatter
+	// Clock is used for polling the files for changes.
+	Clock clock.Clock
+	// PollInterval is the interval at which files are checked for changes.
+	PollInterval time.Duration
+}
+
+// ConfigReloader re-reads the configuration and applies the changes that do
+// not require a restart.
+type ConfigReloader struct {
+	params *ConfigReloaderParams
+
+	mu sync.Mutex
+	// config is the last successfully read config.
+	config Config
+	// modTimes contains the modification times of the files when they were
+	// last read.
+	modTimes []time.Time
+}
+
+func NewConfigReloader(params ConfigReloaderParams) *ConfigReloader {
+	params.Log = params.Log.WithNamespaceAppended("config_reloader")
+
+	if params.PollInterval <= 0 {
+		params.PollInterval = defaultConfigPollInterval
+	}
+
+	r := &ConfigReloader{
+		params:   &params,
+		mu:       sync.Mutex{},
+		config:   params.Config,
+		modTimes: nil,
+	}
+
+	r.modTimes = r.readModTimes()
+
+	return r
+}
+
+// Reload reads the config and applies the changes. The current config is
+// kept when the config cannot be read.
+func (r *ConfigReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.reload()
+}
+
+func (r *ConfigReloader) reload() error {
+	r.modTimes = r.readModTimes()
+
+	config, err := ReadConfig(r.params.Files)
+	if err != nil {
+		prometheusConfigReloadsTotal.WithLabelValues("error").Inc()
+
+		return errors.Annotate(err, "reload config")
+	}
+
+	if fields := restartRequiredFields(r.config, config); len(fields) > 0 {
+		r.params.Log.Warn("Changed config fields require a restart", logger.Ctx{
+			"fields": strings.Join(fields, ","),
+		})
+	}
+
+	r.params.Mux.SetConfig(MuxConfig{
+		// The TURN server is only started with the initial config.
+		ICEServers:            ICEServersWithTURN(config.ICEServers, r.params.Config.TURN),
+		Frontend:              config.Frontend,
+		PrometheusAccessToken: config.Prometheus.AccessToken,
+		AdminAccessToken:      config.Admin.AccessToken,
+	})
+
+	r.params.LogLevels.SetConfig(config.Log)
+	r.params.LogFormatter.Store(NewLogFormatter(config.LogFormat))
+
+	r.config = config
+
+	prometheusConfigReloadsTotal.WithLabelValues("success").Inc()
+
+	r.params.Log.Info("Reloaded config", nil)
+
+	return nil
+}
+
+// Watch reloads the config every time one of the files is modified. It
+// returns when ctx is done.
+func (r *ConfigReloader) Watch(ctx context.Context) {
+	if len(r.params.Files) == 0 {
+		return
+	}
+
+	ticker := r.params.Clock.NewTicker(r.params.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if err := r.reloadIfModified(); err != nil {
+				r.params.Log.Error("Reload config after file change", errors.Trace(err), nil)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *ConfigReloader) reloadIfModified() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if reflect.DeepEqual(r.readModTimes(), r.modTimes) {
+		return nil
+	}
+
+	return r.reload()
+}
+
+// readModTimes returns the modification times of the files, or zero times
+// for the files that cannot be read.
+func (r *ConfigReloader) readModTimes() []time.Time {
+	modTimes := make([]time.Time, len(r.params.Files))
+
+	for i, filename := range r.params.Files {
+		if fi, err := os.Stat(filename); err == nil {
+			modTimes[i] = fi.ModTime()
+		}
+	}
+
+	return modTimes
+}
+
+// restartRequiredFields returns the yaml names of the top level fields that
+// changed, but cannot be applied without a restart.
+func restartRequiredFields(oldConfig, newConfig Config) []string {
+	var fields []string
+
+	oldValue := reflect.ValueOf(oldConfig)
+	newValue := reflect.ValueOf(newConfig)
+	typ := oldValue.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		name := strings.Split(typ.Field(i).Tag.Get("yaml"), ",")[0]
+
+		if _, ok := reloadableConfigFields[name]; ok {
+			continue
+		}
+
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			fields = append(fields, name)
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestartRequiredFields(t *testing.T) {
+	var oldConfig, newConfig Config
+
+	InitConfig(&oldConfig)
+	InitConfig(&newConfig)
+
+	assert.Empty(t, restartRequiredFields(oldConfig, newConfig))
+
+	newConfig.ICEServers = nil
+	newConfig.Prometheus.AccessToken = "prom"
+	newConfig.Log = "*"
+
+	assert.Empty(t, restartRequiredFields(oldConfig, newConfig))
+
+	newConfig.BindPort = 3001
+	newConfig.Network.Type = NetworkTypeSFU
+
+	assert.Equal(t, []string{"bind_port", "network"}, restartRequiredFields(oldConfig, newConfig))
+}
@@ -0,0 +1,129 @@
+package server_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, filename string, data string, modTime time.Time) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(filename, []byte(data), 0o600))
+	require.NoError(t, os.Chtimes(filename, modTime, modTime))
+}
+
+func TestConfigReloader(t *testing.T) {
+	defer test.UnsetEnvPrefix("PEERCALLS_")
+
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	modTime := time.Now().Add(-time.Hour)
+
+	writeConfigFile(t, filename, `
+bind_port: 3001
+prometheus:
+  access_token: prom1
+`, modTime)
+
+	config, err := server.ReadConfig([]string{filename})
+	require.NoError(t, err)
+
+	mrm := NewMockRoomManager()
+	defer mrm.close()
+
+	logConfig := logger.NewAtomicConfig(logger.LevelInfo)
+	mockClock := clock.NewMock()
+
+	logFormatter := logger.NewAtomicFormatter(server.NewLogFormatter(config.LogFormat))
+
+	logLevels := server.NewLogLevels(server.LogLevelsParams{
+		Log:       test.NewLogger(),
+		LogConfig: logConfig,
+		Clock:     mockClock,
+		Config:    config.Log,
+	})
+
+	params := newMuxParams(mrm, newMockTracksManager())
+	params.ICEServers = config.ICEServers
+	params.Prometheus = config.Prometheus
+	params.Admin = config.Admin
+	params.LogLevels = logLevels
+	mux := server.NewMux(params)
+
+	reloader := server.NewConfigReloader(server.ConfigReloaderParams{
+		Log:          test.NewLogger(),
+		Files:        []string{filename},
+		Config:       config,
+		Mux:          mux,
+		LogLevels:    logLevels,
+		LogFormatter: logFormatter,
+		Clock:        mockClock,
+		PollInterval: time.Second,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	watchDone := make(chan struct{})
+
+	go func() {
+		defer close(watchDone)
+
+		reloader.Watch(ctx)
+	}()
+
+	defer func() {
+		cancel()
+		<-watchDone
+	}()
+
+	writeConfigFile(t, filename, `
+bind_port: 3002
+ice_servers:
+- urls:
+  - stun:stun.example.com
+prometheus:
+  access_token: prom2
+admin:
+  access_token: admin2
+frontend:
+  encodedInsertableStreams: true
+log: "**:sdp:trace"
+log_format: json
+`, modTime.Add(time.Minute))
+
+	assert.Eventually(t, func() bool {
+		mockClock.Add(time.Second)
+
+		return mux.Config().PrometheusAccessToken == "prom2"
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, server.MuxConfig{
+		ICEServers: []server.ICEServer{{
+			URLs: []string{"stun:stun.example.com"},
+		}},
+		Frontend: server.Frontend{
+			EncodedInsertableStreams: true,
+			Signaling:                server.SignalingTransportAuto,
+		},
+		PrometheusAccessToken: "prom2",
+		AdminAccessToken:      "admin2",
+	}, mux.Config())
+
+	assert.Equal(t, logger.LevelTrace, logConfig.LevelForNamespace("main:sdp"))
+	assert.IsType(t, &logger.JSONFormatter{}, logFormatter.Load())
+
+	// The current config is kept when the file cannot be read.
+	writeConfigFile(t, filename, "invalid: [", modTime.Add(2*time.Minute))
+
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, "prom2", mux.Config().PrometheusAccessToken)
+}
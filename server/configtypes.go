@@ -1,5 +1,11 @@
 package server
 
+import (
+	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+)
+
 type AuthType string
 
 const (
@@ -39,16 +45,41 @@ type StoreConfig struct {
 	Redis RedisConfig `yaml:"redis"`
 }
 
+type LogFormat string
+
+const (
+	// LogFormatText writes human readable lines. It is the default.
+	LogFormatText LogFormat = "text"
+	// LogFormatJSON writes one JSON object per line.
+	LogFormatJSON LogFormat = "json"
+)
+
 type NetworkType string
 
 const (
 	NetworkTypeMesh NetworkType = "mesh"
 	NetworkTypeSFU  NetworkType = "sfu"
+	// NetworkTypeHybrid starts the rooms as mesh and switches them to the SFU
+	// when they grow.
+	NetworkTypeHybrid NetworkType = "hybrid"
 )
 
 type NetworkConfig struct {
-	Type NetworkType      `yaml:"type"`
-	SFU  NetworkConfigSFU `yaml:"sfu"`
+	Type   NetworkType         `yaml:"type"`
+	SFU    NetworkConfigSFU    `yaml:"sfu"`
+	Hybrid NetworkConfigHybrid `yaml:"hybrid"`
+}
+
+// NetworkConfigHybrid configures when the rooms of the hybrid network switch
+// between mesh and SFU.
+type NetworkConfigHybrid struct {
+	// SFUThreshold is the number of clients at which a mesh room switches to
+	// the SFU.
+	SFUThreshold int `yaml:"sfu_threshold"`
+	// MeshThreshold is the number of clients at which an SFU room falls back
+	// to mesh. It must be lower than SFUThreshold so that the rooms do not
+	// switch back and forth.
+	MeshThreshold int `yaml:"mesh_threshold"`
 }
 
 type NetworkConfigSFU struct {
@@ -65,15 +96,239 @@ type NetworkConfigSFU struct {
 	} `yaml:"udp"`
 }
 
+type TransportType string
+
+const (
+	// TransportTypeUDP multiplexes the media and an SCTP association over UDP.
+	TransportTypeUDP TransportType = "udp"
+	// TransportTypeQUIC sends the media as QUIC datagrams and everything else
+	// over QUIC streams.
+	TransportTypeQUIC TransportType = "quic"
+)
+
 type TransportConfig struct {
-	ListenAddr string `yaml:"listen_addr"`
-	Nodes      []string
+	// Type is the protocol used between nodes. TransportTypeUDP is used when
+	// empty.
+	Type       TransportType `yaml:"type"`
+	ListenAddr string        `yaml:"listen_addr"`
+	// AdvertiseAddr is the address other nodes use to reach this node. It is
+	// used for registration during discovery and defaults to ListenAddr.
+	AdvertiseAddr string `yaml:"advertise_addr"`
+	// Nodes is the list of nodes used by the static discovery.
+	Nodes     []string
+	Discovery DiscoveryConfig     `yaml:"discovery"`
+	DTLS      TransportDTLSConfig `yaml:"dtls"`
+}
+
+// TransportDTLSConfig configures DTLS for the connections between nodes.
+// With TransportTypeQUIC the certificates are used for TLS instead, and PSK
+// is not supported.
+type TransportDTLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Identity is the identity of this node sent to the remote nodes. It is
+	// required when PSK is set.
+	Identity string `yaml:"identity"`
+	// PSK contains the hex-encoded pre-shared keys indexed by the identities
+	// of remote nodes.
+	PSK map[string]string `yaml:"psk"`
+	// Cert and Key are the paths to the PEM-encoded certificate and key of
+	// this node. They are used when PSK is not set.
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	// CA is the path to the PEM-encoded certificate authority used for
+	// verifying the certificates of remote nodes.
+	CA string `yaml:"ca"`
+}
+
+type DiscoveryType string
+
+const (
+	DiscoveryTypeStatic DiscoveryType = "static"
+	DiscoveryTypeDNS    DiscoveryType = "dns"
+	DiscoveryTypeRedis  DiscoveryType = "redis"
+	DiscoveryTypeFile   DiscoveryType = "file"
+)
+
+type DiscoveryConfig struct {
+	// Type is the discovery type. Static discovery with TransportConfig.Nodes
+	// is used when empty.
+	Type DiscoveryType `yaml:"type"`
+	// Interval is the period between two lookups of nodes.
+	Interval time.Duration `yaml:"interval"`
+	DNS      struct {
+		Name string `yaml:"name"`
+		Port int    `yaml:"port"`
+		SRV  bool   `yaml:"srv"`
+	} `yaml:"dns"`
+	// File is the path to a file containing a single host:port per line.
+	File string `yaml:"file"`
 }
 
 type PrometheusConfig struct {
 	AccessToken string `yaml:"access_token"`
 }
 
+// AdminConfig configures the admin endpoints.
+type AdminConfig struct {
+	// AccessToken is required for accessing the admin endpoints. The endpoints
+	// are disabled when it is empty.
+	AccessToken string `yaml:"access_token"`
+}
+
+// DrainConfig configures the graceful shutdown.
+type DrainConfig struct {
+	// Timeout is the maximum duration to wait for the active calls to end
+	// after the drain has started.
+	Timeout time.Duration `yaml:"timeout"`
+	// AlternateURL is the origin of another node. It is sent to the clients
+	// so they can reconnect there.
+	AlternateURL string `yaml:"alternate_url"`
+}
+
+// LimitsConfig configures the capacity of the rooms. The limits are disabled
+// when zero.
+type LimitsConfig struct {
+	// MaxRooms is the maximum number of rooms on this node.
+	MaxRooms int `yaml:"max_rooms"`
+	// MaxClientsPerRoom is the maximum number of clients in a room. It is
+	// counted on all nodes when the store type is redis.
+	MaxClientsPerRoom int `yaml:"max_clients_per_room"`
+	// MaxPublishersPerRoom is the maximum number of clients publishing tracks
+	// in a room. It only applies to the SFU, and is counted on all nodes when
+	// the store type is redis.
+	MaxPublishersPerRoom int `yaml:"max_publishers_per_room"`
+	// MaxTracksPerClient is the maximum number of tracks published by a
+	// client. It only applies to the SFU.
+	MaxTracksPerClient int `yaml:"max_tracks_per_client"`
+}
+
+// WebinarConfig configures the webinar rooms, in which only the presenters
+// can publish tracks and the other clients join as viewers. It only applies
+// to the SFU.
+type WebinarConfig struct {
+	Rooms map[identifiers.RoomID]WebinarRoomConfig `yaml:"rooms"`
+}
+
+// WebinarRoomConfig configures who can present in a webinar room.
+type WebinarRoomConfig struct {
+	// Presenters contains the access tokens of the clients that join as
+	// presenters, by client ID. The clients choose their IDs, so an ID alone
+	// does not make a client a presenter.
+	Presenters map[identifiers.ClientID]string `yaml:"presenters"`
+	// PresenterAccessToken is the access token of the clients that join as
+	// presenters. It is disabled when empty.
+	PresenterAccessToken string `yaml:"presenter_access_token"`
+}
+
+// ChatConfig configures the chat messages relayed by the server.
+type ChatConfig struct {
+	// HistorySize is the number of messages kept for each room and sent to the
+	// clients when they connect. The history is disabled when zero.
+	HistorySize int `yaml:"history_size"`
+	// HistoryMaxAge is the maximum age of the messages in the history. The
+	// messages are kept until they are pushed out by newer ones when zero,
+	// but a history stored in Redis still expires after 30 days without new
+	// messages.
+	HistoryMaxAge time.Duration `yaml:"history_max_age"`
+	// MaxMessageSize is the maximum size of a message in bytes. Disabled when
+	// zero.
+	MaxMessageSize int `yaml:"max_message_size"`
+	// RateLimit is the maximum number of messages a client can send during
+	// RateInterval. Disabled when zero.
+	RateLimit int `yaml:"rate_limit"`
+	// RateInterval is the duration of the rate limit window.
+	RateInterval time.Duration `yaml:"rate_interval"`
+}
+
+// TURNConfig configures the embedded TURN server.
+type TURNConfig struct {
+	// Enabled starts the TURN server and adds it to the ICE servers sent to
+	// the clients.
+	Enabled bool `yaml:"enabled"`
+	// ListenAddr is the UDP address the TURN server listens on.
+	ListenAddr string `yaml:"listen_addr"`
+	// PublicIP is the address of the relayed candidates, it must be reachable
+	// by the clients.
+	PublicIP string `yaml:"public_ip"`
+	// URLs are advertised to the clients. The STUN and TURN URLs of PublicIP
+	// and the port of ListenAddr are used when empty.
+	URLs  []string `yaml:"urls"`
+	Realm string   `yaml:"realm"`
+	// Username is added to the generated usernames, like the username of the
+	// ICE servers with the secret auth type.
+	Username string `yaml:"username"`
+	// Secret is used to sign the time-limited credentials.
+	Secret string `yaml:"secret"`
+	// RelayPortMin and RelayPortMax limit the ports of the relayed
+	// candidates. Random ports are used when both are zero.
+	RelayPortMin uint16 `yaml:"relay_port_min"`
+	RelayPortMax uint16 `yaml:"relay_port_max"`
+	// MaxAllocationsPerUser is the maximum number of client addresses using
+	// the same credentials. The credentials are issued per client, so this
+	// limits the allocations of each client. Disabled when zero.
+	MaxAllocationsPerUser int `yaml:"max_allocations_per_user"`
+}
+
+// HeartbeatConfig configures the pings sent to the clients over the signaling
+// connection.
+type HeartbeatConfig struct {
+	// Interval is the duration between the pings.
+	Interval time.Duration `yaml:"interval"`
+	// Timeout is the maximum duration without a pong before the connection is
+	// closed. Dead connections hold their room slots until then. Disabled when
+	// zero.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// HealthConfig configures the health checks.
+type HealthConfig struct {
+	// Timeout is the maximum duration of a single health check.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxGoroutines fails the readiness probe when the number of goroutines
+	// exceeds it, which means they are leaking or the server is overloaded.
+	// Disabled when zero.
+	MaxGoroutines int `yaml:"max_goroutines"`
+	// MaxRooms fails the readiness probe when the number of active rooms
+	// reaches it. Disabled when zero.
+	MaxRooms int `yaml:"max_rooms"`
+}
+
+type TracingExporter string
+
+const (
+	// TracingExporterOTLP exports the spans using OTLP over HTTP.
+	TracingExporterOTLP TracingExporter = "otlp"
+	// TracingExporterStdout writes the spans to stdout. It is useful for
+	// development and tests.
+	TracingExporterStdout TracingExporter = "stdout"
+)
+
+// TracingConfig configures the OpenTelemetry tracing.
+type TracingConfig struct {
+	// Exporter enables tracing when set.
+	Exporter TracingExporter `yaml:"exporter"`
+	// Endpoint is the URL of the OTLP endpoint, for example
+	// http://localhost:4318/v1/traces. The standard OTEL_EXPORTER_OTLP_*
+	// environment variables are used when empty.
+	Endpoint string `yaml:"endpoint"`
+	// SampleRatio is the fraction of the traces that are sampled, unless the
+	// parent span decides otherwise.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// defaultQualityTopK is the default number of tracks and rooms exported as
+// quality metrics.
+const defaultQualityTopK = 10
+
+// QualityConfig configures the media quality metrics exported to Prometheus.
+type QualityConfig struct {
+	// TopK is the number of tracks and rooms with the lowest quality score
+	// that are exported. The metrics are disabled when zero.
+	TopK int `yaml:"top_k"`
+	// RoomLabel adds the room label to the metrics.
+	RoomLabel bool `yaml:"room_label"`
+}
+
 type Config struct {
 	BaseURL  string `yaml:"base_url"`
 	BindHost string `yaml:"bind_host"`
@@ -86,14 +341,45 @@ type Config struct {
 	Store      StoreConfig      `yaml:"store"`
 	Network    NetworkConfig    `yaml:"network"`
 	Prometheus PrometheusConfig `yaml:"prometheus"`
+	Admin      AdminConfig      `yaml:"admin"`
+	Drain      DrainConfig      `yaml:"drain"`
+	Health     HealthConfig     `yaml:"health"`
+	Heartbeat  HeartbeatConfig  `yaml:"heartbeat"`
+	Limits     LimitsConfig     `yaml:"limits"`
+	Webinar    WebinarConfig    `yaml:"webinar"`
+	Chat       ChatConfig       `yaml:"chat"`
+	TURN       TURNConfig       `yaml:"turn"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Quality    QualityConfig    `yaml:"quality"`
+
+	// Log configures the log levels for the namespaces, in the same format as
+	// the PEERCALLS_LOG environment variable. The defaults are used when empty.
+	Log string `yaml:"log"`
+	// LogFormat is the output format of the server logs.
+	LogFormat LogFormat `yaml:"log_format"`
 
 	Frontend Frontend `yaml:"frontend"`
 }
 
 type Frontend struct {
 	EncodedInsertableStreams bool `yaml:"encodedInsertableStreams"`
+	// Signaling is the transport used by the clients for signaling.
+	Signaling SignalingTransport `yaml:"signaling"`
 }
 
+type SignalingTransport string
+
+const (
+	// SignalingTransportAuto uses websockets, and falls back to server-sent
+	// events when the websocket cannot connect. It is the default.
+	SignalingTransportAuto SignalingTransport = "auto"
+	// SignalingTransportWebSocket only uses websockets.
+	SignalingTransportWebSocket SignalingTransport = "websocket"
+	// SignalingTransportSSE only uses server-sent events to receive the
+	// messages and HTTP requests to send them.
+	SignalingTransportSSE SignalingTransport = "sse"
+)
+
 type ICEAuthServer struct {
 	URLs       []string `json:"urls"`
 	Username   string   `json:"username,omitempty"`
@@ -107,6 +393,8 @@ type ClientConfig struct {
 	PeerID     string      `json:"peerId"`
 	PeerConfig PeerConfig  `json:"peerConfig"`
 	Network    NetworkType `json:"network"`
+	// Signaling is the transport the client should use for signaling.
+	Signaling SignalingTransport `json:"signaling"`
 }
 
 type PeerConfig struct {
@@ -0,0 +1,165 @@
+// Package discovery provides a list of remote Peer Calls nodes that should
+// exchange media and data with the local node.
+package discovery
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+)
+
+// Discovery provides the current list of remote nodes.
+type Discovery interface {
+	// Nodes returns a channel that receives the complete list of nodes every
+	// time the list changes. The channel is closed after Close is called.
+	Nodes() <-chan []*net.UDPAddr
+	// Close stops the discovery.
+	Close() error
+}
+
+// LookupFunc returns the current list of nodes.
+type LookupFunc func() ([]*net.UDPAddr, error)
+
+// PollerParams are the parameters for NewPoller.
+type PollerParams struct {
+	Log   logger.Logger
+	Clock clock.Clock
+	// Interval is the period between two lookups.
+	Interval time.Duration
+	// Lookup is called once after the poller is created and once every
+	// Interval after that.
+	Lookup LookupFunc
+	// OnClose will be called when the poller is closed, if set.
+	OnClose func() error
+}
+
+// Poller is a Discovery that periodically calls a LookupFunc and emits the
+// list of nodes when it changes. When a lookup fails the previous list is
+// retained so that transient errors do not disconnect any nodes.
+type Poller struct {
+	params  *PollerParams
+	nodesCh chan []*net.UDPAddr
+
+	teardown chan struct{}
+	torndown chan struct{}
+}
+
+var _ Discovery = &Poller{}
+
+// NewPoller creates a new instance of Poller and starts polling.
+func NewPoller(params PollerParams) *Poller {
+	params.Log = params.Log.WithNamespaceAppended("discovery")
+
+	p := &Poller{
+		params:  &params,
+		nodesCh: make(chan []*net.UDPAddr),
+
+		teardown: make(chan struct{}),
+		torndown: make(chan struct{}),
+	}
+
+	go p.start()
+
+	return p
+}
+
+func (p *Poller) start() {
+	ticker := p.params.Clock.NewTicker(p.params.Interval)
+
+	defer func() {
+		ticker.Stop()
+
+		close(p.nodesCh)
+		close(p.torndown)
+	}()
+
+	var (
+		current     []*net.UDPAddr
+		initialized bool
+	)
+
+	lookup := func() bool {
+		nodes, err := p.params.Lookup()
+		if err != nil {
+			p.params.Log.Error("Lookup nodes", errors.Trace(err), nil)
+
+			return true
+		}
+
+		if initialized && equal(current, nodes) {
+			return true
+		}
+
+		initialized = true
+		current = nodes
+
+		p.params.Log.Info("Nodes changed", logger.Ctx{
+			"nodes": key(nodes),
+		})
+
+		select {
+		case p.nodesCh <- nodes:
+			return true
+		case <-p.teardown:
+			return false
+		}
+	}
+
+	if !lookup() {
+		return
+	}
+
+	for {
+		select {
+		case <-ticker.C():
+			if !lookup() {
+				return
+			}
+		case <-p.teardown:
+			return
+		}
+	}
+}
+
+// Nodes implements Discovery.
+func (p *Poller) Nodes() <-chan []*net.UDPAddr {
+	return p.nodesCh
+}
+
+// Close implements Discovery.
+func (p *Poller) Close() error {
+	select {
+	case p.teardown <- struct{}{}:
+		<-p.torndown
+	case <-p.torndown:
+		return nil
+	}
+
+	if p.params.OnClose != nil {
+		return errors.Trace(p.params.OnClose())
+	}
+
+	return nil
+}
+
+// key returns a sorted, comma-separated string representation of nodes.
+func key(nodes []*net.UDPAddr) string {
+	addrs := make([]string, len(nodes))
+
+	for i, node := range nodes {
+		addrs[i] = node.String()
+	}
+
+	sort.Strings(addrs)
+
+	return strings.Join(addrs, ",")
+}
+
+func equal(a, b []*net.UDPAddr) bool {
+	return len(a) == len(b) && key(a) == key(b)
+}
@@ -0,0 +1,207 @@
+package discovery_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/discovery"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func mustResolve(addrs ...string) []*net.UDPAddr {
+	ret := make([]*net.UDPAddr, len(addrs))
+
+	for i, addr := range addrs {
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			panic(err)
+		}
+
+		ret[i] = udpAddr
+	}
+
+	return ret
+}
+
+func TestStatic(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	nodes := mustResolve("127.0.0.1:3001")
+
+	s := discovery.NewStatic(nodes)
+
+	assert.Equal(t, nodes, <-s.Nodes())
+
+	assert.NoError(t, s.Close())
+
+	_, ok := <-s.Nodes()
+	assert.False(t, ok, "channel should be closed")
+}
+
+func TestPoller(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var (
+		mu     sync.Mutex
+		result []*net.UDPAddr
+		err    error
+	)
+
+	set := func(r []*net.UDPAddr, e error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		result, err = r, e
+	}
+
+	set(mustResolve("127.0.0.1:3001"), nil)
+
+	mockClock := clock.NewMock()
+
+	lookups := make(chan struct{})
+	closed := false
+
+	p := discovery.NewPoller(discovery.PollerParams{
+		Log:      test.NewLogger(),
+		Clock:    mockClock,
+		Interval: time.Second,
+		Lookup: func() ([]*net.UDPAddr, error) {
+			lookups <- struct{}{}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			return result, err
+		},
+		OnClose: func() error {
+			closed = true
+
+			return nil
+		},
+	})
+
+	tick := func() {
+		mockClock.Add(time.Second)
+		<-lookups
+	}
+
+	<-lookups
+	assert.Equal(t, mustResolve("127.0.0.1:3001"), <-p.Nodes())
+
+	set(mustResolve("127.0.0.1:3002", "127.0.0.1:3001"), nil)
+	tick()
+	assert.Equal(t, mustResolve("127.0.0.1:3002", "127.0.0.1:3001"), <-p.Nodes())
+
+	// Errors and unchanged lists should not be emitted.
+	set(nil, errors.New("test error"))
+	tick()
+	set(mustResolve("127.0.0.1:3001", "127.0.0.1:3002"), nil)
+	tick()
+
+	set(nil, nil)
+	tick()
+	assert.Empty(t, <-p.Nodes())
+
+	assert.NoError(t, p.Close())
+	assert.True(t, closed, "OnClose should have been called")
+
+	_, ok := <-p.Nodes()
+	assert.False(t, ok, "channel should be closed")
+}
+
+type resolverMock struct {
+	ips  map[string][]net.IPAddr
+	srvs map[string][]*net.SRV
+}
+
+func (r resolverMock) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r.ips[host]
+	if !ok {
+		return nil, errors.Errorf("host not found: %s", host)
+	}
+
+	return ips, nil
+}
+
+func (r resolverMock) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	srvs, ok := r.srvs[name]
+	if !ok {
+		return "", nil, errors.Errorf("srv not found: %s", name)
+	}
+
+	return name, srvs, nil
+}
+
+func TestDNSLookup(t *testing.T) {
+	resolver := resolverMock{
+		ips: map[string][]net.IPAddr{
+			"nodes.example.com": {
+				{IP: net.ParseIP("10.0.0.1")},
+				{IP: net.ParseIP("10.0.0.2")},
+			},
+			"node3.example.com": {
+				{IP: net.ParseIP("10.0.0.3")},
+			},
+		},
+		srvs: map[string][]*net.SRV{
+			"_peercalls._udp.example.com": {
+				{Target: "node3.example.com", Port: 4003},
+			},
+		},
+	}
+
+	nodes, err := discovery.NewDNSLookup(discovery.DNSParams{
+		Resolver: resolver,
+		Name:     "nodes.example.com",
+		Port:     4001,
+	})()
+	assert.NoError(t, err)
+	assert.Equal(t, mustResolve("10.0.0.1:4001", "10.0.0.2:4001"), nodes)
+
+	nodes, err = discovery.NewDNSLookup(discovery.DNSParams{
+		Resolver: resolver,
+		Name:     "_peercalls._udp.example.com",
+		SRV:      true,
+		Timeout:  time.Second,
+	})()
+	assert.NoError(t, err)
+	assert.Equal(t, mustResolve("10.0.0.3:4003"), nodes)
+
+	_, err = discovery.NewDNSLookup(discovery.DNSParams{
+		Resolver: resolver,
+		Name:     "missing.example.com",
+	})()
+	assert.Error(t, err)
+}
+
+func TestFileLookup(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "nodes")
+
+	lookup := discovery.NewFileLookup(filename)
+
+	_, err := lookup()
+	assert.Error(t, err, "file does not exist")
+
+	contents := "# peer calls nodes\n127.0.0.1:3001\n\n  127.0.0.1:3002  \n"
+
+	require.NoError(t, os.WriteFile(filename, []byte(contents), 0o600))
+
+	nodes, err := lookup()
+	assert.NoError(t, err)
+	assert.Equal(t, mustResolve("127.0.0.1:3001", "127.0.0.1:3002"), nodes)
+
+	require.NoError(t, os.WriteFile(filename, []byte("invalid"), 0o600))
+
+	_, err = lookup()
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Resolver contains a subset of methods from net.Resolver to make mocking
+// easier.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+var _ Resolver = net.DefaultResolver
+
+// DNSParams are the parameters for NewDNSLookup.
+type DNSParams struct {
+	Resolver Resolver
+	// Name is the DNS name to resolve. When SRV is true, it should be a full
+	// SRV record name, e.g. _peercalls._udp.example.com.
+	Name string
+	// Port is used together with A/AAAA records. It is ignored when SRV is
+	// set because the port is read from the SRV records.
+	Port int
+	// SRV enables the lookup of SRV records instead of A/AAAA records.
+	SRV bool
+	// Timeout is the maximum duration of a single lookup.
+	Timeout time.Duration
+}
+
+// NewDNSLookup creates a LookupFunc that resolves nodes from DNS records.
+func NewDNSLookup(params DNSParams) LookupFunc {
+	if params.Resolver == nil {
+		params.Resolver = net.DefaultResolver
+	}
+
+	return func() ([]*net.UDPAddr, error) {
+		ctx := context.Background()
+
+		if params.Timeout > 0 {
+			var cancel context.CancelFunc
+
+			ctx, cancel = context.WithTimeout(ctx, params.Timeout)
+			defer cancel()
+		}
+
+		if !params.SRV {
+			nodes, err := lookupIPAddrs(ctx, params.Resolver, params.Name, params.Port)
+
+			return nodes, errors.Trace(err)
+		}
+
+		_, records, err := params.Resolver.LookupSRV(ctx, "", "", params.Name)
+		if err != nil {
+			return nil, errors.Annotatef(err, "lookup SRV: %s", params.Name)
+		}
+
+		var nodes []*net.UDPAddr
+
+		for _, record := range records {
+			addrs, err := lookupIPAddrs(ctx, params.Resolver, record.Target, int(record.Port))
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+
+			nodes = append(nodes, addrs...)
+		}
+
+		return nodes, nil
+	}
+}
+
+func lookupIPAddrs(ctx context.Context, resolver Resolver, host string, port int) ([]*net.UDPAddr, error) {
+	ipAddrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, errors.Annotatef(err, "lookup IP addr: %s", host)
+	}
+
+	nodes := make([]*net.UDPAddr, len(ipAddrs))
+
+	for i, ipAddr := range ipAddrs {
+		nodes[i] = &net.UDPAddr{
+			IP:   ipAddr.IP,
+			Port: port,
+			Zone: ipAddr.Zone,
+		}
+	}
+
+	return nodes, nil
+}
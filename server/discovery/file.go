@@ -0,0 +1,51 @@
+package discovery
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// NewFileLookup creates a LookupFunc that reads nodes from a file. The file
+// should contain a single host:port address per line. Empty lines and lines
+// starting with # are ignored. Used together with a Poller, the changes to
+// the file will be picked up without restarting the server.
+func NewFileLookup(filename string) LookupFunc {
+	return func() ([]*net.UDPAddr, error) {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, errors.Annotatef(err, "open nodes file: %s", filename)
+		}
+
+		defer f.Close()
+
+		nodes, err := ReadNodes(bufio.NewScanner(f))
+
+		return nodes, errors.Annotatef(err, "read nodes file: %s", filename)
+	}
+}
+
+// ReadNodes reads a single host:port address per line.
+func ReadNodes(scanner *bufio.Scanner) ([]*net.UDPAddr, error) {
+	var nodes []*net.UDPAddr
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		addr, err := net.ResolveUDPAddr("udp", line)
+		if err != nil {
+			return nil, errors.Annotatef(err, "resolve UDP addr: %q", line)
+		}
+
+		nodes = append(nodes, addr)
+	}
+
+	return nodes, errors.Trace(scanner.Err())
+}
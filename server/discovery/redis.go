@@ -0,0 +1,94 @@
+package discovery
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+)
+
+// RedisParams are the parameters for NewRedis.
+type RedisParams struct {
+	Client *redis.Client
+	// Prefix is the prefix for Redis keys, same as the one used by the store.
+	Prefix string
+	Clock  clock.Clock
+	// Addr is the address advertised to the other nodes.
+	Addr *net.UDPAddr
+	// TTL is the duration after which a node that stopped refreshing its
+	// registration is removed. It should be at least a few lookup intervals.
+	TTL time.Duration
+}
+
+// Redis registers the local node in a Redis sorted set scored by the time of
+// the last registration, and finds other nodes registered in the same set.
+type Redis struct {
+	params *RedisParams
+	key    string
+}
+
+// NewRedis creates a new instance of Redis.
+func NewRedis(params RedisParams) *Redis {
+	return &Redis{
+		params: &params,
+		key:    params.Prefix + ":nodes",
+	}
+}
+
+// Lookup refreshes the registration of the local node, removes the expired
+// registrations and returns the addresses of all other registered nodes. It
+// can be used as a LookupFunc.
+func (r *Redis) Lookup() ([]*net.UDPAddr, error) {
+	now := r.params.Clock.Now()
+	self := r.params.Addr.String()
+
+	minScore := strconv.FormatInt(now.Add(-r.params.TTL).UnixNano(), 10)
+
+	pipe := r.params.Client.TxPipeline()
+
+	pipe.ZAdd(r.key, &redis.Z{
+		Score:  float64(now.UnixNano()),
+		Member: self,
+	})
+
+	pipe.ZRemRangeByScore(r.key, "-inf", "("+minScore)
+
+	rangeCmd := pipe.ZRangeByScore(r.key, &redis.ZRangeBy{
+		Min:    minScore,
+		Max:    "+inf",
+		Offset: 0,
+		Count:  0,
+	})
+
+	if _, err := pipe.Exec(); err != nil {
+		return nil, errors.Annotatef(err, "register node: %s", r.key)
+	}
+
+	var nodes []*net.UDPAddr
+
+	for _, member := range rangeCmd.Val() {
+		if member == self {
+			continue
+		}
+
+		addr, err := net.ResolveUDPAddr("udp", member)
+		if err != nil {
+			return nil, errors.Annotatef(err, "resolve UDP addr: %q", member)
+		}
+
+		nodes = append(nodes, addr)
+	}
+
+	return nodes, nil
+}
+
+// Unregister removes the local node from the set so that other nodes do not
+// have to wait for the registration to expire.
+func (r *Redis) Unregister() error {
+	err := r.params.Client.ZRem(r.key, r.params.Addr.String()).Err()
+
+	return errors.Annotatef(err, "unregister node: %s", r.key)
+}
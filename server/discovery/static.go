@@ -0,0 +1,58 @@
+package discovery
+
+import (
+	"net"
+)
+
+// Static is a Discovery with a fixed list of nodes.
+type Static struct {
+	nodesCh chan []*net.UDPAddr
+
+	teardown chan struct{}
+	torndown chan struct{}
+}
+
+var _ Discovery = &Static{}
+
+// NewStatic creates a new Discovery that emits nodes only once.
+func NewStatic(nodes []*net.UDPAddr) *Static {
+	s := &Static{
+		nodesCh: make(chan []*net.UDPAddr),
+
+		teardown: make(chan struct{}),
+		torndown: make(chan struct{}),
+	}
+
+	go func() {
+		defer func() {
+			close(s.nodesCh)
+			close(s.torndown)
+		}()
+
+		select {
+		case s.nodesCh <- nodes:
+		case <-s.teardown:
+			return
+		}
+
+		<-s.teardown
+	}()
+
+	return s
+}
+
+// Nodes implements Discovery.
+func (s *Static) Nodes() <-chan []*net.UDPAddr {
+	return s.nodesCh
+}
+
+// Close implements Discovery.
+func (s *Static) Close() error {
+	select {
+	case s.teardown <- struct{}{}:
+		<-s.torndown
+	case <-s.torndown:
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+)
+
+// ErrDraining is returned when a new room cannot be created because the
+// server is draining.
+var ErrDraining = errors.New("server is draining")
+
+// Drain keeps track of the active calls so the server can be shut down
+// gracefully. Once started, no new rooms should be created and the clients
+// of the active calls are asked to reconnect, preferably to another node.
+type Drain struct {
+	log    logger.Logger
+	config DrainConfig
+
+	mu sync.Mutex
+	// started is closed once the drain has started.
+	started chan struct{}
+	// calls contains the notify functions of the active calls.
+	calls map[uint64]func(alternateURL string)
+	// lastCallID is used for generating keys for calls.
+	lastCallID uint64
+	// callsChanged is closed and replaced every time a call ends.
+	callsChanged chan struct{}
+}
+
+func NewDrain(log logger.Logger, config DrainConfig) *Drain {
+	return &Drain{
+		log:    log.WithNamespaceAppended("drain"),
+		config: config,
+
+		mu:           sync.Mutex{},
+		started:      make(chan struct{}),
+		calls:        map[uint64]func(string){},
+		lastCallID:   0,
+		callsChanged: make(chan struct{}),
+	}
+}
+
+// Start starts the drain and notifies all active calls. It is safe to call
+// Start multiple times.
+func (d *Drain) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	select {
+	case <-d.started:
+		return
+	default:
+	}
+
+	d.log.Info("Start drain", logger.Ctx{
+		"active_calls":  len(d.calls),
+		"alternate_url": d.config.AlternateURL,
+	})
+
+	prometheusDraining.Set(1)
+
+	close(d.started)
+
+	for _, notify := range d.calls {
+		// Writing to clients might block.
+		go notify(d.config.AlternateURL)
+	}
+}
+
+// Started is closed once the drain has started.
+func (d *Drain) Started() <-chan struct{} {
+	return d.started
+}
+
+// Draining returns true after the drain has started.
+func (d *Drain) Draining() bool {
+	select {
+	case <-d.started:
+		return true
+	default:
+		return false
+	}
+}
+
+// CheckHealth fails after the drain has started so that no new calls are
+// routed to this server.
+func (d *Drain) CheckHealth(ctx context.Context) error {
+	if d.Draining() {
+		return errors.Trace(ErrDraining)
+	}
+
+	return nil
+}
+
+// AlternateURL returns the URL of the node the clients should reconnect to.
+// It might be empty.
+func (d *Drain) AlternateURL() string {
+	return d.config.AlternateURL
+}
+
+// AddCall registers an active call. The notify function will be called when
+// the drain starts, or right away when it already has. The returned function
+// must be called once the call ends.
+func (d *Drain) AddCall(notify func(alternateURL string)) (removeCall func()) {
+	d.mu.Lock()
+
+	d.lastCallID++
+	callID := d.lastCallID
+
+	d.calls[callID] = notify
+
+	draining := d.Draining()
+
+	d.mu.Unlock()
+
+	if draining {
+		notify(d.config.AlternateURL)
+	}
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+
+			delete(d.calls, callID)
+
+			close(d.callsChanged)
+			d.callsChanged = make(chan struct{})
+		})
+	}
+}
+
+// ActiveCalls returns the number of active calls.
+func (d *Drain) ActiveCalls() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.calls)
+}
+
+// Wait waits for all active calls to end, but no longer than the configured
+// timeout.
+func (d *Drain) Wait(ctx context.Context) error {
+	if d.config.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, d.config.Timeout)
+		defer cancel()
+	}
+
+	for {
+		d.mu.Lock()
+		activeCalls := len(d.calls)
+		callsChanged := d.callsChanged
+		d.mu.Unlock()
+
+		if activeCalls == 0 {
+			d.log.Info("All calls ended", nil)
+
+			return nil
+		}
+
+		select {
+		case <-callsChanged:
+		case <-ctx.Done():
+			return errors.Annotatef(ctx.Err(), "wait for %d active calls", activeCalls)
+		}
+	}
+}
+
+// Run waits for the drain to start, however it was triggered, and then for
+// the active calls to end before calling shutdown. Canceling ctx stops the
+// wait for the calls, but shutdown is still called once the drain has
+// started.
+func (d *Drain) Run(ctx context.Context, shutdown func()) {
+	select {
+	case <-d.started:
+	case <-ctx.Done():
+	}
+
+	if !d.Draining() {
+		return
+	}
+
+	if err := d.Wait(ctx); err != nil {
+		d.log.Error("Drain wait", errors.Trace(err), nil)
+	}
+
+	shutdown()
+}
@@ -0,0 +1,142 @@
+package server_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrain(t *testing.T) {
+	drain := server.NewDrain(test.NewLogger(), server.DrainConfig{
+		Timeout:      time.Second,
+		AlternateURL: "https://node2.example.com",
+	})
+
+	notified := make(chan string, 2)
+
+	notify := func(alternateURL string) {
+		notified <- alternateURL
+	}
+
+	removeCall1 := drain.AddCall(notify)
+	removeCall2 := drain.AddCall(notify)
+
+	assert.Equal(t, 2, drain.ActiveCalls())
+	assert.False(t, drain.Draining())
+
+	drain.Start()
+	drain.Start()
+
+	assert.True(t, drain.Draining())
+
+	for i := 0; i < 2; i++ {
+		select {
+		case url := <-notified:
+			assert.Equal(t, "https://node2.example.com", url)
+		case <-time.After(time.Second):
+			require.Fail(t, "Timed out waiting for notification")
+		}
+	}
+
+	waitErr := make(chan error, 1)
+
+	go func() {
+		waitErr <- drain.Wait(context.Background())
+	}()
+
+	removeCall1()
+	removeCall1()
+
+	assert.Equal(t, 1, drain.ActiveCalls())
+
+	removeCall2()
+
+	select {
+	case err := <-waitErr:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		require.Fail(t, "Timed out waiting for calls to end")
+	}
+}
+
+func TestDrain_Timeout(t *testing.T) {
+	drain := server.NewDrain(test.NewLogger(), server.DrainConfig{
+		Timeout:      10 * time.Millisecond,
+		AlternateURL: "",
+	})
+
+	removeCall := drain.AddCall(func(string) {})
+	defer removeCall()
+
+	drain.Start()
+
+	err := drain.Wait(context.Background())
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+}
+
+func TestDrain_AddCall_draining(t *testing.T) {
+	drain := server.NewDrain(test.NewLogger(), server.DrainConfig{})
+
+	drain.Start()
+
+	notified := false
+
+	removeCall := drain.AddCall(func(string) {
+		notified = true
+	})
+	defer removeCall()
+
+	assert.True(t, notified)
+}
+
+func TestDrain_Run(t *testing.T) {
+	drain := server.NewDrain(test.NewLogger(), server.DrainConfig{
+		Timeout:      time.Second,
+		AlternateURL: "",
+	})
+
+	removeCall := drain.AddCall(func(string) {})
+
+	shutdown := make(chan struct{})
+
+	go drain.Run(context.Background(), func() {
+		close(shutdown)
+	})
+
+	drain.Start()
+
+	select {
+	case <-shutdown:
+		require.Fail(t, "Shut down before the call ended")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	removeCall()
+
+	select {
+	case <-shutdown:
+	case <-time.After(time.Second):
+		require.Fail(t, "Timed out waiting for shutdown")
+	}
+}
+
+func TestDrain_Run_canceled(t *testing.T) {
+	drain := server.NewDrain(test.NewLogger(), server.DrainConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	shutdownCalled := false
+
+	drain.Run(ctx, func() {
+		shutdownCalled = true
+	})
+
+	assert.False(t, shutdownCalled, "should not shut down without a drain")
+}
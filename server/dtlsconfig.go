@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"os"
+
+	"github.com/juju/errors"
+	"github.com/pion/dtls/v2"
+)
+
+// NewDTLSConfig creates a DTLS config for the connections between nodes.
+// Pre-shared keys are used when set, otherwise the nodes authenticate each
+// other with certificates signed by the CA. It returns nil when DTLS is
+// disabled.
+func NewDTLSConfig(c TransportDTLSConfig) (*dtls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	if len(c.PSK) > 0 {
+		return newPSKDTLSConfig(c)
+	}
+
+	if c.Cert == "" || c.Key == "" || c.CA == "" {
+		return nil, errors.Errorf("DTLS requires either psk or cert, key and ca")
+	}
+
+	cert, certPool, err := loadNodeCertificates(c)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	// nolint:exhaustivestruct
+	return &dtls.Config{
+		Certificates:         []tls.Certificate{cert},
+		RootCAs:              certPool,
+		ClientCAs:            certPool,
+		ClientAuth:           dtls.RequireAndVerifyClientCert,
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	}, nil
+}
+
+// loadNodeCertificates loads the certificate of this node and the CA used for
+// verifying the remote nodes.
+func loadNodeCertificates(c TransportDTLSConfig) (tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+	if err != nil {
+		return cert, nil, errors.Annotatef(err, "load key pair")
+	}
+
+	caPEM, err := os.ReadFile(c.CA)
+	if err != nil {
+		return cert, nil, errors.Annotatef(err, "read CA: %s", c.CA)
+	}
+
+	certPool := x509.NewCertPool()
+
+	if !certPool.AppendCertsFromPEM(caPEM) {
+		return cert, nil, errors.Errorf("no certificates found in CA: %s", c.CA)
+	}
+
+	return cert, certPool, nil
+}
+
+func newPSKDTLSConfig(c TransportDTLSConfig) (*dtls.Config, error) {
+	if c.Identity == "" {
+		return nil, errors.Errorf("DTLS identity is required with psk")
+	}
+
+	keys := make(map[string][]byte, len(c.PSK))
+
+	for identity, hexKey := range c.PSK {
+		key, err := hex.DecodeString(hexKey)
+		if err != nil {
+			return nil, errors.Annotatef(err, "decode DTLS psk for identity: %q", identity)
+		}
+
+		keys[identity] = key
+	}
+
+	// nolint:exhaustivestruct
+	return &dtls.Config{
+		// PSK is called with the identity of the remote node.
+		PSK: func(identity []byte) ([]byte, error) {
+			key, ok := keys[string(identity)]
+			if !ok {
+				return nil, errors.Errorf("unknown node identity: %q", identity)
+			}
+
+			return key, nil
+		},
+		PSKIdentityHint:      []byte(c.Identity),
+		CipherSuites:         []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_GCM_SHA256},
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDTLSConfig_Disabled(t *testing.T) {
+	config, err := server.NewDTLSConfig(server.TransportDTLSConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+}
+
+func TestNewDTLSConfig_PSK(t *testing.T) {
+	config, err := server.NewDTLSConfig(server.TransportDTLSConfig{
+		Enabled:  true,
+		Identity: "node1",
+		PSK: map[string]string{
+			"node2": "0a0b0c",
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("node1"), config.PSKIdentityHint)
+
+	key, err := config.PSK([]byte("node2"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x0a, 0x0b, 0x0c}, key)
+
+	_, err = config.PSK([]byte("node3"))
+	assert.Error(t, err, "unknown identity")
+
+	_, err = server.NewDTLSConfig(server.TransportDTLSConfig{
+		Enabled: true,
+		PSK: map[string]string{
+			"node2": "0a0b0c",
+		},
+	})
+	assert.Error(t, err, "missing identity")
+
+	_, err = server.NewDTLSConfig(server.TransportDTLSConfig{
+		Enabled:  true,
+		Identity: "node1",
+		PSK: map[string]string{
+			"node2": "not hex",
+		},
+	})
+	assert.Error(t, err, "invalid key")
+}
+
+func writePEM(t *testing.T, filename string, typ string, b []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b})
+
+	require.NoError(t, os.WriteFile(filename, data, 0o600))
+}
+
+func TestNewDTLSConfig_Cert(t *testing.T) {
+	dir := t.TempDir()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "peercalls"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	c := server.TransportDTLSConfig{
+		Enabled: true,
+		Cert:    filepath.Join(dir, "node.pem"),
+		Key:     filepath.Join(dir, "node.key"),
+		CA:      filepath.Join(dir, "ca.pem"),
+	}
+
+	writePEM(t, c.Cert, "CERTIFICATE", cert)
+	writePEM(t, c.Key, "EC PRIVATE KEY", keyDER)
+	writePEM(t, c.CA, "CERTIFICATE", cert)
+
+	config, err := server.NewDTLSConfig(c)
+	require.NoError(t, err)
+
+	assert.Len(t, config.Certificates, 1)
+	assert.NotNil(t, config.RootCAs)
+	assert.NotNil(t, config.ClientCAs)
+
+	_, err = server.NewDTLSConfig(server.TransportDTLSConfig{
+		Enabled: true,
+		Cert:    c.Cert,
+		Key:     c.Key,
+	})
+	assert.Error(t, err, "missing CA")
+}
@@ -0,0 +1,312 @@
+package server
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+)
+
+const defaultHealthCheckTimeout = 5 * time.Second
+
+// HealthCheckType decides how a failed check affects the health report.
+type HealthCheckType int
+
+const (
+	// HealthCheckTypeLiveness checks fail when the server cannot recover
+	// without a restart. A server that is not alive is not ready either.
+	HealthCheckTypeLiveness HealthCheckType = iota + 1
+	// HealthCheckTypeReadiness checks fail when the server should not receive
+	// new calls.
+	HealthCheckTypeReadiness
+	// HealthCheckTypeInfo checks are only reported. They are used for
+	// dependencies that should not take the whole server out of rotation, like
+	// the connections to other nodes.
+	HealthCheckTypeInfo
+)
+
+func (t HealthCheckType) String() string {
+	switch t {
+	case HealthCheckTypeLiveness:
+		return "liveness"
+	case HealthCheckTypeReadiness:
+		return "readiness"
+	case HealthCheckTypeInfo:
+		return "info"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t HealthCheckType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (t *HealthCheckType) UnmarshalText(b []byte) error {
+	for _, typ := range []HealthCheckType{
+		HealthCheckTypeLiveness,
+		HealthCheckTypeReadiness,
+		HealthCheckTypeInfo,
+	} {
+		if typ.String() == string(b) {
+			*t = typ
+
+			return nil
+		}
+	}
+
+	return errors.Errorf("unknown health check type: %q", b)
+}
+
+// HealthCheckFunc returns an error when the component is unhealthy. It
+// should return when ctx is done.
+type HealthCheckFunc func(ctx context.Context) error
+
+type HealthCheck struct {
+	// Name identifies the check in the report.
+	Name  string
+	Type  HealthCheckType
+	Check HealthCheckFunc
+}
+
+// HealthCheckResult is the result of a single HealthCheck.
+type HealthCheckResult struct {
+	Name    string          `json:"name"`
+	Type    HealthCheckType `json:"type"`
+	Healthy bool            `json:"healthy"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// HealthReport contains the results of all registered checks.
+type HealthReport struct {
+	// Live is false when any of the liveness checks failed.
+	Live bool `json:"live"`
+	// Ready is false when any of the liveness or readiness checks failed.
+	Ready  bool                `json:"ready"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+// Health contains the health checks registered by the components of the
+// server.
+type Health struct {
+	log    logger.Logger
+	config HealthConfig
+
+	mu sync.Mutex
+	// checks contains the registered checks.
+	checks map[uint64]HealthCheck
+	// failing contains the IDs of the checks that failed the last time they
+	// ran, so that only the changes are logged.
+	failing map[uint64]struct{}
+	// lastCheckID is used for generating keys for checks.
+	lastCheckID uint64
+}
+
+func NewHealth(log logger.Logger, config HealthConfig) *Health {
+	h := &Health{
+		log:    log.WithNamespaceAppended("health"),
+		config: config,
+
+		mu:          sync.Mutex{},
+		checks:      map[uint64]HealthCheck{},
+		failing:     map[uint64]struct{}{},
+		lastCheckID: 0,
+	}
+
+	if config.MaxGoroutines > 0 {
+		// A spike in load can exceed the limit too, so the server is only taken
+		// out of rotation instead of being restarted.
+		h.Register(HealthCheck{
+			Name:  "goroutines",
+			Type:  HealthCheckTypeReadiness,
+			Check: checkGoroutines(config.MaxGoroutines),
+		})
+	}
+
+	return h
+}
+
+// Register adds a check to all future reports. The returned function removes
+// the check.
+func (h *Health) Register(check HealthCheck) (unregister func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastCheckID++
+	checkID := h.lastCheckID
+
+	h.checks[checkID] = check
+
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.checks, checkID)
+		delete(h.failing, checkID)
+	}
+}
+
+// Report runs all checks concurrently and waits for the results. Checks that
+// do not finish within the configured timeout fail.
+func (h *Health) Report(ctx context.Context) HealthReport {
+	timeout := h.config.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	h.mu.Lock()
+
+	checkIDs := make([]uint64, 0, len(h.checks))
+	checks := make([]HealthCheck, 0, len(h.checks))
+
+	for checkID, check := range h.checks {
+		checkIDs = append(checkIDs, checkID)
+		checks = append(checks, check)
+	}
+
+	h.mu.Unlock()
+
+	results := make([]HealthCheckResult, len(checks))
+
+	var wg sync.WaitGroup
+
+	wg.Add(len(checks))
+
+	for i, check := range checks {
+		go func(i int, check HealthCheck) {
+			defer wg.Done()
+
+			results[i] = h.runCheck(ctx, check)
+		}(i, check)
+	}
+
+	wg.Wait()
+
+	for i, result := range results {
+		h.logChange(checkIDs[i], result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	report := HealthReport{
+		Live:   true,
+		Ready:  true,
+		Checks: results,
+	}
+
+	for _, result := range results {
+		if result.Healthy {
+			continue
+		}
+
+		// nolint:exhaustive
+		switch result.Type {
+		case HealthCheckTypeLiveness:
+			report.Live = false
+			report.Ready = false
+		case HealthCheckTypeReadiness:
+			report.Ready = false
+		}
+	}
+
+	return report
+}
+
+func (h *Health) runCheck(ctx context.Context, check HealthCheck) HealthCheckResult {
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- check.Check(ctx)
+	}()
+
+	var err error
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = errors.Annotatef(ctx.Err(), "check %s", check.Name)
+	}
+
+	result := HealthCheckResult{
+		Name:    check.Name,
+		Type:    check.Type,
+		Healthy: err == nil,
+		Error:   "",
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// logChange logs the result of the check with checkID when it differs from
+// the previous one. The probes run the checks every few seconds, so logging
+// every failure would flood the logs during an outage.
+func (h *Health) logChange(checkID uint64, result HealthCheckResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.checks[checkID]; !ok {
+		// The check was unregistered while it ran.
+		return
+	}
+
+	_, wasFailing := h.failing[checkID]
+
+	if result.Healthy == !wasFailing {
+		return
+	}
+
+	if result.Healthy {
+		delete(h.failing, checkID)
+
+		h.log.Info("Health check recovered", logger.Ctx{
+			"check": result.Name,
+			"type":  result.Type,
+		})
+
+		return
+	}
+
+	h.failing[checkID] = struct{}{}
+
+	h.log.Warn("Health check failed", logger.Ctx{
+		"check": result.Name,
+		"type":  result.Type,
+		"err":   result.Error,
+	})
+}
+
+func checkGoroutines(max int) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		if n := runtime.NumGoroutine(); n > max {
+			return errors.Errorf("%d goroutines exceed the limit of %d", n, max)
+		}
+
+		return nil
+	}
+}
+
+// checkCount returns a HealthCheckFunc that fails once count reaches max.
+func checkCount(name string, count func() int, max int) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		if n := count(); n >= max {
+			return errors.Errorf("%d %s reached the limit of %d", n, name, max)
+		}
+
+		return nil
+	}
+}
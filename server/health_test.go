@@ -0,0 +1,101 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth_Report(t *testing.T) {
+	health := server.NewHealth(test.NewLogger(), server.HealthConfig{
+		Timeout:       50 * time.Millisecond,
+		MaxGoroutines: 0,
+		MaxRooms:      0,
+	})
+
+	report := health.Report(context.Background())
+	assert.Equal(t, server.HealthReport{
+		Live:   true,
+		Ready:  true,
+		Checks: []server.HealthCheckResult{},
+	}, report)
+
+	unregister := health.Register(server.HealthCheck{
+		Name: "slow",
+		Type: server.HealthCheckTypeInfo,
+		Check: func(ctx context.Context) error {
+			<-ctx.Done()
+
+			return ctx.Err()
+		},
+	})
+
+	report = health.Report(context.Background())
+	assert.True(t, report.Live, "info checks do not affect liveness")
+	assert.True(t, report.Ready, "info checks do not affect readiness")
+	assert.Len(t, report.Checks, 1)
+	assert.False(t, report.Checks[0].Healthy)
+	assert.Contains(t, report.Checks[0].Error, "deadline exceeded")
+
+	unregister()
+
+	report = health.Report(context.Background())
+	assert.Empty(t, report.Checks)
+}
+
+func TestHealth_MaxGoroutines(t *testing.T) {
+	health := server.NewHealth(test.NewLogger(), server.HealthConfig{
+		Timeout:       time.Second,
+		MaxGoroutines: 1,
+		MaxRooms:      0,
+	})
+
+	report := health.Report(context.Background())
+	assert.True(t, report.Live)
+	assert.False(t, report.Ready)
+	assert.Equal(t, "goroutines", report.Checks[0].Name)
+}
+
+func TestHealth_Report_logChanges(t *testing.T) {
+	var buf bytes.Buffer
+
+	log := logger.New().
+		WithConfig(logger.NewConfigFromString("**:info")).
+		WithWriter(&buf)
+
+	health := server.NewHealth(log, server.HealthConfig{
+		Timeout:       time.Second,
+		MaxGoroutines: 0,
+		MaxRooms:      0,
+	})
+
+	var checkErr error
+
+	health.Register(server.HealthCheck{
+		Name: "flaky",
+		Type: server.HealthCheckTypeReadiness,
+		Check: func(ctx context.Context) error {
+			return checkErr
+		},
+	})
+
+	checkErr = errors.New("unreachable")
+
+	health.Report(context.Background())
+	health.Report(context.Background())
+	assert.Equal(t, 1, strings.Count(buf.String(), "Health check failed"), "only the change should be logged")
+
+	checkErr = nil
+
+	health.Report(context.Background())
+	health.Report(context.Background())
+	assert.Equal(t, 1, strings.Count(buf.String(), "Health check recovered"))
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/peer-calls/peer-calls/v4/server/message"
+	"go.opentelemetry.io/otel/trace"
+	"nhooyr.io/websocket"
+)
+
+const (
+	defaultHybridSFUThreshold  = 4
+	defaultHybridMeshThreshold = 2
+)
+
+// Hybrid handles the websocket connections of the hybrid network. The rooms
+// start as mesh, and switch to the SFU when the number of clients reaches
+// the SFU threshold. They fall back to mesh when it drops to the mesh
+// threshold. The network of a room is stored in its Adapter, so all nodes
+// agree on it.
+type Hybrid struct {
+	log    logger.Logger
+	wss    *WSS
+	sfu    *SFU
+	config NetworkConfigHybrid
+}
+
+func NewHybridHandler(
+	log logger.Logger,
+	wss *WSS,
+	iceServers ICEServersFunc,
+	network NetworkConfig,
+	tracksManager TracksManager,
+	health *Health,
+) *Hybrid {
+	log = log.WithNamespaceAppended("hybrid")
+
+	config := network.Hybrid
+
+	if config.MeshThreshold >= config.SFUThreshold {
+		log.Warn("Mesh threshold must be lower than the SFU threshold", logger.Ctx{
+			"sfu_threshold":  config.SFUThreshold,
+			"mesh_threshold": config.MeshThreshold,
+		})
+
+		config.MeshThreshold = config.SFUThreshold - 1
+	}
+
+	return &Hybrid{
+		log:    log,
+		wss:    wss,
+		sfu:    NewSFUHandler(log, wss, iceServers, network.SFU, tracksManager, health),
+		config: config,
+	}
+}
+
+// hybridSocketHandler passes the messages of a client to the handler of the
+// network it is connected to.
+type hybridSocketHandler struct {
+	mesh *meshSocketHandler
+	sfu  *SocketHandler
+	// network is the network of the last Ready message.
+	network NetworkType
+}
+
+func (h *Hybrid) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	sub, err := h.wss.NewWebsocketContext(w, r)
+	if err != nil {
+		h.log.Error("Create websocket context", errors.Trace(err), nil)
+		return
+	}
+
+	roomID := sub.RoomID()
+	clientID := sub.ClientID()
+	adapter := sub.Adapter()
+
+	log := h.log.WithCtx(logger.Ctx{
+		"room_id":   roomID,
+		"client_id": clientID,
+	})
+
+	ctx = trace.ContextWithSpanContext(ctx, sub.SpanContext())
+
+	pinger := sub.StartHeartbeat(ctx)
+	chat := sub.StartChat()
+
+	socketHandler := &hybridSocketHandler{
+		mesh: newMeshSocketHandler(h.log, sub, pinger, chat),
+		sfu: NewSocketHandler(
+			ctx,
+			log,
+			h.sfu.tracksManager,
+			h.sfu.webRTCTransportFactory,
+			clientID,
+			roomID,
+			sub.Role(),
+			adapter,
+			pinger,
+			chat,
+			sub.Breakouts(),
+		),
+		network: NetworkTypeMesh,
+	}
+
+	// The new client either switches the room to the SFU, or it is told which
+	// network the room uses.
+	h.updateNetwork(log, roomID, adapter, clientID)
+
+	for msg := range sub.Messages() {
+		if err := h.handleMessage(log, adapter, socketHandler, msg); err != nil {
+			log.Error("Handle websocket message", errors.Trace(err), nil)
+		}
+	}
+
+	if socketHandler.network == NetworkTypeSFU {
+		socketHandler.sfu.HangUp()
+	}
+
+	if err := sub.Close(websocket.StatusNormalClosure, ""); err != nil {
+		log.Trace("Close websocket", logger.Ctx{
+			"err": err,
+		})
+	}
+
+	h.updateNetwork(log, roomID, adapter, "")
+}
+
+// handleMessage passes the Ready message to the handler of the network the
+// room uses, and the other messages to the handler of the network the client
+// is connected to.
+func (h *Hybrid) handleMessage(
+	log logger.Logger,
+	adapter Adapter,
+	socketHandler *hybridSocketHandler,
+	msg message.Message,
+) error {
+	if msg.Type == message.TypeReady {
+		network := h.roomNetwork(log, adapter)
+
+		if socketHandler.network == NetworkTypeSFU && network != NetworkTypeSFU {
+			// The client is hung up before it joins the mesh, so that the other
+			// clients do not see it twice.
+			if err := socketHandler.sfu.closeTransport(); err != nil {
+				return errors.Annotate(err, "leave sfu")
+			}
+		}
+
+		socketHandler.network = network
+	}
+
+	if socketHandler.network == NetworkTypeSFU {
+		return errors.Trace(socketHandler.sfu.HandleMessage(msg))
+	}
+
+	return errors.Trace(socketHandler.mesh.HandleMessage(msg))
+}
+
+// roomNetwork returns the network the room uses. The room uses mesh until it
+// is switched to the SFU.
+func (h *Hybrid) roomNetwork(log logger.Logger, adapter Adapter) NetworkType {
+	network, err := adapter.Network()
+	if err != nil {
+		log.Error("Get room network", errors.Trace(err), nil)
+	}
+
+	if NetworkType(network) == NetworkTypeSFU {
+		return NetworkTypeSFU
+	}
+
+	return NetworkTypeMesh
+}
+
+// updateNetwork switches the network of the room when the number of clients
+// crosses a threshold, and lets all clients know about it. Otherwise, it only
+// lets the new client with clientID know which network the room uses, when
+// clientID is set.
+func (h *Hybrid) updateNetwork(
+	log logger.Logger,
+	roomID identifiers.RoomID,
+	adapter Adapter,
+	clientID identifiers.ClientID,
+) {
+	size, err := adapter.Size()
+	if err != nil {
+		log.Error("Get room size", errors.Trace(err), nil)
+
+		return
+	}
+
+	network := h.roomNetwork(log, adapter)
+	switched := false
+
+	switch {
+	case size == 0:
+		// The room is empty, or it has been removed.
+		if _, err := adapter.SetNetwork(""); err != nil {
+			log.Error("Remove room network", errors.Trace(err), nil)
+		}
+
+		return
+	case network == NetworkTypeMesh && size >= h.config.SFUThreshold:
+		network = NetworkTypeSFU
+		switched = true
+	case network == NetworkTypeSFU && size <= h.config.MeshThreshold:
+		network = NetworkTypeMesh
+		switched = true
+	}
+
+	if switched {
+		// Another node might have switched the room at the same time, and
+		// only the node that stored the switch lets the clients know.
+		prev, err := adapter.SetNetwork(string(network))
+		if err != nil {
+			log.Error("Set room network", errors.Trace(err), nil)
+		}
+
+		switched = err == nil && NetworkType(prev) != network
+	}
+
+	msg := message.NewSwitchNetwork(roomID, message.SwitchNetwork{
+		Network: string(network),
+	})
+
+	switch {
+	case switched:
+		log.Info("Switch network", logger.Ctx{
+			"network": network,
+			"size":    size,
+		})
+
+		prometheusHybridSwitchesTotal.WithLabelValues(string(network)).Inc()
+
+		err = errors.Annotate(adapter.Broadcast(msg), "broadcast switch network")
+	case clientID != "":
+		err = errors.Annotate(adapter.Emit(clientID, msg), "emit switch network")
+	default:
+		err = nil
+	}
+
+	if err != nil {
+		log.Error("Send switch network", errors.Trace(err), nil)
+	}
+}
@@ -0,0 +1,196 @@
+package server_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/peer-calls/peer-calls/v4/server/message"
+	"github.com/peer-calls/peer-calls/v4/server/quota"
+	"github.com/peer-calls/peer-calls/v4/server/sfu"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"nhooyr.io/websocket"
+)
+
+func setupHybridServer(rooms server.RoomManager, hybrid server.NetworkConfigHybrid) (s *httptest.Server, url string) {
+	log := test.NewLogger()
+
+	handler := server.NewHybridHandler(
+		log,
+		server.NewWSS(server.WSSParams{
+			Log:       log,
+			Rooms:     rooms,
+			Drain:     server.NewDrain(log, server.DrainConfig{}),
+			Heartbeat: server.HeartbeatConfig{},
+			Limits:    server.LimitsConfig{},
+			Webinar:   server.WebinarConfig{},
+			Chat:      server.ChatConfig{},
+			Quota:     nil,
+		}),
+		func() []server.ICEServer { return nil },
+		server.NetworkConfig{
+			Type:   server.NetworkTypeHybrid,
+			SFU:    server.NetworkConfigSFU{},
+			Hybrid: hybrid,
+		},
+		sfu.NewTracksManager(log, false, sfu.Limits{}, quota.NewMemory()),
+		server.NewHealth(log, server.HealthConfig{}),
+	)
+	s = httptest.NewServer(handler)
+	url = "ws" + strings.TrimPrefix(s.URL, "http") + "/ws/" + roomName.String() + "/"
+
+	return s, url
+}
+
+// mustReadWSType reads until a message of type typ is received.
+func mustReadWSType(t *testing.T, ctx context.Context, ws *websocket.Conn, typ message.Type) message.Message {
+	t.Helper()
+
+	msg := mustReadWS(t, ctx, ws)
+	for msg.Type != typ {
+		msg = mustReadWS(t, ctx, ws)
+	}
+
+	return msg
+}
+
+func TestHybrid(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	log := test.NewLogger()
+
+	newAdapter := server.NewAdapterFactory(log, server.StoreConfig{})
+	defer newAdapter.Close()
+
+	rooms := server.NewAdapterRoomManager(newAdapter.NewAdapter)
+	srv, url := setupHybridServer(rooms, server.NetworkConfigHybrid{
+		SFUThreshold:  3,
+		MeshThreshold: 1,
+	})
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	readNetwork := func(ws *websocket.Conn) string {
+		t.Helper()
+
+		return mustReadWSType(t, ctx, ws, message.TypeSwitchNetwork).Payload.SwitchNetwork.Network
+	}
+
+	readInitiator := func(ws *websocket.Conn) identifiers.ClientID {
+		t.Helper()
+
+		return mustReadWSType(t, ctx, ws, message.TypeUsers).Payload.Users.Initiator
+	}
+
+	ready := message.NewReady(roomName, message.Ready{
+		Nickname: "test",
+	})
+
+	ws1 := mustDialWS(t, ctx, url+"user1")
+	defer ws1.Close(websocket.StatusNormalClosure, "")
+
+	assert.Equal(t, "mesh", readNetwork(ws1))
+
+	mustWriteWS(t, ctx, ws1, ready)
+	assert.Equal(t, identifiers.ClientID("user1"), readInitiator(ws1))
+
+	ws2 := mustDialWS(t, ctx, url+"user2")
+	assert.Equal(t, "mesh", readNetwork(ws2))
+
+	// The third client switches the room to the SFU.
+	ws3 := mustDialWS(t, ctx, url+"user3")
+
+	assert.Equal(t, "sfu", readNetwork(ws1))
+	assert.Equal(t, "sfu", readNetwork(ws2))
+	assert.Equal(t, "sfu", readNetwork(ws3))
+
+	mustWriteWS(t, ctx, ws1, ready)
+	assert.Equal(t, identifiers.ClientID("__SERVER__"), readInitiator(ws1))
+
+	// The room stays on the SFU until it shrinks to the mesh threshold.
+	require.NoError(t, ws3.Close(websocket.StatusNormalClosure, ""))
+	require.NoError(t, ws2.Close(websocket.StatusNormalClosure, ""))
+
+	assert.Equal(t, "mesh", readNetwork(ws1))
+
+	// The client leaves the SFU before it joins the mesh.
+	mustWriteWS(t, ctx, ws1, ready)
+	assert.Equal(t, identifiers.ClientID("user1"), readInitiator(ws1))
+}
+
+func TestHybrid_nodes(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	log := test.NewLogger()
+
+	newAdapter := server.NewAdapterFactory(log, server.StoreConfig{})
+	defer newAdapter.Close()
+
+	// The nodes share the rooms, like the nodes that use the Redis store.
+	rooms := server.NewAdapterRoomManager(newAdapter.NewAdapter)
+
+	hybrid := server.NetworkConfigHybrid{
+		SFUThreshold:  3,
+		MeshThreshold: 1,
+	}
+
+	srv1, url1 := setupHybridServer(rooms, hybrid)
+	defer srv1.Close()
+
+	srv2, url2 := setupHybridServer(rooms, hybrid)
+	defer srv2.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	readNetwork := func(ws *websocket.Conn) string {
+		t.Helper()
+
+		return mustReadWSType(t, ctx, ws, message.TypeSwitchNetwork).Payload.SwitchNetwork.Network
+	}
+
+	readInitiator := func(ws *websocket.Conn) identifiers.ClientID {
+		t.Helper()
+
+		return mustReadWSType(t, ctx, ws, message.TypeUsers).Payload.Users.Initiator
+	}
+
+	ready := message.NewReady(roomName, message.Ready{
+		Nickname: "test",
+	})
+
+	ws1 := mustDialWS(t, ctx, url1+"user1")
+	defer ws1.Close(websocket.StatusNormalClosure, "")
+
+	assert.Equal(t, "mesh", readNetwork(ws1))
+
+	ws2 := mustDialWS(t, ctx, url2+"user2")
+	assert.Equal(t, "mesh", readNetwork(ws2))
+
+	// The third client switches the room to the SFU on the second node.
+	ws3 := mustDialWS(t, ctx, url2+"user3")
+
+	assert.Equal(t, "sfu", readNetwork(ws1))
+	assert.Equal(t, "sfu", readNetwork(ws3))
+
+	// The first node joins its client to the SFU too.
+	mustWriteWS(t, ctx, ws1, ready)
+	assert.Equal(t, identifiers.ClientID("__SERVER__"), readInitiator(ws1))
+
+	// The second node switches the room back to mesh.
+	require.NoError(t, ws3.Close(websocket.StatusNormalClosure, ""))
+	require.NoError(t, ws2.Close(websocket.StatusNormalClosure, ""))
+
+	assert.Equal(t, "mesh", readNetwork(ws1))
+
+	mustWriteWS(t, ctx, ws1, ready)
+	assert.Equal(t, identifiers.ClientID("user1"), readInitiator(ws1))
+}
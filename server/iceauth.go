@@ -6,19 +6,28 @@ import (
 	"encoding/base64"
 	"fmt"
 	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 )
 
 func GetICEAuthServers(servers []ICEServer) (result []ICEAuthServer) {
+	return GetClientICEAuthServers(servers, "")
+}
+
+// GetClientICEAuthServers returns the credentials for the client with
+// clientID. The client ID is added to the usernames of the time-limited
+// credentials, so that the TURN server can count the allocations per client.
+func GetClientICEAuthServers(servers []ICEServer, clientID identifiers.ClientID) (result []ICEAuthServer) {
 	for _, server := range servers {
-		result = append(result, newICEServer(server))
+		result = append(result, newICEServer(server, clientID))
 	}
 	return
 }
 
-func newICEServer(server ICEServer) ICEAuthServer {
+func newICEServer(server ICEServer, clientID identifiers.ClientID) ICEAuthServer {
 	switch server.AuthType {
 	case AuthTypeSecret:
-		return getICEStaticAuthSecretCredentials(server)
+		return getICEStaticAuthSecretCredentials(server, clientID)
 	case AuthTypeNone:
 		fallthrough
 	default:
@@ -32,9 +41,13 @@ func newICEServer(server ICEServer) ICEAuthServer {
 
 const oneHourSeconds = 24 * 3600
 
-func getICEStaticAuthSecretCredentials(server ICEServer) ICEAuthServer {
+func getICEStaticAuthSecretCredentials(server ICEServer, clientID identifiers.ClientID) ICEAuthServer {
 	timestamp := time.Now().Unix() + oneHourSeconds
 	username := fmt.Sprintf("%d:%s", timestamp, server.AuthSecret.Username)
+
+	if clientID != "" {
+		username += ":" + clientID.String()
+	}
 	h := hmac.New(sha1.New, []byte(server.AuthSecret.Secret))
 
 	if _, err := h.Write([]byte(username)); err != nil {
@@ -31,4 +31,10 @@ func TestGetICEAuthServers(t *testing.T) {
 	assert.Equal(t, s2.URLs, r2.URLs)
 	assert.Regexp(t, "^[0-9]+:test$", r2.Username)
 	assert.NotEmpty(t, r2.Credential)
+
+	result = server.GetClientICEAuthServers(servers, "client1")
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, "", result[0].Username)
+	assert.Regexp(t, "^[0-9]+:test:client1$", result[1].Username)
+	assert.NotEmpty(t, result[1].Credential)
 }
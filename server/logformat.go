@@ -0,0 +1,20 @@
+package server
+
+import (
+	"github.com/peer-calls/peer-calls/v4/server/logformatter"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+)
+
+// NewLogFormatter returns the formatter for format. The text formatter is
+// used for unknown formats.
+func NewLogFormatter(format LogFormat) logger.Formatter {
+	// nolint:exhaustive
+	switch format {
+	case LogFormatJSON:
+		return logger.NewJSONFormatter(logger.JSONFormatterParams{
+			DateLayout: "",
+		})
+	default:
+		return logformatter.New()
+	}
+}
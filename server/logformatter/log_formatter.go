@@ -70,7 +70,7 @@ func (f *LogFormatter) Format(message logger.Message) ([]byte, error) {
 			message.Level,
 			namespace,
 			clientID,
-			strings.TrimRight(message.Body, "\n"),
+			message.Text(),
 			b.String(),
 		)
 	} else {
@@ -78,7 +78,7 @@ func (f *LogFormatter) Format(message logger.Message) ([]byte, error) {
 			message.Timestamp.Format(timeLayout),
 			message.Level,
 			namespace,
-			strings.TrimRight(message.Body, "\n"),
+			message.Text(),
 			b.String(),
 		)
 	}
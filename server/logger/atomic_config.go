@@ -0,0 +1,46 @@
+package logger
+
+import "sync/atomic"
+
+// AtomicConfig is a Config that can be replaced while the loggers using it
+// are in use, for example when the configuration is reloaded.
+type AtomicConfig struct {
+	defaultConfig Config
+	config        atomic.Pointer[Config]
+}
+
+// compile-time assertion that AtomicConfig implements Config.
+var _ Config = &AtomicConfig{}
+
+// NewAtomicConfig returns a new AtomicConfig which uses defaultConfig until
+// another Config is stored.
+func NewAtomicConfig(defaultConfig Config) *AtomicConfig {
+	c := &AtomicConfig{
+		defaultConfig: defaultConfig,
+		config:        atomic.Pointer[Config]{},
+	}
+
+	c.Store(nil)
+
+	return c
+}
+
+// Store replaces the current Config. The default Config will be used when
+// config is nil.
+func (c *AtomicConfig) Store(config Config) {
+	if config == nil {
+		config = c.defaultConfig
+	}
+
+	c.config.Store(&config)
+}
+
+// Load returns the current Config.
+func (c *AtomicConfig) Load() Config {
+	return *c.config.Load()
+}
+
+// LevelForNamespace implements Config.
+func (c *AtomicConfig) LevelForNamespace(namespace string) Level {
+	return c.Load().LevelForNamespace(namespace)
+}
@@ -0,0 +1,38 @@
+package logger_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAtomicConfig(t *testing.T) {
+	t.Parallel()
+
+	config := logger.NewAtomicConfig(logger.LevelInfo)
+
+	var buf bytes.Buffer
+
+	log := logger.New().
+		WithConfig(config).
+		WithWriter(&buf).
+		WithNamespaceAppended("test")
+
+	log.Debug("hidden", nil)
+	assert.Equal(t, "", buf.String())
+
+	config.Store(logger.NewConfigFromString("test:debug"))
+
+	log.Debug("visible", nil)
+	assert.Contains(t, buf.String(), "visible")
+
+	buf.Reset()
+
+	config.Store(nil)
+
+	log.Debug("hidden", nil)
+	assert.Equal(t, "", buf.String())
+	assert.Equal(t, logger.LevelInfo, config.Load())
+}
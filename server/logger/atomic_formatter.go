@@ -0,0 +1,39 @@
+package logger
+
+import "sync/atomic"
+
+// AtomicFormatter is a Formatter that can be replaced while the loggers using
+// it are in use, for example when the output format is read from the config.
+type AtomicFormatter struct {
+	formatter atomic.Pointer[Formatter]
+}
+
+// compile-time assertion that AtomicFormatter implements Formatter.
+var _ Formatter = &AtomicFormatter{}
+
+// NewAtomicFormatter returns a new AtomicFormatter which uses formatter
+// until another Formatter is stored.
+func NewAtomicFormatter(formatter Formatter) *AtomicFormatter {
+	f := &AtomicFormatter{
+		formatter: atomic.Pointer[Formatter]{},
+	}
+
+	f.Store(formatter)
+
+	return f
+}
+
+// Store replaces the current Formatter.
+func (f *AtomicFormatter) Store(formatter Formatter) {
+	f.formatter.Store(&formatter)
+}
+
+// Load returns the current Formatter.
+func (f *AtomicFormatter) Load() Formatter {
+	return *f.formatter.Load()
+}
+
+// Format implements Formatter.
+func (f *AtomicFormatter) Format(message Message) ([]byte, error) {
+	return f.Load().Format(message)
+}
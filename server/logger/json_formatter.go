@@ -0,0 +1,145 @@
+package logger
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// JSONFormatter formats each message as a single line JSON object, for
+// example for log pipelines which index the fields.
+type JSONFormatter struct {
+	params *JSONFormatterParams
+}
+
+// JSONFormatterParams are parameters for JSONFormatter.
+type JSONFormatterParams struct {
+	// DateLayout is the layout to be passed to time.Time.Format function for
+	// formatting logging timestamp.
+	DateLayout string
+}
+
+// compile-time assertion that JSONFormatter implements Formatter.
+var _ Formatter = &JSONFormatter{}
+
+// Keys of the fields written for every message. Context fields with the same
+// keys are written with the jsonCtxKeyPrefix.
+const (
+	jsonKeyTimestamp  = "ts"
+	jsonKeyLevel      = "level"
+	jsonKeyNamespace  = "namespace"
+	jsonKeyMessage    = "msg"
+	jsonKeyError      = "error"
+	jsonKeyErrorTrace = "error_trace"
+
+	jsonCtxKeyPrefix = "ctx_"
+)
+
+// NewJSONFormatter creates a new instance of JSONFormatter.
+func NewJSONFormatter(params JSONFormatterParams) *JSONFormatter {
+	if params.DateLayout == "" {
+		params.DateLayout = "2006-01-02T15:04:05.000000Z07:00"
+	}
+
+	return &JSONFormatter{
+		params: &params,
+	}
+}
+
+// Format implements Formatter. The context fields are sorted by key and
+// written after the message fields.
+func (f *JSONFormatter) Format(message Message) ([]byte, error) {
+	fields := make([]jsonField, 0, 6+len(message.Ctx))
+
+	fields = append(fields,
+		jsonField{jsonKeyTimestamp, message.Timestamp.Format(f.params.DateLayout)},
+		jsonField{jsonKeyLevel, message.Level.String()},
+		jsonField{jsonKeyNamespace, message.Namespace},
+		jsonField{jsonKeyMessage, strings.TrimRight(message.Body, "\n")},
+	)
+
+	if message.Err != nil {
+		fields = append(fields,
+			jsonField{jsonKeyError, message.Err.Error()},
+			jsonField{jsonKeyErrorTrace, fmt.Sprintf("%+v", message.Err)},
+		)
+	}
+
+	keys := make([]string, 0, len(message.Ctx))
+
+	for k := range message.Ctx {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		key := k
+
+		switch k {
+		case jsonKeyTimestamp, jsonKeyLevel, jsonKeyNamespace, jsonKeyMessage, jsonKeyError, jsonKeyErrorTrace:
+			key = jsonCtxKeyPrefix + k
+		}
+
+		fields = append(fields, jsonField{key, message.Ctx[k]})
+	}
+
+	var b bytes.Buffer
+
+	b.WriteString("{")
+
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString(",")
+		}
+
+		k, err := json.Marshal(field.key)
+		if err != nil {
+			return nil, fmt.Errorf("marshal key %q: %w", field.key, err)
+		}
+
+		v, err := json.Marshal(jsonValue(field.value))
+		if err != nil {
+			// The value might contain unsupported types, like channels.
+			v, _ = json.Marshal(fmt.Sprintf("%+v", field.value))
+		}
+
+		b.Write(k)
+		b.WriteString(":")
+		b.Write(v)
+	}
+
+	b.WriteString("}\n")
+
+	return b.Bytes(), nil
+}
+
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+// jsonValue converts the context values which do not have a useful JSON
+// representation. Errors and types implementing fmt.Stringer, like
+// addresses and durations, are written as strings. Other values keep their
+// types.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return v
+	case json.Marshaler, encoding.TextMarshaler:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
@@ -0,0 +1,88 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONFormatter(t *testing.T) {
+	t.Parallel()
+
+	formatter := logger.NewJSONFormatter(logger.JSONFormatterParams{
+		DateLayout: time.RFC3339,
+	})
+
+	testErr := errors.Annotate(errors.New("test err"), "annotated")
+
+	b, err := formatter.Format(logger.Message{
+		Timestamp: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		Namespace: "main:sdp",
+		Level:     logger.LevelError,
+		Body:      "Test message\n",
+		Err:       testErr,
+		Ctx: logger.Ctx{
+			"local_addr": &net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: 3000},
+			"count":      3,
+			"ok":         true,
+			"timeout":    time.Second,
+			"level":      "overridden",
+			"ch":         make(chan struct{}),
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, byte('\n'), b[len(b)-1])
+
+	var fields map[string]interface{}
+
+	require.NoError(t, json.Unmarshal(b, &fields))
+
+	assert.Contains(t, fields["error_trace"], "json_formatter_test.go")
+	delete(fields, "error_trace")
+	assert.NotEmpty(t, fields["ch"])
+	delete(fields, "ch")
+
+	assert.Equal(t, map[string]interface{}{
+		"ts":         "2021-01-02T03:04:05Z",
+		"level":      "error",
+		"namespace":  "main:sdp",
+		"msg":        "Test message",
+		"error":      "annotated: test err",
+		"local_addr": "127.0.0.1:3000",
+		"count":      float64(3),
+		"ok":         true,
+		"timeout":    "1s",
+		"ctx_level":  "overridden",
+	}, fields)
+}
+
+func TestAtomicFormatter(t *testing.T) {
+	t.Parallel()
+
+	formatter := logger.NewAtomicFormatter(logger.NewStringFormatter(logger.StringFormatterParams{}))
+
+	var buf bytes.Buffer
+
+	log := logger.New().
+		WithConfig(logger.LevelInfo).
+		WithFormatter(formatter).
+		WithWriter(&buf)
+
+	log.Info("text", nil)
+	assert.Contains(t, buf.String(), " info ")
+
+	buf.Reset()
+
+	formatter.Store(logger.NewJSONFormatter(logger.JSONFormatterParams{}))
+
+	log.Error("json", errors.New("test err"), nil)
+	assert.Contains(t, buf.String(), `"msg":"json","error":"test err"`)
+}
@@ -180,43 +180,35 @@ func (l *logger) Level() Level {
 
 // Trace implements Logger.
 func (l *logger) Trace(message string, ctx Ctx) (int, error) {
-	i, err := l.log(time.Now(), LevelTrace, message, ctx)
+	i, err := l.log(time.Now(), LevelTrace, message, nil, ctx)
 
 	return i, err
 }
 
 // Debug implements Logger.
 func (l *logger) Debug(message string, ctx Ctx) (int, error) {
-	i, err := l.log(time.Now(), LevelDebug, message, ctx)
+	i, err := l.log(time.Now(), LevelDebug, message, nil, ctx)
 
 	return i, err
 }
 
 // Info implements Logger.
 func (l *logger) Info(message string, ctx Ctx) (int, error) {
-	i, err := l.log(time.Now(), LevelInfo, message, ctx)
+	i, err := l.log(time.Now(), LevelInfo, message, nil, ctx)
 
 	return i, err
 }
 
 // Warn implements Logger.
 func (l *logger) Warn(message string, ctx Ctx) (int, error) {
-	i, err := l.log(time.Now(), LevelWarn, message, ctx)
+	i, err := l.log(time.Now(), LevelWarn, message, nil, ctx)
 
 	return i, err
 }
 
 // Error implements Logger.
 func (l *logger) Error(message string, err error, ctx Ctx) (int, error) {
-	if err != nil {
-		if message != "" {
-			message = fmt.Sprintf("%s: %+v", message, err)
-		} else {
-			message = fmt.Sprintf("%+v", err)
-		}
-	}
-
-	i, err := l.log(time.Now(), LevelError, message, ctx)
+	i, err := l.log(time.Now(), LevelError, message, err, ctx)
 
 	return i, err
 }
@@ -228,7 +220,7 @@ func (l *logger) IsLevelEnabled(level Level) bool {
 	return configuredLevel > 0 && level <= configuredLevel
 }
 
-func (l *logger) log(ts time.Time, level Level, message string, ctx Ctx) (int, error) {
+func (l *logger) log(ts time.Time, level Level, message string, msgErr error, ctx Ctx) (int, error) {
 	if !l.IsLevelEnabled(level) {
 		return 0, nil
 	}
@@ -238,6 +230,7 @@ func (l *logger) log(ts time.Time, level Level, message string, ctx Ctx) (int, e
 		Namespace: l.namespace,
 		Level:     level,
 		Body:      message,
+		Err:       msgErr,
 		Ctx:       l.ctx.WithCtx(ctx),
 	})
 	if err != nil {
@@ -1,6 +1,10 @@
 package logger
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 type Message struct {
 	// Timestamp contains the time of the message.
@@ -15,6 +19,26 @@ type Message struct {
 	// Body has the message contents.
 	Body string
 
+	// Err is the error logged with the message, if any.
+	Err error
+
 	// Ctx is the message context.
 	Ctx Ctx
 }
+
+// Text returns the body followed by the error with its stack trace, if any.
+// Formatters which do not write the error separately should use it instead
+// of Body.
+func (m Message) Text() string {
+	body := strings.TrimRight(m.Body, "\n")
+
+	if m.Err == nil {
+		return body
+	}
+
+	if body == "" {
+		return fmt.Sprintf("%+v", m.Err)
+	}
+
+	return fmt.Sprintf("%s: %+v", body, m.Err)
+}
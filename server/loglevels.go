@@ -0,0 +1,207 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+)
+
+const (
+	defaultLogLevelsTTL = 10 * time.Minute
+	maxLogLevelsTTL     = 24 * time.Hour
+)
+
+var (
+	ErrLogLevelsEmpty = errors.New("log levels are empty")
+	ErrLogLevelsTTL   = errors.Errorf("log levels ttl exceeds %s", maxLogLevelsTTL)
+)
+
+type LogLevelsParams struct {
+	Log logger.Logger
+	// LogConfig receives the active log levels.
+	LogConfig *logger.AtomicConfig
+	// Clock is used for reverting the overridden levels.
+	Clock clock.Clock
+	// Config contains the log levels from the server config, in the format
+	// read by logger.NewConfigFromString.
+	Config string
+}
+
+// LogLevels contains the log levels used by the server. The levels from the
+// server config can be temporarily overridden at runtime, for example to
+// enable trace logs while debugging a live incident.
+type LogLevels struct {
+	params *LogLevelsParams
+
+	mu sync.Mutex
+	// config contains the levels from the server config.
+	config string
+	// override contains the levels that replace the config until expiresAt.
+	override  string
+	expiresAt time.Time
+	// cancelRevert stops the pending revert of the override.
+	cancelRevert chan struct{}
+}
+
+// LogLevelsState describes the active log levels.
+type LogLevelsState struct {
+	// Config contains the active log levels.
+	Config string `json:"config"`
+	// Default contains the log levels from the server config which will be
+	// used once the override expires.
+	Default string `json:"default"`
+	// ExpiresAt is set when the active levels are overridden.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+func NewLogLevels(params LogLevelsParams) *LogLevels {
+	params.Log = params.Log.WithNamespaceAppended("log_levels")
+
+	l := &LogLevels{
+		params: &params,
+
+		mu:           sync.Mutex{},
+		config:       params.Config,
+		override:     "",
+		expiresAt:    time.Time{},
+		cancelRevert: nil,
+	}
+
+	l.params.LogConfig.Store(logger.NewConfigFromString(params.Config))
+
+	return l
+}
+
+// SetConfig replaces the levels from the server config. They are only
+// applied when the levels are not overridden.
+func (l *LogLevels) SetConfig(config string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.config = config
+
+	if l.cancelRevert == nil {
+		l.params.LogConfig.Store(logger.NewConfigFromString(config))
+	}
+}
+
+// Override replaces the active levels for ttl, after which the levels from
+// the server config are restored. The default TTL is used when ttl is zero.
+func (l *LogLevels) Override(config string, ttl time.Duration) (LogLevelsState, error) {
+	if config == "" {
+		return LogLevelsState{}, errors.Trace(ErrLogLevelsEmpty)
+	}
+
+	if ttl <= 0 {
+		ttl = defaultLogLevelsTTL
+	}
+
+	if ttl > maxLogLevelsTTL {
+		return LogLevelsState{}, errors.Trace(ErrLogLevelsTTL)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stopRevert()
+
+	cancelRevert := make(chan struct{})
+	timer := l.params.Clock.NewTimer(ttl)
+
+	l.override = config
+	l.expiresAt = l.params.Clock.Now().Add(ttl)
+	l.cancelRevert = cancelRevert
+
+	l.params.LogConfig.Store(logger.NewConfigFromString(config))
+
+	l.params.Log.Info("Log levels overridden", logger.Ctx{
+		"config":     config,
+		"expires_at": l.expiresAt,
+	})
+
+	go func() {
+		defer timer.Stop()
+
+		select {
+		case <-timer.C():
+			l.revert(cancelRevert)
+		case <-cancelRevert:
+		}
+	}()
+
+	return l.state(), nil
+}
+
+// Reset restores the levels from the server config.
+func (l *LogLevels) Reset() LogLevelsState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stopRevert()
+
+	l.params.LogConfig.Store(logger.NewConfigFromString(l.config))
+
+	return l.state()
+}
+
+// State returns the active log levels.
+func (l *LogLevels) State() LogLevelsState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.state()
+}
+
+// revert restores the levels from the server config, unless the override
+// that scheduled the revert has since been replaced.
+func (l *LogLevels) revert(cancelRevert chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cancelRevert != cancelRevert {
+		return
+	}
+
+	l.cancelRevert = nil
+	l.override = ""
+	l.expiresAt = time.Time{}
+
+	l.params.LogConfig.Store(logger.NewConfigFromString(l.config))
+
+	l.params.Log.Info("Log levels override expired", logger.Ctx{
+		"config": l.config,
+	})
+}
+
+func (l *LogLevels) stopRevert() {
+	if l.cancelRevert == nil {
+		return
+	}
+
+	close(l.cancelRevert)
+
+	l.cancelRevert = nil
+	l.override = ""
+	l.expiresAt = time.Time{}
+}
+
+func (l *LogLevels) state() LogLevelsState {
+	if l.cancelRevert == nil {
+		return LogLevelsState{
+			Config:    l.config,
+			Default:   l.config,
+			ExpiresAt: nil,
+		}
+	}
+
+	expiresAt := l.expiresAt
+
+	return LogLevelsState{
+		Config:    l.override,
+		Default:   l.config,
+		ExpiresAt: &expiresAt,
+	}
+}
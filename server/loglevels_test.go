@@ -0,0 +1,79 @@
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLevels(t *testing.T) {
+	logConfig := logger.NewAtomicConfig(logger.LevelDisabled)
+	mockClock := clock.NewMock()
+
+	logLevels := server.NewLogLevels(server.LogLevelsParams{
+		Log:       test.NewLogger(),
+		LogConfig: logConfig,
+		Clock:     mockClock,
+		Config:    "**:info",
+	})
+
+	level := func() logger.Level {
+		return logConfig.LevelForNamespace("main:metadata_transport")
+	}
+
+	assert.Equal(t, logger.LevelInfo, level())
+	assert.Equal(t, server.LogLevelsState{
+		Config:    "**:info",
+		Default:   "**:info",
+		ExpiresAt: nil,
+	}, logLevels.State())
+
+	_, err := logLevels.Override("", 0)
+	assert.Equal(t, server.ErrLogLevelsEmpty, errors.Cause(err))
+
+	_, err = logLevels.Override("**:trace", 25*time.Hour)
+	assert.Equal(t, server.ErrLogLevelsTTL, errors.Cause(err))
+
+	state, err := logLevels.Override("**:metadata_transport:trace", time.Minute)
+	require.NoError(t, err)
+
+	expiresAt := mockClock.Now().Add(time.Minute)
+
+	assert.Equal(t, server.LogLevelsState{
+		Config:    "**:metadata_transport:trace",
+		Default:   "**:info",
+		ExpiresAt: &expiresAt,
+	}, state)
+	assert.Equal(t, logger.LevelTrace, level())
+
+	// The config from a reload is applied once the override expires.
+	logLevels.SetConfig("**:warn")
+	assert.Equal(t, logger.LevelTrace, level())
+
+	mockClock.Add(30 * time.Second)
+	assert.Equal(t, logger.LevelTrace, level())
+
+	mockClock.Add(30 * time.Second)
+
+	assert.Eventually(t, func() bool {
+		return level() == logger.LevelWarn
+	}, time.Second, time.Millisecond)
+
+	assert.Nil(t, logLevels.State().ExpiresAt)
+
+	_, err = logLevels.Override("**:trace", 0)
+	require.NoError(t, err)
+	assert.Equal(t, logger.LevelTrace, level())
+
+	state = logLevels.Reset()
+	assert.Equal(t, "**:warn", state.Config)
+	assert.Nil(t, state.ExpiresAt)
+	assert.Equal(t, logger.LevelWarn, level())
+}
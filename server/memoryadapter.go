@@ -2,6 +2,7 @@ package server
 
 import (
 	"sync"
+	"time"
 
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server/identifiers"
@@ -12,6 +13,14 @@ type MemoryAdapter struct {
 	clientsMu *sync.RWMutex
 	clients   map[identifiers.ClientID]ClientWriter
 	room      identifiers.RoomID
+
+	// history is dropped when the adapter is closed after the last client
+	// leaves the room.
+	historyMu sync.Mutex
+	history   []message.Chat
+
+	networkMu sync.Mutex
+	network   string
 }
 
 func NewMemoryAdapter(room identifiers.RoomID) *MemoryAdapter {
@@ -21,6 +30,10 @@ func NewMemoryAdapter(room identifiers.RoomID) *MemoryAdapter {
 		clientsMu: &clientsMu,
 		clients:   map[identifiers.ClientID]ClientWriter{},
 		room:      room,
+		historyMu: sync.Mutex{},
+		history:   nil,
+		networkMu: sync.Mutex{},
+		network:   "",
 	}
 }
 
@@ -109,6 +122,54 @@ func (m *MemoryAdapter) Size() (value int, err error) {
 	return
 }
 
+func (m *MemoryAdapter) AddChat(chat message.Chat, maxLen int, maxAge time.Duration) error {
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+
+	m.history = append(m.history, chat)
+
+	if maxAge > 0 {
+		minTimestamp := chat.Timestamp - maxAge.Milliseconds()
+
+		for len(m.history) > 0 && m.history[0].Timestamp < minTimestamp {
+			m.history = m.history[1:]
+		}
+	}
+
+	if len(m.history) > maxLen {
+		m.history = m.history[len(m.history)-maxLen:]
+	}
+
+	return nil
+}
+
+func (m *MemoryAdapter) ChatHistory() ([]message.Chat, error) {
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+
+	history := make([]message.Chat, len(m.history))
+	copy(history, m.history)
+
+	return history, nil
+}
+
+func (m *MemoryAdapter) Network() (string, error) {
+	m.networkMu.Lock()
+	defer m.networkMu.Unlock()
+
+	return m.network, nil
+}
+
+func (m *MemoryAdapter) SetNetwork(network string) (string, error) {
+	m.networkMu.Lock()
+	defer m.networkMu.Unlock()
+
+	prev := m.network
+	m.network = network
+
+	return prev, nil
+}
+
 // Send a message to all sockets
 func (m *MemoryAdapter) Broadcast(msg message.Message) error {
 	m.clientsMu.RLock()
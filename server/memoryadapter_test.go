@@ -4,6 +4,7 @@ import (
 	"context"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server"
@@ -149,3 +150,65 @@ func TestMemoryAdapter_Broadcast(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestMemoryAdapter_chatHistory(t *testing.T) {
+	adapter := server.NewMemoryAdapter(room)
+
+	chat := func(msg string, timestamp int64) message.Chat {
+		return message.Chat{
+			ClientID:  "a",
+			Nickname:  "nick",
+			Message:   msg,
+			Timestamp: timestamp,
+		}
+	}
+
+	assert.NoError(t, adapter.AddChat(chat("1", 1000), 2, 0))
+	assert.NoError(t, adapter.AddChat(chat("2", 2000), 2, 0))
+	assert.NoError(t, adapter.AddChat(chat("3", 3000), 2, 0))
+
+	history, err := adapter.ChatHistory()
+	assert.NoError(t, err)
+	assert.Equal(t, []message.Chat{chat("2", 2000), chat("3", 3000)}, history)
+
+	// The messages older than max age are removed.
+	assert.NoError(t, adapter.AddChat(chat("4", 5000), 2, 2*time.Second))
+
+	history, err = adapter.ChatHistory()
+	assert.NoError(t, err)
+	assert.Equal(t, []message.Chat{chat("3", 3000), chat("4", 5000)}, history)
+
+	assert.NoError(t, adapter.AddChat(chat("5", 8000), 2, 2*time.Second))
+
+	history, err = adapter.ChatHistory()
+	assert.NoError(t, err)
+	assert.Equal(t, []message.Chat{chat("5", 8000)}, history)
+}
+
+func TestMemoryAdapter_network(t *testing.T) {
+	adapter := server.NewMemoryAdapter(room)
+
+	network, err := adapter.Network()
+	assert.NoError(t, err)
+	assert.Equal(t, "", network)
+
+	prev, err := adapter.SetNetwork("sfu")
+	assert.NoError(t, err)
+	assert.Equal(t, "", prev)
+
+	prev, err = adapter.SetNetwork("sfu")
+	assert.NoError(t, err)
+	assert.Equal(t, "sfu", prev)
+
+	network, err = adapter.Network()
+	assert.NoError(t, err)
+	assert.Equal(t, "sfu", network)
+
+	prev, err = adapter.SetNetwork("")
+	assert.NoError(t, err)
+	assert.Equal(t, "sfu", prev)
+
+	network, err = adapter.Network()
+	assert.NoError(t, err)
+	assert.Equal(t, "", network)
+}
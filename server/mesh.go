@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server/identifiers"
@@ -31,70 +30,21 @@ func NewMeshHandler(log logger.Logger, wss *WSS) http.Handler {
 			return
 		}
 
-		roomID := websocketCtx.RoomID()
-		clientID := websocketCtx.ClientID()
-
 		// Just in case. I'm actually not sure if this is necessary since if the
 		// reading stops, it most likely means the connection has already been
 		// closed.
 		defer websocketCtx.Close(websocket.StatusNormalClosure, "")
 
-		adapter := websocketCtx.Adapter()
-
-		pinger := NewPinger(ctx, 5*time.Second, func() {
-			adapter.Emit(clientID, message.NewPing(roomID))
-		})
+		socketHandler := newMeshSocketHandler(
+			log,
+			websocketCtx,
+			websocketCtx.StartHeartbeat(ctx),
+			websocketCtx.StartChat(),
+		)
 
 		for msg := range websocketCtx.Messages() {
-			log = log.WithCtx(logger.Ctx{
-				"client_id": clientID,
-				"room_id":   roomID,
-			})
-
-			var err error
-
-			switch msg.Type {
-			case message.TypeHangUp:
-				log.Info("hangUp event", nil)
-				adapter.SetMetadata(clientID, "")
-			case message.TypeReady:
-				ready := *msg.Payload.Ready
-				adapter.SetMetadata(clientID, ready.Nickname)
-
-				clients, readyClientsErr := getReadyClients(adapter)
-				if readyClientsErr != nil {
-					log.Error("Retrieve clients", errors.Trace(err), nil)
-				}
-
-				log.Info(fmt.Sprintf("Got clients: %s", clients), nil)
-
-				err = adapter.Broadcast(
-					message.NewUsers(roomID, message.Users{
-						Initiator: clientID,
-						PeerIDs:   clientsToPeerIDs(clients),
-						Nicknames: clients,
-					}),
-				)
-				err = errors.Annotatef(err, "ready broadcast")
-			case message.TypeSignal:
-				signal := *msg.Payload.Signal
-
-				targetClientID := signal.PeerID
-
-				log.Info("Send signal to", logger.Ctx{
-					"target_client_id": targetClientID,
-				})
-				err = adapter.Emit(targetClientID, message.NewSignal(roomID, message.UserSignal{
-					Signal: signal.Signal,
-					PeerID: clientID,
-				}))
-				err = errors.Annotatef(err, "signal emit")
-			case message.TypePong:
-				pinger.ReceivePong()
-			}
-
-			if err != nil {
-				log.Error("Send event", errors.Trace(err), nil)
+			if err := socketHandler.HandleMessage(msg); err != nil {
+				socketHandler.log.Error("Send event", errors.Trace(err), nil)
 			}
 		}
 	}
@@ -102,6 +52,109 @@ func NewMeshHandler(log logger.Logger, wss *WSS) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// meshSocketHandler relays the signals of a client to the other clients in
+// the mesh room.
+type meshSocketHandler struct {
+	log      logger.Logger
+	adapter  Adapter
+	roomID   identifiers.RoomID
+	clientID identifiers.ClientID
+	pinger   *Pinger
+	chat     *Chat
+}
+
+func newMeshSocketHandler(
+	log logger.Logger,
+	websocketCtx *WebsocketContext,
+	pinger *Pinger,
+	chat *Chat,
+) *meshSocketHandler {
+	roomID := websocketCtx.RoomID()
+	clientID := websocketCtx.ClientID()
+
+	return &meshSocketHandler{
+		log: log.WithCtx(logger.Ctx{
+			"client_id": clientID,
+			"room_id":   roomID,
+		}),
+		adapter:  websocketCtx.Adapter(),
+		roomID:   roomID,
+		clientID: clientID,
+		pinger:   pinger,
+		chat:     chat,
+	}
+}
+
+// HandleMessage handles a message from the client and replies with an Error
+// when it fails, or with an Ack when the message has a RequestID.
+func (mh *meshSocketHandler) HandleMessage(msg message.Message) error {
+	err := mh.handleMessage(msg)
+
+	if reply, ok := newReply(msg, err); ok {
+		if err := mh.adapter.Emit(mh.clientID, reply); err != nil {
+			mh.log.Error("Emit reply", errors.Trace(err), nil)
+		}
+	}
+
+	return errors.Trace(err)
+}
+
+func (mh *meshSocketHandler) handleMessage(msg message.Message) error {
+	log := mh.log
+	adapter := mh.adapter
+	roomID := mh.roomID
+	clientID := mh.clientID
+
+	var err error
+
+	switch msg.Type {
+	case message.TypeHangUp:
+		log.Info("hangUp event", nil)
+		adapter.SetMetadata(clientID, "")
+	case message.TypeReady:
+		ready := *msg.Payload.Ready
+		adapter.SetMetadata(clientID, ready.Nickname)
+
+		clients, readyClientsErr := getReadyClients(adapter)
+		if readyClientsErr != nil {
+			log.Error("Retrieve clients", errors.Trace(readyClientsErr), nil)
+		}
+
+		log.Info(fmt.Sprintf("Got clients: %s", clients), nil)
+
+		err = adapter.Broadcast(
+			message.NewUsers(roomID, message.Users{
+				Initiator: clientID,
+				PeerIDs:   clientsToPeerIDs(clients),
+				Nicknames: clients,
+			}),
+		)
+		err = errors.Annotatef(err, "ready broadcast")
+	case message.TypeSignal:
+		signal := *msg.Payload.Signal
+
+		targetClientID := signal.PeerID
+
+		log.Info("Send signal to", logger.Ctx{
+			"target_client_id": targetClientID,
+		})
+		err = adapter.Emit(targetClientID, message.NewSignal(roomID, message.UserSignal{
+			Signal: signal.Signal,
+			PeerID: clientID,
+		}))
+		err = errors.Annotatef(err, "signal emit")
+	case message.TypeChat:
+		err = errors.Trace(mh.chat.HandleChat(*msg.Payload.Chat))
+	case message.TypePing:
+	case message.TypePong:
+		mh.pinger.ReceivePong()
+	default:
+		err = errors.Annotatef(ErrUnexpectedMessage, "unhandled event: %+v", msg)
+	}
+
+	return errors.Trace(err)
+}
+
 func getReadyClients(adapter Adapter) (map[identifiers.ClientID]string, error) {
 	filteredClients := map[identifiers.ClientID]string{}
 	clients, err := adapter.Clients()
@@ -53,6 +53,10 @@ func (r *MockRoomManager) Exit(room identifiers.RoomID) bool {
 	return false
 }
 
+func (r *MockRoomManager) Get(room identifiers.RoomID) (server.Adapter, bool) {
+	return &MockAdapter{room: room, emit: r.emit, broadcast: r.broadcast}, true
+}
+
 func (r *MockRoomManager) close() {
 	close(r.enter)
 	close(r.exit)
@@ -95,6 +99,22 @@ func (m *MockAdapter) Size() (int, error) {
 	return 0, nil
 }
 
+func (m *MockAdapter) AddChat(chat message.Chat, maxLen int, maxAge time.Duration) error {
+	return nil
+}
+
+func (m *MockAdapter) ChatHistory() ([]message.Chat, error) {
+	return nil, nil
+}
+
+func (m *MockAdapter) Network() (string, error) {
+	return "", nil
+}
+
+func (m *MockAdapter) SetNetwork(network string) (string, error) {
+	return "", nil
+}
+
 func (m *MockAdapter) Metadata(clientID identifiers.ClientID) (string, bool) {
 	return "", true
 }
@@ -137,8 +157,15 @@ func mustReadWS(t *testing.T, ctx context.Context, ws *websocket.Conn) message.M
 }
 
 func setupMeshServer(rooms server.RoomManager) (s *httptest.Server, url string) {
+	return setupMeshServerWithParams(server.WSSParams{Rooms: rooms})
+}
+
+// setupMeshServerWithParams sets the logger and the drain of params.
+func setupMeshServerWithParams(params server.WSSParams) (s *httptest.Server, url string) {
 	log := logger.New()
-	handler := server.NewMeshHandler(log, server.NewWSS(log, rooms))
+	params.Log = log
+	params.Drain = server.NewDrain(log, server.DrainConfig{})
+	handler := server.NewMeshHandler(log, server.NewWSS(params))
 	s = httptest.NewServer(handler)
 	url = "ws" + strings.TrimPrefix(s.URL, "http") + "/ws/" + roomName.String() + "/" + clientID.String()
 	return
@@ -223,3 +250,169 @@ func TestMesh_event_signal(t *testing.T) {
 	assert.Equal(t, signal, emit.message.Payload.Signal.Signal)
 	assert.Equal(t, clientID, emit.message.Payload.Signal.PeerID)
 }
+
+func TestMesh_subprotocol_cbor(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	rooms := NewMockRoomManager()
+	defer rooms.close()
+	srv, url := setupMeshServer(rooms)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ws, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{
+		Subprotocols: []string{server.SubprotocolCBOR},
+	})
+	require.NoError(t, err)
+	defer func() { <-rooms.exit }()
+	defer ws.Close(websocket.StatusGoingAway, "")
+	assert.Equal(t, server.SubprotocolCBOR, ws.Subprotocol())
+
+	otherClientID := identifiers.ClientID("other-user")
+
+	data, err := server.CBORSerializer{}.Serialize(message.NewSignal("test-room", message.UserSignal{
+		PeerID: otherClientID,
+		Signal: message.Signal{
+			Type: message.SignalTypeOffer,
+			SDP:  "-sdp-",
+		},
+	}))
+	require.NoError(t, err)
+	err = ws.Write(ctx, websocket.MessageBinary, data)
+	require.NoError(t, err)
+
+	emit, ok := <-rooms.emit
+	require.True(t, ok, "rooms.emit channel is closed")
+	assert.Equal(t, emit.clientID, otherClientID)
+	require.NotNil(t, emit.message.Payload.Signal)
+	assert.Equal(t, "-sdp-", emit.message.Payload.Signal.Signal.SDP)
+}
+
+func TestMesh_reply(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	rooms := NewMockRoomManager()
+	defer rooms.close()
+	srv, url := setupMeshServer(rooms)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ws := mustDialWS(t, ctx, url)
+	defer func() { <-rooms.exit }()
+	defer ws.Close(websocket.StatusGoingAway, "")
+
+	ready := message.NewReady("test-room", message.Ready{
+		Nickname: "abc",
+	})
+	ready.RequestID = "1"
+
+	mustWriteWS(t, ctx, ws, ready)
+	<-rooms.broadcast
+
+	emit := <-rooms.emit
+	assert.Equal(t, clientID, emit.clientID)
+	assert.Equal(t, message.NewAck("test-room", "1"), emit.message)
+
+	// Mesh clients do not subscribe to tracks.
+	mustWriteWS(t, ctx, ws, message.NewSubTrack("test-room", message.SubTrack{
+		TrackID:     identifiers.TrackID{ID: "track", StreamID: "stream"},
+		PubClientID: clientID2,
+		Type:        0,
+	}))
+
+	emit = <-rooms.emit
+	assert.Equal(t, clientID, emit.clientID)
+	assert.Equal(t, message.TypeError, emit.message.Type)
+	assert.Equal(t, "", emit.message.RequestID)
+	require.NotNil(t, emit.message.Payload.Error)
+	assert.Equal(t, message.ErrorCodeUnexpectedMessage, emit.message.Payload.Error.Code)
+	assert.Equal(t, message.TypeSubTrack, emit.message.Payload.Error.RequestType)
+}
+
+func TestMesh_pongTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	rooms := NewMockRoomManager()
+	defer rooms.close()
+	srv, url := setupMeshServerWithParams(server.WSSParams{
+		Rooms: rooms,
+		Heartbeat: server.HeartbeatConfig{
+			Interval: 10 * time.Millisecond,
+			Timeout:  30 * time.Millisecond,
+		},
+	})
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ws := mustDialWS(t, ctx, url)
+	defer ws.Close(websocket.StatusGoingAway, "")
+
+	emit := <-rooms.emit
+	assert.Equal(t, message.TypePing, emit.message.Type)
+
+	// The client never responds with a pong.
+	_, _, err := ws.Read(ctx)
+	assert.Equal(t, server.StatusPongTimeout, websocket.CloseStatus(err))
+
+	<-rooms.exit
+}
+
+func TestMesh_limits(t *testing.T) {
+	type testCase struct {
+		descr      string
+		limits     server.LimitsConfig
+		secondRoom identifiers.RoomID
+		wantError  string
+	}
+
+	testCases := []testCase{
+		{
+			descr:      "room full",
+			limits:     server.LimitsConfig{MaxClientsPerRoom: 1},
+			secondRoom: roomName,
+			wantError:  "room is full",
+		},
+		{
+			descr:      "too many rooms",
+			limits:     server.LimitsConfig{MaxRooms: 1},
+			secondRoom: "test-room-2",
+			wantError:  "too many rooms",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.descr, func(t *testing.T) {
+			defer goleak.VerifyNone(t)
+			rooms := NewMockRoomManager()
+			defer rooms.close()
+			srv, url := setupMeshServerWithParams(server.WSSParams{
+				Rooms:  rooms,
+				Limits: tc.limits,
+			})
+			defer srv.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			ws := mustDialWS(t, ctx, url)
+			defer func() { <-rooms.exit }()
+			defer ws.Close(websocket.StatusGoingAway, "")
+			<-rooms.enter
+
+			url2 := strings.Replace(url, "/"+roomName.String()+"/"+clientID.String(), "/"+tc.secondRoom.String()+"/"+clientID2.String(), 1)
+			ws2 := mustDialWS(t, ctx, url2)
+			defer ws2.Close(websocket.StatusGoingAway, "")
+
+			msg := mustReadWS(t, ctx, ws2)
+			assert.Equal(t, message.NewError(tc.secondRoom, "", message.Error{
+				Code:        message.ErrorCodeQuotaExceeded,
+				Message:     tc.wantError,
+				RequestType: "",
+			}), msg)
+
+			_, _, err := ws2.Read(ctx)
+			assert.Equal(t, websocket.StatusTryAgainLater, websocket.CloseStatus(err))
+
+			assert.Equal(t, tc.secondRoom, <-rooms.enter)
+			assert.Equal(t, tc.secondRoom, <-rooms.exit)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package message
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+)
+
+// CBOR is the compact binary counterpart of JSON. The envelope is encoded as
+// an array instead of a map so the field names are not repeated in every
+// message. The payload fields keep the names from their json tags.
+type CBOR struct {
+	_ struct{} `cbor:",toarray"`
+
+	Type Type
+	// Room this message is related to
+	Room identifiers.RoomID
+	// RequestID is set by the client to correlate the response.
+	RequestID string
+	// Payload content
+	Payload cbor.RawMessage
+	// TraceContext contains the tracing span of the sender.
+	TraceContext map[string]string
+}
+
+func (m Message) MarshalCBOR() ([]byte, error) {
+	value, err := m.payloadValue()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	payload, err := cbor.Marshal(value)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	c := CBOR{
+		Type:         m.Type,
+		Room:         m.Room,
+		RequestID:    m.RequestID,
+		Payload:      cbor.RawMessage(payload),
+		TraceContext: m.TraceContext,
+	}
+
+	b, err := cbor.Marshal(c)
+
+	return b, errors.Annotatef(err, "message: %+v", m)
+}
+
+func (m *Message) UnmarshalCBOR(b []byte) error {
+	var c CBOR
+
+	err := cbor.Unmarshal(b, &c)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	m.Room = c.Room
+	m.Type = c.Type
+	m.RequestID = c.RequestID
+	m.TraceContext = c.TraceContext
+
+	value, err := m.initPayload()
+	if err == nil && value != nil {
+		err = cbor.Unmarshal(c.Payload, value)
+		err = errors.Trace(err)
+	}
+
+	return errors.Annotatef(err, "payload: %x", []byte(c.Payload))
+}
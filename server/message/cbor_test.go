@@ -0,0 +1,58 @@
+package message_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/peer-calls/peer-calls/v4/server/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessage_CBOR(t *testing.T) {
+	for _, m := range testMessages() {
+		b, err := cbor.Marshal(m)
+		assert.NoError(t, err, "marshal message: %+v", m)
+
+		var m2 message.Message
+
+		err = cbor.Unmarshal(b, &m2)
+		assert.NoError(t, err, "unmarshal message: %x", b)
+
+		assert.Equal(t, m, m2, "messages are not equal")
+	}
+}
+
+func TestMessage_CBOR_unknownType(t *testing.T) {
+	_, err := cbor.Marshal(message.Message{
+		Type: "unknown",
+		Room: "test",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), message.ErrUnknownMessageType.Error())
+}
+
+func TestMessage_CBOR_size(t *testing.T) {
+	users := message.Users{
+		Initiator: "client-0",
+		PeerIDs:   nil,
+		Nicknames: map[identifiers.ClientID]string{},
+	}
+
+	for _, clientID := range []identifiers.ClientID{"client-0", "client-1", "client-2", "client-3"} {
+		users.PeerIDs = append(users.PeerIDs, clientID)
+		users.Nicknames[clientID] = "nickname"
+	}
+
+	m := message.NewUsers("test", users)
+
+	jsonData, err := json.Marshal(m)
+	require.NoError(t, err)
+
+	cborData, err := cbor.Marshal(m)
+	require.NoError(t, err)
+
+	assert.Less(t, len(cborData), len(jsonData))
+}
@@ -0,0 +1,66 @@
+package message
+
+import (
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+)
+
+// ErrorCode is a machine-readable reason of an Error.
+type ErrorCode string
+
+const (
+	// ErrorCodeInvalidMessage is used when the message content is invalid.
+	ErrorCodeInvalidMessage ErrorCode = "invalidMessage"
+	// ErrorCodeUnexpectedMessage is used when the message type is not handled,
+	// or when it is not expected in the current state, for example a second
+	// Ready.
+	ErrorCodeUnexpectedMessage ErrorCode = "unexpectedMessage"
+	// ErrorCodeNotFound is used when the message refers to a track, a
+	// subscription or a room that does not exist.
+	ErrorCodeNotFound ErrorCode = "notFound"
+	// ErrorCodeQuotaExceeded is used when the room or the node is full, or
+	// when a track is rejected because of the publishing limits.
+	ErrorCodeQuotaExceeded ErrorCode = "quotaExceeded"
+	// ErrorCodeForbidden is used when the client does not have the role
+	// required by the message, for example when a viewer tries to publish.
+	ErrorCodeForbidden ErrorCode = "forbidden"
+	// ErrorCodeInternal is used for all other errors.
+	ErrorCodeInternal ErrorCode = "internal"
+)
+
+// Ack is sent to the client after a message with a RequestID has been
+// handled successfully. The RequestID of the Ack is the same as the one of
+// the handled message.
+type Ack struct{}
+
+// Error is sent to the client when handling its message failed. The
+// RequestID of the Error is the same as the one of the failed message, so it
+// is empty when the client did not set it.
+type Error struct {
+	Code ErrorCode `json:"code"`
+	// Message is a human-readable description of the error.
+	Message string `json:"message"`
+	// RequestType is the type of the failed message.
+	RequestType Type `json:"requestType"`
+}
+
+func NewAck(roomID identifiers.RoomID, requestID string) Message {
+	return Message{
+		Type:      TypeAck,
+		Room:      roomID,
+		RequestID: requestID,
+		Payload: Payload{
+			Ack: &Ack{},
+		},
+	}
+}
+
+func NewError(roomID identifiers.RoomID, requestID string, payload Error) Message {
+	return Message{
+		Type:      TypeError,
+		Room:      roomID,
+		RequestID: requestID,
+		Payload: Payload{
+			Error: &payload,
+		},
+	}
+}
@@ -13,59 +13,31 @@ type JSON struct {
 	Type Type `json:"type"`
 	// Room this message is related to
 	Room identifiers.RoomID `json:"room"`
+	// RequestID is set by the client to correlate the response.
+	RequestID string `json:"requestId,omitempty"`
 	// Payload content
 	Payload json.RawMessage `json:"payload"`
+	// TraceContext contains the tracing span of the sender.
+	TraceContext map[string]string `json:"traceContext,omitempty"`
 }
 
 func (m Message) MarshalJSON() ([]byte, error) {
-	var (
-		payload []byte
-		err     error
-	)
-
-	switch m.Type {
-	case TypeHangUp:
-		payload, err = json.Marshal(m.Payload.HangUp)
-		err = errors.Trace(err)
-	case TypeReady:
-		payload, err = json.Marshal(m.Payload.Ready)
-		err = errors.Trace(err)
-	case TypeSignal:
-		payload, err = json.Marshal(m.Payload.Signal)
-		err = errors.Trace(err)
-	case TypePing:
-		payload, err = json.Marshal(m.Payload.Ping)
-		err = errors.Trace(err)
-	case TypePong:
-		payload, err = json.Marshal(m.Payload.Pong)
-		err = errors.Trace(err)
-	case TypePubTrack:
-		payload, err = json.Marshal(m.Payload.PubTrack)
-		err = errors.Trace(err)
-	case TypeSubTrack:
-		payload, err = json.Marshal(m.Payload.SubTrack)
-		err = errors.Trace(err)
-	case TypeRoomJoin:
-		payload, err = json.Marshal(m.Payload.RoomJoin)
-		err = errors.Trace(err)
-	case TypeRoomLeave:
-		payload, err = json.Marshal(m.Payload.RoomLeave)
-		err = errors.Trace(err)
-	case TypeUsers:
-		payload, err = json.Marshal(m.Payload.Users)
-		err = errors.Trace(err)
-	default:
-		err = errors.Annotatef(ErrUnknownMessageType, "message: %+v", m)
+	value, err := m.payloadValue()
+	if err != nil {
+		return nil, errors.Trace(err)
 	}
 
+	payload, err := json.Marshal(value)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
 	j := JSON{
-		Type:    m.Type,
-		Room:    m.Room,
-		Payload: json.RawMessage(payload),
+		Type:         m.Type,
+		Room:         m.Room,
+		RequestID:    m.RequestID,
+		Payload:      json.RawMessage(payload),
+		TraceContext: m.TraceContext,
 	}
 
 	b, err := json.Marshal(j)
@@ -83,45 +55,13 @@ func (m *Message) UnmarshalJSON(b []byte) error {
 
 	m.Room = j.Room
 	m.Type = j.Type
+	m.RequestID = j.RequestID
+	m.TraceContext = j.TraceContext
 
-	switch m.Type {
-	case TypeHangUp:
-		m.Payload.HangUp = &HangUp{}
-		err = json.Unmarshal(j.Payload, m.Payload.HangUp)
-		err = errors.Trace(err)
-	case TypeReady:
-		m.Payload.Ready = &Ready{}
-		err = json.Unmarshal(j.Payload, m.Payload.Ready)
-		err = errors.Trace(err)
-	case TypeSignal:
-		m.Payload.Signal = &UserSignal{}
-		err = json.Unmarshal(j.Payload, m.Payload.Signal)
-		err = errors.Trace(err)
-	case TypePing:
-		m.Payload.Ping = &Ping{}
-	case TypePong:
-		m.Payload.Pong = &Pong{}
-	case TypePubTrack:
-		m.Payload.PubTrack = &PubTrack{}
-		err = json.Unmarshal(j.Payload, m.Payload.PubTrack)
-		err = errors.Trace(err)
-	case TypeSubTrack:
-		m.Payload.SubTrack = &SubTrack{}
-		err = json.Unmarshal(j.Payload, m.Payload.SubTrack)
-		err = errors.Trace(err)
-	case TypeRoomJoin:
-		m.Payload.RoomJoin = &RoomJoin{}
-		err = json.Unmarshal(j.Payload, m.Payload.RoomJoin)
-		err = errors.Trace(err)
-	case TypeRoomLeave:
-		err = json.Unmarshal(j.Payload, &m.Payload.RoomLeave)
-		err = errors.Trace(err)
-	case TypeUsers:
-		m.Payload.Users = &Users{}
-		err = json.Unmarshal(j.Payload, m.Payload.Users)
+	value, err := m.initPayload()
+	if err == nil && value != nil {
+		err = json.Unmarshal(j.Payload, value)
 		err = errors.Trace(err)
-	default:
-		err = errors.Trace(ErrUnknownMessageType)
 	}
 
 	return errors.Annotatef(err, "payload: %s", j.Payload)
@@ -11,8 +11,9 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestMessage_JSON(t *testing.T) {
-	messages := []message.Message{
+// testMessages returns a message of each type, for the wire format tests.
+func testMessages() []message.Message {
+	return []message.Message{
 		{
 			Type: message.TypeHangUp,
 			Room: "test",
@@ -158,9 +159,87 @@ func TestMessage_JSON(t *testing.T) {
 				},
 			},
 		},
+		{
+			Type: message.TypeDrain,
+			Room: "test",
+			Payload: message.Payload{
+				Drain: &message.Drain{
+					URL: "https://node2.example.com",
+				},
+			},
+		},
+		message.NewPromote("test", message.Promote{
+			ClientID: "client123",
+		}),
+		message.NewRole("test", message.Role{
+			ClientID: "client123",
+			Role:     message.ClientRoleSpeaker,
+		}),
+		message.NewSwitchNetwork("test", message.SwitchNetwork{
+			Network: "sfu",
+		}),
+		message.NewChat("test", message.Chat{
+			ClientID:  "client123",
+			Nickname:  "nick",
+			Message:   "hello",
+			Timestamp: 1609556645000,
+		}),
+		message.NewChatHistory("test", message.ChatHistory{
+			Messages: []message.Chat{{
+				ClientID:  "client123",
+				Nickname:  "nick",
+				Message:   "hello",
+				Timestamp: 1609556645000,
+			}},
+		}),
+		message.NewBreakout("test", message.Breakout{
+			Room:   "test~group-1",
+			Parent: "test",
+			EndsAt: 1609556645000,
+			Clients: []identifiers.ClientID{
+				"client123",
+			},
+		}),
+		message.NewStartBreakout("test", message.StartBreakout{
+			Rooms: map[string][]identifiers.ClientID{
+				"group-1": {"client123"},
+			},
+			Duration: 900000,
+		}),
+		message.NewEndBreakout("test"),
+		message.NewAck("test", "1"),
+		message.NewError("test", "2", message.Error{
+			Code:        message.ErrorCodeNotFound,
+			Message:     "track not found",
+			RequestType: message.TypeSubTrack,
+		}),
+		{
+			Type:      message.TypeSubTrack,
+			Room:      "test",
+			RequestID: "3",
+			Payload: message.Payload{
+				SubTrack: &message.SubTrack{
+					TrackID:     identifiers.TrackID{ID: "123", StreamID: "456"},
+					PubClientID: identifiers.ClientID("client123"),
+					Type:        transport.TrackEventTypeSub,
+				},
+			},
+		},
+		{
+			Type: message.TypePing,
+			Room: "test",
+			Payload: message.Payload{
+				Ping: &message.Ping{},
+			},
+			TraceContext: map[string]string{
+				"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+			},
+		},
 	}
+}
 
-	for _, m := range messages {
+func TestMessage_JSON(t *testing.T) {
+	for _, m := range testMessages() {
 		b, err := json.Marshal(m)
 		assert.NoError(t, err, "marshal message: %+v", m)
 
@@ -11,8 +11,14 @@ type Message struct {
 	Type Type
 	// Room this message is related to
 	Room identifiers.RoomID
+	// RequestID is an optional ID set by the client. The Ack or Error sent in
+	// response to the message has the same RequestID.
+	RequestID string
 	// Payload content
 	Payload Payload
+	// TraceContext contains the tracing span of the sender when set. It is
+	// only sent between nodes, not to the clients.
+	TraceContext map[string]string
 }
 
 func NewPing(roomID identifiers.RoomID) Message {
@@ -95,6 +101,96 @@ func NewSubTrack(roomID identifiers.RoomID, payload SubTrack) Message {
 	}
 }
 
+func NewDrain(roomID identifiers.RoomID, payload Drain) Message {
+	return Message{
+		Type: TypeDrain,
+		Room: roomID,
+		Payload: Payload{
+			Drain: &payload,
+		},
+	}
+}
+
+func NewPromote(roomID identifiers.RoomID, payload Promote) Message {
+	return Message{
+		Type: TypePromote,
+		Room: roomID,
+		Payload: Payload{
+			Promote: &payload,
+		},
+	}
+}
+
+func NewRole(roomID identifiers.RoomID, payload Role) Message {
+	return Message{
+		Type: TypeRole,
+		Room: roomID,
+		Payload: Payload{
+			Role: &payload,
+		},
+	}
+}
+
+func NewSwitchNetwork(roomID identifiers.RoomID, payload SwitchNetwork) Message {
+	return Message{
+		Type: TypeSwitchNetwork,
+		Room: roomID,
+		Payload: Payload{
+			SwitchNetwork: &payload,
+		},
+	}
+}
+
+func NewChat(roomID identifiers.RoomID, payload Chat) Message {
+	return Message{
+		Type: TypeChat,
+		Room: roomID,
+		Payload: Payload{
+			Chat: &payload,
+		},
+	}
+}
+
+func NewChatHistory(roomID identifiers.RoomID, payload ChatHistory) Message {
+	return Message{
+		Type: TypeChatHistory,
+		Room: roomID,
+		Payload: Payload{
+			ChatHistory: &payload,
+		},
+	}
+}
+
+func NewBreakout(roomID identifiers.RoomID, payload Breakout) Message {
+	return Message{
+		Type: TypeBreakout,
+		Room: roomID,
+		Payload: Payload{
+			Breakout: &payload,
+		},
+	}
+}
+
+func NewStartBreakout(roomID identifiers.RoomID, payload StartBreakout) Message {
+	return Message{
+		Type: TypeStartBreakout,
+		Room: roomID,
+		Payload: Payload{
+			StartBreakout: &payload,
+		},
+	}
+}
+
+func NewEndBreakout(roomID identifiers.RoomID) Message {
+	return Message{
+		Type: TypeEndBreakout,
+		Room: roomID,
+		Payload: Payload{
+			EndBreakout: &EndBreakout{},
+		},
+	}
+}
+
 func NewSignal(roomID identifiers.RoomID, payload UserSignal) Message {
 	return Message{
 		Type: TypeSignal,
@@ -131,6 +227,44 @@ type Payload struct {
 	// Users is sent as a response to Ready.
 	// TODO use PubTrack instead.
 	Users *Users
+
+	// Drain is sent from the server to the client when the server is shutting
+	// down.
+	Drain *Drain
+
+	// Promote is sent from a presenter to the server to let a viewer publish
+	// tracks.
+	Promote *Promote
+	// Role is sent from the server to the clients in webinar rooms when a
+	// client becomes ready or is promoted.
+	Role *Role
+
+	// SwitchNetwork is sent from the server to the clients in a hybrid network
+	// when they connect and when the room switches between mesh and SFU.
+	SwitchNetwork *SwitchNetwork
+
+	// Chat is sent from the client to the server, which broadcasts it to the
+	// room.
+	Chat *Chat
+	// ChatHistory is sent from the server to the client when it connects.
+	ChatHistory *ChatHistory
+
+	// Breakout is sent from the server to the client when it is moved to a
+	// breakout room, or back to the parent room.
+	Breakout *Breakout
+	// StartBreakout is sent from a presenter to the server to move the
+	// clients of the room to breakout rooms.
+	StartBreakout *StartBreakout
+	// EndBreakout is sent from a presenter to the server to bring the clients
+	// back from the breakout rooms.
+	EndBreakout *EndBreakout
+
+	// Ack is sent from the server to the client in response to a message with
+	// a RequestID.
+	Ack *Ack
+	// Error is sent from the server to the client when handling its message
+	// failed.
+	Error *Error
 }
 
 type RoomJoin struct {
@@ -154,6 +288,23 @@ const (
 	TypeRoomLeave Type = "wsRoomLeave"
 
 	TypeUsers Type = "users"
+
+	TypeDrain Type = "drain"
+
+	TypePromote Type = "promote"
+	TypeRole    Type = "role"
+
+	TypeSwitchNetwork Type = "switchNetwork"
+
+	TypeChat        Type = "chat"
+	TypeChatHistory Type = "chatHistory"
+
+	TypeBreakout      Type = "breakout"
+	TypeStartBreakout Type = "startBreakout"
+	TypeEndBreakout   Type = "endBreakout"
+
+	TypeAck   Type = "ack"
+	TypeError Type = "error"
 )
 
 type HangUp struct {
@@ -164,6 +315,89 @@ type Ready struct {
 	Nickname string `json:"nickname"`
 }
 
+// Drain tells the client that the server is draining and that it should
+// reconnect, preferably to URL when set.
+type Drain struct {
+	URL string `json:"url"`
+}
+
+// ClientRole defines what a client can do in a webinar room.
+type ClientRole string
+
+const (
+	// ClientRolePresenter can publish tracks and promote the viewers.
+	ClientRolePresenter ClientRole = "presenter"
+	// ClientRoleSpeaker is a promoted viewer, which can publish tracks.
+	ClientRoleSpeaker ClientRole = "speaker"
+	// ClientRoleViewer can only subscribe to the tracks of others.
+	ClientRoleViewer ClientRole = "viewer"
+)
+
+// Promote asks the server to promote the viewer with ClientID to speaker.
+type Promote struct {
+	ClientID identifiers.ClientID `json:"peerId"`
+}
+
+// Role tells the clients in a webinar room the role of the client with
+// ClientID.
+type Role struct {
+	ClientID identifiers.ClientID `json:"peerId"`
+	Role     ClientRole           `json:"role"`
+}
+
+// SwitchNetwork tells the clients which network the room uses. The clients
+// must hang up and send Ready again when it changes.
+type SwitchNetwork struct {
+	// Network is either mesh or sfu.
+	Network string `json:"network"`
+}
+
+// Chat is a text message sent to everyone in the room. The client only sets
+// Message, the other fields are set by the server.
+type Chat struct {
+	ClientID identifiers.ClientID `json:"peerId"`
+	Nickname string               `json:"nickname"`
+	Message  string               `json:"message"`
+	// Timestamp is the unix time in milliseconds when the server received the
+	// message.
+	Timestamp int64 `json:"timestamp"`
+}
+
+// ChatHistory contains the stored chat messages of a room, oldest first.
+type ChatHistory struct {
+	Messages []Chat `json:"messages"`
+}
+
+// Breakout tells the client to reconnect to Room.
+type Breakout struct {
+	// Room is either a breakout room or the parent room.
+	Room identifiers.RoomID `json:"room"`
+	// Parent is the room the breakout rooms were created from.
+	Parent identifiers.RoomID `json:"parent"`
+	// EndsAt is the unix time in milliseconds when the client is moved back
+	// to the parent room. It is zero when moving back to the parent room.
+	EndsAt int64 `json:"endsAt"`
+	// Clients contains the clients which are moved, or all clients of the
+	// room when it is empty. It is removed before the message is written to
+	// the client.
+	Clients []identifiers.ClientID `json:"clients,omitempty"`
+}
+
+// StartBreakout asks the server to move the clients of the room to breakout
+// rooms.
+type StartBreakout struct {
+	// Rooms contains the clients moved to each breakout room, keyed by the
+	// name of the room.
+	Rooms map[string][]identifiers.ClientID `json:"rooms"`
+	// Duration is the time in milliseconds after which the clients are
+	// brought back to the room.
+	Duration int64 `json:"duration"`
+}
+
+// EndBreakout asks the server to bring the clients back from the breakout
+// rooms of the room.
+type EndBreakout struct{}
+
 type Ping struct{}
 
 type Pong struct{}
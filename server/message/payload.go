@@ -0,0 +1,128 @@
+package message
+
+import (
+	"github.com/juju/errors"
+)
+
+// payloadValue returns the Payload field that is set for the message type.
+// It is shared by the wire formats.
+func (m Message) payloadValue() (interface{}, error) {
+	switch m.Type {
+	case TypeHangUp:
+		return m.Payload.HangUp, nil
+	case TypeReady:
+		return m.Payload.Ready, nil
+	case TypeSignal:
+		return m.Payload.Signal, nil
+	case TypePing:
+		return m.Payload.Ping, nil
+	case TypePong:
+		return m.Payload.Pong, nil
+	case TypePubTrack:
+		return m.Payload.PubTrack, nil
+	case TypeSubTrack:
+		return m.Payload.SubTrack, nil
+	case TypeRoomJoin:
+		return m.Payload.RoomJoin, nil
+	case TypeRoomLeave:
+		return m.Payload.RoomLeave, nil
+	case TypeUsers:
+		return m.Payload.Users, nil
+	case TypeDrain:
+		return m.Payload.Drain, nil
+	case TypePromote:
+		return m.Payload.Promote, nil
+	case TypeRole:
+		return m.Payload.Role, nil
+	case TypeSwitchNetwork:
+		return m.Payload.SwitchNetwork, nil
+	case TypeChat:
+		return m.Payload.Chat, nil
+	case TypeChatHistory:
+		return m.Payload.ChatHistory, nil
+	case TypeBreakout:
+		return m.Payload.Breakout, nil
+	case TypeStartBreakout:
+		return m.Payload.StartBreakout, nil
+	case TypeEndBreakout:
+		return m.Payload.EndBreakout, nil
+	case TypeAck:
+		return m.Payload.Ack, nil
+	case TypeError:
+		return m.Payload.Error, nil
+	default:
+		return nil, errors.Annotatef(ErrUnknownMessageType, "message: %+v", m)
+	}
+}
+
+// initPayload sets the Payload field for the message type to a new value and
+// returns a pointer to it, for the payload to be decoded into. It returns nil
+// when the payload has no content to decode.
+func (m *Message) initPayload() (interface{}, error) {
+	switch m.Type {
+	case TypeHangUp:
+		m.Payload.HangUp = &HangUp{}
+		return m.Payload.HangUp, nil
+	case TypeReady:
+		m.Payload.Ready = &Ready{}
+		return m.Payload.Ready, nil
+	case TypeSignal:
+		m.Payload.Signal = &UserSignal{}
+		return m.Payload.Signal, nil
+	case TypePing:
+		m.Payload.Ping = &Ping{}
+		return nil, nil
+	case TypePong:
+		m.Payload.Pong = &Pong{}
+		return nil, nil
+	case TypePubTrack:
+		m.Payload.PubTrack = &PubTrack{}
+		return m.Payload.PubTrack, nil
+	case TypeSubTrack:
+		m.Payload.SubTrack = &SubTrack{}
+		return m.Payload.SubTrack, nil
+	case TypeRoomJoin:
+		m.Payload.RoomJoin = &RoomJoin{}
+		return m.Payload.RoomJoin, nil
+	case TypeRoomLeave:
+		return &m.Payload.RoomLeave, nil
+	case TypeUsers:
+		m.Payload.Users = &Users{}
+		return m.Payload.Users, nil
+	case TypeDrain:
+		m.Payload.Drain = &Drain{}
+		return m.Payload.Drain, nil
+	case TypePromote:
+		m.Payload.Promote = &Promote{}
+		return m.Payload.Promote, nil
+	case TypeRole:
+		m.Payload.Role = &Role{}
+		return m.Payload.Role, nil
+	case TypeSwitchNetwork:
+		m.Payload.SwitchNetwork = &SwitchNetwork{}
+		return m.Payload.SwitchNetwork, nil
+	case TypeChat:
+		m.Payload.Chat = &Chat{}
+		return m.Payload.Chat, nil
+	case TypeChatHistory:
+		m.Payload.ChatHistory = &ChatHistory{}
+		return m.Payload.ChatHistory, nil
+	case TypeBreakout:
+		m.Payload.Breakout = &Breakout{}
+		return m.Payload.Breakout, nil
+	case TypeStartBreakout:
+		m.Payload.StartBreakout = &StartBreakout{}
+		return m.Payload.StartBreakout, nil
+	case TypeEndBreakout:
+		m.Payload.EndBreakout = &EndBreakout{}
+		return nil, nil
+	case TypeAck:
+		m.Payload.Ack = &Ack{}
+		return nil, nil
+	case TypeError:
+		m.Payload.Error = &Error{}
+		return m.Payload.Error, nil
+	default:
+		return nil, errors.Trace(ErrUnknownMessageType)
+	}
+}
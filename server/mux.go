@@ -1,22 +1,30 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"io/fs"
 	"net/http"
 	"net/url"
 	"path"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
 	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/pubsub"
+	"github.com/peer-calls/peer-calls/v4/server/quota"
 	"github.com/peer-calls/peer-calls/v4/server/sfu"
 	"github.com/peer-calls/peer-calls/v4/server/transport"
 	"github.com/peer-calls/peer-calls/v4/server/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func buildManifest(baseURL string) []byte {
@@ -37,12 +45,44 @@ func buildManifest(baseURL string) []byte {
 }
 
 type Mux struct {
-	BaseURL                  string
-	handler                  *chi.Mux
-	iceServers               []ICEServer
-	network                  NetworkConfig
-	version                  string
-	encodedInsertableStreams bool
+	BaseURL string
+	handler *chi.Mux
+	network NetworkConfig
+	version string
+	drain   *Drain
+	health  *Health
+	tracks  TracksManager
+
+	logLevels *LogLevels
+	breakouts *Breakouts
+
+	// config can be replaced at runtime.
+	config atomic.Pointer[MuxConfig]
+}
+
+// MuxConfig contains the Mux configuration that can be changed without
+// restarting the server.
+type MuxConfig struct {
+	ICEServers            []ICEServer
+	Frontend              Frontend
+	PrometheusAccessToken string
+	AdminAccessToken      string
+}
+
+// Config returns the current configuration.
+func (mux *Mux) Config() MuxConfig {
+	return *mux.config.Load()
+}
+
+// SetConfig replaces the configuration. It will be used for all subsequent
+// requests.
+func (mux *Mux) SetConfig(config MuxConfig) {
+	mux.config.Store(&config)
+}
+
+// iceServers returns the ICE servers of the current configuration.
+func (mux *Mux) iceServers() []ICEServer {
+	return mux.config.Load().ICEServers
 }
 
 func (mux *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -50,9 +90,16 @@ func (mux *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 type TracksManager interface {
-	Add(room identifiers.RoomID, transport transport.Transport) (<-chan pubsub.PubTrackEvent, error)
-	Sub(params sfu.SubParams) error
+	Add(
+		ctx context.Context,
+		room identifiers.RoomID,
+		transport transport.Transport,
+		onTrackRejected sfu.TrackRejectedFunc,
+	) (<-chan pubsub.PubTrackEvent, error)
+	Sub(ctx context.Context, params sfu.SubParams) error
 	Unsub(params sfu.SubParams) error
+	Promote(room identifiers.RoomID, clientID identifiers.ClientID) error
+	Stats() []sfu.RoomStats
 }
 
 func withGauge(counter prometheus.Counter, h http.HandlerFunc) http.HandlerFunc {
@@ -65,86 +112,130 @@ func withGauge(counter prometheus.Counter, h http.HandlerFunc) http.HandlerFunc
 type RoomManager interface {
 	Enter(room identifiers.RoomID) (adapter Adapter, isNew bool)
 	Exit(room identifiers.RoomID) (isRemoved bool)
+	// Get returns the adapter of a room that has been entered, without
+	// entering it. The adapter is closed when the last reference exits the
+	// room, so it should only be used briefly.
+	Get(room identifiers.RoomID) (adapter Adapter, ok bool)
 }
 
-func NewMux(
-	log logger.Logger,
-	baseURL string,
-	version string,
-	network NetworkConfig,
-	iceServers []ICEServer,
-	encodedInsertableStreams bool,
-	rooms RoomManager,
-	tracks TracksManager,
-	prom PrometheusConfig,
-	embed Embed,
-) *Mux {
-	log = log.WithNamespaceAppended("mux")
+// MuxParams are parameters for Mux.
+type MuxParams struct {
+	Log        logger.Logger
+	BaseURL    string
+	Version    string
+	Network    NetworkConfig
+	ICEServers []ICEServer
+	Frontend   Frontend
+	Rooms      RoomManager
+	// NewAdapter creates the adapters of the rooms which are not active on
+	// this node, for moving their clients to and from the breakout rooms.
+	NewAdapter NewAdapterFunc
+	Tracks     TracksManager
+	Prometheus PrometheusConfig
+	Admin      AdminConfig
+	Drain      *Drain
+	Heartbeat  HeartbeatConfig
+	Limits     LimitsConfig
+	Webinar    WebinarConfig
+	Chat       ChatConfig
+	// Quota counts the clients in the rooms. The clients are only counted on
+	// this node when it is nil.
+	Quota     quota.Quota
+	Health    *Health
+	LogLevels *LogLevels
+	Embed     Embed
+}
 
-	templates := ParseTemplates(embed.Templates)
-	renderer := NewRenderer(log, templates, baseURL, version)
+func NewMux(params MuxParams) *Mux {
+	log := params.Log.WithNamespaceAppended("mux")
+
+	templates := ParseTemplates(params.Embed.Templates)
+	renderer := NewRenderer(log, templates, params.BaseURL, params.Version)
 
 	handler := chi.NewRouter()
 	mux := &Mux{
-		BaseURL:                  baseURL,
-		handler:                  handler,
-		iceServers:               iceServers,
-		network:                  network,
-		version:                  version,
-		encodedInsertableStreams: encodedInsertableStreams,
+		BaseURL: params.BaseURL,
+		handler: handler,
+		network: params.Network,
+		version: params.Version,
+		drain:   params.Drain,
+		health:  params.Health,
+		tracks:  params.Tracks,
+
+		logLevels: params.LogLevels,
+		breakouts: NewBreakouts(BreakoutsParams{
+			Log:        log,
+			Rooms:      params.Rooms,
+			NewAdapter: params.NewAdapter,
+			Clock:      clock.New(),
+		}),
+
+		config: atomic.Pointer[MuxConfig]{},
 	}
 
+	mux.SetConfig(MuxConfig{
+		ICEServers:            params.ICEServers,
+		Frontend:              params.Frontend,
+		PrometheusAccessToken: params.Prometheus.AccessToken,
+		AdminAccessToken:      params.Admin.AccessToken,
+	})
+
 	var root string
-	if baseURL == "" {
+	if params.BaseURL == "" {
 		root = "/"
 	} else {
-		root = baseURL
+		root = params.BaseURL
 	}
 
+	wss := NewWSS(WSSParams{
+		Log:       log,
+		Rooms:     params.Rooms,
+		Drain:     params.Drain,
+		Heartbeat: params.Heartbeat,
+		Limits:    params.Limits,
+		Webinar:   params.Webinar,
+		Chat:      params.Chat,
+		Quota:     params.Quota,
+		Breakouts: mux.breakouts,
+	})
+
 	wsHandler := newWebSocketHandler(
 		log,
-		network,
-		NewWSS(log, rooms),
-		iceServers,
-		tracks,
+		params.Network,
+		wss,
+		mux.iceServers,
+		params.Tracks,
+		params.Health,
 	)
 
-	manifest := buildManifest(baseURL)
+	manifest := buildManifest(params.BaseURL)
 	handler.Route(root, func(router chi.Router) {
 		router.Get("/", withGauge(prometheusHomeViewsTotal, renderer.Render(mux.routeIndex)))
-		router.Handle("/static/*", static(baseURL+"/static", embed.Static))
-		router.Handle("/res/*", static(baseURL+"/res", embed.Resources))
+		router.Handle("/static/*", static(params.BaseURL+"/static", params.Embed.Static))
+		router.Handle("/res/*", static(params.BaseURL+"/res", params.Embed.Resources))
 		router.Post("/call", withGauge(prometheusCallJoinTotal, mux.routeNewCall))
 		router.Get("/call/{callID}", withGauge(prometheusCallViewsTotal, renderer.Render(mux.routeCall)))
-		router.Get("/probes/liveness", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-		})
-		router.Get("/probes/health", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-		})
+		router.Get("/probes/liveness", mux.routeProbe(false))
+		router.Get("/probes/health", mux.routeProbe(true))
 		router.Get("/manifest.json", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/json")
 			w.Write(manifest)
 		})
-		router.Get("/metrics", func(w http.ResponseWriter, r *http.Request) {
-			accessToken := r.Header.Get("Authorization")
-			if strings.HasPrefix(accessToken, "Bearer ") {
-				accessToken = accessToken[len("Bearer "):]
-			} else {
-				accessToken = r.FormValue("access_token")
-			}
-
-			if accessToken == "" || accessToken != prom.AccessToken {
-				w.WriteHeader(http.StatusUnauthorized)
-
-				return
-			}
-			promhttp.Handler().ServeHTTP(w, r)
-		})
+		router.Get("/metrics", withAccessToken(mux.prometheusAccessToken, promhttp.Handler().ServeHTTP))
+		router.Post("/admin/drain", withAccessToken(mux.adminAccessToken, mux.routeDrain))
+		router.Get("/admin/log", withAccessToken(mux.adminAccessToken, mux.routeGetLogLevels))
+		router.Put("/admin/log", withAccessToken(mux.adminAccessToken, mux.routeSetLogLevels))
+		router.Delete("/admin/log", withAccessToken(mux.adminAccessToken, mux.routeResetLogLevels))
+		router.Get("/admin/stats", withAccessToken(mux.adminAccessToken, mux.routeStats))
+		router.Get("/admin/breakouts", withAccessToken(mux.adminAccessToken, mux.routeGetBreakouts))
+		router.Post("/admin/breakouts", withAccessToken(mux.adminAccessToken, mux.routeStartBreakout))
+		router.Delete("/admin/breakouts/{roomID}", withAccessToken(mux.adminAccessToken, mux.routeEndBreakout))
 
 		router.Mount("/ws", wsHandler)
+		// The server-sent events fallback uses the same handler for the events
+		// stream.
+		router.Get("/sse/{roomID}/{clientID}", wsHandler.ServeHTTP)
+		router.Post("/sse/{roomID}/{clientID}", wss.ServeSSEMessage)
 	})
 
 	return mux
@@ -154,8 +245,9 @@ func newWebSocketHandler(
 	log logger.Logger,
 	network NetworkConfig,
 	wss *WSS,
-	iceServers []ICEServer,
+	iceServers ICEServersFunc,
 	tracks TracksManager,
+	health *Health,
 ) http.Handler {
 	log = log.WithNamespaceAppended("websocket_handler")
 
@@ -163,7 +255,11 @@ func newWebSocketHandler(
 	case NetworkTypeSFU:
 		log.Info("Using network type sfu", nil)
 
-		return NewSFUHandler(log, wss, iceServers, network.SFU, tracks)
+		return NewSFUHandler(log, wss, iceServers, network.SFU, tracks, health)
+	case NetworkTypeHybrid:
+		log.Info("Using network type hybrid", nil)
+
+		return NewHybridHandler(log, wss, iceServers, network, tracks, health)
 	case NetworkTypeMesh:
 		fallthrough
 	default:
@@ -179,6 +275,220 @@ func static(prefix string, box fs.FS) http.Handler {
 	return http.StripPrefix(prefix, fileServer)
 }
 
+// accessToken returns the bearer token from the Authorization header, or the
+// access_token form value.
+func accessToken(r *http.Request) string {
+	if token := r.Header.Get("Authorization"); strings.HasPrefix(token, "Bearer ") {
+		return token[len("Bearer "):]
+	}
+
+	return r.FormValue("access_token")
+}
+
+func (mux *Mux) prometheusAccessToken() string {
+	return mux.config.Load().PrometheusAccessToken
+}
+
+func (mux *Mux) adminAccessToken() string {
+	return mux.config.Load().AdminAccessToken
+}
+
+// withAccessToken only calls h when the request contains the access token
+// returned by wantFunc. All requests are unauthorized when it is empty.
+func withAccessToken(wantFunc func() string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := accessToken(r)
+		want := wantFunc()
+
+		if want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
+
+// routeProbe responds with the health report. The status code depends on
+// the liveness or the readiness, so the report can be used for both probes.
+func (mux *Mux) routeProbe(readiness bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := mux.health.Report(r.Context())
+
+		healthy := report.Live
+		if readiness {
+			healthy = report.Ready
+		}
+
+		statusCode := http.StatusOK
+		if !healthy {
+			statusCode = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+
+		_ = json.NewEncoder(w).Encode(report)
+	}
+}
+
+type drainResponse struct {
+	Draining    bool `json:"draining"`
+	ActiveCalls int  `json:"activeCalls"`
+}
+
+func (mux *Mux) routeDrain(w http.ResponseWriter, r *http.Request) {
+	mux.drain.Start()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+
+	_ = json.NewEncoder(w).Encode(drainResponse{
+		Draining:    true,
+		ActiveCalls: mux.drain.ActiveCalls(),
+	})
+}
+
+// LogLevelsRequest overrides the active log levels.
+type LogLevelsRequest struct {
+	// Config contains the log levels in the same format as the log config
+	// field, for example "**:metadata_transport:trace".
+	Config string `json:"config"`
+	// TTL is the duration after which the levels from the config are
+	// restored, for example "10m".
+	TTL string `json:"ttl,omitempty"`
+}
+
+func (mux *Mux) routeGetLogLevels(w http.ResponseWriter, r *http.Request) {
+	writeLogLevelsState(w, mux.logLevels.State())
+}
+
+func (mux *Mux) routeSetLogLevels(w http.ResponseWriter, r *http.Request) {
+	var req LogLevelsRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+
+		return
+	}
+
+	var ttl time.Duration
+
+	if req.TTL != "" {
+		var err error
+
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			http.Error(w, "Invalid ttl", http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	state, err := mux.logLevels.Override(req.Config, ttl)
+	if err != nil {
+		http.Error(w, errors.Cause(err).Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	writeLogLevelsState(w, state)
+}
+
+func (mux *Mux) routeResetLogLevels(w http.ResponseWriter, r *http.Request) {
+	writeLogLevelsState(w, mux.logLevels.Reset())
+}
+
+func writeLogLevelsState(w http.ResponseWriter, state LogLevelsState) {
+	w.Header().Set("Content-Type", "application/json")
+
+	_ = json.NewEncoder(w).Encode(state)
+}
+
+// StatsResponse contains the media quality statistics of the SFU rooms.
+type StatsResponse struct {
+	Rooms []sfu.RoomStats `json:"rooms"`
+}
+
+func (mux *Mux) routeStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	_ = json.NewEncoder(w).Encode(StatsResponse{
+		Rooms: mux.tracks.Stats(),
+	})
+}
+
+// BreakoutRequest starts a breakout.
+type BreakoutRequest struct {
+	// Room is the parent room.
+	Room identifiers.RoomID `json:"room"`
+	// Rooms contains the clients moved to each breakout room, keyed by the
+	// name of the room.
+	Rooms map[string][]identifiers.ClientID `json:"rooms"`
+	// Duration is the duration after which the clients are brought back to
+	// the parent room, for example "15m".
+	Duration string `json:"duration"`
+}
+
+// BreakoutsResponse contains the active breakouts on this node.
+type BreakoutsResponse struct {
+	Breakouts []BreakoutState `json:"breakouts"`
+}
+
+func (mux *Mux) routeGetBreakouts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	_ = json.NewEncoder(w).Encode(BreakoutsResponse{
+		Breakouts: mux.breakouts.State(),
+	})
+}
+
+func (mux *Mux) routeStartBreakout(w http.ResponseWriter, r *http.Request) {
+	var req BreakoutRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+
+		return
+	}
+
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		http.Error(w, "Invalid duration", http.StatusBadRequest)
+
+		return
+	}
+
+	state, err := mux.breakouts.Start(req.Room, req.Rooms, duration)
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		if errors.Cause(err) == ErrBreakoutExists {
+			statusCode = http.StatusConflict
+		}
+
+		http.Error(w, errors.Cause(err).Error(), statusCode)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	_ = json.NewEncoder(w).Encode(state)
+}
+
+func (mux *Mux) routeEndBreakout(w http.ResponseWriter, r *http.Request) {
+	room := identifiers.RoomID(chi.URLParam(r, "roomID"))
+
+	if err := mux.breakouts.End(room); err != nil {
+		http.Error(w, errors.Cause(err).Error(), http.StatusNotFound)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (mux *Mux) routeNewCall(w http.ResponseWriter, r *http.Request) {
 	callID := r.PostFormValue("call")
 	if callID == "" {
@@ -206,7 +516,16 @@ func (mux *Mux) getData() map[string]interface{} {
 func (mux *Mux) routeCall(w http.ResponseWriter, r *http.Request) (string, interface{}, error) {
 	callID := url.PathEscape(path.Base(r.URL.Path))
 	peerID := uuid.New()
-	iceServers := GetICEAuthServers(mux.iceServers)
+	muxConfig := mux.config.Load()
+
+	_, span := startHTTPSpan(r, "Mux.routeCall")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("room_id", callID),
+		attribute.String("client_id", peerID),
+	)
+	iceServers := GetClientICEAuthServers(muxConfig.ICEServers, identifiers.ClientID(peerID))
 
 	config := ClientConfig{
 		BaseURL:  mux.BaseURL,
@@ -215,9 +534,10 @@ func (mux *Mux) routeCall(w http.ResponseWriter, r *http.Request) (string, inter
 		PeerID:   peerID,
 		PeerConfig: PeerConfig{
 			ICEServers:               iceServers,
-			EncodedInsertableStreams: mux.encodedInsertableStreams,
+			EncodedInsertableStreams: muxConfig.Frontend.EncodedInsertableStreams,
 		},
-		Network: mux.network.Type,
+		Network:   mux.network.Type,
+		Signaling: muxConfig.Frontend.Signaling,
 	}
 
 	configJSON, _ := json.Marshal(config)
@@ -1,6 +1,7 @@
 package server_test
 
 import (
+	"context"
 	"encoding/json"
 	"html"
 	"net/http"
@@ -9,10 +10,14 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
 	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/pubsub"
 	"github.com/peer-calls/peer-calls/v4/server/sfu"
+	"github.com/peer-calls/peer-calls/v4/server/sfu/stats"
 	"github.com/peer-calls/peer-calls/v4/server/test"
 	"github.com/peer-calls/peer-calls/v4/server/transport"
 	"github.com/stretchr/testify/assert"
@@ -31,6 +36,7 @@ type mockTracksManager struct {
 	added        chan addedPeer
 	subscribed   chan sfu.SubParams
 	unsubscribed chan sfu.SubParams
+	stats        []sfu.RoomStats
 }
 
 var _ server.TracksManager = &mockTracksManager{}
@@ -40,10 +46,16 @@ func newMockTracksManager() *mockTracksManager {
 		added:        make(chan addedPeer, 10),
 		subscribed:   make(chan sfu.SubParams, 10),
 		unsubscribed: make(chan sfu.SubParams, 10),
+		stats:        nil,
 	}
 }
 
-func (m *mockTracksManager) Add(room identifiers.RoomID, transport transport.Transport) (<-chan pubsub.PubTrackEvent, error) {
+func (m *mockTracksManager) Add(
+	ctx context.Context,
+	room identifiers.RoomID,
+	transport transport.Transport,
+	onTrackRejected sfu.TrackRejectedFunc,
+) (<-chan pubsub.PubTrackEvent, error) {
 	ch := make(chan pubsub.PubTrackEvent)
 	close(ch)
 
@@ -56,7 +68,7 @@ func (m *mockTracksManager) Add(room identifiers.RoomID, transport transport.Tra
 	return ch, nil
 }
 
-func (m *mockTracksManager) Sub(params sfu.SubParams) error {
+func (m *mockTracksManager) Sub(ctx context.Context, params sfu.SubParams) error {
 	m.subscribed <- params
 	return nil
 }
@@ -66,6 +78,14 @@ func (m *mockTracksManager) Unsub(params sfu.SubParams) error {
 	return nil
 }
 
+func (m *mockTracksManager) Promote(room identifiers.RoomID, clientID identifiers.ClientID) error {
+	return nil
+}
+
+func (m *mockTracksManager) Stats() []sfu.RoomStats {
+	return m.stats
+}
+
 func mesh() (network server.NetworkConfig) {
 	network.Type = server.NetworkTypeMesh
 	return
@@ -77,12 +97,64 @@ func prom() server.PrometheusConfig {
 	return server.PrometheusConfig{prometheusAccessToken}
 }
 
+const adminAccessToken = "admin1234"
+
+func admin() server.AdminConfig {
+	return server.AdminConfig{adminAccessToken}
+}
+
+func newDrain() *server.Drain {
+	return server.NewDrain(test.NewLogger(), server.DrainConfig{})
+}
+
+func newLogLevels() *server.LogLevels {
+	return server.NewLogLevels(server.LogLevelsParams{
+		Log:       test.NewLogger(),
+		LogConfig: logger.NewAtomicConfig(logger.LevelInfo),
+		Clock:     clock.NewMock(),
+		Config:    "",
+	})
+}
+
+func newHealth() *server.Health {
+	return server.NewHealth(test.NewLogger(), server.HealthConfig{})
+}
+
+// newMuxParams returns the params of a Mux for a mesh network with the
+// default test config.
+func newMuxParams(rooms server.RoomManager, tracks server.TracksManager) server.MuxParams {
+	return server.MuxParams{
+		Log:        test.NewLogger(),
+		BaseURL:    "/test",
+		Version:    "v0.0.0",
+		Network:    mesh(),
+		ICEServers: iceServers,
+		Frontend:   server.Frontend{},
+		Rooms:      rooms,
+		NewAdapter: nil,
+		Tracks:     tracks,
+		Prometheus: prom(),
+		Admin:      admin(),
+		Drain:      newDrain(),
+		Heartbeat:  server.HeartbeatConfig{},
+		Limits:     server.LimitsConfig{},
+		Webinar:    server.WebinarConfig{},
+		Chat:       server.ChatConfig{},
+		Quota:      nil,
+		Health:     newHealth(),
+		LogLevels:  newLogLevels(),
+		Embed:      embed,
+	}
+}
+
 func Test_routeIndex(t *testing.T) {
 	mrm := NewMockRoomManager()
 	trk := newMockTracksManager()
 	prom := server.PrometheusConfig{"test1234"}
 	defer mrm.close()
-	mux := server.NewMux(test.NewLogger(), "/test", "v0.0.0", mesh(), iceServers, false, mrm, trk, prom, embed)
+	params := newMuxParams(mrm, trk)
+	params.Prometheus = prom
+	mux := server.NewMux(params)
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/test", nil)
 
@@ -96,7 +168,9 @@ func Test_routeIndex_noBaseURL(t *testing.T) {
 	mrm := NewMockRoomManager()
 	trk := newMockTracksManager()
 	defer mrm.close()
-	mux := server.NewMux(test.NewLogger(), "", "v0.0.0", mesh(), iceServers, false, mrm, trk, prom(), embed)
+	params := newMuxParams(mrm, trk)
+	params.BaseURL = ""
+	mux := server.NewMux(params)
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/", nil)
 
@@ -110,7 +184,7 @@ func Test_routeNewCall_name(t *testing.T) {
 	mrm := NewMockRoomManager()
 	trk := newMockTracksManager()
 	defer mrm.close()
-	mux := server.NewMux(test.NewLogger(), "/test", "v0.0.0", mesh(), iceServers, false, mrm, trk, prom(), embed)
+	mux := server.NewMux(newMuxParams(mrm, trk))
 	w := httptest.NewRecorder()
 	reader := strings.NewReader("call=my room")
 	r := httptest.NewRequest("POST", "/test/call", reader)
@@ -126,7 +200,7 @@ func Test_routeNewCall_random(t *testing.T) {
 	mrm := NewMockRoomManager()
 	trk := newMockTracksManager()
 	defer mrm.close()
-	mux := server.NewMux(test.NewLogger(), "/test", "v0.0.0", mesh(), iceServers, false, mrm, trk, prom(), embed)
+	mux := server.NewMux(newMuxParams(mrm, trk))
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("POST", "/test/call", nil)
 	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -145,7 +219,13 @@ func Test_routeCall(t *testing.T) {
 	iceServers := []server.ICEServer{{
 		URLs: []string{"stun:"},
 	}}
-	mux := server.NewMux(test.NewLogger(), "/test", "v0.0.0", mesh(), iceServers, false, mrm, trk, prom(), embed)
+	params := newMuxParams(mrm, trk)
+	params.ICEServers = iceServers
+	params.Frontend = server.Frontend{
+		EncodedInsertableStreams: false,
+		Signaling:                server.SignalingTransportAuto,
+	}
+	mux := server.NewMux(params)
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/test/call/abc", nil)
 	mux.ServeHTTP(w, r)
@@ -165,13 +245,14 @@ func Test_routeCall(t *testing.T) {
 	assert.NotEmpty(t, config.PeerConfig.ICEServers)
 	assert.False(t, config.PeerConfig.EncodedInsertableStreams)
 	assert.Equal(t, server.NetworkTypeMesh, config.Network)
+	assert.Equal(t, server.SignalingTransportAuto, config.Signaling)
 }
 
 func Test_manifest(t *testing.T) {
 	mrm := NewMockRoomManager()
 	trk := newMockTracksManager()
 	defer mrm.close()
-	mux := server.NewMux(test.NewLogger(), "/test", "v0.0.0", mesh(), iceServers, false, mrm, trk, prom(), embed)
+	mux := server.NewMux(newMuxParams(mrm, trk))
 	w := httptest.NewRecorder()
 	reader := strings.NewReader("call=my room")
 	r := httptest.NewRequest("GET", "/test/manifest.json", reader)
@@ -186,7 +267,7 @@ func Test_Metrics(t *testing.T) {
 	mrm := NewMockRoomManager()
 	trk := newMockTracksManager()
 	defer mrm.close()
-	mux := server.NewMux(test.NewLogger(), "/test", "v0.0.0", mesh(), iceServers, false, mrm, trk, prom(), embed)
+	mux := server.NewMux(newMuxParams(mrm, trk))
 
 	for _, testCase := range []struct {
 		statusCode    int
@@ -211,3 +292,289 @@ func Test_Metrics(t *testing.T) {
 		})
 	}
 }
+
+func Test_Drain(t *testing.T) {
+	mrm := NewMockRoomManager()
+	trk := newMockTracksManager()
+	defer mrm.close()
+	drain := newDrain()
+	health := newHealth()
+	health.Register(server.HealthCheck{
+		Name:  "drain",
+		Type:  server.HealthCheckTypeReadiness,
+		Check: drain.CheckHealth,
+	})
+	params := newMuxParams(mrm, trk)
+	params.Drain = drain
+	params.Health = health
+	mux := server.NewMux(params)
+
+	probe := func(url string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", url, nil)
+		mux.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	postDrain := func(authorization string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/test/admin/drain", nil)
+		r.Header.Set("Authorization", authorization)
+		mux.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, probe("/test/probes/liveness"))
+	assert.Equal(t, http.StatusOK, probe("/test/probes/health"))
+
+	assert.Equal(t, http.StatusUnauthorized, postDrain(""))
+	assert.Equal(t, http.StatusUnauthorized, postDrain("Bearer "+prometheusAccessToken))
+	assert.False(t, drain.Draining())
+
+	assert.Equal(t, http.StatusAccepted, postDrain("Bearer "+adminAccessToken))
+	assert.True(t, drain.Draining())
+
+	assert.Equal(t, http.StatusOK, probe("/test/probes/liveness"))
+	assert.Equal(t, http.StatusServiceUnavailable, probe("/test/probes/health"))
+}
+
+func Test_Drain_disabled(t *testing.T) {
+	mrm := NewMockRoomManager()
+	trk := newMockTracksManager()
+	defer mrm.close()
+	drain := newDrain()
+	params := newMuxParams(mrm, trk)
+	params.Admin = server.AdminConfig{}
+	params.Drain = drain
+	mux := server.NewMux(params)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/test/admin/drain?access_token=", nil)
+	mux.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.False(t, drain.Draining())
+}
+
+func Test_Probes(t *testing.T) {
+	mrm := NewMockRoomManager()
+	trk := newMockTracksManager()
+	defer mrm.close()
+	health := newHealth()
+	params := newMuxParams(mrm, trk)
+	params.Health = health
+	mux := server.NewMux(params)
+
+	probe := func(url string) (int, server.HealthReport) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", url, nil)
+		mux.ServeHTTP(w, r)
+
+		var report server.HealthReport
+		err := json.Unmarshal(w.Body.Bytes(), &report)
+		require.NoError(t, err)
+
+		return w.Code, report
+	}
+
+	code, report := probe("/test/probes/health")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, report.Live)
+	assert.True(t, report.Ready)
+
+	var liveErr error
+
+	health.Register(server.HealthCheck{
+		Name:  "store",
+		Type:  server.HealthCheckTypeReadiness,
+		Check: func(ctx context.Context) error { return errors.New("store down") },
+	})
+	health.Register(server.HealthCheck{
+		Name:  "loop",
+		Type:  server.HealthCheckTypeLiveness,
+		Check: func(ctx context.Context) error { return liveErr },
+	})
+
+	code, _ = probe("/test/probes/liveness")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, report = probe("/test/probes/health")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, server.HealthReport{
+		Live:  true,
+		Ready: false,
+		Checks: []server.HealthCheckResult{{
+			Name:    "loop",
+			Type:    server.HealthCheckTypeLiveness,
+			Healthy: true,
+		}, {
+			Name:    "store",
+			Type:    server.HealthCheckTypeReadiness,
+			Healthy: false,
+			Error:   "store down",
+		}},
+	}, report)
+
+	liveErr = errors.New("stuck")
+
+	code, report = probe("/test/probes/liveness")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, report.Live)
+	assert.False(t, report.Ready)
+}
+
+func Test_LogLevels(t *testing.T) {
+	mrm := NewMockRoomManager()
+	trk := newMockTracksManager()
+	defer mrm.close()
+	logLevels := newLogLevels()
+	params := newMuxParams(mrm, trk)
+	params.LogLevels = logLevels
+	mux := server.NewMux(params)
+
+	request := func(method string, body string, token string) (int, server.LogLevelsState) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/test/admin/log", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		mux.ServeHTTP(w, r)
+
+		var state server.LogLevelsState
+		if w.Code == http.StatusOK {
+			err := json.Unmarshal(w.Body.Bytes(), &state)
+			require.NoError(t, err)
+		}
+
+		return w.Code, state
+	}
+
+	code, _ := request("GET", "", prometheusAccessToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = request("PUT", `{"config":"**:trace"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = request("PUT", `{"config":"**:trace","ttl":"1 minute"}`, adminAccessToken)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = request("PUT", `{"config":""}`, adminAccessToken)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, state := request("PUT", `{"config":"**:metadata_transport:trace","ttl":"1m"}`, adminAccessToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "**:metadata_transport:trace", state.Config)
+	assert.NotNil(t, state.ExpiresAt)
+
+	code, state = request("GET", "", adminAccessToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "**:metadata_transport:trace", state.Config)
+
+	code, state = request("DELETE", "", adminAccessToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, server.LogLevelsState{}, state)
+	assert.Equal(t, server.LogLevelsState{}, logLevels.State())
+}
+
+func Test_Stats(t *testing.T) {
+	mrm := NewMockRoomManager()
+	trk := newMockTracksManager()
+	trk.stats = []sfu.RoomStats{{
+		RoomID: "room1",
+		Score:  4,
+		Tracks: []sfu.TrackStats{{
+			PubClientID: "client1",
+			TrackID: identifiers.TrackID{
+				ID:       "track1",
+				StreamID: "stream1",
+			},
+			Kind: transport.TrackKindAudio,
+			TrackSnapshot: stats.TrackSnapshot{
+				PacketsReceived: 10,
+				Score:           4,
+			},
+		}},
+	}}
+	defer mrm.close()
+	mux := server.NewMux(newMuxParams(mrm, trk))
+
+	request := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/test/admin/stats", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		mux.ServeHTTP(w, r)
+
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request(prometheusAccessToken).Code)
+
+	w := request(adminAccessToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var res server.StatsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, trk.stats, res.Rooms)
+
+	assert.Contains(t, w.Body.String(), `"packetsReceived":10`)
+}
+
+func Test_Breakouts(t *testing.T) {
+	rooms := server.NewAdapterRoomManager(func(room identifiers.RoomID) server.Adapter {
+		return server.NewMemoryAdapter(room)
+	})
+	trk := newMockTracksManager()
+	mux := server.NewMux(newMuxParams(rooms, trk))
+
+	request := func(method string, path string, body string, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/test/admin/breakouts"+path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		mux.ServeHTTP(w, r)
+
+		return w
+	}
+
+	body := `{"room":"class","rooms":{"g1":["a","b"],"g2":["c"]},"duration":"15m"}`
+
+	assert.Equal(t, http.StatusUnauthorized, request("POST", "", body, prometheusAccessToken).Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", "", `{"room":"class","duration":"15 minutes"}`, adminAccessToken).Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", "", `{"room":"class","duration":"15m"}`, adminAccessToken).Code)
+
+	w := request("POST", "", body, adminAccessToken)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var state server.BreakoutState
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &state))
+	assert.Equal(t, identifiers.RoomID("class"), state.Room)
+	require.Len(t, state.Rooms, 2)
+	assert.Equal(t, identifiers.RoomID("class~g1"), state.Rooms[0].Room)
+	assert.Equal(t, []identifiers.ClientID{"a", "b"}, state.Rooms[0].Assigned)
+
+	assert.Equal(t, http.StatusConflict, request("POST", "", body, adminAccessToken).Code)
+
+	w = request("GET", "", "", adminAccessToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var res server.BreakoutsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, []server.BreakoutState{state}, res.Breakouts)
+
+	assert.Equal(t, http.StatusNoContent, request("DELETE", "/class", "", adminAccessToken).Code)
+	assert.Equal(t, http.StatusNotFound, request("DELETE", "/class", "", adminAccessToken).Code)
+	assert.Equal(t, 0, rooms.Len())
+}
+
+func Test_SSEMessage_sessionNotFound(t *testing.T) {
+	mrm := NewMockRoomManager()
+	trk := newMockTracksManager()
+	defer mrm.close()
+	mux := server.NewMux(newMuxParams(mrm, trk))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/test/sse/room1/client1", strings.NewReader(`{"type":"ping","room":"room1"}`))
+	r.Header.Set(server.SSESessionHeader, "session1")
+	mux.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -1,15 +1,21 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"net"
 	"sync"
 	"time"
 
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/discovery"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/sfu"
+	"github.com/peer-calls/peer-calls/v4/server/transport"
 	"github.com/peer-calls/peer-calls/v4/server/udptransport2"
+	"github.com/pion/dtls/v2"
 )
 
 const (
@@ -22,6 +28,21 @@ type NodeManager struct {
 	wg               sync.WaitGroup
 	mu               sync.Mutex
 	transportManager *udptransport2.Manager
+
+	// localID identifies this node in the relay trees.
+	localID string
+
+	// roomsMu guards rooms, factories and parents, and ensures the transports
+	// are created and closed in the same order as the room events are
+	// received.
+	roomsMu sync.Mutex
+	// rooms contains the rooms with at least one peer on this node.
+	rooms map[identifiers.RoomID]struct{}
+	// factories contains the factories that have not been torn down.
+	factories map[*udptransport2.Factory]struct{}
+	// parents contains the parent of this node in each room's relay tree. The
+	// root node has no parent.
+	parents map[identifiers.RoomID]*udptransport2.Factory
 }
 
 type NodeManagerParams struct {
@@ -29,7 +50,21 @@ type NodeManagerParams struct {
 	RoomManager   *ChannelRoomManager
 	TracksManager TracksManager
 	ListenAddr    *net.UDPAddr
-	Nodes         []*net.UDPAddr
+	// AdvertiseAddr is the address of this node as seen by other nodes. It
+	// will be ignored when received from Discovery.
+	AdvertiseAddr *net.UDPAddr
+	// Discovery provides the remote nodes to connect to. NodeManager closes it
+	// on Close.
+	Discovery discovery.Discovery
+	// TransportType is the protocol used for connecting to other nodes.
+	TransportType TransportType
+	// DTLSConfig enables DTLS for the connections to other nodes when set.
+	// Only used with TransportTypeUDP.
+	DTLSConfig *dtls.Config
+	// TLSConfig is required with TransportTypeQUIC.
+	TLSConfig *tls.Config
+	// Health is used for registering a check for each remote node.
+	Health *Health
 }
 
 func NewNodeManager(params NodeManagerParams) (*NodeManager, error) {
@@ -51,51 +86,143 @@ func NewNodeManager(params NodeManagerParams) (*NodeManager, error) {
 
 	params.Log.Info("Listen on UDP", nil)
 
-	transportManager := udptransport2.NewManager(udptransport2.ManagerParams{
+	var advertiseAddr net.Addr
+	if params.AdvertiseAddr != nil {
+		advertiseAddr = params.AdvertiseAddr
+	}
+
+	// Other nodes see this node by the advertised address, or by the address
+	// the conn was bound to.
+	localID := conn.LocalAddr().String()
+	if advertiseAddr != nil {
+		localID = advertiseAddr.String()
+	}
+
+	managerParams := udptransport2.ManagerParams{
 		Conn:                conn,
 		Log:                 params.Log,
 		Clock:               clock.New(),
 		PingTimeout:         pingTimeout,
 		DestroyTimeout:      destroyTimeout,
 		InterceptorRegistry: interceptorRegistry,
-	})
+		DTLSConfig:          params.DTLSConfig,
+		TLSConfig:           params.TLSConfig,
+		AdvertiseAddr:       advertiseAddr,
+	}
+
+	var transportManager *udptransport2.Manager
+
+	switch params.TransportType {
+	case TransportTypeQUIC:
+		transportManager, err = udptransport2.NewQUICManager(managerParams)
+		if err != nil {
+			conn.Close()
+
+			return nil, errors.Annotatef(err, "new QUIC manager")
+		}
+	case TransportTypeUDP:
+		fallthrough
+	default:
+		transportManager = udptransport2.NewManager(managerParams)
+	}
 
 	nm := &NodeManager{
 		params:           &params,
 		transportManager: transportManager,
+		localID:          localID,
+		rooms:            map[identifiers.RoomID]struct{}{},
+		factories:        map[*udptransport2.Factory]struct{}{},
+		parents:          map[identifiers.RoomID]*udptransport2.Factory{},
 	}
 
-	for _, addr := range params.Nodes {
-		log := params.Log.WithCtx(logger.Ctx{
-			"remote_addr": addr,
-		})
+	nm.wg.Add(1)
+
+	go func() {
+		defer nm.wg.Done()
 
-		log.Info("Configuring remote node", nil)
+		nm.startDiscoveryLoop()
+	}()
 
-		getFactoryResponse := transportManager.GetFactory(addr)
+	go nm.startTransportEventLoop()
+	go nm.startRoomEventLoop()
 
-		nm.wg.Add(1)
+	return nm, nil
+}
 
-		go func() {
-			defer nm.wg.Done()
+// startDiscoveryLoop creates factories for nodes that were added and closes
+// factories of nodes that were removed.
+func (nm *NodeManager) startDiscoveryLoop() {
+	// nodes contains the currently discovered nodes indexed by address.
+	nodes := map[string]*net.UDPAddr{}
 
-			factory, err := (<-getFactoryResponse).Result()
-			if err != nil {
-				log.Error("Create transport factory", errors.Trace(err), nil)
-				return
+	for discovered := range nm.params.Discovery.Nodes() {
+		next := make(map[string]*net.UDPAddr, len(discovered))
+
+		for _, addr := range discovered {
+			if nm.isLocalAddr(addr) {
+				continue
 			}
 
-			nm.handleTransportFactory(factory)
+			next[addr.String()] = addr
+		}
+
+		for raddr, addr := range next {
+			if _, ok := nodes[raddr]; !ok {
+				nm.addNode(addr)
+			}
+		}
 
-			// TODO attempt reconnect once the factory is Done (after ticker is
-			// implemented.
-		}()
+		for raddr, addr := range nodes {
+			if _, ok := next[raddr]; !ok {
+				nm.removeNode(addr)
+			}
+		}
+
+		nodes = next
 	}
+}
 
-	go nm.startTransportEventLoop()
-	go nm.startRoomEventLoop()
+func (nm *NodeManager) isLocalAddr(addr *net.UDPAddr) bool {
+	return addr.String() == nm.params.ListenAddr.String() ||
+		(nm.params.AdvertiseAddr != nil && addr.String() == nm.params.AdvertiseAddr.String())
+}
 
-	return nm, nil
+func (nm *NodeManager) addNode(addr *net.UDPAddr) {
+	log := nm.params.Log.WithCtx(logger.Ctx{
+		"remote_addr": addr,
+	})
+
+	log.Info("Configuring remote node", nil)
+
+	getFactoryResponse := nm.transportManager.GetFactory(addr)
+
+	nm.wg.Add(1)
+
+	go func() {
+		defer nm.wg.Done()
+
+		factory, err := (<-getFactoryResponse).Result()
+		if err != nil {
+			log.Error("Create transport factory", errors.Trace(err), nil)
+
+			return
+		}
+
+		// The transport manager reconnects the factory after a heartbeat
+		// timeout, and the new factory will be received in
+		// startTransportEventLoop.
+		nm.handleTransportFactory(factory)
+	}()
+}
+
+func (nm *NodeManager) removeNode(addr *net.UDPAddr) {
+	log := nm.params.Log.WithCtx(logger.Ctx{
+		"remote_addr": addr,
+	})
+
+	log.Info("Removing remote node", nil)
+
+	nm.transportManager.RemoveFactory(addr)
 }
 
 func (nm *NodeManager) startTransportEventLoop() {
@@ -119,62 +246,167 @@ func (nm *NodeManager) handleTransportFactory(factory *udptransport2.Factory) {
 			}
 		}
 	}()
+
+	unregisterHealthCheck := nm.params.Health.Register(HealthCheck{
+		Name:  "node " + factory.RemoteAddr().String(),
+		Type:  HealthCheckTypeInfo,
+		Check: factory.CheckHealth,
+	})
+
+	nm.wg.Add(1)
+
+	go func() {
+		defer nm.wg.Done()
+		defer unregisterHealthCheck()
+
+		nm.startRelayTreeLoop(factory)
+	}()
+
+	// The node might have been discovered after some rooms were already
+	// created, so the transports for these need to be created now.
+	nm.roomsMu.Lock()
+	defer nm.roomsMu.Unlock()
+
+	nm.factories[factory] = struct{}{}
+
+	for room := range nm.rooms {
+		if err := factory.CreateTransport(room); err != nil {
+			nm.params.Log.Error("Create transport", errors.Trace(err), logger.Ctx{
+				"room_id": room,
+			})
+		}
+	}
+}
+
+// startRelayTreeLoop updates the relay trees every time the remote node
+// advertises a change in interest, and after the factory is torn down.
+func (nm *NodeManager) startRelayTreeLoop(factory *udptransport2.Factory) {
+	for {
+		select {
+		case <-factory.RemoteInterestsChanged():
+			nm.roomsMu.Lock()
+
+			for room := range nm.rooms {
+				nm.updateRelayParent(room)
+			}
+
+			nm.roomsMu.Unlock()
+		case <-factory.Done():
+			nm.roomsMu.Lock()
+
+			delete(nm.factories, factory)
+
+			for room, parent := range nm.parents {
+				if parent == factory {
+					// No need to notify the old parent, it is gone.
+					delete(nm.parents, room)
+					nm.updateRelayParent(room)
+				}
+			}
+
+			nm.roomsMu.Unlock()
+
+			return
+		}
+	}
+}
+
+// updateRelayParent selects the parent of this node in the room's relay tree
+// from the remote nodes with peers in the room. Room transports are only
+// created between a node and its parent, so the tracks are only forwarded
+// along the edges of the tree. The caller must hold roomsMu.
+func (nm *NodeManager) updateRelayParent(room identifiers.RoomID) {
+	var parent *udptransport2.Factory
+
+	if _, ok := nm.rooms[room]; ok {
+		factories := make([]*udptransport2.Factory, 0, len(nm.factories))
+		candidates := make([]relayCandidate, 0, len(nm.factories))
+
+		for factory := range nm.factories {
+			if !factory.RemoteInterested(room) {
+				continue
+			}
+
+			factories = append(factories, factory)
+			candidates = append(candidates, relayCandidate{
+				ID:  factory.RemoteAddr().String(),
+				RTT: factory.RTT(),
+			})
+		}
+
+		if i := selectRelayParent(nm.localID, candidates); i >= 0 {
+			parent = factories[i]
+		}
+	}
+
+	prevParent := nm.parents[room]
+	if parent == prevParent {
+		return
+	}
+
+	log := nm.params.Log.WithCtx(logger.Ctx{
+		"room_id": room,
+	})
+
+	if prevParent != nil {
+		if err := prevParent.SetParent(room, false); err != nil {
+			log.Error("Unset relay parent", errors.Trace(err), nil)
+		}
+
+		delete(nm.parents, room)
+	}
+
+	if parent == nil {
+		log.Info("No relay parent", nil)
+
+		return
+	}
+
+	log.Info("Set relay parent", logger.Ctx{
+		"remote_addr": parent.RemoteAddr(),
+		"rtt":         parent.RTT(),
+	})
+
+	if err := parent.SetParent(room, true); err != nil {
+		log.Error("Set relay parent", errors.Trace(err), nil)
+
+		return
+	}
+
+	nm.parents[room] = parent
 }
 
-func (nm *NodeManager) handleTransport(transport *udptransport2.Transport) error {
+func (nm *NodeManager) handleTransport(tr *udptransport2.Transport) error {
 	nm.mu.Lock()
 	defer nm.mu.Unlock()
 
-	streamID := transport.StreamID()
+	streamID := tr.StreamID()
 
 	nm.params.Log.Info("Add transport", logger.Ctx{
 		"stream_id": streamID,
-		"client_id": transport.ClientID(),
+		"client_id": tr.ClientID(),
 	})
 
-	ch, err := nm.params.TracksManager.Add(streamID, transport)
+	ch, err := nm.params.TracksManager.Add(context.Background(), streamID, tr, nil)
 	if err != nil {
-		transport.Close()
+		tr.Close()
 		return errors.Annotatef(err, "add transport: %s", streamID)
 	}
 
 	nm.wg.Add(1)
 
 	go func() {
-		// FIXME currently all transport subscribe to all published tracks.
-		//
-		// This is the first step in an attempt to communicate the changes in
-		// published tracks without actually adding the tracks to the peer
-		// connection and wasting data.
-		//
-		// The frontend would need to be updated to handle these events and
-		// subscribe to interesting streams. The first version might simply
-		// subscribe to all tracks.
-		//
-		// The server transport would also need to be updated to:
-		// 1. Not sub to tracks until at least one track is added.
-		// 2. Automatically unsub from tracks after the last track is removed.
+		defer nm.wg.Done()
+
+		// Room transports only exist along the edges of the room's relay tree,
+		// so all tracks are forwarded to all transports, except back to the
+		// transport they came from.
 		//
-		// Additionally, something needs to be done to prevent duplicate tracks
-		// when more than 2 server nodes are present. For example, if there were
-		// 3 nodes with 1 peer connection connected to node A, it would be
-		// redundant if both server transports from node A and node B both
-		// advertised the tracks from the peer connection to node C.
+		// Subscribing a server transport only advertises the track to the remote
+		// node. The media is not sent until the remote node subscribes to the
+		// track because it has subscribers of its own, so nodes without any
+		// subscribers do not receive anything.
 		for pubTrackEvent := range ch {
-			// If tracks stop being automatically added to all other transports,
-			// the AddTrack/RemoveTrack methods could be called here to provide
-			// track metadata to streamTransport.
-			//
-			// However, there is one big difference in how StreamTransport _should_
-			// handle addition or removal of tracks when compared to
-			// WebRTCTransport: StreamTransport should only advertise tracks to
-			// but not actually subscribe to them to prevent unnecessary network
-			// traffic, whereas WebRTC transport always already receives tracks
-			// from the app clients (browsers).
-			//
-			// The question is: how should StreamTransport handle/receive
-			// subscription requests?
-
 			logCtx := logger.Ctx{
 				"client_id":        pubTrackEvent.PubTrack.ClientID,
 				"user_id":          pubTrackEvent.PubTrack.PeerID,
@@ -182,20 +414,20 @@ func (nm *NodeManager) handleTransport(transport *udptransport2.Transport) error
 				"track_event_type": pubTrackEvent.Type,
 			}
 
-			if pubTrackEvent.PubTrack.ClientID.IsServer() {
-				// Do not forward tracks from other server transports to this node;
-				// only forward tracks from WebRTC connections connected directly to
-				// this server.
-				nm.params.Log.Info("Skipping track from other server transport", logCtx)
+			if pubTrackEvent.Type != transport.TrackEventTypeAdd {
+				continue
+			}
 
+			if pubTrackEvent.PubTrack.ClientID == tr.ClientID() {
+				// Do not send the tracks back to the node they came from.
 				continue
 			}
 
-			err := nm.params.TracksManager.Sub(sfu.SubParams{
+			err := nm.params.TracksManager.Sub(context.Background(), sfu.SubParams{
 				Room:        streamID,
 				PubClientID: pubTrackEvent.PubTrack.ClientID,
 				TrackID:     pubTrackEvent.PubTrack.TrackID,
-				SubClientID: transport.ClientID(),
+				SubClientID: tr.ClientID(),
 			})
 			if err != nil {
 				nm.params.Log.Error("Failed to subscribe server transport to pub track event", errors.Trace(err), logCtx)
@@ -223,8 +455,12 @@ func (nm *NodeManager) startRoomEventLoop() {
 			"room_id": roomEvent.RoomName,
 		})
 
+		nm.roomsMu.Lock()
+
 		switch roomEvent.Type {
 		case RoomEventTypeAdd:
+			nm.rooms[roomEvent.RoomName] = struct{}{}
+
 			// Create new transports once the room was created on this node (e.g.
 			// someone has joined on this node and the room was just created).
 			// Transports initiated by other nodes will be accepted.
@@ -236,7 +472,11 @@ func (nm *NodeManager) startRoomEventLoop() {
 					continue
 				}
 			}
+
+			nm.updateRelayParent(roomEvent.RoomName)
 		case RoomEventTypeRemove:
+			delete(nm.rooms, roomEvent.RoomName)
+
 			// No need to do anything special if the room closes. The server
 			// transports be automatically closed once the final peer disconnects.
 			//
@@ -261,15 +501,21 @@ func (nm *NodeManager) startRoomEventLoop() {
 					continue
 				}
 			}
+
+			nm.updateRelayParent(roomEvent.RoomName)
 		}
+
+		nm.roomsMu.Unlock()
 	}
 }
 
 func (nm *NodeManager) Close() error {
+	err := nm.params.Discovery.Close()
+
 	nm.params.RoomManager.Close()
 	nm.transportManager.Close()
 
 	nm.wg.Wait()
 
-	return nil
+	return errors.Trace(err)
 }
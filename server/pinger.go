@@ -3,48 +3,75 @@ package server
 import (
 	"context"
 	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+)
+
+const (
+	defaultHeartbeatInterval = 5 * time.Second
+	defaultHeartbeatTimeout  = 30 * time.Second
 )
 
 // Pinger is a component that sends pings to clients on a regular interval and
 // receives pongs back.
 type Pinger struct {
-	ticker *time.Ticker
+	params *PingerParams
+	ticker clock.Ticker
 	pongCh chan struct{}
-	ping   func()
 }
 
-// NewPinger creates a new instance of Pinger and starts a ticker whose
-// duration is set to dur. The ping callback is called on every interval. The
-// main event loop will be closed when ctx is done.
-func NewPinger(ctx context.Context, dur time.Duration, ping func()) *Pinger {
-	ticker := time.NewTicker(dur)
-	pongCh := make(chan struct{}, 1)
+// PingerParams are parameters for Pinger.
+type PingerParams struct {
+	Clock clock.Clock
+	// Interval is the duration between the pings.
+	Interval time.Duration
+	// Timeout is the maximum duration since the last pong. It is checked on
+	// every interval, so the client is evicted after at most Timeout plus
+	// Interval. Disabled when zero.
+	Timeout time.Duration
+	// Ping is called on every interval.
+	Ping func()
+	// OnTimeout is called once when the timeout is exceeded. No more pings are
+	// sent after that.
+	OnTimeout func()
+}
 
+// NewPinger creates a new instance of Pinger and starts a ticker whose
+// duration is set to params.Interval. The main event loop will be closed when
+// ctx is done or the timeout is exceeded.
+func NewPinger(ctx context.Context, params PingerParams) *Pinger {
 	p := &Pinger{
-		ticker: ticker,
-		pongCh: pongCh,
-		ping:   ping,
+		params: &params,
+		ticker: params.Clock.NewTicker(params.Interval),
+		pongCh: make(chan struct{}, 1),
 	}
 
-	go p.run(ctx)
+	// The connection has just been established, so it counts as the first
+	// pong.
+	go p.run(ctx, params.Clock.Now())
 
 	return p
 }
 
 // run is the main event loop.
-func (p *Pinger) run(ctx context.Context) {
+func (p *Pinger) run(ctx context.Context, lastPongTime time.Time) {
 	defer p.ticker.Stop()
-	lastPongTime := time.Time{}
 
 	for {
 		select {
-		case <-p.ticker.C:
-			// TODO terminate connection when we haven't received pong in a while.
-			_ = lastPongTime
+		case <-p.ticker.C():
+			timeout := p.params.Timeout
+
+			if timeout > 0 && p.params.Clock.Since(lastPongTime) > timeout {
+				prometheusWSPongTimeoutTotal.Inc()
+				p.params.OnTimeout()
+
+				return
+			}
 
-			p.ping()
+			p.params.Ping()
 		case <-p.pongCh:
-			lastPongTime = time.Now()
+			lastPongTime = p.params.Clock.Now()
 		case <-ctx.Done():
 			return
 		}
@@ -2,36 +2,109 @@ package server_test
 
 import (
 	"context"
-	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
 )
 
+type pingerMock struct {
+	clock    *clock.Mock
+	pinger   *server.Pinger
+	pings    chan struct{}
+	timeouts chan struct{}
+}
+
+func newPingerMock(ctx context.Context, timeout time.Duration) *pingerMock {
+	p := &pingerMock{
+		clock:    clock.NewMock(),
+		pings:    make(chan struct{}),
+		timeouts: make(chan struct{}),
+	}
+
+	p.pinger = server.NewPinger(ctx, server.PingerParams{
+		Clock:    p.clock,
+		Interval: time.Second,
+		Timeout:  timeout,
+		Ping: func() {
+			p.pings <- struct{}{}
+		},
+		OnTimeout: func() {
+			close(p.timeouts)
+		},
+	})
+
+	return p
+}
+
+// tick advances the clock by one interval and waits for the ping or the
+// timeout, whichever is expected.
+func (p *pingerMock) tick(t *testing.T, wantTimeout bool) {
+	t.Helper()
+
+	p.clock.Add(time.Second)
+
+	select {
+	case <-p.pings:
+		require.False(t, wantTimeout, "expected timeout, but got ping")
+	case <-p.timeouts:
+		require.True(t, wantTimeout, "expected ping, but got timeout")
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for ping")
+	}
+}
+
 func TestPinger(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
+	t.Run("pongs received", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		p := newPingerMock(ctx, 3*time.Second)
 
-	count := int64(0)
+		for i := 0; i < 10; i++ {
+			p.tick(t, false)
+			p.pinger.ReceivePong()
+		}
 
-	pinger := server.NewPinger(ctx, 5*time.Millisecond, func() {
-		atomic.AddInt64(&count, 1)
+		cancel()
+
+		p.pinger.ReceivePong()
 	})
 
-	for atomic.LoadInt64(&count) < 5 {
-		require.NoError(t, ctx.Err())
-		time.Sleep(1 * time.Millisecond)
-	}
+	t.Run("pong timeout", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		p := newPingerMock(ctx, 3*time.Second)
 
-	pinger.ReceivePong()
-	pinger.ReceivePong()
+		p.tick(t, false)
+		p.tick(t, false)
+		p.tick(t, false)
+		p.tick(t, true)
 
-	cancel()
+		// No more pings are sent after the timeout.
+		p.clock.Add(time.Second)
 
-	pinger.ReceivePong()
+		select {
+		case <-p.pings:
+			require.FailNow(t, "unexpected ping after timeout")
+		case <-time.After(10 * time.Millisecond):
+		}
+	})
+
+	t.Run("timeout disabled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		p := newPingerMock(ctx, 0)
+
+		for i := 0; i < 10; i++ {
+			p.tick(t, false)
+		}
+	})
 }
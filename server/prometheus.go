@@ -35,6 +35,11 @@ var prometheusWSConnErrTotal = promauto.NewCounter(prometheus.CounterOpts{
 	Help: "Total number of errored out websocket connections",
 })
 
+var prometheusWSPongTimeoutTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "ws_pong_timeout_total",
+	Help: "Total number of websocket connections closed because of a pong timeout",
+})
+
 var prometheusWSConnDuration = promauto.NewHistogram(prometheus.HistogramOpts{
 	Name:    "ws_conn_duration",
 	Help:    "Duration of websocket connections",
@@ -61,3 +66,28 @@ var prometheusWebRTCConnDuration = promauto.NewHistogram(prometheus.HistogramOpt
 	Help:    "Duration of webrtc connections",
 	Buckets: []float64{1, 60, 5 * 60, 15 * 60, 30 * 60, 45 * 60, 60 * 60, 120 * 60},
 })
+
+var prometheusDraining = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "draining",
+	Help: "Set to 1 while the server is draining",
+})
+
+var prometheusConfigReloadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "config_reloads_total",
+	Help: "Total number of config reloads by result",
+}, []string{"result"})
+
+var prometheusChatMessagesTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "chat_messages_total",
+	Help: "Total number of chat messages relayed by the server",
+})
+
+var prometheusTURNAuthTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "turn_auth_total",
+	Help: "Total number of TURN authentications by result",
+}, []string{"result"})
+
+var prometheusHybridSwitchesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "hybrid_switches_total",
+	Help: "Total number of hybrid network rooms switched to mesh or sfu",
+}, []string{"network"})
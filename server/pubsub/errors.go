@@ -6,4 +6,5 @@ var (
 	ErrTrackNotFound       = errors.New("track not found")
 	ErrSubNotFound         = errors.New("subscriber not found")
 	ErrSubscribeToOwnTrack = errors.New("cannot subscribe to own track")
+	ErrPublishNotAllowed   = errors.New("viewer cannot publish")
 )
@@ -0,0 +1,212 @@
+package pubsub
+
+import (
+	"strings"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// keyframeCacheMaxPackets is the maximum number of packets kept in the cache,
+// including the keyframe packets. When a publisher does not send keyframes
+// often enough, the cache is invalidated until the next keyframe arrives.
+const keyframeCacheMaxPackets = 1024
+
+// keyframeCache keeps the most recent keyframe of a video track and all of the
+// packets that followed it so that new subscribers can start decoding the
+// video immediately, instead of waiting for the publisher to send the next
+// keyframe. The user of this implementation must implement locking.
+type keyframeCache struct {
+	isKeyframe func(payload []byte) bool
+	maxPackets int
+
+	// packets contains the keyframe and subsequent packets in the order of
+	// arrival. Packets is nil when the cache is invalid.
+	packets []*rtp.Packet
+	// timestamp is the RTP timestamp of the cached keyframe. Keyframes can be
+	// split across multiple packets (e.g. H264 SPS, PPS and IDR), and they
+	// will all share the same timestamp.
+	timestamp uint32
+}
+
+// newKeyframeCache creates a new keyframeCache for tracks of mimeType. It
+// returns nil when keyframes for this mimeType cannot be detected, for
+// example for audio tracks.
+func newKeyframeCache(mimeType string, maxPackets int) *keyframeCache {
+	var isKeyframe func(payload []byte) bool
+
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		isKeyframe = isVP8Keyframe
+	case strings.ToLower(webrtc.MimeTypeH264):
+		isKeyframe = isH264Keyframe
+	default:
+		return nil
+	}
+
+	return &keyframeCache{
+		isKeyframe: isKeyframe,
+		maxPackets: maxPackets,
+	}
+}
+
+// Push adds the packet to the cache. When the packet is the start of a new
+// keyframe, the previously cached packets are discarded.
+func (c *keyframeCache) Push(packet *rtp.Packet) {
+	if c.isKeyframe(packet.Payload) {
+		if c.packets == nil || packet.Timestamp != c.timestamp {
+			c.packets = make([]*rtp.Packet, 0, c.maxPackets)
+			c.timestamp = packet.Timestamp
+		}
+
+		c.append(packet)
+
+		return
+	}
+
+	if c.packets == nil {
+		return
+	}
+
+	// Ignore packets that arrived late and belong before the keyframe.
+	if int16(packet.SequenceNumber-c.packets[0].SequenceNumber) < 0 {
+		return
+	}
+
+	c.append(packet)
+}
+
+func (c *keyframeCache) append(packet *rtp.Packet) {
+	if len(c.packets) >= c.maxPackets {
+		c.packets = nil
+
+		return
+	}
+
+	c.packets = append(c.packets, packet)
+}
+
+// Packets returns the cached packets, starting with the keyframe. It returns
+// nil when there is no valid keyframe in the cache. The returned slice must
+// not be modified.
+func (c *keyframeCache) Packets() []*rtp.Packet {
+	if c == nil {
+		return nil
+	}
+
+	return c.packets
+}
+
+// isVP8Keyframe parses the VP8 payload descriptor and the VP8 payload header
+// and returns true if the payload is the first partition of a keyframe.
+//
+// See https://tools.ietf.org/html/rfc7741#section-4.2
+func isVP8Keyframe(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+
+	const (
+		bitX = 0x80
+		bitS = 0x10
+		bitI = 0x80
+		bitL = 0x40
+		bitT = 0x20
+		bitK = 0x10
+		bitM = 0x80
+	)
+
+	descriptor := payload[0]
+
+	// Only the start of partition 0 contains the payload header.
+	if descriptor&bitS == 0 || descriptor&0x07 != 0 {
+		return false
+	}
+
+	offset := 1
+
+	if descriptor&bitX != 0 {
+		if len(payload) < offset+1 {
+			return false
+		}
+
+		ext := payload[offset]
+		offset++
+
+		if ext&bitI != 0 {
+			if len(payload) < offset+1 {
+				return false
+			}
+
+			if payload[offset]&bitM != 0 {
+				offset++
+			}
+
+			offset++
+		}
+
+		if ext&bitL != 0 {
+			offset++
+		}
+
+		if ext&(bitT|bitK) != 0 {
+			offset++
+		}
+	}
+
+	if len(payload) < offset+1 {
+		return false
+	}
+
+	// The P bit of the payload header is 0 for keyframes.
+	return payload[offset]&0x01 == 0
+}
+
+// isH264Keyframe returns true when the payload contains an SPS or an IDR NAL
+// unit, either as a single NAL unit, aggregated in a STAP-A packet or as the
+// start of a FU-A fragmented unit.
+//
+// See https://tools.ietf.org/html/rfc6184#section-5.2
+func isH264Keyframe(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+
+	const (
+		naluTypeIDR  = 5
+		naluTypeSPS  = 7
+		naluTypeSTAP = 24
+		naluTypeFUA  = 28
+
+		naluTypeMask = 0x1F
+		fuStartBit   = 0x80
+	)
+
+	isKeyframeNALU := func(naluType byte) bool {
+		return naluType == naluTypeIDR || naluType == naluTypeSPS
+	}
+
+	switch naluType := payload[0] & naluTypeMask; naluType {
+	case naluTypeSTAP:
+		for offset := 1; offset+2 < len(payload); {
+			size := int(payload[offset])<<8 | int(payload[offset+1])
+			offset += 2
+
+			if isKeyframeNALU(payload[offset] & naluTypeMask) {
+				return true
+			}
+
+			offset += size
+		}
+
+		return false
+	case naluTypeFUA:
+		if len(payload) < 2 {
+			return false
+		}
+
+		return payload[1]&fuStartBit != 0 && isKeyframeNALU(payload[1]&naluTypeMask)
+	default:
+		return isKeyframeNALU(naluType)
+	}
+}
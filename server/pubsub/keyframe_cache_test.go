@@ -0,0 +1,163 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsVP8Keyframe(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		descr   string
+		payload []byte
+		want    bool
+	}
+
+	testCases := []testCase{
+		{"empty", nil, false},
+		{"keyframe, no extensions", []byte{0x10, 0x00}, true},
+		{"interframe, no extensions", []byte{0x10, 0x01}, false},
+		{"keyframe, not a partition start", []byte{0x00, 0x00}, false},
+		{"keyframe, partition 1", []byte{0x11, 0x00}, false},
+		{"keyframe, 7-bit picture id", []byte{0x90, 0x80, 0x05, 0x00}, true},
+		{"keyframe, 15-bit picture id", []byte{0x90, 0x80, 0x85, 0x05, 0x00}, true},
+		{"interframe, 15-bit picture id", []byte{0x90, 0x80, 0x85, 0x05, 0x01}, false},
+		{"keyframe, all extensions", []byte{0x90, 0xF0, 0x85, 0x05, 0x01, 0x02, 0x00}, true},
+		{"truncated", []byte{0x90, 0xF0, 0x85}, false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, isVP8Keyframe(tc.payload), tc.descr)
+	}
+}
+
+func TestIsH264Keyframe(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		descr   string
+		payload []byte
+		want    bool
+	}
+
+	testCases := []testCase{
+		{"empty", nil, false},
+		{"single IDR", []byte{0x65, 0x00}, true},
+		{"single SPS", []byte{0x67, 0x00}, true},
+		{"single non-IDR", []byte{0x41, 0x00}, false},
+		{"STAP-A with SPS and PPS", []byte{0x18, 0x00, 0x02, 0x67, 0x00, 0x00, 0x02, 0x68, 0x00}, true},
+		{"STAP-A without keyframe", []byte{0x18, 0x00, 0x02, 0x06, 0x00, 0x00, 0x02, 0x68, 0x00}, false},
+		{"FU-A IDR start", []byte{0x7C, 0x85, 0x00}, true},
+		{"FU-A IDR middle", []byte{0x7C, 0x05, 0x00}, false},
+		{"FU-A non-IDR start", []byte{0x7C, 0x81, 0x00}, false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, isH264Keyframe(tc.payload), tc.descr)
+	}
+}
+
+func TestKeyframeCache(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newKeyframeCache(webrtc.MimeTypeOpus, 4))
+
+	c := newKeyframeCache(webrtc.MimeTypeVP8, 4)
+
+	keyframe := []byte{0x10, 0x00}
+	interframe := []byte{0x10, 0x01}
+
+	packet := func(seq uint16, ts uint32, payload []byte) *rtp.Packet {
+		return &rtp.Packet{
+			Header: rtp.Header{
+				SequenceNumber: seq,
+				Timestamp:      ts,
+			},
+			Payload: payload,
+		}
+	}
+
+	seqs := func() (ret []uint16) {
+		for _, p := range c.Packets() {
+			ret = append(ret, p.SequenceNumber)
+		}
+
+		return ret
+	}
+
+	c.Push(packet(1, 100, interframe))
+	assert.Nil(t, seqs(), "no keyframe yet")
+
+	c.Push(packet(2, 200, keyframe))
+	c.Push(packet(3, 200, keyframe))
+	assert.Equal(t, []uint16{2, 3}, seqs(), "keyframe split across packets")
+
+	c.Push(packet(5, 300, interframe))
+	c.Push(packet(1, 100, interframe))
+	assert.Equal(t, []uint16{2, 3, 5}, seqs(), "late packets are ignored")
+
+	c.Push(packet(6, 400, keyframe))
+	assert.Equal(t, []uint16{6}, seqs(), "new keyframe")
+
+	c.Push(packet(7, 500, interframe))
+	c.Push(packet(8, 500, interframe))
+	c.Push(packet(9, 500, interframe))
+	assert.Equal(t, []uint16{6, 7, 8, 9}, seqs())
+
+	c.Push(packet(10, 600, interframe))
+	assert.Nil(t, seqs(), "invalidated after max packets")
+
+	c.Push(packet(11, 600, interframe))
+	assert.Nil(t, seqs(), "still invalid")
+
+	c.Push(packet(12, 700, keyframe))
+	assert.Equal(t, []uint16{12}, seqs(), "valid again")
+}
+
+func TestSequenceRewriter(t *testing.T) {
+	t.Parallel()
+
+	packet := func(seq uint16) *rtp.Packet {
+		return &rtp.Packet{
+			Header: rtp.Header{
+				SequenceNumber: seq,
+			},
+		}
+	}
+
+	seqs := func(packets []*rtp.Packet) []uint16 {
+		var ret []uint16
+		for _, p := range packets {
+			ret = append(ret, p.SequenceNumber)
+		}
+
+		return ret
+	}
+
+	var r sequenceRewriter
+
+	cached := []*rtp.Packet{packet(65533), packet(65535), packet(2)}
+
+	assert.Equal(t, []uint16{65533, 65534, 65535}, seqs(r.Replay(cached)), "first replay")
+	assert.Equal(t, uint16(2), cached[2].SequenceNumber, "original not modified")
+
+	assert.Equal(t, uint16(0), r.Rewrite(packet(3)).SequenceNumber)
+	assert.Equal(t, uint16(1), r.Rewrite(packet(4)).SequenceNumber)
+
+	// The cache is replayed again after the track was not demanded. The
+	// replayed packets continue after the last written packet even though
+	// the cached keyframe is older.
+	cached = []*rtp.Packet{packet(65533), packet(65535), packet(2), packet(3), packet(4), packet(8)}
+
+	assert.Equal(t, []uint16{2, 3, 4, 5, 6, 7}, seqs(r.Replay(cached)), "second replay")
+	assert.Equal(t, uint16(8), r.Rewrite(packet(9)).SequenceNumber)
+
+	var noOffset sequenceRewriter
+
+	p := packet(3)
+	assert.Same(t, p, noOffset.Rewrite(p), "no offset")
+}
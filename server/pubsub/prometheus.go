@@ -40,3 +40,8 @@ var prometheusRTPPacketsSentBytes = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "rtp_packets_sent2_bytes_total",
 	Help: "Total number of sent RTP bytes",
 })
+
+var prometheusKeyframeCacheReplays = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "rtp_keyframe_cache_replays_total",
+	Help: "Total number of times cached keyframes were replayed to new subscribers",
+})
@@ -35,6 +35,9 @@ type PubSub struct {
 	// subsBySubClientID is a map of a set of publishers that the transport has
 	// subscribed to.
 	subsBySubClientID map[identifiers.ClientID]subscriber
+
+	// viewers is a set of clients that are not allowed to publish tracks.
+	viewers map[identifiers.ClientID]struct{}
 }
 
 type publisher struct {
@@ -61,13 +64,36 @@ func New(log logger.Logger, cl clock.Clock) *PubSub {
 		publishers:              map[identifiers.TrackID]publisher{},
 		publishersByPubClientID: map[identifiers.ClientID]readerSet{},
 		subsBySubClientID:       map[identifiers.ClientID]subscriber{},
+		viewers:                 map[identifiers.ClientID]struct{}{},
+	}
+}
+
+// SetViewer sets whether the client is a viewer. The tracks of viewers are
+// refused by Pub. It does not affect the tracks that are already published.
+func (p *PubSub) SetViewer(clientID identifiers.ClientID, viewer bool) {
+	if viewer {
+		p.viewers[clientID] = struct{}{}
+	} else {
+		delete(p.viewers, clientID)
 	}
 }
 
-// Pub publishes a track.
-func (p *PubSub) Pub(pubClientID identifiers.ClientID, reader Reader) {
+// Viewer returns true when the client is a viewer.
+func (p *PubSub) Viewer(clientID identifiers.ClientID) bool {
+	_, ok := p.viewers[clientID]
+
+	return ok
+}
+
+// Pub publishes a track. It returns ErrPublishNotAllowed when the client is
+// a viewer.
+func (p *PubSub) Pub(pubClientID identifiers.ClientID, reader Reader) error {
 	track := reader.Track()
 
+	if p.Viewer(pubClientID) {
+		return errors.Annotatef(ErrPublishNotAllowed, "pub: client: %s", pubClientID)
+	}
+
 	p.log.Info("Pub", logger.Ctx{
 		"client_id": pubClientID,
 		"track_id":  track.TrackID(),
@@ -96,6 +122,8 @@ func (p *PubSub) Pub(pubClientID identifiers.ClientID, reader Reader) {
 		PubTrack: newPubTrack(pubClientID, track),
 		Type:     transport.TrackEventTypeAdd,
 	}
+
+	return nil
 }
 
 // Unpub unpublishes a track as well as unsubs all subscribers.
@@ -282,6 +310,7 @@ type TrackProps struct {
 	ClientID identifiers.ClientID
 	SSRC     webrtc.SSRC
 	RID      string
+	Kind     transport.TrackKind
 }
 
 // ClientIDByTrackID returns the clientID from a published unique trackID.
@@ -296,6 +325,7 @@ func (p *PubSub) TrackPropsByTrackID(trackID identifiers.TrackID) (TrackProps, b
 		ClientID: pub.clientID,
 		SSRC:     pub.reader.SSRC(),
 		RID:      pub.reader.RID(),
+		Kind:     pub.reader.Track().Codec().TrackKind(),
 	}, true
 }
 
@@ -316,6 +346,11 @@ func (p *PubSub) Tracks() []PubTrack {
 	return ret
 }
 
+// PubTracksCount returns the number of tracks published by the client.
+func (p *PubSub) PubTracksCount(pubClientID identifiers.ClientID) int {
+	return len(p.publishersByPubClientID[pubClientID])
+}
+
 // SubscribeToEvents creates a new subscription to track events.
 func (p *PubSub) SubscribeToEvents(clientID identifiers.ClientID) (<-chan PubTrackEvent, error) {
 	p.log.Trace("SubscribeToEvents", logger.Ctx{
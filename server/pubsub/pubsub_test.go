@@ -410,7 +410,7 @@ func TestPubSub(t *testing.T) {
 
 		switch {
 		case tc.pub != nil:
-			ps.Pub(tc.pub.clientID, newReaderMock(tc.pub.track))
+			err = ps.Pub(tc.pub.clientID, newReaderMock(tc.pub.track))
 		case tc.unpub != nil:
 			ps.Unpub(tc.unpub.clientID, tc.unpub.trackID)
 		case tc.sub != nil:
@@ -451,6 +451,35 @@ func TestPubSub(t *testing.T) {
 	}
 }
 
+func TestPubSub_viewer(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ps := pubsub.New(logger.NewFromEnv("LOG"), clock.New())
+
+	defer ps.Close()
+
+	codec := transport.Codec{
+		MimeType:    "audio/opus",
+		ClockRate:   48000,
+		Channels:    2,
+		SDPFmtpLine: "",
+	}
+
+	ps.SetViewer("a", true)
+	assert.True(t, ps.Viewer("a"))
+
+	err := ps.Pub("a", newReaderMock(transport.NewSimpleTrack("track1", "A", codec, "a")))
+	assert.Equal(t, pubsub.ErrPublishNotAllowed, errors.Cause(err))
+	assert.Equal(t, 0, ps.PubTracksCount("a"))
+
+	ps.SetViewer("a", false)
+	assert.False(t, ps.Viewer("a"))
+
+	err = ps.Pub("a", newReaderMock(transport.NewSimpleTrack("track1", "A", codec, "a")))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ps.PubTracksCount("a"))
+}
+
 type transportMock struct {
 	clientID    identifiers.ClientID
 	addedTracks map[identifiers.TrackID]transport.Track
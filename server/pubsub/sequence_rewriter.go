@@ -0,0 +1,67 @@
+package pubsub
+
+import "github.com/pion/rtp"
+
+// sequenceRewriter rewrites RTP sequence numbers of packets written to a
+// single subscriber. Packets replayed from the keyframeCache are renumbered
+// consecutively, right after the last packet written to the subscriber, and
+// the live packets that follow are shifted by the same offset. This keeps the
+// sequence numbers seen by the subscriber increasing without gaps across
+// replays, so it does not send NACKs for packets that never made it to the
+// cache or were skipped while the track was not demanded.
+type sequenceRewriter struct {
+	offset uint16
+	// last is the last sequence number written to the subscriber.
+	last uint16
+	// started is true after the first packet was written.
+	started bool
+}
+
+// Replay returns copies of packets with consecutive sequence numbers. The
+// first one is numbered right after the last written packet, or keeps its
+// sequence number when no packet was written yet. The offset for subsequent
+// calls to Rewrite is adjusted so that live packets continue right after the
+// last replayed packet.
+func (r *sequenceRewriter) Replay(packets []*rtp.Packet) []*rtp.Packet {
+	if len(packets) == 0 {
+		return nil
+	}
+
+	first := packets[0].SequenceNumber
+	if r.started {
+		first = r.last + 1
+	}
+
+	ret := make([]*rtp.Packet, len(packets))
+
+	for i, packet := range packets {
+		ret[i] = withSequenceNumber(packet, first+uint16(i))
+	}
+
+	r.last = first + uint16(len(packets)-1)
+	r.offset = r.last - packets[len(packets)-1].SequenceNumber
+	r.started = true
+
+	return ret
+}
+
+// Rewrite returns the packet with the sequence number shifted by the current
+// offset. The original packet is never modified because it is shared between
+// subscribers.
+func (r *sequenceRewriter) Rewrite(packet *rtp.Packet) *rtp.Packet {
+	r.last = packet.SequenceNumber + r.offset
+	r.started = true
+
+	if r.offset == 0 {
+		return packet
+	}
+
+	return withSequenceNumber(packet, r.last)
+}
+
+func withSequenceNumber(packet *rtp.Packet, sequenceNumber uint16) *rtp.Packet {
+	p := *packet
+	p.Header.SequenceNumber = sequenceNumber
+
+	return &p
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 	"github.com/peer-calls/peer-calls/v4/server/multierr"
 	"github.com/peer-calls/peer-calls/v4/server/transport"
+	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v3"
 )
 
@@ -27,7 +28,25 @@ type TrackReader struct {
 	onClose func()
 
 	trackRemote transport.TrackRemote
-	subs        map[identifiers.ClientID]transport.TrackLocal
+	subs        map[identifiers.ClientID]*trackSub
+
+	// subscribed is true when trackRemote was subscribed to because at least
+	// one of the subs demands the packets.
+	subscribed bool
+
+	// keyframeCache will be nil for tracks that do not support it.
+	keyframeCache *keyframeCache
+}
+
+// trackSub contains the state of a single subscription to the track.
+type trackSub struct {
+	trackLocal transport.TrackLocal
+	// bound will be closed once the trackLocal is ready for writing.
+	bound <-chan struct{}
+	// started is set to true after the first packet has been written.
+	started bool
+
+	sequenceRewriter sequenceRewriter
 }
 
 var _ Reader = &TrackReader{}
@@ -37,7 +56,12 @@ func NewTrackReader(trackRemote transport.TrackRemote, onClose func()) *TrackRea
 		onClose: onClose,
 
 		trackRemote: trackRemote,
-		subs:        map[identifiers.ClientID]transport.TrackLocal{},
+		subs:        map[identifiers.ClientID]*trackSub{},
+
+		keyframeCache: newKeyframeCache(
+			trackRemote.Track().Codec().MimeType,
+			keyframeCacheMaxPackets,
+		),
 	}
 
 	go t.startReadLoop()
@@ -59,22 +83,37 @@ func (t *TrackReader) startReadLoop() {
 
 		t.mu.Lock()
 
-		numSent := float64(0)
+		if t.keyframeCache != nil {
+			t.keyframeCache.Push(packet)
+		}
 
-		for key, trackLocal := range t.subs {
-			if err := trackLocal.WriteRTP(packet); err != nil {
-				if multierr.Is(err, io.ErrClosedPipe) {
-					_ = t.unsub(key)
-				}
+		writes := make([]trackWrite, 0, len(t.subs))
 
-				continue
+		for key, sub := range t.subs {
+			if packets := t.packets(sub, packet); len(packets) > 0 {
+				writes = append(writes, trackWrite{
+					subClientID: key,
+					trackLocal:  sub.trackLocal,
+					packets:     packets,
+				})
 			}
-
-			numSent++
 		}
 
 		t.mu.Unlock()
 
+		// The packets are written without holding the lock so a slow
+		// subscriber, or a replay of the cache, does not block the others.
+		numSent := float64(0)
+
+		for _, w := range writes {
+			n, err := w.write()
+			numSent += float64(n)
+
+			if err != nil && multierr.Is(err, io.ErrClosedPipe) {
+				t.unsubTrack(w.subClientID, w.trackLocal)
+			}
+		}
+
 		packetSize := float64(packet.MarshalSize())
 
 		prometheusRTPPacketsReceived.Inc()
@@ -92,6 +131,64 @@ func (t *TrackReader) startReadLoop() {
 	t.mu.Unlock()
 }
 
+// trackWrite contains the packets to write to a single subscriber.
+type trackWrite struct {
+	subClientID identifiers.ClientID
+	trackLocal  transport.TrackLocal
+	packets     []*rtp.Packet
+}
+
+// write writes the packets and returns the number of packets written.
+func (w trackWrite) write() (int, error) {
+	for i, p := range w.packets {
+		if err := w.trackLocal.WriteRTP(p); err != nil {
+			return i, errors.Trace(err)
+		}
+	}
+
+	return len(w.packets), nil
+}
+
+// packets returns the packets to write to the subscriber. The first write to
+// a subscriber replays the packets from the keyframeCache, if available, so
+// the subscriber does not have to wait for the next keyframe. The sequence
+// numbers are rewritten per subscriber so that they stay contiguous across
+// replays. The caller must hold the lock and must have already pushed the
+// packet to the keyframeCache.
+func (t *TrackReader) packets(sub *trackSub, packet *rtp.Packet) []*rtp.Packet {
+	if !isDemanded(sub.trackLocal) {
+		// Replay the cache once the track is demanded again.
+		sub.started = false
+
+		return nil
+	}
+
+	if sub.started {
+		return []*rtp.Packet{sub.sequenceRewriter.Rewrite(packet)}
+	}
+
+	select {
+	case <-sub.bound:
+	default:
+		// Packets written to a track that has not been bound yet would be
+		// dropped, so we wait so the cached packets can be replayed.
+		return nil
+	}
+
+	sub.started = true
+
+	// When the cache is valid, the last cached packet is the current packet.
+	// Replay returns copies because the cache is modified by the next packets.
+	packets := sub.sequenceRewriter.Replay(t.keyframeCache.Packets())
+	if len(packets) == 0 {
+		return []*rtp.Packet{sub.sequenceRewriter.Rewrite(packet)}
+	}
+
+	prometheusKeyframeCacheReplays.Inc()
+
+	return packets
+}
+
 func (t *TrackReader) Sub(subClientID identifiers.ClientID, trackLocal transport.TrackLocal) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -106,32 +203,101 @@ func (t *TrackReader) Sub(subClientID identifiers.ClientID, trackLocal transport
 		return errors.Errorf("already subscribed")
 	}
 
-	t.subs[subClientID] = trackLocal
+	sub := &trackSub{
+		trackLocal: trackLocal,
+		bound:      closedChan,
+		// Tracks without a cache have nothing to replay so there is no need to
+		// wait for them to be bound.
+		started: t.keyframeCache == nil,
+	}
+
+	if b, ok := trackLocal.(boundable); ok {
+		sub.bound = b.Bound()
+	}
+
+	t.subs[subClientID] = sub
+
+	if d, ok := trackLocal.(demander); ok {
+		d.OnDemandChange(t.handleDemandChange)
+	}
+
+	_ = t.updateSubscription()
+
+	return nil
+}
+
+func (t *TrackReader) handleDemandChange() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return
+	}
+
+	_ = t.updateSubscription()
+}
+
+// updateSubscription subscribes to trackRemote when at least one of the subs
+// demands the packets and unsubscribes after none do. This way the tracks
+// from other nodes are only received while there is someone to forward them
+// to. The caller must hold the lock.
+func (t *TrackReader) updateSubscription() error {
+	demanded := false
+
+	for _, sub := range t.subs {
+		if isDemanded(sub.trackLocal) {
+			demanded = true
+
+			break
+		}
+	}
+
+	if demanded == t.subscribed {
+		return nil
+	}
+
+	t.subscribed = demanded
 
 	// TODO do not block network IO.
-	if sub, ok := t.trackRemote.(subscribable); ok {
-		_ = sub.Subscribe()
+	if demanded {
+		if sub, ok := t.trackRemote.(subscribable); ok {
+			return errors.Annotate(sub.Subscribe(), "Subscribe")
+		}
+
+		return nil
+	}
+
+	if unsub, ok := t.trackRemote.(unsubscribable); ok {
+		return errors.Annotate(unsub.Unsubscribe(), "Unsubscribe")
 	}
 
 	return nil
 }
 
 func (t *TrackReader) unsub(subClientID identifiers.ClientID) error {
-	var err error
-
-	if _, ok := t.subs[subClientID]; !ok {
+	sub, ok := t.subs[subClientID]
+	if !ok {
 		return errors.Errorf("track not found: %v", subClientID)
 	}
 
 	delete(t.subs, subClientID)
 
-	// TODO do not block network IO.
-	if unsub, ok := t.trackRemote.(unsubscribable); ok {
-		err = unsub.Unsubscribe()
-		err = errors.Annotate(err, "Unsubscribe")
+	if d, ok := sub.trackLocal.(demander); ok {
+		d.OnDemandChange(nil)
 	}
 
-	return errors.Trace(err)
+	return errors.Trace(t.updateSubscription())
+}
+
+// unsubTrack removes the subscription when it still writes to trackLocal. The
+// client might have subscribed again while the packets were being written.
+func (t *TrackReader) unsubTrack(subClientID identifiers.ClientID, trackLocal transport.TrackLocal) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if sub, ok := t.subs[subClientID]; ok && sub.trackLocal == trackLocal {
+		_ = t.unsub(subClientID)
+	}
 }
 
 func (t *TrackReader) Unsub(subClientID identifiers.ClientID) error {
@@ -168,6 +334,37 @@ func (t *TrackReader) RID() string {
 	return t.trackRemote.RID()
 }
 
+// boundable is implemented by local tracks that drop any packets written
+// before they are bound, e.g. before the WebRTC negotiation has completed.
+type boundable interface {
+	Bound() <-chan struct{}
+}
+
+// closedChan is used for tracks that are not boundable.
+// nolint:gochecknoglobals
+var closedChan = func() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+
+	return ch
+}()
+
+// demander is implemented by local tracks that only want the packets while
+// there is demand for them, e.g. tracks sent to other nodes are only demanded
+// while the other node has subscribers.
+type demander interface {
+	Demanded() bool
+	OnDemandChange(fn func())
+}
+
+func isDemanded(trackLocal transport.TrackLocal) bool {
+	if d, ok := trackLocal.(demander); ok {
+		return d.Demanded()
+	}
+
+	return true
+}
+
 type subscribable interface {
 	Subscribe() error
 }
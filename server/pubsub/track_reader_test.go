@@ -0,0 +1,346 @@
+package pubsub_test
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server/pubsub"
+	"github.com/peer-calls/peer-calls/v4/server/transport"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestTrackReader_keyframeCache(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	codec := transport.Codec{
+		MimeType:  webrtc.MimeTypeVP8,
+		ClockRate: 90000,
+	}
+
+	track := transport.NewSimpleTrack("track1", "stream1", codec, "peer1")
+
+	trackRemote := newTrackRemoteMock(track)
+
+	closed := make(chan struct{})
+
+	reader := pubsub.NewTrackReader(trackRemote, func() {
+		close(closed)
+	})
+
+	keyframe := []byte{0x10, 0x00}
+	interframe := []byte{0x10, 0x01}
+
+	trackRemote.packets <- newPacket(10, 1, interframe)
+	trackRemote.packets <- newPacket(11, 2, keyframe)
+	trackRemote.packets <- newPacket(13, 3, interframe)
+
+	sub1 := newBoundableTrackLocalMock(track)
+
+	assert.NoError(t, reader.Sub("sub1", sub1))
+
+	trackRemote.packets <- newPacket(14, 4, interframe)
+
+	assert.Nil(t, sub1.sequenceNumbers(), "should not write before bound")
+
+	close(sub1.bound)
+
+	trackRemote.packets <- newPacket(15, 5, interframe)
+	trackRemote.packets <- newPacket(16, 6, interframe)
+
+	close(trackRemote.packets)
+	<-closed
+
+	// The replayed packets are renumbered consecutively.
+	assert.Equal(t, []uint16{11, 12, 13, 14, 15}, sub1.sequenceNumbers())
+	assert.Equal(t, []uint32{2, 3, 4, 5, 6}, sub1.timestamps())
+}
+
+func TestTrackReader_demand(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	codec := transport.Codec{
+		MimeType:  webrtc.MimeTypeOpus,
+		ClockRate: 48000,
+		Channels:  2,
+	}
+
+	track := transport.NewSimpleTrack("track1", "stream1", codec, "peer1")
+
+	trackRemote := &subscribableTrackRemoteMock{
+		trackRemoteMock: *newTrackRemoteMock(track),
+	}
+
+	closed := make(chan struct{})
+
+	reader := pubsub.NewTrackReader(trackRemote, func() {
+		close(closed)
+	})
+
+	sub1 := newDemandingTrackLocalMock(track)
+	sub2 := newDemandingTrackLocalMock(track)
+
+	assert.NoError(t, reader.Sub("sub1", sub1))
+	assert.NoError(t, reader.Sub("sub2", sub2))
+	assert.Nil(t, trackRemote.getCalls(), "should not subscribe without demand")
+
+	trackRemote.packets <- newPacket(1, 1, []byte{0x01})
+
+	sub1.setDemanded(true)
+	assert.Equal(t, []string{"sub"}, trackRemote.getCalls())
+
+	trackRemote.packets <- newPacket(2, 2, []byte{0x01})
+
+	assert.Eventually(t, func() bool {
+		return len(sub1.sequenceNumbers()) == 1
+	}, time.Second, time.Millisecond)
+
+	sub2.setDemanded(true)
+	sub1.setDemanded(false)
+	assert.Equal(t, []string{"sub"}, trackRemote.getCalls(), "still demanded by sub2")
+
+	trackRemote.packets <- newPacket(3, 3, []byte{0x01})
+
+	assert.Eventually(t, func() bool {
+		return len(sub2.sequenceNumbers()) == 1
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, reader.Unsub("sub2"))
+	assert.Equal(t, []string{"sub", "unsub"}, trackRemote.getCalls())
+
+	close(trackRemote.packets)
+	<-closed
+
+	assert.Equal(t, []uint16{2}, sub1.sequenceNumbers())
+	assert.Equal(t, []uint16{3}, sub2.sequenceNumbers())
+}
+
+func TestTrackReader_keyframeCache_demandAgain(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	codec := transport.Codec{
+		MimeType:  webrtc.MimeTypeVP8,
+		ClockRate: 90000,
+	}
+
+	track := transport.NewSimpleTrack("track1", "stream1", codec, "peer1")
+
+	trackRemote := newTrackRemoteMock(track)
+
+	closed := make(chan struct{})
+
+	reader := pubsub.NewTrackReader(trackRemote, func() {
+		close(closed)
+	})
+
+	keyframe := []byte{0x10, 0x00}
+	interframe := []byte{0x10, 0x01}
+
+	sub1 := newDemandingTrackLocalMock(track)
+
+	assert.NoError(t, reader.Sub("sub1", sub1))
+
+	trackRemote.packets <- newPacket(10, 1, keyframe)
+	trackRemote.packets <- newPacket(11, 2, interframe)
+
+	sub1.setDemanded(true)
+
+	trackRemote.packets <- newPacket(12, 3, interframe)
+
+	assert.Eventually(t, func() bool {
+		return len(sub1.sequenceNumbers()) == 3
+	}, time.Second, time.Millisecond)
+
+	sub1.setDemanded(false)
+
+	trackRemote.packets <- newPacket(13, 4, interframe)
+	trackRemote.packets <- newPacket(14, 5, interframe)
+
+	// The cache, which still starts with the keyframe, is replayed again.
+	sub1.setDemanded(true)
+
+	trackRemote.packets <- newPacket(15, 6, interframe)
+
+	close(trackRemote.packets)
+	<-closed
+
+	// The sequence numbers continue after the packets written before, instead
+	// of going back to the one of the cached keyframe.
+	assert.Equal(t, []uint16{10, 11, 12, 13, 14, 15, 16, 17, 18}, sub1.sequenceNumbers())
+}
+
+func newPacket(seq uint16, ts uint32, payload []byte) *rtp.Packet {
+	return &rtp.Packet{
+		Header: rtp.Header{
+			SequenceNumber: seq,
+			Timestamp:      ts,
+		},
+		Payload: payload,
+	}
+}
+
+type trackRemoteMock struct {
+	track   transport.Track
+	packets chan *rtp.Packet
+}
+
+func newTrackRemoteMock(track transport.Track) *trackRemoteMock {
+	return &trackRemoteMock{
+		track:   track,
+		packets: make(chan *rtp.Packet),
+	}
+}
+
+var _ transport.TrackRemote = &trackRemoteMock{}
+
+func (t *trackRemoteMock) Track() transport.Track {
+	return t.track
+}
+
+func (t *trackRemoteMock) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	packet, ok := <-t.packets
+	if !ok {
+		return nil, nil, io.EOF
+	}
+
+	return packet, nil, nil
+}
+
+func (t *trackRemoteMock) SSRC() webrtc.SSRC {
+	return 0
+}
+
+func (t *trackRemoteMock) RID() string {
+	return ""
+}
+
+type subscribableTrackRemoteMock struct {
+	trackRemoteMock
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (t *subscribableTrackRemoteMock) Subscribe() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.calls = append(t.calls, "sub")
+
+	return nil
+}
+
+func (t *subscribableTrackRemoteMock) Unsubscribe() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.calls = append(t.calls, "unsub")
+
+	return nil
+}
+
+func (t *subscribableTrackRemoteMock) getCalls() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.calls
+}
+
+type demandingTrackLocalMock struct {
+	boundableTrackLocalMock
+
+	demanded       bool
+	onDemandChange func()
+}
+
+func newDemandingTrackLocalMock(track transport.Track) *demandingTrackLocalMock {
+	t := &demandingTrackLocalMock{
+		boundableTrackLocalMock: *newBoundableTrackLocalMock(track),
+	}
+
+	close(t.bound)
+
+	return t
+}
+
+func (t *demandingTrackLocalMock) Demanded() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.demanded
+}
+
+func (t *demandingTrackLocalMock) OnDemandChange(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onDemandChange = fn
+}
+
+func (t *demandingTrackLocalMock) setDemanded(demanded bool) {
+	t.mu.Lock()
+	t.demanded = demanded
+	onDemandChange := t.onDemandChange
+	t.mu.Unlock()
+
+	if onDemandChange != nil {
+		onDemandChange()
+	}
+}
+
+type boundableTrackLocalMock struct {
+	trackLocalMock
+
+	mu      sync.Mutex
+	bound   chan struct{}
+	written []*rtp.Packet
+}
+
+func newBoundableTrackLocalMock(track transport.Track) *boundableTrackLocalMock {
+	return &boundableTrackLocalMock{
+		trackLocalMock: trackLocalMock{
+			track: track,
+		},
+		bound: make(chan struct{}),
+	}
+}
+
+func (t *boundableTrackLocalMock) Bound() <-chan struct{} {
+	return t.bound
+}
+
+func (t *boundableTrackLocalMock) WriteRTP(packet *rtp.Packet) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.written = append(t.written, packet)
+
+	return nil
+}
+
+func (t *boundableTrackLocalMock) sequenceNumbers() (ret []uint16) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, p := range t.written {
+		ret = append(ret, p.SequenceNumber)
+	}
+
+	return ret
+}
+
+func (t *boundableTrackLocalMock) timestamps() (ret []uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, p := range t.written {
+		ret = append(ret, p.Timestamp)
+	}
+
+	return ret
+}
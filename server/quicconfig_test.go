@@ -0,0 +1,90 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCA(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "peercalls"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return key, cert
+}
+
+func TestNewQUICTLSConfig_Disabled(t *testing.T) {
+	config, err := server.NewQUICTLSConfig(server.TransportDTLSConfig{})
+	require.NoError(t, err)
+
+	assert.Len(t, config.Certificates, 1)
+	assert.True(t, config.InsecureSkipVerify)
+}
+
+func TestNewQUICTLSConfig_PSK(t *testing.T) {
+	_, err := server.NewQUICTLSConfig(server.TransportDTLSConfig{
+		Enabled:  true,
+		Identity: "node1",
+		PSK: map[string]string{
+			"node2": "0a0b0c",
+		},
+	})
+	assert.Error(t, err, "psk is not supported")
+}
+
+func TestNewQUICTLSConfig_Cert(t *testing.T) {
+	dir := t.TempDir()
+
+	key, cert := newTestCA(t)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	c := server.TransportDTLSConfig{
+		Enabled: true,
+		Cert:    filepath.Join(dir, "node.pem"),
+		Key:     filepath.Join(dir, "node.key"),
+		CA:      filepath.Join(dir, "ca.pem"),
+	}
+
+	writePEM(t, c.Cert, "CERTIFICATE", cert)
+	writePEM(t, c.Key, "EC PRIVATE KEY", keyDER)
+	writePEM(t, c.CA, "CERTIFICATE", cert)
+
+	config, err := server.NewQUICTLSConfig(c)
+	require.NoError(t, err)
+
+	assert.Len(t, config.Certificates, 1)
+
+	assert.NoError(t, config.VerifyPeerCertificate([][]byte{cert}, nil))
+
+	_, otherCert := newTestCA(t)
+
+	assert.Error(t, config.VerifyPeerCertificate([][]byte{otherCert}, nil), "unknown CA")
+	assert.Error(t, config.VerifyPeerCertificate(nil, nil), "no certificate")
+}
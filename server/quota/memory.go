@@ -0,0 +1,63 @@
+package quota
+
+import (
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// Memory keeps the sets in memory, so they are only shared within a single
+// node.
+type Memory struct {
+	mu   sync.Mutex
+	sets map[string]map[string]struct{}
+}
+
+var _ Quota = &Memory{}
+
+// NewMemory creates a new instance of Memory.
+func NewMemory() *Memory {
+	return &Memory{
+		sets: map[string]map[string]struct{}{},
+	}
+}
+
+// Acquire implements Quota.
+func (m *Memory) Acquire(key string, member string, limit int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	set, ok := m.sets[key]
+	if !ok {
+		set = map[string]struct{}{}
+		m.sets[key] = set
+	}
+
+	if _, ok := set[member]; ok {
+		return nil
+	}
+
+	if limit > 0 && len(set) >= limit {
+		return errors.Annotatef(ErrExceeded, "%s: limit %d", key, limit)
+	}
+
+	set[member] = struct{}{}
+
+	return nil
+}
+
+// Release implements Quota.
+func (m *Memory) Release(key string, member string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	set := m.sets[key]
+
+	delete(set, member)
+
+	if len(set) == 0 {
+		delete(m.sets, key)
+	}
+
+	return nil
+}
@@ -0,0 +1,19 @@
+// Package quota limits the number of members of named sets, for example the
+// clients in a room.
+package quota
+
+import "github.com/juju/errors"
+
+// ErrExceeded is returned when a set already has the maximum number of
+// members.
+var ErrExceeded = errors.New("quota exceeded")
+
+// Quota keeps track of the members of named sets.
+type Quota interface {
+	// Acquire adds the member to the set unless the set already has limit
+	// members, in which case it returns ErrExceeded. Acquiring an existing
+	// member succeeds. The limit is disabled when zero.
+	Acquire(key string, member string, limit int) error
+	// Release removes the member from the set.
+	Release(key string, member string) error
+}
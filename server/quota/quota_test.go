@@ -0,0 +1,110 @@
+package quota_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/quota"
+	"github.com/peer-calls/peer-calls/v4/server/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testQuota(t *testing.T, q quota.Quota) {
+	t.Helper()
+
+	key := "room:" + uuid.New() + ":clients"
+
+	require.NoError(t, q.Acquire(key, "a", 2))
+	require.NoError(t, q.Acquire(key, "b", 2))
+	// Acquiring an existing member does not count twice.
+	require.NoError(t, q.Acquire(key, "a", 2))
+
+	err := q.Acquire(key, "c", 2)
+	assert.Equal(t, quota.ErrExceeded, errors.Cause(err))
+
+	// Other sets are not affected.
+	require.NoError(t, q.Acquire(key+"2", "c", 2))
+
+	require.NoError(t, q.Release(key, "a"))
+	require.NoError(t, q.Acquire(key, "c", 2))
+
+	// Zero disables the limit.
+	require.NoError(t, q.Acquire(key, "d", 0))
+
+	for _, member := range []string{"b", "c", "d"} {
+		require.NoError(t, q.Release(key, member))
+	}
+
+	require.NoError(t, q.Release(key+"2", "c"))
+}
+
+func TestMemory(t *testing.T) {
+	testQuota(t, quota.NewMemory())
+}
+
+func newRedisClient(t *testing.T) *redis.Client {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{
+		Addr:        "localhost:6379",
+		DialTimeout: 10 * time.Second,
+	})
+
+	t.Cleanup(func() {
+		client.Close()
+	})
+
+	return client
+}
+
+func TestRedis(t *testing.T) {
+	testQuota(t, quota.NewRedis(quota.RedisParams{
+		Client: newRedisClient(t),
+		Prefix: "peercalls-test",
+		Clock:  clock.New(),
+		TTL:    time.Minute,
+	}))
+}
+
+func TestRedis_expire(t *testing.T) {
+	client := newRedisClient(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	// The quotas of two nodes.
+	q1 := quota.NewRedis(quota.RedisParams{
+		Client: client,
+		Prefix: "peercalls-test",
+		Clock:  clk,
+		TTL:    time.Minute,
+	})
+	q2 := quota.NewRedis(quota.RedisParams{
+		Client: client,
+		Prefix: "peercalls-test",
+		Clock:  clk,
+		TTL:    time.Minute,
+	})
+
+	key := "room:" + uuid.New() + ":clients"
+
+	require.NoError(t, q1.Acquire(key, "a", 1))
+
+	clk.Add(50 * time.Second)
+	require.NoError(t, q1.Refresh())
+
+	clk.Add(50 * time.Second)
+
+	err := q2.Acquire(key, "b", 1)
+	assert.Equal(t, quota.ErrExceeded, errors.Cause(err), "refreshed member should not expire")
+
+	// The first node stops refreshing the member, like after a crash.
+	clk.Add(time.Minute)
+
+	require.NoError(t, q2.Acquire(key, "b", 1))
+	require.NoError(t, q2.Release(key, "b"))
+}
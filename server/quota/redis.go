@@ -0,0 +1,165 @@
+package quota
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+)
+
+// acquireScript adds ARGV[1] to the sorted set KEYS[1] unless the set already
+// has ARGV[2] members. The members are scored by the time they expire at, in
+// milliseconds, and the expired ones are removed first. ARGV[3] is the current
+// time and ARGV[4] the TTL, both in milliseconds. It returns 1 when the member
+// is in the set afterwards.
+var acquireScript = redis.NewScript(`
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+
+if not redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+	local limit = tonumber(ARGV[2])
+
+	if limit > 0 and redis.call("ZCARD", KEYS[1]) >= limit then
+		return 0
+	end
+end
+
+redis.call("ZADD", KEYS[1], now + ttl, ARGV[1])
+redis.call("PEXPIRE", KEYS[1], ttl)
+
+return 1
+`)
+
+// RedisParams are the parameters for NewRedis.
+type RedisParams struct {
+	Client *redis.Client
+	// Prefix is the prefix for Redis keys, same as the one used by the store.
+	Prefix string
+	Clock  clock.Clock
+	// TTL is the duration after which the members that were not refreshed
+	// expire. Refresh should be called at a shorter interval.
+	TTL time.Duration
+}
+
+// Redis keeps the sets in Redis so that they are shared by all nodes. The
+// check and the addition are done atomically in a script.
+//
+// The members expire unless the node that acquired them refreshes them, so
+// the members of a crashed node are eventually released.
+type Redis struct {
+	params *RedisParams
+
+	mu sync.Mutex
+	// members contains the members acquired by this node by key.
+	members map[string]map[string]struct{}
+}
+
+var _ Quota = &Redis{}
+
+// NewRedis creates a new instance of Redis.
+func NewRedis(params RedisParams) *Redis {
+	return &Redis{
+		params:  &params,
+		mu:      sync.Mutex{},
+		members: map[string]map[string]struct{}{},
+	}
+}
+
+func (r *Redis) key(key string) string {
+	return r.params.Prefix + ":quota:" + key
+}
+
+// Acquire implements Quota.
+func (r *Redis) Acquire(key string, member string, limit int) error {
+	now := r.params.Clock.Now().UnixMilli()
+	ttl := r.params.TTL.Milliseconds()
+
+	ok, err := acquireScript.Run(r.params.Client, []string{r.key(key)}, member, limit, now, ttl).Int()
+	if err != nil {
+		return errors.Annotatef(err, "acquire: %s", key)
+	}
+
+	if ok == 0 {
+		return errors.Annotatef(ErrExceeded, "%s: limit %d", key, limit)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members, found := r.members[key]
+	if !found {
+		members = map[string]struct{}{}
+		r.members[key] = members
+	}
+
+	members[member] = struct{}{}
+
+	return nil
+}
+
+// Release implements Quota.
+func (r *Redis) Release(key string, member string) error {
+	r.mu.Lock()
+
+	members := r.members[key]
+
+	delete(members, member)
+
+	if len(members) == 0 {
+		delete(r.members, key)
+	}
+
+	r.mu.Unlock()
+
+	err := r.params.Client.ZRem(r.key(key), member).Err()
+
+	return errors.Annotatef(err, "release: %s", key)
+}
+
+// Refresh extends the expiry of the members acquired by this node. Members
+// that have already expired are not added back.
+func (r *Redis) Refresh() error {
+	r.mu.Lock()
+
+	members := make(map[string][]string, len(r.members))
+
+	for key, set := range r.members {
+		for member := range set {
+			members[key] = append(members[key], member)
+		}
+	}
+
+	r.mu.Unlock()
+
+	if len(members) == 0 {
+		return nil
+	}
+
+	expiresAt := float64(r.params.Clock.Now().Add(r.params.TTL).UnixMilli())
+
+	pipe := r.params.Client.Pipeline()
+
+	for key, set := range members {
+		zs := make([]*redis.Z, 0, len(set))
+
+		for _, member := range set {
+			zs = append(zs, &redis.Z{
+				Score:  expiresAt,
+				Member: member,
+			})
+		}
+
+		pipe.ZAddXX(r.key(key), zs...)
+		pipe.PExpire(r.key(key), r.params.TTL)
+	}
+
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Annotatef(err, "refresh %d keys", len(members))
+	}
+
+	return nil
+}
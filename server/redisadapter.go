@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	e "errors"
 	"fmt"
 	"strings"
@@ -13,6 +14,9 @@ import (
 	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/message"
+	"github.com/peer-calls/peer-calls/v4/server/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -45,6 +49,8 @@ type RedisAdapter struct {
 	keys     struct {
 		roomChannel   string
 		roomClients   string
+		roomChat      string
+		roomNetwork   string
 		clientPattern string
 	}
 	stop func() error
@@ -65,6 +71,16 @@ func getRoomClientsName(prefix string, room identifiers.RoomID) string {
 	return prefix + ":room:" + room.String() + ":clients"
 }
 
+func getRoomChatName(prefix string, room identifiers.RoomID) string {
+	// TODO escape room name, what if it has ":" in the name?
+	return prefix + ":room:" + room.String() + ":chat"
+}
+
+func getRoomNetworkName(prefix string, room identifiers.RoomID) string {
+	// TODO escape room name, what if it has ":" in the name?
+	return prefix + ":room:" + room.String() + ":network"
+}
+
 func NewRedisAdapter(
 	log logger.Logger,
 	pubRedis *redis.Client,
@@ -72,17 +88,18 @@ func NewRedisAdapter(
 	prefix string,
 	room identifiers.RoomID,
 ) *RedisAdapter {
-	var (
-		clientsMu      sync.RWMutex
-		byteSerializer ByteSerializer
-	)
+	var clientsMu sync.RWMutex
 
 	adapter := RedisAdapter{
 		log: log.WithNamespaceAppended("redis_adapter").WithCtx(logger.Ctx{
 			"room_id": room,
 		}),
-		serializer:   byteSerializer,
-		deserializer: byteSerializer,
+		// The messages are published as JSON because the nodes from older
+		// releases cannot read CBOR, and they might still be running during a
+		// rolling upgrade. Both formats are read, so the serializer can be
+		// switched to CBORSerializer in the next release.
+		serializer:   ByteSerializer{},
+		deserializer: AnyDeserializer{},
 		clients:      map[identifiers.ClientID]ClientWriter{},
 		clientsMu:    &clientsMu,
 		prefix:       prefix,
@@ -95,6 +112,8 @@ func NewRedisAdapter(
 	adapter.keys.roomChannel = getRoomChannelName(prefix, room)
 	adapter.keys.clientPattern = getClientChannelName(prefix, room, "*")
 	adapter.keys.roomClients = getRoomClientsName(prefix, room)
+	adapter.keys.roomChat = getRoomChatName(prefix, room)
+	adapter.keys.roomNetwork = getRoomNetworkName(prefix, room)
 
 	adapter.subscribeUntilReady(defaultSubscriptionTimeout)
 
@@ -236,6 +255,113 @@ func (a *RedisAdapter) Size() (size int, err error) {
 	return len(c), errors.Annotate(err, "size")
 }
 
+// maxChatHistoryTTL bounds the lifetime of the chat history of a room without
+// new messages when the max age is not set, so the lists of the rooms that are
+// no longer used are eventually removed.
+const maxChatHistoryTTL = 30 * 24 * time.Hour
+
+// AddChat appends the chat message to a list which outlives the room. The
+// list expires after maxAge without new messages, or after maxChatHistoryTTL
+// when maxAge is not set.
+func (a *RedisAdapter) AddChat(chat message.Chat, maxLen int, maxAge time.Duration) error {
+	a.log.Trace("AddChat", logger.Ctx{
+		"client_id": chat.ClientID,
+	})
+
+	data, err := json.Marshal(chat)
+	if err != nil {
+		return errors.Annotate(err, "marshal chat")
+	}
+
+	key := a.keys.roomChat
+
+	_, err = a.pubRedis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.RPush(key, data)
+		pipe.LTrim(key, int64(-maxLen), -1)
+
+		ttl := maxAge
+		if ttl <= 0 {
+			ttl = maxChatHistoryTTL
+		}
+
+		pipe.Expire(key, ttl)
+
+		return nil
+	})
+
+	return errors.Annotatef(err, "add chat: %s", key)
+}
+
+// ChatHistory returns the chat messages stored by all nodes.
+func (a *RedisAdapter) ChatHistory() ([]message.Chat, error) {
+	a.log.Trace("ChatHistory", nil)
+
+	values, err := a.pubRedis.LRange(a.keys.roomChat, 0, -1).Result()
+	if err != nil {
+		return nil, errors.Annotatef(err, "chat history: %s", a.keys.roomChat)
+	}
+
+	history := make([]message.Chat, 0, len(values))
+
+	for _, value := range values {
+		var chat message.Chat
+
+		if err := json.Unmarshal([]byte(value), &chat); err != nil {
+			return nil, errors.Annotate(err, "unmarshal chat")
+		}
+
+		history = append(history, chat)
+	}
+
+	return history, nil
+}
+
+// Network returns the network of the room stored by any of the nodes.
+func (a *RedisAdapter) Network() (string, error) {
+	a.log.Trace("Network", nil)
+
+	network, err := a.pubRedis.Get(a.keys.roomNetwork).Result()
+	if errors.Cause(err) == redis.Nil {
+		return "", nil
+	}
+
+	return network, errors.Annotatef(err, "network: %s", a.keys.roomNetwork)
+}
+
+// SetNetwork atomically replaces the network of the room, so that only one
+// node sees the previous network when several nodes switch the room at the
+// same time.
+func (a *RedisAdapter) SetNetwork(network string) (string, error) {
+	a.log.Trace("SetNetwork", logger.Ctx{
+		"network": network,
+	})
+
+	key := a.keys.roomNetwork
+
+	var prev *redis.StringCmd
+
+	_, err := a.pubRedis.TxPipelined(func(pipe redis.Pipeliner) error {
+		if network == "" {
+			prev = pipe.Get(key)
+			pipe.Del(key)
+		} else {
+			prev = pipe.GetSet(key, network)
+		}
+
+		return nil
+	})
+	if err != nil && errors.Cause(err) != redis.Nil {
+		return "", errors.Annotatef(err, "set network: %s", key)
+	}
+
+	prevNetwork, err := prev.Result()
+	if errors.Cause(err) == redis.Nil {
+		return "", nil
+	}
+
+	return prevNetwork, errors.Annotatef(err, "set network: %s", key)
+}
+
 func (a *RedisAdapter) handleMessage(
 	pattern string,
 	channel string,
@@ -246,6 +372,21 @@ func (a *RedisAdapter) handleMessage(
 		return errors.Annotate(err, "deserialize redis subscription")
 	}
 
+	if len(msg.TraceContext) > 0 {
+		// Continue the trace of the node which published the message.
+		ctx := tracing.Extract(context.Background(), tracing.Carrier(msg.TraceContext))
+
+		_, span := tracer.Start(ctx, "RedisAdapter.handleMessage", trace.WithSpanKind(trace.SpanKindConsumer))
+		span.SetAttributes(
+			attribute.String("channel", channel),
+			attribute.String("message_type", string(msg.Type)),
+		)
+
+		defer func() {
+			tracing.End(span, err)
+		}()
+	}
+
 	handleRoomJoin := func(roomID identifiers.RoomID, join message.RoomJoin) error {
 		a.clientsMu.RLock()
 		clients := a.localClients()
@@ -444,7 +585,24 @@ func (a *RedisAdapter) localClients() map[identifiers.ClientID]ClientWriter {
 	return clients
 }
 
-func (a *RedisAdapter) publish(channel string, msg message.Message) error {
+// publish publishes msg to channel in a producer span. The message carries
+// the trace context of the span so that the node which receives it continues
+// the trace. The span is a child of the trace context of msg, if any.
+func (a *RedisAdapter) publish(channel string, msg message.Message) (err error) {
+	ctx := tracing.Extract(context.Background(), tracing.Carrier(msg.TraceContext))
+
+	ctx, span := tracer.Start(ctx, "RedisAdapter.publish", trace.WithSpanKind(trace.SpanKindProducer))
+	span.SetAttributes(
+		attribute.String("channel", channel),
+		attribute.String("message_type", string(msg.Type)),
+	)
+
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	msg.TraceContext = tracing.Inject(ctx)
+
 	data, err := a.serializer.Serialize(msg)
 	if err != nil {
 		return errors.Annotatef(err, "serialize")
@@ -492,13 +650,9 @@ func (a *RedisAdapter) Emit(clientID identifiers.ClientID, msg message.Message)
 		"client_channel": channel,
 	})
 
-	data, err := a.serializer.Serialize(msg)
-	if err != nil {
-		return errors.Annotatef(err, "serialize message")
-	}
+	err := a.publish(channel, msg)
 
-	err = a.pubRedis.Publish(channel, string(data)).Err()
-	return errors.Annotatef(err, "publish message")
+	return errors.Annotate(err, "emit")
 }
 
 func (a *RedisAdapter) localEmit(client ClientWriter, msg message.Message) error {
@@ -14,7 +14,14 @@ import (
 	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 	"github.com/peer-calls/peer-calls/v4/server/message"
 	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/peer-calls/peer-calls/v4/server/tracing"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/goleak"
 	"nhooyr.io/websocket"
 )
@@ -142,3 +149,230 @@ func TestRedisAdapter_add_remove_client(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestRedisAdapter_chatHistory(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	pub, sub, stop := configureRedis(t)
+	defer stop()
+
+	chatRoom := identifiers.RoomID("chat-" + room.String())
+	defer pub.Del("peercalls:room:" + chatRoom.String() + ":chat")
+
+	adapter1 := server.NewRedisAdapter(test.NewLogger(), pub, sub, "peercalls", chatRoom)
+	defer adapter1.Close()
+
+	adapter2 := server.NewRedisAdapter(test.NewLogger(), pub, sub, "peercalls", chatRoom)
+	defer adapter2.Close()
+
+	chat := func(msg string) message.Chat {
+		return message.Chat{
+			ClientID:  "a",
+			Nickname:  "nick",
+			Message:   msg,
+			Timestamp: 1000,
+		}
+	}
+
+	assert.NoError(t, adapter1.AddChat(chat("1"), 2, time.Minute))
+	assert.NoError(t, adapter2.AddChat(chat("2"), 2, time.Minute))
+	assert.NoError(t, adapter1.AddChat(chat("3"), 2, time.Minute))
+
+	// The history is shared by the nodes.
+	history, err := adapter2.ChatHistory()
+	assert.NoError(t, err)
+	assert.Equal(t, []message.Chat{chat("2"), chat("3")}, history)
+}
+
+func TestRedisAdapter_network(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	pub, sub, stop := configureRedis(t)
+	defer stop()
+
+	networkRoom := identifiers.RoomID("network-" + room.String())
+	defer pub.Del("peercalls:room:" + networkRoom.String() + ":network")
+
+	adapter1 := server.NewRedisAdapter(test.NewLogger(), pub, sub, "peercalls", networkRoom)
+	defer adapter1.Close()
+
+	adapter2 := server.NewRedisAdapter(test.NewLogger(), pub, sub, "peercalls", networkRoom)
+	defer adapter2.Close()
+
+	network, err := adapter1.Network()
+	assert.NoError(t, err)
+	assert.Equal(t, "", network)
+
+	prev, err := adapter1.SetNetwork("sfu")
+	assert.NoError(t, err)
+	assert.Equal(t, "", prev)
+
+	// The network is shared by the nodes, so only the first switch is seen.
+	prev, err = adapter2.SetNetwork("sfu")
+	assert.NoError(t, err)
+	assert.Equal(t, "sfu", prev)
+
+	prev, err = adapter2.SetNetwork("")
+	assert.NoError(t, err)
+	assert.Equal(t, "sfu", prev)
+
+	network, err = adapter1.Network()
+	assert.NoError(t, err)
+	assert.Equal(t, "", network)
+}
+
+func TestRedisAdapter_wireFormat(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	pub, sub, stop := configureRedis(t)
+	defer stop()
+
+	formatRoom := identifiers.RoomID("format-" + room.String())
+	channel := "peercalls:room:" + formatRoom.String() + ":broadcast"
+
+	pubsub := sub.Subscribe(channel)
+	defer pubsub.Close()
+
+	_, err := pubsub.Receive()
+	require.NoError(t, err)
+
+	adapter := server.NewRedisAdapter(test.NewLogger(), pub, sub, "peercalls", formatRoom)
+	defer adapter.Close()
+
+	received := make(chan message.Message, 16)
+
+	client := newMockClientWriter("client1", func(msg message.Message) error {
+		received <- msg
+
+		return nil
+	})
+
+	require.NoError(t, adapter.Add(client))
+
+	// The nodes from older releases only read JSON.
+	for redisMsg := range pubsub.Channel() {
+		msg, err := server.ByteSerializer{}.Deserialize([]byte(redisMsg.Payload))
+		require.NoError(t, err, "payload: %q", redisMsg.Payload)
+
+		if msg.Type == message.TypeRoomJoin {
+			break
+		}
+	}
+
+	// CBOR messages from the upgraded nodes are read too.
+	data, err := server.CBORSerializer{}.Serialize(message.NewPing(formatRoom))
+	require.NoError(t, err)
+	require.NoError(t, pub.Publish(channel, string(data)).Err())
+
+	for {
+		select {
+		case msg := <-received:
+			if msg.Type == message.TypePing {
+				return
+			}
+		case <-time.After(time.Second):
+			require.FailNow(t, "timed out waiting for ping")
+		}
+	}
+}
+
+func TestRedisAdapter_traceContext(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	defer func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+		assert.NoError(t, provider.Shutdown(context.Background()))
+	}()
+
+	pub, sub, stop := configureRedis(t)
+	defer stop()
+
+	traceRoom := identifiers.RoomID("trace-" + room.String())
+
+	adapter1 := server.NewRedisAdapter(test.NewLogger(), pub, sub, "peercalls", traceRoom)
+	defer adapter1.Close()
+
+	adapter2 := server.NewRedisAdapter(test.NewLogger(), pub, sub, "peercalls", traceRoom)
+	defer adapter2.Close()
+
+	received := make(chan message.Message, 16)
+
+	client2 := newMockClientWriter("client2", func(msg message.Message) error {
+		received <- msg
+
+		return nil
+	})
+
+	require.NoError(t, adapter2.Add(client2))
+
+	// recv returns the next message of type typ received by client2.
+	recv := func(t *testing.T, typ message.Type) message.Message {
+		t.Helper()
+
+		for {
+			select {
+			case msg := <-received:
+				if msg.Type == typ {
+					return msg
+				}
+			case <-time.After(time.Second):
+				require.FailNow(t, "timed out waiting for message", "type: %s", typ)
+			}
+		}
+	}
+
+	// findSpan returns the ended span with the name that matches fn.
+	findSpan := func(name string, fn func(sdktrace.ReadOnlySpan) bool) sdktrace.ReadOnlySpan {
+		for _, span := range recorder.Ended() {
+			if span.Name() == name && fn(span) {
+				return span
+			}
+		}
+
+		return nil
+	}
+
+	for _, tc := range []struct {
+		descr   string
+		msgType message.Type
+		publish func() error
+	}{
+		{"broadcast", message.TypePing, func() error {
+			return adapter1.Broadcast(message.NewPing(traceRoom))
+		}},
+		{"emit", message.TypeEndBreakout, func() error {
+			return adapter1.Emit(client2.ID(), message.NewEndBreakout(traceRoom))
+		}},
+	} {
+		t.Run(tc.descr, func(t *testing.T) {
+			require.NoError(t, tc.publish())
+
+			msg := recv(t, tc.msgType)
+
+			// The message carries the span of the publishing node.
+			spanContext := trace.SpanContextFromContext(
+				tracing.Extract(context.Background(), tracing.Carrier(msg.TraceContext)),
+			)
+			require.True(t, spanContext.IsValid(), "trace context: %v", msg.TraceContext)
+
+			publishSpan := findSpan("RedisAdapter.publish", func(span sdktrace.ReadOnlySpan) bool {
+				return span.SpanContext().SpanID() == spanContext.SpanID()
+			})
+			require.NotNil(t, publishSpan, "publish span")
+			assert.Equal(t, trace.SpanKindProducer, publishSpan.SpanKind())
+
+			// The receiving node continues the trace.
+			assert.Eventually(t, func() bool {
+				return findSpan("RedisAdapter.handleMessage", func(span sdktrace.ReadOnlySpan) bool {
+					return span.Parent().SpanID() == spanContext.SpanID()
+				}) != nil
+			}, time.Second, 10*time.Millisecond)
+		})
+	}
+}
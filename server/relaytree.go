@@ -0,0 +1,52 @@
+package server
+
+import "time"
+
+// relayCandidate is a remote node with peers in a room.
+type relayCandidate struct {
+	// ID identifies the node. All nodes must agree on the IDs, so the
+	// advertised address is used.
+	ID string
+	// RTT is the measured round trip time to the node, zero when unknown.
+	RTT time.Duration
+}
+
+// selectRelayParent returns the index of the candidate that should be the
+// parent of the local node in the room's relay tree, or -1 when the local
+// node is the root.
+//
+// Only nodes with a smaller ID are considered, and the one with the lowest
+// RTT wins. This way each node can select its parent without coordination,
+// the node with the smallest ID becomes the root, and the edges cannot form
+// a cycle, so all interested nodes form a spanning tree.
+func selectRelayParent(localID string, candidates []relayCandidate) int {
+	parent := -1
+
+	for i, c := range candidates {
+		if c.ID >= localID {
+			continue
+		}
+
+		if parent == -1 || isCloserRelay(c, candidates[parent]) {
+			parent = i
+		}
+	}
+
+	return parent
+}
+
+// isCloserRelay returns true when a should be preferred over b. Candidates
+// with an unknown RTT are the least preferred, and ties are broken by ID so
+// the result does not depend on the order of candidates.
+func isCloserRelay(a, b relayCandidate) bool {
+	switch {
+	case a.RTT == b.RTT:
+		return a.ID < b.ID
+	case a.RTT == 0:
+		return false
+	case b.RTT == 0:
+		return true
+	default:
+		return a.RTT < b.RTT
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectRelayParent(t *testing.T) {
+	ms := time.Millisecond
+
+	type testCase struct {
+		descr      string
+		localID    string
+		candidates []relayCandidate
+		want       int
+	}
+
+	for _, tc := range []testCase{
+		{"no candidates", "b", nil, -1},
+		{"root", "a", []relayCandidate{{"b", ms}, {"c", ms}}, -1},
+		{"lowest rtt", "d", []relayCandidate{{"a", 9 * ms}, {"b", 3 * ms}, {"c", 5 * ms}}, 1},
+		{"larger ids ignored", "c", []relayCandidate{{"d", ms}, {"a", 5 * ms}}, 1},
+		{"tie", "c", []relayCandidate{{"b", ms}, {"a", ms}}, 1},
+		{"unknown rtt", "c", []relayCandidate{{"a", 0}, {"b", 5 * ms}}, 1},
+	} {
+		t.Run(tc.descr, func(t *testing.T) {
+			assert.Equal(t, tc.want, selectRelayParent(tc.localID, tc.candidates))
+		})
+	}
+}
+
+func TestSelectRelayParent_SpanningTree(t *testing.T) {
+	ids := []string{"10.0.0.1:3000", "10.0.0.2:3000", "10.0.0.3:3000", "10.0.0.4:3000", "10.0.0.5:3000"}
+
+	// rtts[i][j] is the RTT between nodes i and j.
+	rtts := [][]time.Duration{
+		{0, 40, 10, 50, 30},
+		{40, 0, 20, 5, 25},
+		{10, 20, 0, 35, 15},
+		{50, 5, 35, 0, 45},
+		{30, 25, 15, 45, 0},
+	}
+
+	parents := make([]int, len(ids))
+
+	for i, id := range ids {
+		candidates := make([]relayCandidate, 0, len(ids)-1)
+		indexes := make([]int, 0, len(ids)-1)
+
+		for j, candidateID := range ids {
+			if i == j {
+				continue
+			}
+
+			candidates = append(candidates, relayCandidate{
+				ID:  candidateID,
+				RTT: rtts[i][j] * time.Millisecond,
+			})
+			indexes = append(indexes, j)
+		}
+
+		parents[i] = -1
+
+		if p := selectRelayParent(id, candidates); p >= 0 {
+			parents[i] = indexes[p]
+		}
+	}
+
+	assert.Equal(t, []int{-1, 0, 0, 1, 2}, parents)
+
+	// Every node reaches the root.
+	for i := range ids {
+		node := i
+
+		for steps := 0; parents[node] != -1; steps++ {
+			assert.Less(t, steps, len(ids), "cycle detected")
+
+			node = parents[node]
+		}
+
+		assert.Equal(t, 0, node)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/message"
+	"github.com/peer-calls/peer-calls/v4/server/pubsub"
+	"github.com/peer-calls/peer-calls/v4/server/sfu"
+)
+
+var (
+	// ErrUnexpectedMessage is returned by the message handlers when the message
+	// type is not handled, or when the message is not expected in the current
+	// state.
+	ErrUnexpectedMessage = errors.New("unexpected message")
+	// ErrInvalidMessage is returned by the message handlers when the message
+	// content is invalid.
+	ErrInvalidMessage = errors.New("invalid message")
+	// ErrForbidden is returned by the message handlers when the role of the
+	// client does not allow the message.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// errorCode returns the code of the Error sent to the client when handling
+// its message failed with err.
+func errorCode(err error) message.ErrorCode {
+	switch {
+	case errIs(err, ErrInvalidMessage), errIs(err, pubsub.ErrSubscribeToOwnTrack),
+		errIs(err, sfu.ErrNotViewer), errIs(err, ErrChatMessageTooLarge),
+		errIs(err, ErrInvalidBreakout):
+		return message.ErrorCodeInvalidMessage
+	case errIs(err, ErrUnexpectedMessage), errIs(err, ErrBreakoutExists):
+		return message.ErrorCodeUnexpectedMessage
+	case errIs(err, pubsub.ErrTrackNotFound), errIs(err, pubsub.ErrSubNotFound),
+		errIs(err, ErrBreakoutNotFound):
+		return message.ErrorCodeNotFound
+	case errIs(err, ErrRoomFull), errIs(err, ErrTooManyRooms),
+		errIs(err, sfu.ErrTooManyPublishers), errIs(err, sfu.ErrTooManyTracks),
+		errIs(err, ErrChatRateLimited):
+		return message.ErrorCodeQuotaExceeded
+	case errIs(err, ErrForbidden), errIs(err, pubsub.ErrPublishNotAllowed):
+		return message.ErrorCodeForbidden
+	default:
+		return message.ErrorCodeInternal
+	}
+}
+
+// newReply returns the message sent back to the client after handling its
+// request: an Error when err is set, otherwise an Ack when the request has a
+// RequestID. It returns false when there is nothing to send.
+func newReply(req message.Message, err error) (message.Message, bool) {
+	if err == nil {
+		if req.RequestID == "" {
+			return message.Message{}, false
+		}
+
+		return message.NewAck(req.Room, req.RequestID), true
+	}
+
+	code := errorCode(err)
+
+	description := err.Error()
+	if code == message.ErrorCodeInternal {
+		// The details of internal errors are only logged.
+		description = "internal error"
+	}
+
+	return message.NewError(req.Room, req.RequestID, message.Error{
+		Code:        code,
+		Message:     description,
+		RequestType: req.Type,
+	}), true
+}
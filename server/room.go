@@ -48,6 +48,26 @@ func (r *AdapterRoomManager) Enter(room identifiers.RoomID) (adapter Adapter, is
 	return ac.adapter, isNew
 }
 
+func (r *AdapterRoomManager) Get(room identifiers.RoomID) (adapter Adapter, ok bool) {
+	r.roomsMu.RLock()
+	defer r.roomsMu.RUnlock()
+
+	ac, ok := r.rooms[room]
+	if !ok {
+		return nil, false
+	}
+
+	return ac.adapter, true
+}
+
+// Len returns the number of active rooms.
+func (r *AdapterRoomManager) Len() int {
+	r.roomsMu.RLock()
+	defer r.roomsMu.RUnlock()
+
+	return len(r.rooms)
+}
+
 func (r *AdapterRoomManager) Exit(room identifiers.RoomID) (isRemoved bool) {
 	r.roomsMu.Lock()
 	defer r.roomsMu.Unlock()
@@ -130,6 +150,11 @@ func (r *ChannelRoomManager) Exit(room identifiers.RoomID) (isRemoved bool) {
 	return isRemoved
 }
 
+// Get does not send any events because the room is not entered.
+func (r *ChannelRoomManager) Get(room identifiers.RoomID) (adapter Adapter, ok bool) {
+	return r.roomManager.Get(room)
+}
+
 func (r *ChannelRoomManager) AcceptEvent() (RoomEvent, error) {
 	event, ok := <-r.roomEventsChan
 	if !ok {
@@ -1,8 +1,22 @@
 package server
 
 import (
+	"crypto/tls"
+	"net"
+	"time"
+
 	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/discovery"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/pion/dtls/v2"
+)
+
+const (
+	defaultDiscoveryInterval = 10 * time.Second
+	// discoveryTTLFactor is multiplied by the discovery interval to get the
+	// TTL of Redis registrations.
+	discoveryTTLFactor = 3
 )
 
 type RoomManagerFactory struct {
@@ -13,6 +27,10 @@ type RoomManagerFactoryParams struct {
 	AdapterFactory *AdapterFactory
 	TracksManager  TracksManager
 	Log            logger.Logger
+	Health         *Health
+	// MaxRooms fails the readiness check once the number of rooms reaches it.
+	// Disabled when zero.
+	MaxRooms int
 }
 
 func NewRoomManagerFactory(params RoomManagerFactoryParams) *RoomManagerFactory {
@@ -26,13 +44,23 @@ func NewRoomManagerFactory(params RoomManagerFactoryParams) *RoomManagerFactory
 func (rmf *RoomManagerFactory) NewRoomManager(c NetworkConfig) (RoomManager, *NodeManager) {
 	rooms := NewAdapterRoomManager(rmf.params.AdapterFactory.NewAdapter)
 
-	if c.Type == NetworkTypeSFU && c.SFU.Transport.ListenAddr != "" {
+	if rmf.params.MaxRooms > 0 {
+		rmf.params.Health.Register(HealthCheck{
+			Name:  "rooms",
+			Type:  HealthCheckTypeReadiness,
+			Check: checkCount("rooms", rooms.Len, rmf.params.MaxRooms),
+		})
+	}
+
+	usesSFU := c.Type == NetworkTypeSFU || c.Type == NetworkTypeHybrid
+
+	if usesSFU && c.SFU.Transport.ListenAddr != "" {
 		roomManager, nodeManager, err := rmf.createChannelRoomManager(c, rooms)
 		if err == nil {
 			return roomManager, nodeManager
 		}
 
-		rmf.params.Log.Info("Error creating NodeTransport, falling back to single SFU", nil)
+		rmf.params.Log.Error("Error creating NodeTransport, falling back to single SFU", errors.Trace(err), nil)
 	}
 
 	return rooms, nil
@@ -47,9 +75,41 @@ func (rmf *RoomManagerFactory) createChannelRoomManager(
 		return nil, nil, errors.Annotatef(err, "parse UDP addr")
 	}
 
-	nodes, err := ParseUDPAddrs(c.SFU.Transport.Nodes)
+	advertiseAddr := listenAddr
+
+	if c.SFU.Transport.AdvertiseAddr != "" {
+		advertiseAddr, err = ParseUDPAddr(c.SFU.Transport.AdvertiseAddr)
+		if err != nil {
+			return nil, nil, errors.Annotatef(err, "parse advertise UDP addr")
+		}
+	}
+
+	if advertiseAddr.IP.IsUnspecified() {
+		// The nodes are ordered by their advertised addresses to decide the
+		// relay tree and the QUIC and DTLS roles, so all nodes must agree on them.
+		return nil, nil, errors.Errorf("node transport requires a specific advertise address, got: %s", advertiseAddr)
+	}
+
+	var (
+		dtlsConfig *dtls.Config
+		tlsConfig  *tls.Config
+	)
+
+	if c.SFU.Transport.Type == TransportTypeQUIC {
+		tlsConfig, err = NewQUICTLSConfig(c.SFU.Transport.DTLS)
+		if err != nil {
+			return nil, nil, errors.Annotatef(err, "create QUIC TLS config")
+		}
+	} else {
+		dtlsConfig, err = NewDTLSConfig(c.SFU.Transport.DTLS)
+		if err != nil {
+			return nil, nil, errors.Annotatef(err, "create DTLS config")
+		}
+	}
+
+	disc, err := rmf.createDiscovery(c.SFU.Transport, advertiseAddr)
 	if err != nil {
-		return nil, nil, errors.Annotatef(err, "parse UDP addrs")
+		return nil, nil, errors.Annotatef(err, "create discovery")
 	}
 
 	channelRoomManager := NewChannelRoomManager(rooms)
@@ -57,15 +117,78 @@ func (rmf *RoomManagerFactory) createChannelRoomManager(
 	nodeManager, err := NewNodeManager(NodeManagerParams{
 		Log:           rmf.params.Log,
 		ListenAddr:    listenAddr,
-		Nodes:         nodes,
+		AdvertiseAddr: advertiseAddr,
+		Discovery:     disc,
+		TransportType: c.SFU.Transport.Type,
+		DTLSConfig:    dtlsConfig,
+		TLSConfig:     tlsConfig,
 		RoomManager:   channelRoomManager,
 		TracksManager: rmf.params.TracksManager,
+		Health:        rmf.params.Health,
 	})
 	if err != nil {
 		channelRoomManager.Close()
+		disc.Close()
 
 		return nil, nil, errors.Annotatef(err, "new node manager")
 	}
 
 	return channelRoomManager, nodeManager, nil
 }
+
+func (rmf *RoomManagerFactory) createDiscovery(
+	c TransportConfig,
+	advertiseAddr *net.UDPAddr,
+) (discovery.Discovery, error) {
+	interval := c.Discovery.Interval
+	if interval <= 0 {
+		interval = defaultDiscoveryInterval
+	}
+
+	newPoller := func(lookup discovery.LookupFunc, onClose func() error) discovery.Discovery {
+		return discovery.NewPoller(discovery.PollerParams{
+			Log:      rmf.params.Log,
+			Clock:    clock.New(),
+			Interval: interval,
+			Lookup:   lookup,
+			OnClose:  onClose,
+		})
+	}
+
+	switch c.Discovery.Type {
+	case DiscoveryTypeDNS:
+		return newPoller(discovery.NewDNSLookup(discovery.DNSParams{
+			Resolver: nil,
+			Name:     c.Discovery.DNS.Name,
+			Port:     c.Discovery.DNS.Port,
+			SRV:      c.Discovery.DNS.SRV,
+			Timeout:  interval,
+		}), nil), nil
+	case DiscoveryTypeFile:
+		return newPoller(discovery.NewFileLookup(c.Discovery.File), nil), nil
+	case DiscoveryTypeRedis:
+		client := rmf.params.AdapterFactory.RedisClient()
+		if client == nil {
+			return nil, errors.Errorf("redis discovery requires redis store")
+		}
+
+		reg := discovery.NewRedis(discovery.RedisParams{
+			Client: client,
+			Prefix: rmf.params.AdapterFactory.RedisPrefix(),
+			Clock:  clock.New(),
+			Addr:   advertiseAddr,
+			TTL:    discoveryTTLFactor * interval,
+		})
+
+		return newPoller(reg.Lookup, reg.Unregister), nil
+	case DiscoveryTypeStatic:
+		fallthrough
+	default:
+		nodes, err := ParseUDPAddrs(c.Nodes)
+		if err != nil {
+			return nil, errors.Annotatef(err, "parse UDP addrs")
+		}
+
+		return discovery.NewStatic(nodes), nil
+	}
+}
@@ -26,6 +26,8 @@ func TestRoomManagerFactory(t *testing.T) {
 		Log:            log,
 		AdapterFactory: adapterFactory,
 		TracksManager:  tracksManager,
+		Health:         server.NewHealth(log, server.HealthConfig{}),
+		MaxRooms:       0,
 	})
 
 	cleanup := func(rm server.RoomManager, nm *server.NodeManager) {
@@ -100,6 +102,61 @@ func TestRoomManagerFactory(t *testing.T) {
 		assert.NotNil(t, nm)
 	})
 
+	t.Run("sfu quic transport listen ok, remote addrs", func(t *testing.T) {
+		networkConfig := server.NetworkConfig{}
+		networkConfig.Type = server.NetworkTypeSFU
+		networkConfig.SFU.Transport.Type = server.TransportTypeQUIC
+		networkConfig.SFU.Transport.ListenAddr = "127.0.0.1:0"
+		networkConfig.SFU.Transport.Nodes = []string{
+			"127.0.0.1:1234",
+			"127.0.0.1:1235",
+		}
+
+		rm, nm := factory.NewRoomManager(networkConfig)
+		defer cleanup(rm, nm)
+		_, ok := rm.(*server.ChannelRoomManager)
+		assert.True(t, ok)
+		assert.NotNil(t, nm)
+	})
+
+	t.Run("sfu transport unspecified advertise addr", func(t *testing.T) {
+		networkConfig := server.NetworkConfig{}
+		networkConfig.Type = server.NetworkTypeSFU
+		networkConfig.SFU.Transport.ListenAddr = "0.0.0.0:0"
+
+		rm, nm := factory.NewRoomManager(networkConfig)
+		defer cleanup(rm, nm)
+		_, ok := rm.(*server.AdapterRoomManager)
+		assert.True(t, ok, "should fall back to default")
+		assert.Nil(t, nm, "should fall back to default")
+	})
+
+	t.Run("sfu quic transport unspecified advertise addr", func(t *testing.T) {
+		networkConfig := server.NetworkConfig{}
+		networkConfig.Type = server.NetworkTypeSFU
+		networkConfig.SFU.Transport.Type = server.TransportTypeQUIC
+		networkConfig.SFU.Transport.ListenAddr = "0.0.0.0:0"
+
+		rm, nm := factory.NewRoomManager(networkConfig)
+		defer cleanup(rm, nm)
+		_, ok := rm.(*server.AdapterRoomManager)
+		assert.True(t, ok, "should fall back to default")
+		assert.Nil(t, nm, "should fall back to default")
+	})
+
+	t.Run("sfu transport unspecified listen addr, advertise addr", func(t *testing.T) {
+		networkConfig := server.NetworkConfig{}
+		networkConfig.Type = server.NetworkTypeSFU
+		networkConfig.SFU.Transport.ListenAddr = "0.0.0.0:0"
+		networkConfig.SFU.Transport.AdvertiseAddr = "127.0.0.1:4001"
+
+		rm, nm := factory.NewRoomManager(networkConfig)
+		defer cleanup(rm, nm)
+		_, ok := rm.(*server.ChannelRoomManager)
+		assert.True(t, ok)
+		assert.NotNil(t, nm)
+	})
+
 	t.Run("sfu transport listen ok, invalid addrs", func(t *testing.T) {
 		networkConfig := server.NetworkConfig{}
 		networkConfig.Type = server.NetworkTypeSFU
@@ -59,10 +59,14 @@ func (t *DataTransport) start() {
 		// but works for now.
 		isString := !(buf[0] == 0)
 
+		// The buffer is reused so the data must be copied.
+		data := make([]byte, i-1)
+		copy(data, buf[1:i])
+
 		// TODO figure out which user a message belongs to.
 		message := webrtc.DataChannelMessage{
 			IsString: isString,
-			Data:     buf[1:],
+			Data:     data,
 		}
 
 		t.messagesChan <- message
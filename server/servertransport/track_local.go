@@ -2,7 +2,7 @@ package servertransport
 
 import (
 	"io"
-
+	"sync"
 	"sync/atomic"
 
 	"github.com/juju/errors"
@@ -22,6 +22,12 @@ type trackLocal struct {
 	subscribers int64
 	closed      *atomicInternal.Bool
 
+	// onDemandChangeMu guards onDemandChange.
+	onDemandChangeMu sync.Mutex
+	// onDemandChange is called every time the remote side subscribes or
+	// unsubscribes.
+	onDemandChange func()
+
 	streamInfo           *interceptor.StreamInfo
 	interceptorRTPWriter interceptor.RTPWriter
 }
@@ -40,6 +46,9 @@ func newTrackLocal(
 		interceptor: ceptor,
 		subscribers: 0,
 		closed:      &atomicInternal.Bool{},
+
+		onDemandChangeMu: sync.Mutex{},
+		onDemandChange:   nil,
 	}
 
 	t.streamInfo = &interceptor.StreamInfo{
@@ -67,6 +76,12 @@ func (t *trackLocal) Track() transport.Track {
 }
 
 func (t *trackLocal) Write(b []byte) (int, error) {
+	if !t.isSubscribed() {
+		// Nobody on the remote side is subscribed so there is no need to waste
+		// bandwidth.
+		return len(b), nil
+	}
+
 	var packet *rtp.Packet
 
 	err := packet.Unmarshal(b)
@@ -80,6 +95,10 @@ func (t *trackLocal) Write(b []byte) (int, error) {
 }
 
 func (t *trackLocal) WriteRTP(packet *rtp.Packet) error {
+	if !t.isSubscribed() {
+		return nil
+	}
+
 	_, err := t.write(&packet.Header, packet.Payload, t.streamInfo.Attributes)
 
 	return errors.Annotatef(err, "write RTP")
@@ -137,10 +156,39 @@ func (t *trackLocal) isSubscribed() bool {
 
 func (t *trackLocal) subscribe() {
 	atomic.AddInt64(&t.subscribers, 1)
+
+	t.demandChanged()
 }
 
 func (t *trackLocal) unsubscribe() {
 	atomic.AddInt64(&t.subscribers, -1)
+
+	t.demandChanged()
+}
+
+func (t *trackLocal) demandChanged() {
+	t.onDemandChangeMu.Lock()
+	onDemandChange := t.onDemandChange
+	t.onDemandChangeMu.Unlock()
+
+	if onDemandChange != nil {
+		onDemandChange()
+	}
+}
+
+// Demanded returns true when the remote side is subscribed to this track.
+// Packets written to a track that is not demanded are dropped.
+func (t *trackLocal) Demanded() bool {
+	return t.isSubscribed()
+}
+
+// OnDemandChange sets the function to call every time the remote side
+// subscribes to or unsubscribes from this track. The function is called from
+// the metadata read loop. Set to nil to remove.
+func (t *trackLocal) OnDemandChange(fn func()) {
+	t.onDemandChangeMu.Lock()
+	t.onDemandChange = fn
+	t.onDemandChangeMu.Unlock()
 }
 
 func (t *trackLocal) Close() {
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
@@ -11,7 +12,9 @@ import (
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/message"
 	"github.com/peer-calls/peer-calls/v4/server/sfu"
+	"github.com/peer-calls/peer-calls/v4/server/tracing"
 	"github.com/peer-calls/peer-calls/v4/server/transport"
+	"go.opentelemetry.io/otel/trace"
 	"nhooyr.io/websocket"
 )
 
@@ -24,13 +27,15 @@ const serverIsInitiator = true
 func NewSFUHandler(
 	log logger.Logger,
 	wss *WSS,
-	iceServers []ICEServer,
+	iceServers ICEServersFunc,
 	sfuConfig NetworkConfigSFU,
 	tracksManager TracksManager,
+	health *Health,
 ) *SFU {
 	log = log.WithNamespaceAppended("sfu")
 
 	webRTCTransportFactory := NewWebRTCTransportFactory(log, iceServers, sfuConfig)
+	webRTCTransportFactory.RegisterHealthChecks(health)
 
 	return &SFU{log, wss, tracksManager, webRTCTransportFactory}
 }
@@ -61,6 +66,10 @@ func (sfu *SFU) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"client_id": clientID,
 	})
 
+	// The spans started while handling the messages are children of the
+	// websocket accept span.
+	ctx = trace.ContextWithSpanContext(ctx, sub.SpanContext())
+
 	socketHandler := NewSocketHandler(
 		ctx,
 		log,
@@ -68,7 +77,11 @@ func (sfu *SFU) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		sfu.webRTCTransportFactory,
 		clientID,
 		roomID,
+		sub.Role(),
 		sub.Adapter(),
+		sub.StartHeartbeat(ctx),
+		sub.StartChat(),
+		sub.Breakouts(),
 	)
 
 	// Just in case. I'm actually not sure if this is necessary since if the
@@ -95,6 +108,18 @@ type SocketHandler struct {
 	clientID               identifiers.ClientID
 	room                   identifiers.RoomID
 	pinger                 *Pinger
+	chat                   *Chat
+	breakouts              *Breakouts
+
+	// webRTCTransportDone is closed after the client was hung up because the
+	// webRTCTransport was closed.
+	webRTCTransportDone chan struct{}
+
+	// role is the role of the client in a webinar room, empty for other rooms.
+	role message.ClientRole
+
+	// traceCtx is the parent of the spans started by the handler.
+	traceCtx context.Context
 
 	mu sync.Mutex
 }
@@ -106,26 +131,42 @@ func NewSocketHandler(
 	webRTCTransportFactory *WebRTCTransportFactory,
 	clientID identifiers.ClientID,
 	room identifiers.RoomID,
+	role message.ClientRole,
 	adapter Adapter,
+	pinger *Pinger,
+	chat *Chat,
+	breakouts *Breakouts,
 ) *SocketHandler {
-	pinger := NewPinger(ctx, 5*time.Second, func() {
-		if err := adapter.Emit(clientID, message.NewPing(room)); err != nil {
-			log.Error("Sending ping", errors.Trace(err), nil)
-		}
-	})
-
 	return &SocketHandler{
 		log:                    log.WithNamespaceAppended("sfu"),
 		pinger:                 pinger,
+		chat:                   chat,
+		breakouts:              breakouts,
 		tracksManager:          tracksManager,
 		webRTCTransportFactory: webRTCTransportFactory,
 		clientID:               clientID,
 		room:                   room,
+		role:                   role,
 		adapter:                adapter,
+		traceCtx:               tracing.Detach(ctx),
 	}
 }
 
+// HandleMessage handles a message from the client and replies with an Error
+// when it fails, or with an Ack when the message has a RequestID.
 func (sh *SocketHandler) HandleMessage(msg message.Message) error {
+	err := sh.handleMessage(msg)
+
+	if reply, ok := newReply(msg, err); ok {
+		if emitErr := sh.adapter.Emit(sh.clientID, reply); emitErr != nil {
+			sh.log.Error("Emit reply", errors.Trace(emitErr), nil)
+		}
+	}
+
+	return errors.Trace(err)
+}
+
+func (sh *SocketHandler) handleMessage(msg message.Message) error {
 	sh.mu.Lock()
 	defer sh.mu.Unlock()
 
@@ -140,11 +181,19 @@ func (sh *SocketHandler) HandleMessage(msg message.Message) error {
 		err = errors.Trace(sh.handleSignal(*msg.Payload.Signal))
 	case message.TypeSubTrack:
 		err = errors.Trace(sh.handleSubTrackEvent(*msg.Payload.SubTrack))
+	case message.TypePromote:
+		err = errors.Trace(sh.handlePromote(*msg.Payload.Promote))
+	case message.TypeStartBreakout:
+		err = errors.Trace(sh.handleStartBreakout(*msg.Payload.StartBreakout))
+	case message.TypeEndBreakout:
+		err = errors.Trace(sh.handleEndBreakout())
+	case message.TypeChat:
+		err = errors.Trace(sh.chat.HandleChat(*msg.Payload.Chat))
 	case message.TypePing:
 	case message.TypePong:
 		sh.pinger.ReceivePong()
 	default:
-		err = errors.Errorf("Unhandled event: %+v", msg)
+		err = errors.Annotatef(ErrUnexpectedMessage, "unhandled event: %+v", msg)
 	}
 
 	return errors.Trace(err)
@@ -168,11 +217,15 @@ func (sh *SocketHandler) HangUp() {
 }
 
 func (sh *SocketHandler) handleSubTrackEvent(sub message.SubTrack) error {
+	if sh.webRTCTransport == nil {
+		return errors.Annotatef(ErrUnexpectedMessage, "sub track: webRTCTransport not initialized")
+	}
+
 	var err error
 
 	switch sub.Type {
 	case transport.TrackEventTypeSub:
-		err = sh.tracksManager.Sub(sfu.SubParams{
+		err = sh.tracksManager.Sub(sh.traceCtx, sfu.SubParams{
 			PubClientID: sub.PubClientID,
 			Room:        sh.room,
 			TrackID:     sub.TrackID,
@@ -188,7 +241,7 @@ func (sh *SocketHandler) handleSubTrackEvent(sub message.SubTrack) error {
 		})
 		err = errors.Trace(err)
 	default:
-		err = errors.Errorf("invalid sub track event: %+v", sub)
+		err = errors.Annotatef(ErrInvalidMessage, "sub track event: %+v", sub)
 	}
 
 	return errors.Trace(err)
@@ -209,7 +262,13 @@ func (sh *SocketHandler) handleHangUp(_ message.HangUp) error {
 	return nil
 }
 
-func (sh *SocketHandler) handleReady(msg message.Ready) error {
+func (sh *SocketHandler) handleReady(msg message.Ready) (err error) {
+	ctx, span := tracer.Start(sh.traceCtx, "SocketHandler.handleReady")
+
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	adapter := sh.adapter
 	roomID := sh.room
 	clientID := sh.clientID
@@ -226,7 +285,7 @@ func (sh *SocketHandler) handleReady(msg message.Ready) error {
 	})
 
 	if sh.webRTCTransport != nil {
-		return errors.Errorf("unexpected ready event in room %s - already have a webrtc transport", roomID)
+		return errors.Annotatef(ErrUnexpectedMessage, "ready event in room %s - already have a webrtc transport", roomID)
 	}
 
 	adapter.SetMetadata(clientID, msg.Nickname)
@@ -237,28 +296,31 @@ func (sh *SocketHandler) handleReady(msg message.Ready) error {
 	}
 
 	err = adapter.Broadcast(
-		message.NewUsers(roomID, message.Users{
+		withTraceContext(ctx, message.NewUsers(roomID, message.Users{
 			Initiator: initiator,
 			PeerIDs:   []identifiers.ClientID{localPeerID},
 			Nicknames: clients,
-		}),
+		})),
 	)
 	if err != nil {
 		return errors.Annotatef(err, "broadcasting users")
 	}
 
-	webRTCTransport, err := sh.webRTCTransportFactory.NewWebRTCTransport(roomID, clientID, peerID)
+	viewer := sh.role == message.ClientRoleViewer
+
+	webRTCTransport, err := sh.webRTCTransportFactory.NewWebRTCTransport(ctx, roomID, clientID, peerID, viewer)
 	if err != nil {
 		return errors.Annotatef(err, "create new WebRTCTransport")
 	}
 
-	pubTrackEventsCh, err := sh.tracksManager.Add(roomID, webRTCTransport)
+	pubTrackEventsCh, err := sh.tracksManager.Add(ctx, roomID, webRTCTransport, sh.handleTrackRejected)
 	if err != nil {
 		webRTCTransport.Close()
 		return errors.Trace(err)
 	}
 
 	sh.webRTCTransport = webRTCTransport
+	sh.webRTCTransportDone = make(chan struct{})
 
 	go func() {
 		for pubTrackEvent := range pubTrackEventsCh {
@@ -275,21 +337,110 @@ func (sh *SocketHandler) handleReady(msg message.Ready) error {
 		}
 	}()
 
-	go sh.processLocalSignals(webRTCTransport.SignalChannel())
+	go sh.processLocalSignals(webRTCTransport.SignalChannel(), sh.webRTCTransportDone)
+
+	if sh.role != "" {
+		err := adapter.Broadcast(message.NewRole(roomID, message.Role{
+			ClientID: clientID,
+			Role:     sh.role,
+		}))
+		if err != nil {
+			return errors.Annotatef(err, "broadcasting role")
+		}
+	}
 
 	return nil
 }
 
+// handlePromote lets a viewer publish tracks when the client is a presenter.
+func (sh *SocketHandler) handlePromote(promote message.Promote) error {
+	if sh.role != message.ClientRolePresenter {
+		return errors.Annotatef(ErrForbidden, "promote: client is not a presenter")
+	}
+
+	sh.log.Info("Promote viewer", logger.Ctx{
+		"viewer_client_id": promote.ClientID,
+	})
+
+	if err := sh.tracksManager.Promote(sh.room, promote.ClientID); err != nil {
+		return errors.Annotatef(err, "promote: %s", promote.ClientID)
+	}
+
+	err := sh.adapter.Broadcast(message.NewRole(sh.room, message.Role{
+		ClientID: promote.ClientID,
+		Role:     message.ClientRoleSpeaker,
+	}))
+
+	return errors.Annotatef(err, "broadcasting role")
+}
+
+// handleStartBreakout moves the clients of the room to breakout rooms when the
+// client is a presenter.
+func (sh *SocketHandler) handleStartBreakout(startBreakout message.StartBreakout) error {
+	if sh.role != message.ClientRolePresenter || sh.breakouts == nil {
+		return errors.Annotatef(ErrForbidden, "start breakout: client is not a presenter")
+	}
+
+	duration := time.Duration(startBreakout.Duration) * time.Millisecond
+
+	_, err := sh.breakouts.Start(sh.room, startBreakout.Rooms, duration)
+
+	return errors.Annotatef(err, "start breakout")
+}
+
+// handleEndBreakout brings the clients back from the breakout rooms when the
+// client is a presenter.
+func (sh *SocketHandler) handleEndBreakout() error {
+	if sh.role != message.ClientRolePresenter || sh.breakouts == nil {
+		return errors.Annotatef(ErrForbidden, "end breakout: client is not a presenter")
+	}
+
+	return errors.Annotatef(sh.breakouts.End(sh.room), "end breakout")
+}
+
+// closeTransport closes the WebRTCTransport, if any, and waits until the
+// client has been hung up.
+func (sh *SocketHandler) closeTransport() error {
+	sh.mu.Lock()
+	webRTCTransport, done := sh.webRTCTransport, sh.webRTCTransportDone
+	sh.mu.Unlock()
+
+	if webRTCTransport == nil {
+		return nil
+	}
+
+	err := webRTCTransport.Close()
+
+	<-done
+
+	return errors.Annotate(err, "close WebRTCTransport")
+}
+
+// handleTrackRejected lets the client know that its track was not published.
+func (sh *SocketHandler) handleTrackRejected(trackID identifiers.TrackID, err error) {
+	msg := message.NewError(sh.room, "", message.Error{
+		Code:        errorCode(err),
+		Message:     fmt.Sprintf("track %s:%s rejected: %s", trackID.StreamID, trackID.ID, errors.Cause(err)),
+		RequestType: "",
+	})
+
+	if err := sh.adapter.Emit(sh.clientID, msg); err != nil {
+		sh.log.Error("Emit track rejected", errors.Trace(err), nil)
+	}
+}
+
 func (sh *SocketHandler) handleSignal(signal message.UserSignal) error {
 	if sh.webRTCTransport == nil {
-		return errors.Errorf("signal: webRTCTransport not initialized")
+		return errors.Annotatef(ErrUnexpectedMessage, "signal: webRTCTransport not initialized")
 	}
 
 	err := sh.webRTCTransport.Signal(signal.Signal)
 	return errors.Annotate(err, "handleSignal")
 }
 
-func (sh *SocketHandler) processLocalSignals(signals <-chan message.Signal) {
+func (sh *SocketHandler) processLocalSignals(signals <-chan message.Signal, done chan<- struct{}) {
+	defer close(done)
+
 	startTime := time.Now()
 
 	prometheusWebRTCConnTotal.Inc()
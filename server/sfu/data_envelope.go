@@ -0,0 +1,77 @@
+package sfu
+
+import (
+	"encoding/json"
+
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/pion/webrtc/v3"
+)
+
+// maxTopicsPerClient limits the topics a client can subscribe to.
+const maxTopicsPerClient = 64
+
+// DataEnvelopeType defines where a data channel message is routed to, or
+// which topic subscription it changes.
+type DataEnvelopeType string
+
+const (
+	// DataEnvelopeTypeAll sends the message to everyone in the room.
+	DataEnvelopeTypeAll DataEnvelopeType = "all"
+	// DataEnvelopeTypePeer sends the message to the client with ID To.
+	DataEnvelopeTypePeer DataEnvelopeType = "peer"
+	// DataEnvelopeTypeTopic sends the message to the clients subscribed to
+	// the topic To.
+	DataEnvelopeTypeTopic DataEnvelopeType = "topic"
+	// DataEnvelopeTypeSub subscribes the sender to the topic To. It is not
+	// forwarded.
+	DataEnvelopeTypeSub DataEnvelopeType = "sub"
+	// DataEnvelopeTypeUnsub unsubscribes the sender from the topic To. It is
+	// not forwarded.
+	DataEnvelopeTypeUnsub DataEnvelopeType = "unsub"
+)
+
+// DataEnvelope wraps the data channel messages which are not broadcast to
+// the whole room. It is sent as a JSON text message. The other messages are
+// broadcast as before.
+type DataEnvelope struct {
+	Type DataEnvelopeType `json:"type"`
+	// To is the client ID or the topic, depending on Type.
+	To string `json:"to,omitempty"`
+	// From is the ID of the client that sent the message. It is set by the
+	// server.
+	From identifiers.ClientID `json:"from,omitempty"`
+	// Data is the payload, it can be any JSON value.
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// parseDataEnvelope returns false when msg is not a valid envelope.
+func parseDataEnvelope(msg webrtc.DataChannelMessage) (DataEnvelope, bool) {
+	var env DataEnvelope
+
+	if !msg.IsString || len(msg.Data) == 0 || msg.Data[0] != '{' {
+		return env, false
+	}
+
+	if err := json.Unmarshal(msg.Data, &env); err != nil {
+		return env, false
+	}
+
+	switch env.Type {
+	case DataEnvelopeTypeAll:
+		return env, true
+	case DataEnvelopeTypePeer, DataEnvelopeTypeTopic, DataEnvelopeTypeSub, DataEnvelopeTypeUnsub:
+		return env, env.To != ""
+	default:
+		return env, false
+	}
+}
+
+// message returns the envelope as a data channel message.
+func (e DataEnvelope) message() (webrtc.DataChannelMessage, error) {
+	data, err := json.Marshal(e)
+
+	return webrtc.DataChannelMessage{
+		IsString: true,
+		Data:     data,
+	}, err
+}
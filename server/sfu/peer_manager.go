@@ -1,7 +1,9 @@
 package sfu
 
 import (
+	"context"
 	"io"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,12 +13,42 @@ import (
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/multierr"
 	"github.com/peer-calls/peer-calls/v4/server/pubsub"
+	"github.com/peer-calls/peer-calls/v4/server/quota"
+	"github.com/peer-calls/peer-calls/v4/server/sfu/stats"
+	"github.com/peer-calls/peer-calls/v4/server/tracing"
 	"github.com/peer-calls/peer-calls/v4/server/transport"
 	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v3"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-var ErrDuplicateTransport = errors.New("duplicate transport")
+var (
+	ErrDuplicateTransport = errors.New("duplicate transport")
+	// ErrTooManyPublishers is passed to TrackRejectedFunc when the room already
+	// has the maximum number of publishers.
+	ErrTooManyPublishers = errors.New("too many publishers in room")
+	// ErrTooManyTracks is passed to TrackRejectedFunc when the client has
+	// already published the maximum number of tracks.
+	ErrTooManyTracks = errors.New("too many tracks published by client")
+	// ErrNotViewer is returned by Promote when the transport is not a viewer.
+	ErrNotViewer = errors.New("not a viewer")
+)
+
+// Limits restricts the tracks published by the clients connected over
+// WebRTC. The tracks received from other nodes are not limited because they
+// have already been checked on their node. The limits are disabled when zero.
+type Limits struct {
+	// MaxPublishers is the maximum number of clients publishing tracks in a
+	// room.
+	MaxPublishers int
+	// MaxTracksPerClient is the maximum number of tracks published by a
+	// client.
+	MaxTracksPerClient int
+}
+
+// TrackRejectedFunc is called when a track of the client is not published
+// because of the limits.
+type TrackRejectedFunc func(trackID identifiers.TrackID, err error)
 
 type PeerManager struct {
 	log logger.Logger
@@ -30,13 +62,32 @@ type PeerManager struct {
 
 	pliTimes map[identifiers.TrackID]time.Time
 
+	// trackStats contains the quality statistics of the published tracks.
+	trackStats map[identifiers.TrackID]*publishedTrackStats
+
 	room identifiers.RoomID
 
+	limits Limits
+	// quota counts the publishers in the room, on all nodes when it is backed
+	// by Redis.
+	quota quota.Quota
+	// publishers contains the clients that have acquired the publisher quota.
+	publishers map[identifiers.ClientID]struct{}
+
 	// pubsub keeps track of published tracks and its subscribers.
 	pubsub *pubsub.PubSub
+
+	// topics contains the data channel topics each client is subscribed to.
+	topics map[identifiers.ClientID]map[string]struct{}
 }
 
-func NewPeerManager(room identifiers.RoomID, log logger.Logger, jitterHandler JitterHandler) *PeerManager {
+func NewPeerManager(
+	room identifiers.RoomID,
+	log logger.Logger,
+	jitterHandler JitterHandler,
+	limits Limits,
+	q quota.Quota,
+) *PeerManager {
 	return &PeerManager{
 		log: log.WithNamespaceAppended("room_peers_manager"),
 
@@ -46,9 +97,17 @@ func NewPeerManager(room identifiers.RoomID, log logger.Logger, jitterHandler Ji
 
 		pliTimes: map[identifiers.TrackID]time.Time{},
 
+		trackStats: map[identifiers.TrackID]*publishedTrackStats{},
+
 		room: room,
 
+		limits:     limits,
+		quota:      q,
+		publishers: map[identifiers.ClientID]struct{}{},
+
 		pubsub: pubsub.New(log, clock.New()),
+
+		topics: map[identifiers.ClientID]map[string]struct{}{},
 	}
 }
 
@@ -56,30 +115,150 @@ func (t *PeerManager) broadcast(clientID identifiers.ClientID, msg webrtc.DataCh
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	broadcast := func(tr transport.Transport) {
-		if otherClientID := tr.ClientID(); otherClientID != clientID {
-			// FIXME async
-			err := <-tr.Send(msg)
-			if err != nil {
-				t.log.Error("Broadcast", errors.Trace(err), logger.Ctx{
-					"client_id":       clientID,
-					"other_client_id": otherClientID,
-				})
-			}
+	for otherClientID, tr := range t.transports {
+		if otherClientID != clientID {
+			t.sendData(clientID, tr, msg)
+		}
+	}
+}
+
+// handleData routes a data channel message received from tr. The messages
+// in a DataEnvelope are only sent to their destination, the other messages
+// are broadcast.
+//
+// The nodes in a room form a tree, so the messages from other nodes are
+// also relayed to the remaining nodes, the same way as the broadcasts.
+func (t *PeerManager) handleData(tr transport.Transport, msg webrtc.DataChannelMessage) {
+	clientID := tr.ClientID()
+
+	env, ok := parseDataEnvelope(msg)
+	if !ok {
+		t.broadcast(clientID, msg)
+
+		return
+	}
+
+	fromServer := tr.Type() == transport.TypeServer
+
+	// The sender can only be set by the other nodes.
+	if !fromServer || env.From == "" {
+		env.From = clientID
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch env.Type {
+	case DataEnvelopeTypeSub:
+		if !fromServer {
+			t.subscribeTopic(clientID, env.To)
+		}
+
+		return
+	case DataEnvelopeTypeUnsub:
+		if !fromServer {
+			delete(t.topics[clientID], env.To)
 		}
+
+		return
+	case DataEnvelopeTypeAll, DataEnvelopeTypePeer, DataEnvelopeTypeTopic:
+	}
+
+	msg, err := env.message()
+	if err != nil {
+		t.log.Error("Marshal data envelope", errors.Trace(err), logger.Ctx{
+			"client_id": clientID,
+		})
+
+		return
 	}
 
-	for _, tr := range t.transports {
-		broadcast(tr)
+	prometheusDataMessagesTotal.WithLabelValues(string(env.Type)).Inc()
+
+	for otherClientID, other := range t.transports {
+		if otherClientID != clientID && t.isDataDestination(env, other) {
+			t.sendData(clientID, other, msg)
+		}
+	}
+}
+
+// isDataDestination returns true when the message in env should be sent to
+// tr. The caller must hold the lock.
+func (t *PeerManager) isDataDestination(env DataEnvelope, tr transport.Transport) bool {
+	if tr.Type() == transport.TypeServer {
+		// The other nodes are skipped when the peer is connected to this node.
+		if env.Type == DataEnvelopeTypePeer {
+			_, ok := t.transports[identifiers.ClientID(env.To)]
+
+			return !ok
+		}
+
+		return true
+	}
+
+	switch env.Type {
+	case DataEnvelopeTypePeer:
+		return tr.ClientID() == identifiers.ClientID(env.To)
+	case DataEnvelopeTypeTopic:
+		_, ok := t.topics[tr.ClientID()][env.To]
+
+		return ok
+	default:
+		return true
+	}
+}
+
+// subscribeTopic subscribes the client to the data channel topic. The caller
+// must hold the lock.
+func (t *PeerManager) subscribeTopic(clientID identifiers.ClientID, topic string) {
+	topics, ok := t.topics[clientID]
+	if !ok {
+		topics = map[string]struct{}{}
+		t.topics[clientID] = topics
+	}
+
+	if len(topics) >= maxTopicsPerClient {
+		t.log.Warn("Too many data channel topics", logger.Ctx{
+			"client_id": clientID,
+			"topic":     topic,
+		})
+
+		return
+	}
+
+	topics[topic] = struct{}{}
+}
+
+func (t *PeerManager) sendData(clientID identifiers.ClientID, tr transport.Transport, msg webrtc.DataChannelMessage) {
+	// FIXME async
+	err := <-tr.Send(msg)
+	if err != nil {
+		t.log.Error("Send data", errors.Trace(err), logger.Ctx{
+			"client_id":       clientID,
+			"other_client_id": tr.ClientID(),
+		})
 	}
 }
 
 // Add adds a transport with ClientID. If there was already an existing
 // Transport with the same ClientID, it will be closed and removed before a new
-// one is added.
-func (t *PeerManager) Add(tr transport.Transport) (<-chan pubsub.PubTrackEvent, error) {
+// one is added. The remote tracks that exceed the limits or that are published
+// by a viewer are not published, onTrackRejected is called for them instead
+// when it is set.
+func (t *PeerManager) Add(
+	ctx context.Context,
+	tr transport.Transport,
+	onTrackRejected TrackRejectedFunc,
+) (_ <-chan pubsub.PubTrackEvent, err error) {
 	clientID := tr.ClientID()
 
+	_, span := tracer.Start(ctx, "PeerManager.Add")
+	span.SetAttributes(attribute.String("client_id", clientID.String()))
+
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	log := t.log.WithCtx(logger.Ctx{
 		"client_id": clientID,
 	})
@@ -138,17 +317,73 @@ func (t *PeerManager) Add(tr transport.Transport) (<-chan pubsub.PubTrackEvent,
 				rtcpReader := remoteTrackWithReceiver.RTCPReader
 				trackID := remoteTrack.Track().TrackID()
 
+				if err := t.checkLimits(tr); err != nil {
+					log.Warn("Reject track", logger.Ctx{
+						"track_id": trackID,
+						"err":      err,
+					})
+
+					if onTrackRejected != nil {
+						onTrackRejected(trackID, err)
+					}
+
+					continue
+				}
+
 				done := make(chan struct{})
 
-				t.pubsub.Pub(clientID, pubsub.NewTrackReader(remoteTrack, func() {
+				trackStats := &publishedTrackStats{
+					pubClientID: clientID,
+					track:       remoteTrack.Track(),
+					stats: stats.NewTrack(stats.TrackParams{
+						SSRC:      uint32(remoteTrack.SSRC()),
+						ClockRate: remoteTrack.Track().Codec().ClockRate,
+						Interval:  0,
+					}),
+				}
+
+				t.mu.Lock()
+				t.trackStats[trackID] = trackStats
+				t.mu.Unlock()
+
+				remoteTrack = statsTrackRemote{
+					TrackRemote: remoteTrack,
+					stats:       trackStats.stats,
+				}
+
+				t.mu.Lock()
+
+				err := t.pubsub.Pub(clientID, pubsub.NewTrackReader(remoteTrack, func() {
 					t.mu.Lock()
 
 					close(done)
 
 					t.pubsub.Unpub(clientID, trackID)
 
+					if t.trackStats[trackID] == trackStats {
+						delete(t.trackStats, trackID)
+					}
+
 					t.mu.Unlock()
 				}))
+				if err != nil && t.trackStats[trackID] == trackStats {
+					delete(t.trackStats, trackID)
+				}
+
+				t.mu.Unlock()
+
+				if err != nil {
+					log.Warn("Reject track", logger.Ctx{
+						"track_id": trackID,
+						"err":      err,
+					})
+
+					if onTrackRejected != nil {
+						onTrackRejected(trackID, err)
+					}
+
+					continue
+				}
 
 				t.wg.Add(1)
 
@@ -233,7 +468,7 @@ func (t *PeerManager) Add(tr transport.Transport) (<-chan pubsub.PubTrackEvent,
 		defer t.wg.Done()
 
 		for msg := range tr.MessagesChannel() {
-			t.broadcast(clientID, msg)
+			t.handleData(tr, msg)
 		}
 	}()
 
@@ -268,10 +503,26 @@ func (t *PeerManager) add(tr transport.Transport) (<-chan pubsub.PubTrackEvent,
 	// because we're still under a lock.
 	t.transports[clientID] = tr
 
+	if p, ok := tr.(transport.Promotable); ok && p.Viewer() {
+		t.pubsub.SetViewer(clientID, true)
+	}
+
 	return pubTrackEventSub, nil
 }
 
-func (t *PeerManager) Sub(params SubParams) error {
+func (t *PeerManager) Sub(ctx context.Context, params SubParams) (err error) {
+	_, span := tracer.Start(ctx, "PeerManager.Sub")
+	span.SetAttributes(
+		attribute.String("pub_client_id", params.PubClientID.String()),
+		attribute.String("track_id", params.TrackID.ID),
+		attribute.String("stream_id", params.TrackID.StreamID),
+		attribute.String("sub_client_id", params.SubClientID.String()),
+	)
+
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -285,15 +536,38 @@ func (t *PeerManager) Sub(params SubParams) error {
 		return errors.Trace(err)
 	}
 
+	logCtx := logger.Ctx{
+		"pub_client_id": params.PubClientID,
+		"track_id":      params.TrackID,
+		"sub_client_id": params.SubClientID,
+	}
+
+	// trackStats might be nil when the track was published by a transport
+	// that was replaced.
+	trackStats := t.trackStats[params.TrackID]
+
+	if props, ok := t.pubsub.TrackPropsByTrackID(params.TrackID); ok && props.Kind == transport.TrackKindVideo {
+		t.wg.Add(1)
+
+		go func() {
+			defer t.wg.Done()
+
+			// The new subscriber will be fed the most recent keyframe from the
+			// cache (if any), but we still request a fresh keyframe so that the
+			// subscriber is not stuck with a stale picture for too long.
+			if err := t.requestKeyframe(params.TrackID, logCtx); err != nil {
+				t.log.Error("Request keyframe", errors.Trace(err), logCtx)
+			}
+		}()
+	}
+
 	t.wg.Add(1)
 
 	go func() {
 		defer t.wg.Done()
 
-		logCtx := logger.Ctx{
-			"pub_client_id": params.PubClientID,
-			"track_id":      params.TrackID,
-			"sub_client_id": params.SubClientID,
+		if trackStats != nil {
+			defer trackStats.stats.RemoveSubscriber(params.SubClientID)
 		}
 
 		feedBitrateEstimate := func(trackID identifiers.TrackID, bitrate float32) {
@@ -307,54 +581,11 @@ func (t *PeerManager) Sub(params SubParams) error {
 			t.mu.Unlock()
 		}
 
-		forwardPLI := func(packet *rtcp.PictureLossIndication) error {
-			now := time.Now()
-
-			t.mu.Lock()
-
-			props, propsFound := t.pubsub.TrackPropsByTrackID(params.TrackID)
-			transport, transportFound := t.transports[props.ClientID]
-			lastPLITime := t.pliTimes[params.TrackID]
-
-			// TODO perhaps a better solution for this would be an RTCP interceptor.
-			pliTooSoon := now.Sub(lastPLITime) < time.Second
-			if !pliTooSoon {
-				t.pliTimes[params.TrackID] = now
-			}
-
-			t.mu.Unlock()
-
-			if !propsFound {
-				return errors.Annotatef(pubsub.ErrTrackNotFound, "got RTCP for track that was not found")
-			}
-
-			if !transportFound {
-				return errors.Errorf("transport not found: %s", props.ClientID)
-			}
-
-			if pliTooSoon {
-				// Congestion control.
-				// return errors.Errorf("too many PLI packets received, ignoring")
-				return nil
-			}
-
-			// Important: set the correct SSRC before sending the packet to source.
-			packet.MediaSSRC = uint32(props.SSRC)
-			packet.SenderSSRC = uint32(props.SSRC)
-
-			if err := transport.WriteRTCP([]rtcp.Packet{packet}); err != nil {
-				return errors.Annotatef(err, "sending PLI back to source: %s", props.ClientID)
+		handlePacket := func(p rtcp.Packet) (err error) {
+			if trackStats != nil {
+				trackStats.stats.HandleRTCP(params.SubClientID, p, time.Now())
 			}
 
-			prometheusRTCPPacketsSent.Inc()
-
-			// TODO remove this log.
-			t.log.Info("Sent PLI back to source", logCtx)
-
-			return nil
-		}
-
-		handlePacket := func(p rtcp.Packet) (err error) {
 			// NOTE: REMB and NACK are now handled by pion/webrtc interceptors so we
 			// don't have to explicitly handle them here.
 			switch packet := p.(type) {
@@ -365,9 +596,11 @@ func (t *PeerManager) Sub(params SubParams) error {
 			// different peer connections.
 			case *rtcp.PictureLossIndication:
 				prometheusRTCPPLIPacketsReceived.Inc()
-				err = errors.Trace(forwardPLI(packet))
+				err = errors.Trace(t.requestKeyframe(params.TrackID, logCtx))
 			case *rtcp.ReceiverEstimatedMaximumBitrate:
 				feedBitrateEstimate(params.TrackID, packet.Bitrate)
+			case *rtcp.TransportLayerNack:
+				prometheusRTCPNACKPacketsReceived.Inc()
 			default:
 			}
 
@@ -397,6 +630,57 @@ func (t *PeerManager) Sub(params SubParams) error {
 	return nil
 }
 
+// requestKeyframe sends a PLI to the publisher of the track, unless a PLI was
+// already sent less than a second ago.
+func (t *PeerManager) requestKeyframe(trackID identifiers.TrackID, logCtx logger.Ctx) error {
+	now := time.Now()
+
+	t.mu.Lock()
+
+	props, propsFound := t.pubsub.TrackPropsByTrackID(trackID)
+	transport, transportFound := t.transports[props.ClientID]
+	lastPLITime := t.pliTimes[trackID]
+
+	// TODO perhaps a better solution for this would be an RTCP interceptor.
+	pliTooSoon := now.Sub(lastPLITime) < time.Second
+	if !pliTooSoon {
+		t.pliTimes[trackID] = now
+	}
+
+	t.mu.Unlock()
+
+	if !propsFound {
+		return errors.Annotatef(pubsub.ErrTrackNotFound, "got RTCP for track that was not found")
+	}
+
+	if !transportFound {
+		return errors.Errorf("transport not found: %s", props.ClientID)
+	}
+
+	if pliTooSoon {
+		// Congestion control.
+		// return errors.Errorf("too many PLI packets received, ignoring")
+		return nil
+	}
+
+	// Important: set the correct SSRC before sending the packet to source.
+	packet := &rtcp.PictureLossIndication{
+		MediaSSRC:  uint32(props.SSRC),
+		SenderSSRC: uint32(props.SSRC),
+	}
+
+	if err := transport.WriteRTCP([]rtcp.Packet{packet}); err != nil {
+		return errors.Annotatef(err, "sending PLI back to source: %s", props.ClientID)
+	}
+
+	prometheusRTCPPacketsSent.Inc()
+
+	// TODO remove this log.
+	t.log.Info("Sent PLI back to source", logCtx)
+
+	return nil
+}
+
 func (t *PeerManager) Unsub(params SubParams) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -430,6 +714,106 @@ func (t *PeerManager) Remove(tr transport.Transport) error {
 	return nil
 }
 
+// Promote allows the viewer with clientID to publish tracks and renegotiates
+// its transport. It returns ErrNotViewer when the transport cannot be
+// promoted.
+func (t *PeerManager) Promote(clientID identifiers.ClientID) error {
+	t.mu.Lock()
+
+	tr, ok := t.transports[clientID]
+	if !ok {
+		t.mu.Unlock()
+
+		return errors.Errorf("transport not found: %s", clientID)
+	}
+
+	p, ok := tr.(transport.Promotable)
+	if !ok || !p.Viewer() {
+		t.mu.Unlock()
+
+		return errors.Annotatef(ErrNotViewer, "promote: %s", clientID)
+	}
+
+	t.pubsub.SetViewer(clientID, false)
+
+	t.mu.Unlock()
+
+	p.Promote()
+
+	return nil
+}
+
+// publishersKey returns the quota key of the publishers in the room.
+func (t *PeerManager) publishersKey() string {
+	return "room:" + t.room.String() + ":publishers"
+}
+
+// checkLimits acquires the publisher quota for the client before its track is
+// published. It returns an error when the track exceeds the limits.
+func (t *PeerManager) checkLimits(tr transport.Transport) error {
+	if tr.Type() != transport.TypeWebRTC {
+		return nil
+	}
+
+	clientID := tr.ClientID()
+
+	t.mu.Lock()
+
+	err := t.checkTrackLimits(clientID)
+	_, isPublisher := t.publishers[clientID]
+
+	t.mu.Unlock()
+
+	if err != nil || isPublisher {
+		return err
+	}
+
+	// The quota might be stored in Redis, so it is acquired without holding the
+	// lock.
+	err = t.quota.Acquire(t.publishersKey(), clientID.String(), t.limits.MaxPublishers)
+	if errors.Cause(err) == quota.ErrExceeded {
+		return errors.Annotatef(ErrTooManyPublishers, "limit %d", t.limits.MaxPublishers)
+	} else if err != nil {
+		return errors.Annotatef(err, "acquire publisher quota")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.transports[clientID] != tr {
+		// The transport was removed in the meantime so it will not release the
+		// quota. A new transport of the same client shares the quota.
+		if _, ok := t.publishers[clientID]; !ok {
+			if err := t.quota.Release(t.publishersKey(), clientID.String()); err != nil {
+				t.log.Error("Release publisher quota", errors.Trace(err), logger.Ctx{
+					"client_id": clientID,
+				})
+			}
+		}
+
+		return errors.Errorf("transport removed: %s", clientID)
+	}
+
+	t.publishers[clientID] = struct{}{}
+
+	return nil
+}
+
+// checkTrackLimits returns an error when the client is not allowed to
+// publish another track. The caller must hold the lock.
+func (t *PeerManager) checkTrackLimits(clientID identifiers.ClientID) error {
+	// Checked before the quota is acquired, Pub would refuse the track anyway.
+	if t.pubsub.Viewer(clientID) {
+		return errors.Annotatef(pubsub.ErrPublishNotAllowed, "client: %s", clientID)
+	}
+
+	if max := t.limits.MaxTracksPerClient; max > 0 && t.pubsub.PubTracksCount(clientID) >= max {
+		return errors.Annotatef(ErrTooManyTracks, "limit %d", max)
+	}
+
+	return nil
+}
+
 // remove unsubscribes the transport from track events and removes any
 // published published tracks. The transport should be closed by the time this
 // method is called. The caller must hold the lock.
@@ -445,8 +829,50 @@ func (t *PeerManager) remove(clientID identifiers.ClientID) {
 	}
 
 	t.pubsub.Terminate(clientID)
+	t.pubsub.SetViewer(clientID, false)
+
+	if _, ok := t.publishers[clientID]; ok {
+		if err := t.quota.Release(t.publishersKey(), clientID.String()); err != nil {
+			t.log.Error("Release publisher quota", errors.Trace(err), logger.Ctx{
+				"client_id": clientID,
+			})
+		}
+
+		delete(t.publishers, clientID)
+	}
 
 	delete(t.transports, clientID)
+	delete(t.topics, clientID)
+}
+
+// Stats returns the quality statistics of the published tracks, sorted by
+// the publisher and track IDs.
+func (t *PeerManager) Stats(now time.Time) []TrackStats {
+	t.mu.RLock()
+
+	trackStats := make([]TrackStats, 0, len(t.trackStats))
+
+	for _, s := range t.trackStats {
+		trackStats = append(trackStats, s.Snapshot(now))
+	}
+
+	t.mu.RUnlock()
+
+	sort.Slice(trackStats, func(i, j int) bool {
+		a, b := trackStats[i], trackStats[j]
+
+		if a.PubClientID != b.PubClientID {
+			return a.PubClientID < b.PubClientID
+		}
+
+		if a.TrackID.StreamID != b.TrackID.StreamID {
+			return a.TrackID.StreamID < b.TrackID.StreamID
+		}
+
+		return a.TrackID.ID < b.TrackID.ID
+	})
+
+	return trackStats
 }
 
 // Size returns the total size of transports in the room.
@@ -0,0 +1,354 @@
+package sfu
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/peer-calls/peer-calls/v4/server/pubsub"
+	"github.com/peer-calls/peer-calls/v4/server/quota"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/peer-calls/peer-calls/v4/server/transport"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// limitsTransportMock only implements the methods used by checkLimits and
+// Close.
+type limitsTransportMock struct {
+	transport.Transport
+
+	clientID identifiers.ClientID
+	typ      transport.Type
+}
+
+func (m limitsTransportMock) ClientID() identifiers.ClientID {
+	return m.clientID
+}
+
+func (m limitsTransportMock) Type() transport.Type {
+	return m.typ
+}
+
+func (m limitsTransportMock) Close() error {
+	return nil
+}
+
+// limitsReaderMock only implements the methods used by PubSub.Pub and
+// PubSub.Unpub.
+type limitsReaderMock struct {
+	pubsub.Reader
+
+	track transport.Track
+}
+
+func (m limitsReaderMock) Track() transport.Track {
+	return m.track
+}
+
+func (m limitsReaderMock) Subs() []identifiers.ClientID {
+	return nil
+}
+
+// viewerTransportMock is a limitsTransportMock that can be promoted.
+type viewerTransportMock struct {
+	limitsTransportMock
+
+	viewer   bool
+	promoted int
+}
+
+func (m *viewerTransportMock) Viewer() bool {
+	return m.viewer
+}
+
+func (m *viewerTransportMock) Promote() {
+	m.viewer = false
+	m.promoted++
+}
+
+func TestPeerManager_checkLimits(t *testing.T) {
+	log := test.NewLogger()
+
+	pm := NewPeerManager("room", log, NewJitterHandler(log, false), Limits{
+		MaxPublishers:      1,
+		MaxTracksPerClient: 2,
+	}, quota.NewMemory())
+	defer pm.Close()
+
+	a := limitsTransportMock{clientID: "a", typ: transport.TypeWebRTC}
+	b := limitsTransportMock{clientID: "b", typ: transport.TypeWebRTC}
+	node := limitsTransportMock{clientID: "node", typ: transport.TypeServer}
+
+	pm.mu.Lock()
+	pm.transports[a.clientID] = a
+	pm.transports[b.clientID] = b
+	pm.mu.Unlock()
+
+	codec := transport.Codec{
+		MimeType:    "audio/opus",
+		ClockRate:   48000,
+		Channels:    2,
+		SDPFmtpLine: "",
+	}
+
+	pub := func(tr limitsTransportMock, id string) {
+		pm.mu.Lock()
+		defer pm.mu.Unlock()
+
+		err := pm.pubsub.Pub(tr.clientID, limitsReaderMock{
+			track: transport.NewSimpleTrack(id, "stream", codec, identifiers.PeerID(tr.clientID)),
+		})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, pm.checkLimits(a))
+	pub(a, "a1")
+
+	err := pm.checkLimits(b)
+	assert.Equal(t, ErrTooManyPublishers, errors.Cause(err))
+
+	// The tracks from other nodes are not limited.
+	require.NoError(t, pm.checkLimits(node))
+	pub(node, "n1")
+	require.NoError(t, pm.checkLimits(node))
+	pub(node, "n2")
+	require.NoError(t, pm.checkLimits(node))
+
+	require.NoError(t, pm.checkLimits(a))
+	pub(a, "a2")
+
+	err = pm.checkLimits(a)
+	assert.Equal(t, ErrTooManyTracks, errors.Cause(err))
+
+	// Removing the publisher releases its quota.
+	pm.mu.Lock()
+	pm.remove(a.clientID)
+	pm.mu.Unlock()
+
+	require.NoError(t, pm.checkLimits(b))
+}
+
+// acquireHookQuota calls onAcquire before acquiring the quota.
+type acquireHookQuota struct {
+	quota.Quota
+
+	onAcquire func()
+}
+
+func (q acquireHookQuota) Acquire(key string, member string, limit int) error {
+	q.onAcquire()
+
+	return errors.Trace(q.Quota.Acquire(key, member, limit))
+}
+
+func TestPeerManager_checkLimits_removed(t *testing.T) {
+	log := test.NewLogger()
+
+	a := limitsTransportMock{clientID: "a", typ: transport.TypeWebRTC}
+	b := limitsTransportMock{clientID: "b", typ: transport.TypeWebRTC}
+
+	var pm *PeerManager
+
+	q := acquireHookQuota{
+		Quota: quota.NewMemory(),
+		onAcquire: func() {
+			// The quota is acquired without holding the lock, so the
+			// transport can be removed in the meantime.
+			pm.mu.Lock()
+			defer pm.mu.Unlock()
+
+			delete(pm.transports, a.clientID)
+		},
+	}
+
+	pm = NewPeerManager("room", log, NewJitterHandler(log, false), Limits{
+		MaxPublishers:      1,
+		MaxTracksPerClient: 0,
+	}, q)
+	defer pm.Close()
+
+	pm.mu.Lock()
+	pm.transports[a.clientID] = a
+	pm.transports[b.clientID] = b
+	pm.mu.Unlock()
+
+	assert.Error(t, pm.checkLimits(a))
+
+	// The quota acquired for the removed transport was released.
+	q.onAcquire = func() {}
+	pm.quota = q
+
+	require.NoError(t, pm.checkLimits(b))
+}
+
+func TestPeerManager_Promote(t *testing.T) {
+	log := test.NewLogger()
+
+	pm := NewPeerManager("room", log, NewJitterHandler(log, false), Limits{
+		MaxPublishers:      0,
+		MaxTracksPerClient: 0,
+	}, quota.NewMemory())
+	defer pm.Close()
+
+	viewer := &viewerTransportMock{
+		limitsTransportMock: limitsTransportMock{clientID: "a", typ: transport.TypeWebRTC},
+		viewer:              true,
+		promoted:            0,
+	}
+
+	pm.mu.Lock()
+	_, err := pm.add(viewer)
+	pm.mu.Unlock()
+	require.NoError(t, err)
+
+	err = pm.checkLimits(viewer)
+	assert.Equal(t, pubsub.ErrPublishNotAllowed, errors.Cause(err))
+
+	require.NoError(t, pm.Promote("a"))
+	assert.Equal(t, 1, viewer.promoted)
+
+	require.NoError(t, pm.checkLimits(viewer))
+
+	// A speaker cannot be promoted again.
+	err = pm.Promote("a")
+	assert.Equal(t, ErrNotViewer, errors.Cause(err))
+	assert.Equal(t, 1, viewer.promoted)
+
+	err = pm.Promote("b")
+	assert.Error(t, err)
+}
+
+// dataTransportMock records the data channel messages sent to it.
+type dataTransportMock struct {
+	limitsTransportMock
+
+	sent []string
+}
+
+func (m *dataTransportMock) Send(msg webrtc.DataChannelMessage) <-chan error {
+	m.sent = append(m.sent, string(msg.Data))
+
+	errCh := make(chan error, 1)
+	errCh <- nil
+
+	return errCh
+}
+
+func (m *dataTransportMock) Close() error {
+	return nil
+}
+
+func TestPeerManager_handleData(t *testing.T) {
+	log := test.NewLogger()
+
+	pm := NewPeerManager("room", log, NewJitterHandler(log, false), Limits{}, quota.NewMemory())
+	defer pm.Close()
+
+	newTransport := func(clientID identifiers.ClientID, typ transport.Type) *dataTransportMock {
+		tr := &dataTransportMock{
+			limitsTransportMock: limitsTransportMock{clientID: clientID, typ: typ},
+			sent:                nil,
+		}
+
+		pm.mu.Lock()
+		pm.transports[clientID] = tr
+		pm.mu.Unlock()
+
+		return tr
+	}
+
+	a := newTransport("a", transport.TypeWebRTC)
+	b := newTransport("b", transport.TypeWebRTC)
+	c := newTransport("c", transport.TypeWebRTC)
+	node := newTransport("node", transport.TypeServer)
+
+	reset := func() {
+		for _, tr := range []*dataTransportMock{a, b, c, node} {
+			tr.sent = nil
+		}
+	}
+
+	handle := func(tr transport.Transport, data string, isString bool) {
+		pm.handleData(tr, webrtc.DataChannelMessage{
+			IsString: isString,
+			Data:     []byte(data),
+		})
+	}
+
+	t.Run("legacy messages are broadcast", func(t *testing.T) {
+		defer reset()
+
+		handle(a, "chunk", false)
+		handle(a, "text", true)
+
+		assert.Nil(t, a.sent)
+		assert.Equal(t, []string{"chunk", "text"}, b.sent)
+		assert.Equal(t, []string{"chunk", "text"}, c.sent)
+		assert.Equal(t, []string{"chunk", "text"}, node.sent)
+	})
+
+	t.Run("the sender is set by the server", func(t *testing.T) {
+		defer reset()
+
+		handle(a, `{"type":"all","from":"c","data":1}`, true)
+
+		exp := []string{`{"type":"all","from":"a","data":1}`}
+		assert.Nil(t, a.sent)
+		assert.Equal(t, exp, b.sent)
+		assert.Equal(t, exp, c.sent)
+		assert.Equal(t, exp, node.sent)
+	})
+
+	t.Run("peer", func(t *testing.T) {
+		defer reset()
+
+		handle(a, `{"type":"peer","to":"b","data":1}`, true)
+		handle(a, `{"type":"peer","to":"remote","data":2}`, true)
+
+		assert.Equal(t, []string{`{"type":"peer","to":"b","from":"a","data":1}`}, b.sent)
+		assert.Nil(t, c.sent)
+		assert.Equal(t, []string{`{"type":"peer","to":"remote","from":"a","data":2}`}, node.sent)
+	})
+
+	t.Run("topic", func(t *testing.T) {
+		defer reset()
+
+		handle(b, `{"type":"sub","to":"t"}`, true)
+		handle(c, `{"type":"sub","to":"t"}`, true)
+		handle(c, `{"type":"unsub","to":"t"}`, true)
+		// Subscriptions from other nodes are ignored.
+		handle(node, `{"type":"sub","to":"t"}`, true)
+
+		handle(a, `{"type":"topic","to":"t","data":1}`, true)
+		handle(node, `{"type":"topic","to":"t","from":"remote","data":2}`, true)
+
+		assert.Equal(t, []string{
+			`{"type":"topic","to":"t","from":"a","data":1}`,
+			`{"type":"topic","to":"t","from":"remote","data":2}`,
+		}, b.sent)
+		assert.Nil(t, a.sent)
+		assert.Nil(t, c.sent)
+		assert.Equal(t, []string{`{"type":"topic","to":"t","from":"a","data":1}`}, node.sent)
+	})
+
+	t.Run("topics are limited", func(t *testing.T) {
+		defer reset()
+
+		for i := 0; i <= maxTopicsPerClient; i++ {
+			handle(c, fmt.Sprintf(`{"type":"sub","to":"t%d"}`, i), true)
+		}
+
+		pm.mu.Lock()
+		assert.Len(t, pm.topics["c"], maxTopicsPerClient)
+		pm.mu.Unlock()
+
+		pm.remove("c")
+
+		pm.mu.Lock()
+		assert.NotContains(t, pm.topics, identifiers.ClientID("c"))
+		pm.mu.Unlock()
+	})
+}
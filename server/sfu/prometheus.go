@@ -15,11 +15,21 @@ var prometheusRTCPPLIPacketsReceived = promauto.NewCounter(prometheus.CounterOpt
 	Help: "Total number of received Picture Loss Indicator RTCP packets",
 })
 
+var prometheusRTCPNACKPacketsReceived = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "rtcp_nack_packets_received_total",
+	Help: "Total number of received NACK RTCP packets",
+})
+
 // var prometheusRTCPPacketsReceivedBytes = promauto.NewCounter(prometheus.CounterOpts{
 // 	Name: "rtcp_packets_received2_bytes_total",
 // 	Help: "Total number of received RTCP bytes",
 // })
 
+var prometheusDataMessagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "data_messages_total",
+	Help: "Total number of routed data channel messages by destination type",
+}, []string{"type"})
+
 var prometheusRTCPPacketsSent = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "rtcp_packets_sent2_total",
 	Help: "Total number of sent RTCP packets",
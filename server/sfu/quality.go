@@ -0,0 +1,82 @@
+package sfu
+
+import (
+	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/peer-calls/peer-calls/v4/server/sfu/stats"
+	"github.com/peer-calls/peer-calls/v4/server/transport"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+// TrackStats contains the quality statistics of a published track.
+type TrackStats struct {
+	PubClientID identifiers.ClientID `json:"pubClientId"`
+	TrackID     identifiers.TrackID  `json:"trackId"`
+	Kind        transport.TrackKind  `json:"kind"`
+
+	stats.TrackSnapshot
+}
+
+// RoomStats contains the quality statistics of the tracks published in a
+// room.
+type RoomStats struct {
+	RoomID identifiers.RoomID `json:"roomId"`
+	// Score is the mean score of the tracks, or zero when there are no tracks.
+	Score  float64      `json:"score"`
+	Tracks []TrackStats `json:"tracks"`
+}
+
+// newRoomStats computes the aggregate score of the tracks.
+func newRoomStats(roomID identifiers.RoomID, tracks []TrackStats) RoomStats {
+	var score float64
+
+	for _, track := range tracks {
+		score += track.Score
+	}
+
+	if len(tracks) > 0 {
+		score /= float64(len(tracks))
+	}
+
+	return RoomStats{
+		RoomID: roomID,
+		Score:  score,
+		Tracks: tracks,
+	}
+}
+
+// publishedTrackStats contains the statistics of a track published in a
+// PeerManager.
+type publishedTrackStats struct {
+	pubClientID identifiers.ClientID
+	track       transport.Track
+	stats       *stats.Track
+}
+
+func (p *publishedTrackStats) Snapshot(now time.Time) TrackStats {
+	return TrackStats{
+		PubClientID:   p.pubClientID,
+		TrackID:       p.track.TrackID(),
+		Kind:          p.track.Codec().TrackKind(),
+		TrackSnapshot: p.stats.Snapshot(now),
+	}
+}
+
+// statsTrackRemote records the packets read from the TrackRemote.
+type statsTrackRemote struct {
+	transport.TrackRemote
+	stats *stats.Track
+}
+
+var _ transport.TrackRemote = statsTrackRemote{}
+
+func (t statsTrackRemote) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	packet, attrs, err := t.TrackRemote.ReadRTP()
+	if err == nil {
+		t.stats.HandleRTP(packet, time.Now())
+	}
+
+	return packet, attrs, err // nolint:wrapcheck
+}
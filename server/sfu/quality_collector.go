@@ -0,0 +1,182 @@
+package sfu
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// QualityCollector exports the quality statistics of the tracks and rooms
+// with the lowest scores as Prometheus metrics. The tracks and rooms are
+// labelled by their rank instead of their IDs, so the number of series is
+// bounded by TopK.
+type QualityCollector struct {
+	params *QualityCollectorParams
+
+	trackScore        *prometheus.Desc
+	trackFractionLost *prometheus.Desc
+	trackJitter       *prometheus.Desc
+	trackRTT          *prometheus.Desc
+	trackBitrate      *prometheus.Desc
+	trackNACKs        *prometheus.Desc
+	trackPLIs         *prometheus.Desc
+	roomScore         *prometheus.Desc
+}
+
+// QualityCollectorParams are parameters for QualityCollector.
+type QualityCollectorParams struct {
+	// Stats returns the statistics of all rooms, for example
+	// TracksManager.Stats.
+	Stats func() []RoomStats
+	// TopK is the number of tracks and rooms to export.
+	TopK int
+	// RoomLabel adds the room label to the metrics. The number of series is
+	// still bounded, but the room IDs are visible to the metrics consumers.
+	RoomLabel bool
+}
+
+var _ prometheus.Collector = &QualityCollector{}
+
+// NewQualityCollector creates a new instance of QualityCollector.
+func NewQualityCollector(params QualityCollectorParams) *QualityCollector {
+	trackLabels := []string{"rank", "kind"}
+	roomLabels := []string{"rank"}
+
+	if params.RoomLabel {
+		trackLabels = append(trackLabels, "room")
+		roomLabels = append(roomLabels, "room")
+	}
+
+	return &QualityCollector{
+		params: &params,
+
+		trackScore: prometheus.NewDesc(
+			"media_track_quality_score",
+			"Estimated mean opinion score of the tracks with the lowest scores, between 1 and 4.5",
+			trackLabels, nil,
+		),
+		trackFractionLost: prometheus.NewDesc(
+			"media_track_fraction_lost",
+			"Fraction of packets lost between the publisher and the server",
+			trackLabels, nil,
+		),
+		trackJitter: prometheus.NewDesc(
+			"media_track_jitter_seconds",
+			"Interarrival jitter of the packets received from the publisher",
+			trackLabels, nil,
+		),
+		trackRTT: prometheus.NewDesc(
+			"media_track_rtt_seconds",
+			"Mean round trip time between the server and the subscribers",
+			trackLabels, nil,
+		),
+		trackBitrate: prometheus.NewDesc(
+			"media_track_bitrate_bits_per_second",
+			"Bitrate of the packets received from the publisher",
+			trackLabels, nil,
+		),
+		// The ranks move between tracks, so the counts are exported as gauges.
+		trackNACKs: prometheus.NewDesc(
+			"media_track_nack_packets",
+			"Number of NACK packets received from the subscribers of the track",
+			trackLabels, nil,
+		),
+		trackPLIs: prometheus.NewDesc(
+			"media_track_pli_packets",
+			"Number of PLI packets received from the subscribers of the track",
+			trackLabels, nil,
+		),
+		roomScore: prometheus.NewDesc(
+			"media_room_quality_score",
+			"Mean quality score of the tracks in the rooms with the lowest scores",
+			roomLabels, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *QualityCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.trackScore
+	ch <- c.trackFractionLost
+	ch <- c.trackJitter
+	ch <- c.trackRTT
+	ch <- c.trackBitrate
+	ch <- c.trackNACKs
+	ch <- c.trackPLIs
+	ch <- c.roomScore
+}
+
+// roomTrackStats is a track with the ID of its room.
+type roomTrackStats struct {
+	room  string
+	track TrackStats
+}
+
+// Collect implements prometheus.Collector.
+func (c *QualityCollector) Collect(ch chan<- prometheus.Metric) {
+	roomStats := c.params.Stats()
+
+	var tracks []roomTrackStats
+
+	rooms := make([]RoomStats, 0, len(roomStats))
+
+	for _, room := range roomStats {
+		if len(room.Tracks) == 0 {
+			// There is nothing to rate.
+			continue
+		}
+
+		rooms = append(rooms, room)
+
+		for _, track := range room.Tracks {
+			tracks = append(tracks, roomTrackStats{
+				room:  room.RoomID.String(),
+				track: track,
+			})
+		}
+	}
+
+	// The sort is stable because the stats are sorted by IDs.
+	sort.SliceStable(tracks, func(i, j int) bool {
+		return tracks[i].track.Score < tracks[j].track.Score
+	})
+
+	sort.SliceStable(rooms, func(i, j int) bool {
+		return rooms[i].Score < rooms[j].Score
+	})
+
+	for i, t := range tracks {
+		if i >= c.params.TopK {
+			break
+		}
+
+		labels := []string{strconv.Itoa(i + 1), string(t.track.Kind)}
+
+		if c.params.RoomLabel {
+			labels = append(labels, t.room)
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.trackScore, prometheus.GaugeValue, t.track.Score, labels...)
+		ch <- prometheus.MustNewConstMetric(c.trackFractionLost, prometheus.GaugeValue, t.track.FractionLost, labels...)
+		ch <- prometheus.MustNewConstMetric(c.trackJitter, prometheus.GaugeValue, t.track.Jitter, labels...)
+		ch <- prometheus.MustNewConstMetric(c.trackRTT, prometheus.GaugeValue, t.track.RTT, labels...)
+		ch <- prometheus.MustNewConstMetric(c.trackBitrate, prometheus.GaugeValue, t.track.Bitrate, labels...)
+		ch <- prometheus.MustNewConstMetric(c.trackNACKs, prometheus.GaugeValue, float64(t.track.NACKs), labels...)
+		ch <- prometheus.MustNewConstMetric(c.trackPLIs, prometheus.GaugeValue, float64(t.track.PLIs), labels...)
+	}
+
+	for i, room := range rooms {
+		if i >= c.params.TopK {
+			break
+		}
+
+		labels := []string{strconv.Itoa(i + 1)}
+
+		if c.params.RoomLabel {
+			labels = append(labels, room.RoomID.String())
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.roomScore, prometheus.GaugeValue, room.Score, labels...)
+	}
+}
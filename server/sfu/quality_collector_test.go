@@ -0,0 +1,138 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/peer-calls/peer-calls/v4/server/sfu/stats"
+	"github.com/peer-calls/peer-calls/v4/server/transport"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTrackStats(id string, kind transport.TrackKind, score float64) TrackStats {
+	return TrackStats{
+		PubClientID: "client-" + identifiers.ClientID(id),
+		TrackID: identifiers.TrackID{
+			ID:       id,
+			StreamID: "stream",
+		},
+		Kind: kind,
+		TrackSnapshot: stats.TrackSnapshot{
+			Score: score,
+			NACKs: uint64(score * 10),
+			PLIs:  uint64(score),
+		},
+	}
+}
+
+func gatherQualityMetrics(t *testing.T, params QualityCollectorParams) map[string][]*dto.Metric {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(NewQualityCollector(params)))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	metrics := map[string][]*dto.Metric{}
+
+	for _, family := range families {
+		metrics[family.GetName()] = family.GetMetric()
+	}
+
+	return metrics
+}
+
+func labels(metric *dto.Metric) map[string]string {
+	ret := map[string]string{}
+
+	for _, label := range metric.GetLabel() {
+		ret[label.GetName()] = label.GetValue()
+	}
+
+	return ret
+}
+
+// byRank indexes the metrics by the rank label, because the registry sorts
+// them by all labels.
+func byRank(metrics []*dto.Metric) map[string]*dto.Metric {
+	ret := map[string]*dto.Metric{}
+
+	for _, metric := range metrics {
+		ret[labels(metric)["rank"]] = metric
+	}
+
+	return ret
+}
+
+func TestQualityCollector(t *testing.T) {
+	roomStats := []RoomStats{
+		newRoomStats("room1", []TrackStats{
+			newTestTrackStats("a", transport.TrackKindAudio, 5),
+			newTestTrackStats("b", transport.TrackKindVideo, 2),
+		}),
+		newRoomStats("room2", []TrackStats{
+			newTestTrackStats("c", transport.TrackKindAudio, 3),
+		}),
+		newRoomStats("room3", nil),
+	}
+
+	getStats := func() []RoomStats {
+		return roomStats
+	}
+
+	t.Run("without room label", func(t *testing.T) {
+		metrics := gatherQualityMetrics(t, QualityCollectorParams{
+			Stats:     getStats,
+			TopK:      2,
+			RoomLabel: false,
+		})
+
+		require.Len(t, metrics["media_track_quality_score"], 2)
+		scores := byRank(metrics["media_track_quality_score"])
+
+		assert.Equal(t, map[string]string{"rank": "1", "kind": "video"}, labels(scores["1"]))
+		assert.Equal(t, float64(2), scores["1"].GetGauge().GetValue())
+		assert.Equal(t, map[string]string{"rank": "2", "kind": "audio"}, labels(scores["2"]))
+		assert.Equal(t, float64(3), scores["2"].GetGauge().GetValue())
+
+		assert.Len(t, metrics["media_track_bitrate_bits_per_second"], 2)
+
+		require.Len(t, metrics["media_track_nack_packets"], 2)
+		nacks := byRank(metrics["media_track_nack_packets"])
+
+		assert.Equal(t, float64(20), nacks["1"].GetGauge().GetValue())
+		assert.Equal(t, float64(30), nacks["2"].GetGauge().GetValue())
+
+		require.Len(t, metrics["media_track_pli_packets"], 2)
+		plis := byRank(metrics["media_track_pli_packets"])
+
+		assert.Equal(t, float64(2), plis["1"].GetGauge().GetValue())
+		assert.Equal(t, float64(3), plis["2"].GetGauge().GetValue())
+
+		require.Len(t, metrics["media_room_quality_score"], 2)
+		rooms := byRank(metrics["media_room_quality_score"])
+
+		assert.Equal(t, float64(3), rooms["1"].GetGauge().GetValue())
+		assert.Equal(t, 3.5, rooms["2"].GetGauge().GetValue())
+	})
+
+	t.Run("with room label", func(t *testing.T) {
+		metrics := gatherQualityMetrics(t, QualityCollectorParams{
+			Stats:     getStats,
+			TopK:      1,
+			RoomLabel: true,
+		})
+
+		scores := metrics["media_track_quality_score"]
+		require.Len(t, scores, 1)
+		assert.Equal(t, map[string]string{"rank": "1", "kind": "video", "room": "room1"}, labels(scores[0]))
+
+		rooms := metrics["media_room_quality_score"]
+		require.Len(t, rooms, 1)
+		assert.Equal(t, map[string]string{"rank": "1", "room": "room2"}, labels(rooms[0]))
+	})
+}
@@ -47,7 +47,10 @@ func (t NTPTime) Time() time.Time {
 	return time.Unix(0, int64(nanos)).UTC()
 }
 
+// Middle returns the middle 32 bits of the timestamp, the low 16 bits of the
+// seconds and the high 16 bits of the fraction, as used in the reception
+// reports.
 func (t NTPTime) Middle() uint32 {
-	// nolinth: gomnd
-	return uint32(t << 16)
+	// nolint:gomnd
+	return uint32(t >> 16)
 }
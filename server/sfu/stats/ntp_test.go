@@ -16,4 +16,6 @@ func TestNTP(t *testing.T) {
 
 	assert.Equal(t, t1.String(), NewNTPTime(t1).Time().String())
 	assert.Equal(t, "1995-11-10 11:33:36.004999999 +0000 UTC", NewNTPTime(t2).Time().String())
+
+	assert.Equal(t, uint32(0xb705_2000), NewNTPTime(t1).Middle())
 }
@@ -0,0 +1,39 @@
+package stats
+
+// Score estimates the mean opinion score (MOS) of a media stream from its
+// packet loss, jitter and round trip time, using the simplified version of
+// the ITU-T G.107 E-model. The fractionLost is between 0 and 1, and the
+// jitter and rtt are in seconds. The score is between 1 (bad) and 4.5
+// (excellent).
+func Score(fractionLost, jitter, rtt float64) float64 {
+	// The effective latency in milliseconds. Jitter has a bigger impact than
+	// latency because it has to be absorbed by the jitter buffer, and 10ms are
+	// added for the codec delay.
+	latency := rtt*1000/2 + jitter*1000*2 + 10
+
+	r := 93.2
+
+	if latency < 160 {
+		r -= latency / 40
+	} else {
+		r -= (latency - 120) / 10
+	}
+
+	// Every percent of lost packets reduces the rating by 2.5.
+	r -= fractionLost * 100 * 2.5
+
+	switch {
+	case r < 0:
+		r = 0
+	case r > 100:
+		r = 100
+	}
+
+	score := 1 + 0.035*r + 0.000007*r*(r-60)*(100-r)
+	if score < 1 {
+		// The polynomial dips slightly below 1 for very low ratings.
+		score = 1
+	}
+
+	return score
+}
@@ -9,11 +9,21 @@ import (
 
 const rtpSeqMod uint32 = 1 << 16
 
+const (
+	maxDropout    = 3000
+	maxMisorder   = 100
+	minSequential = 2
+)
+
 // Source contains per-Source state information. Implemented as per RFC 3550
 // appendices A.1 and A.3.
 type Source struct {
 	// ssrc is the source SSRC.
 	ssrc uint32
+	// clockRate is the clock rate of the RTP timestamps.
+	clockRate uint32
+	// initialized is set after the first packet was received.
+	initialized bool
 	// lastSenderReport is the NTP time from the latest sender report received
 	// for this source.
 	lastSenderReport NTPTime
@@ -36,14 +46,18 @@ type Source struct {
 	receivedPrior uint32
 	// transit is the relative trans time for previous packet.
 	transit uint32
+	// hasTransit is set after the transit of the first packet was recorded.
+	hasTransit bool
 	// jitter is the estimated jitter.
 	jitter uint32
 }
 
-// NewSource creates a new instance of Source.
-func (s *Source) NewSource(ssrc uint32) *Source {
+// NewSource creates a new instance of Source. The clockRate is used to
+// convert the arrival times to RTP timestamp units for the jitter estimate.
+func NewSource(ssrc uint32, clockRate uint32) *Source {
 	return &Source{
-		ssrc: ssrc,
+		ssrc:      ssrc,
+		clockRate: clockRate,
 	}
 }
 
@@ -63,12 +77,6 @@ func (s *Source) InitSeq(seq uint16) {
 func (s *Source) updateSeq(seq uint16) bool {
 	udelta := seq - s.maxSeq
 
-	const (
-		maxDropout    = 3000
-		maxMisorder   = 100
-		minSequential = 2
-	)
-
 	// Source is not valid until minSequential packets with sequential sequence
 	// numbers have been received.
 	switch {
@@ -118,13 +126,23 @@ func (s *Source) updateSeq(seq uint16) bool {
 
 // Report is implemented according to the RFC 3550 Appendix A.8.
 func (s *Source) updateJitter(packetTS, arrivalTS uint32) {
-	if packetTS > arrivalTS {
-		arrivalTS, packetTS = packetTS, arrivalTS
+	transit := arrivalTS - packetTS
+
+	if !s.hasTransit {
+		// There is no previous packet to compare the transit time to.
+		s.transit = transit
+		s.hasTransit = true
+
+		return
 	}
 
-	transit := arrivalTS - packetTS
+	// The difference is computed in int32 so the wrap around of the timestamps
+	// does not matter.
+	d := int32(transit - s.transit)
+	if d < 0 {
+		d = -d
+	}
 
-	d := transit - s.transit
 	s.transit = transit
 
 	// See alternative below.
@@ -133,7 +151,7 @@ func (s *Source) updateJitter(packetTS, arrivalTS uint32) {
 	// Alternatively, the jitter estimate can be kept as an integer, but
 	// scaled to reduce round-off error.  The calculation is the same except
 	// for the last line:
-	s.jitter += d - ((s.jitter + 8) >> 4)
+	s.jitter += uint32(d) - ((s.jitter + 8) >> 4)
 }
 
 // Report is implemented according to the RFC 3550 Appendix A.3.
@@ -143,11 +161,16 @@ func (s *Source) ReceptionReport(now time.Time) rtcp.ReceptionReport {
 
 	// The number of packets lost is defined to be the number of packets expected
 	// less the number of packets actually received.
-	lost := expected - s.received
+	lost := int64(expected) - int64(s.received)
 
 	// Since this signed number is carried in 24 bits, it should be clamped at
 	// 0x7fffff for positive loss or 0x800000 for negative loss rather than
 	// wrapping around.
+	if lost > 0x7fffff {
+		lost = 0x7fffff
+	} else if lost < -0x800000 {
+		lost = -0x800000
+	}
 
 	// The fraction of packets lost during the last reporting interval (since
 	// the previous SR or RR packet was sent) is calculated from differences in
@@ -160,14 +183,14 @@ func (s *Source) ReceptionReport(now time.Time) rtcp.ReceptionReport {
 	receivedInterval := s.received - s.receivedPrior
 	s.receivedPrior = s.received
 
-	lostInterval := expectedInterval - receivedInterval
+	lostInterval := int64(expectedInterval) - int64(receivedInterval)
 
 	var fraction uint8
 
 	if !(expectedInterval == 0 || lostInterval <= 0) {
 		// The resulting fraction is an 8-bit fixed point number with the binary
 		// point at the left edge.
-		fraction = uint8((lostInterval << 8) / expectedInterval)
+		fraction = uint8((lostInterval << 8) / int64(expectedInterval))
 	}
 
 	jitterShift := 4
@@ -212,7 +235,7 @@ func (s *Source) ReceptionReport(now time.Time) rtcp.ReceptionReport {
 		LastSenderReport:   lastSenderReport,
 		LastSequenceNumber: s.cycles + uint32(s.maxSeq),
 		SSRC:               s.ssrc,
-		TotalLost:          lost,
+		TotalLost:          uint32(lost) & 0xffffff,
 	}
 }
 
@@ -220,9 +243,27 @@ func (s *Source) HandleSenderReport(r *rtcp.SenderReport) {
 	s.lastSenderReport = NTPTime(r.NTPTime)
 }
 
+// HandleRTP updates the sequence number and jitter state with a packet
+// which arrived at now.
 func (s *Source) HandleRTP(packet *rtp.Packet, now time.Time) {
+	if !s.initialized {
+		// New source, as per the RFC 3550 Appendix A.1.
+		s.initialized = true
+		s.InitSeq(packet.SequenceNumber)
+		s.maxSeq = packet.SequenceNumber - 1
+		s.probation = minSequential
+	}
+
 	isValid := s.updateSeq(packet.SequenceNumber)
 	_ = isValid // TODO
 
-	s.updateJitter(packet.Timestamp, NewNTPTime(now).Middle())
+	s.updateJitter(packet.Timestamp, s.rtpTimestamp(now))
+}
+
+// rtpTimestamp converts t to RTP timestamp units. Only the differences
+// between the returned values are meaningful.
+func (s *Source) rtpTimestamp(t time.Time) uint32 {
+	clockRate := uint64(s.clockRate)
+
+	return uint32(uint64(t.Unix())*clockRate + uint64(t.Nanosecond())*clockRate/uint64(time.Second))
 }
@@ -0,0 +1,270 @@
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// DefaultTrackInterval is the default minimum duration of the interval over
+// which the bitrate and the fraction of lost packets are computed.
+const DefaultTrackInterval = 5 * time.Second
+
+// Track collects the quality statistics of a published track. The packet
+// loss, jitter and bitrate are computed from the RTP packets received from
+// the publisher, and the loss, jitter and round trip time of each subscriber
+// from the reports it sends back.
+type Track struct {
+	params *TrackParams
+
+	mu     sync.Mutex
+	source *Source
+
+	packets uint64
+	bytes   uint64
+	nacks   uint64
+	plis    uint64
+
+	subscribers map[identifiers.ClientID]SubscriberSnapshot
+
+	// intervalStart is the start of the current interval, it is zero before the
+	// first snapshot.
+	intervalStart time.Time
+	// intervalBytes is the value of bytes at the intervalStart.
+	intervalBytes uint64
+	// snapshot contains the values computed at the intervalStart.
+	snapshot TrackSnapshot
+}
+
+// TrackParams are parameters for Track.
+type TrackParams struct {
+	// SSRC of the published track.
+	SSRC uint32
+	// ClockRate of the track codec.
+	ClockRate uint32
+	// Interval is the minimum duration over which the bitrate and the fraction
+	// of lost packets are computed. DefaultTrackInterval is used when zero.
+	Interval time.Duration
+}
+
+// TrackSnapshot contains the statistics of a published track.
+type TrackSnapshot struct {
+	// PacketsReceived is the number of RTP packets received from the
+	// publisher.
+	PacketsReceived uint64 `json:"packetsReceived"`
+	// BytesReceived is the number of RTP bytes received from the publisher.
+	BytesReceived uint64 `json:"bytesReceived"`
+	// PacketsLost is the number of packets lost between the publisher and the
+	// server.
+	PacketsLost int64 `json:"packetsLost"`
+	// FractionLost is the fraction of packets lost between the publisher and
+	// the server during the last interval.
+	FractionLost float64 `json:"fractionLost"`
+	// Jitter is the interarrival jitter of the published packets, in seconds.
+	Jitter float64 `json:"jitter"`
+	// Bitrate is the bitrate of the published packets during the last
+	// interval, in bits per second.
+	Bitrate float64 `json:"bitrate"`
+	// RTT is the mean round trip time to the subscribers, in seconds.
+	RTT float64 `json:"rtt"`
+	// NACKs is the number of NACK packets received from the subscribers.
+	NACKs uint64 `json:"nacks"`
+	// PLIs is the number of PLI packets received from the subscribers.
+	PLIs uint64 `json:"plis"`
+	// Score is the estimated mean opinion score of the track, see Score. The
+	// loss and jitter of the publisher and the mean loss and jitter of the
+	// subscribers are combined.
+	Score float64 `json:"score"`
+	// Subscribers contains the statistics reported by the subscribers, sorted
+	// by ClientID.
+	Subscribers []SubscriberSnapshot `json:"subscribers"`
+}
+
+// SubscriberSnapshot contains the statistics from the last receiver report
+// sent by a subscriber.
+type SubscriberSnapshot struct {
+	ClientID identifiers.ClientID `json:"clientId"`
+	// FractionLost is the fraction of packets lost between the server and the
+	// subscriber.
+	FractionLost float64 `json:"fractionLost"`
+	// Jitter is the interarrival jitter at the subscriber, in seconds.
+	Jitter float64 `json:"jitter"`
+	// RTT is the round trip time between the server and the subscriber, in
+	// seconds. It is zero until the subscriber has received a sender report.
+	RTT float64 `json:"rtt"`
+}
+
+// NewTrack creates a new instance of Track.
+func NewTrack(params TrackParams) *Track {
+	if params.Interval == 0 {
+		params.Interval = DefaultTrackInterval
+	}
+
+	return &Track{
+		params:      &params,
+		source:      NewSource(params.SSRC, params.ClockRate),
+		subscribers: map[identifiers.ClientID]SubscriberSnapshot{},
+	}
+}
+
+// HandleRTP records a packet received from the publisher at now.
+func (t *Track) HandleRTP(packet *rtp.Packet, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.packets++
+	t.bytes += uint64(packet.MarshalSize())
+
+	t.source.HandleRTP(packet, now)
+}
+
+// HandleRTCP records a packet received from the subscriber at now. Only the
+// receiver reports, NACKs and PLIs are used.
+func (t *Track) HandleRTCP(subClientID identifiers.ClientID, packet rtcp.Packet, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch p := packet.(type) {
+	case *rtcp.ReceiverReport:
+		t.handleReceptionReports(subClientID, p.Reports, now)
+	case *rtcp.SenderReport:
+		t.handleReceptionReports(subClientID, p.Reports, now)
+	case *rtcp.TransportLayerNack:
+		t.nacks++
+	case *rtcp.PictureLossIndication:
+		t.plis++
+	}
+}
+
+// handleReceptionReports stores the report with the most lost packets, in
+// case the packet contains reports for multiple sources. The caller must
+// hold the lock.
+func (t *Track) handleReceptionReports(subClientID identifiers.ClientID, reports []rtcp.ReceptionReport, now time.Time) {
+	if len(reports) == 0 {
+		return
+	}
+
+	report := reports[0]
+
+	for _, r := range reports[1:] {
+		if r.FractionLost > report.FractionLost {
+			report = r
+		}
+	}
+
+	var rtt float64
+
+	if report.LastSenderReport != 0 {
+		// RFC 3550 Section 6.4.1: the round trip time is the arrival time of the
+		// report less the time the sender report was sent and the delay since
+		// the sender report was received. All in units of 1/65536 seconds.
+		d := int32(NewNTPTime(now).Middle() - report.LastSenderReport - report.Delay)
+		if d > 0 {
+			rtt = float64(d) / 65536
+		}
+	}
+
+	t.subscribers[subClientID] = SubscriberSnapshot{
+		ClientID:     subClientID,
+		FractionLost: float64(report.FractionLost) / 256,
+		Jitter:       t.seconds(report.Jitter),
+		RTT:          rtt,
+	}
+}
+
+// RemoveSubscriber removes the reports of a subscriber that has unsubscribed.
+func (t *Track) RemoveSubscriber(subClientID identifiers.ClientID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.subscribers, subClientID)
+}
+
+// Snapshot returns the statistics of the track at now. The bitrate and the
+// fraction of lost packets are recomputed at most once per interval, so that
+// the values do not depend on how often the Snapshot is requested.
+func (t *Track) Snapshot(now time.Time) TrackSnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if elapsed := now.Sub(t.intervalStart); t.intervalStart.IsZero() || elapsed >= t.params.Interval {
+		var bitrate float64
+
+		if !t.intervalStart.IsZero() {
+			bitrate = float64(t.bytes-t.intervalBytes) * 8 / elapsed.Seconds()
+		}
+
+		t.snapshot.Bitrate = bitrate
+
+		if t.packets > 0 {
+			report := t.source.ReceptionReport(now)
+
+			// TotalLost is a signed 24-bit number.
+			t.snapshot.PacketsLost = int64(int32(report.TotalLost<<8) >> 8)
+			t.snapshot.FractionLost = float64(report.FractionLost) / 256
+			t.snapshot.Jitter = t.seconds(report.Jitter)
+		}
+
+		t.intervalStart = now
+		t.intervalBytes = t.bytes
+	}
+
+	snapshot := t.snapshot
+
+	snapshot.PacketsReceived = t.packets
+	snapshot.BytesReceived = t.bytes
+	snapshot.NACKs = t.nacks
+	snapshot.PLIs = t.plis
+	snapshot.Subscribers = make([]SubscriberSnapshot, 0, len(t.subscribers))
+
+	var (
+		subFractionLost float64
+		subJitter       float64
+		rttSum          float64
+		rttCount        int
+	)
+
+	for _, sub := range t.subscribers {
+		snapshot.Subscribers = append(snapshot.Subscribers, sub)
+
+		subFractionLost += sub.FractionLost
+		subJitter += sub.Jitter
+
+		if sub.RTT > 0 {
+			rttSum += sub.RTT
+			rttCount++
+		}
+	}
+
+	sort.Slice(snapshot.Subscribers, func(i, j int) bool {
+		return snapshot.Subscribers[i].ClientID < snapshot.Subscribers[j].ClientID
+	})
+
+	if n := float64(len(t.subscribers)); n > 0 {
+		subFractionLost /= n
+		subJitter /= n
+	}
+
+	if rttCount > 0 {
+		snapshot.RTT = rttSum / float64(rttCount)
+	}
+
+	fractionLost := 1 - (1-snapshot.FractionLost)*(1-subFractionLost)
+
+	snapshot.Score = Score(fractionLost, snapshot.Jitter+subJitter, snapshot.RTT)
+
+	return snapshot
+}
+
+// seconds converts a duration in RTP timestamp units to seconds.
+func (t *Track) seconds(d uint32) float64 {
+	if t.params.ClockRate == 0 {
+		return 0
+	}
+
+	return float64(d) / float64(t.params.ClockRate)
+}
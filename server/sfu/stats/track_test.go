@@ -0,0 +1,130 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrack_HandleRTP(t *testing.T) {
+	track := NewTrack(TrackParams{
+		SSRC:      1,
+		ClockRate: 90000,
+		Interval:  0,
+	})
+
+	t0 := time.Unix(1000, 0)
+
+	assert.Equal(t, TrackSnapshot{
+		Score:       Score(0, 0, 0),
+		Subscribers: []SubscriberSnapshot{},
+	}, track.Snapshot(t0))
+
+	var bytes uint64
+
+	for i := 0; i <= 10; i++ {
+		if i == 5 {
+			// Lost packet.
+			continue
+		}
+
+		packet := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				SequenceNumber: uint16(100 + i),
+				Timestamp:      uint32(i * 1800),
+				SSRC:           1,
+			},
+			Payload: make([]byte, 100),
+		}
+
+		bytes += uint64(packet.MarshalSize())
+
+		track.HandleRTP(packet, t0.Add(time.Duration(i)*20*time.Millisecond))
+	}
+
+	snapshot := track.Snapshot(t0.Add(5 * time.Second))
+
+	assert.Equal(t, uint64(10), snapshot.PacketsReceived)
+	assert.Equal(t, bytes, snapshot.BytesReceived)
+	assert.Equal(t, int64(1), snapshot.PacketsLost)
+	assert.InDelta(t, 0.1, snapshot.FractionLost, 0.01)
+	assert.Equal(t, float64(0), snapshot.Jitter)
+	assert.Equal(t, float64(bytes*8)/5, snapshot.Bitrate)
+	assert.Less(t, snapshot.Score, Score(0, 0, 0))
+
+	// The interval values do not change until the interval has elapsed.
+	assert.Equal(t, snapshot, track.Snapshot(t0.Add(6*time.Second)))
+
+	snapshot = track.Snapshot(t0.Add(10 * time.Second))
+
+	assert.Equal(t, float64(0), snapshot.Bitrate)
+	assert.Equal(t, float64(0), snapshot.FractionLost)
+	assert.Equal(t, int64(1), snapshot.PacketsLost)
+}
+
+func TestTrack_HandleRTCP(t *testing.T) {
+	track := NewTrack(TrackParams{
+		SSRC:      1,
+		ClockRate: 90000,
+		Interval:  time.Second,
+	})
+
+	now := time.Unix(1000, 0)
+
+	track.HandleRTCP("a", &rtcp.ReceiverReport{
+		SSRC: 2,
+		Reports: []rtcp.ReceptionReport{{
+			SSRC:             3,
+			FractionLost:     64,
+			Jitter:           900,
+			LastSenderReport: NewNTPTime(now.Add(-100 * time.Millisecond)).Middle(),
+			Delay:            65536 / 20,
+		}},
+	}, now)
+	track.HandleRTCP("b", &rtcp.ReceiverReport{
+		SSRC: 4,
+		Reports: []rtcp.ReceptionReport{{
+			SSRC: 5,
+		}},
+	}, now)
+	track.HandleRTCP("a", &rtcp.TransportLayerNack{}, now)
+	track.HandleRTCP("a", &rtcp.TransportLayerNack{}, now)
+	track.HandleRTCP("b", &rtcp.PictureLossIndication{}, now)
+
+	snapshot := track.Snapshot(now)
+
+	assert.Equal(t, uint64(2), snapshot.NACKs)
+	assert.Equal(t, uint64(1), snapshot.PLIs)
+	assert.InDelta(t, 0.05, snapshot.RTT, 0.001)
+
+	if assert.Len(t, snapshot.Subscribers, 2) {
+		assert.Equal(t, "a", snapshot.Subscribers[0].ClientID.String())
+		assert.Equal(t, 0.25, snapshot.Subscribers[0].FractionLost)
+		assert.Equal(t, 0.01, snapshot.Subscribers[0].Jitter)
+		assert.InDelta(t, 0.05, snapshot.Subscribers[0].RTT, 0.001)
+
+		assert.Equal(t, "b", snapshot.Subscribers[1].ClientID.String())
+		assert.Equal(t, float64(0), snapshot.Subscribers[1].RTT)
+	}
+
+	assert.InDelta(t, Score(0.125, 0.005, 0.05), snapshot.Score, 0.01)
+
+	track.RemoveSubscriber("a")
+
+	snapshot = track.Snapshot(now)
+
+	assert.Len(t, snapshot.Subscribers, 1)
+	assert.Equal(t, float64(0), snapshot.RTT)
+}
+
+func TestScore(t *testing.T) {
+	assert.InDelta(t, 4.4, Score(0, 0, 0), 0.01)
+	assert.Less(t, Score(0, 0, 0.5), Score(0, 0, 0.1))
+	assert.Less(t, Score(0, 0.05, 0), Score(0, 0.01, 0))
+	assert.Less(t, Score(0.05, 0, 0), Score(0.01, 0, 0))
+	assert.Equal(t, float64(1), Score(1, 0, 0))
+}
@@ -0,0 +1,6 @@
+package sfu
+
+import "github.com/peer-calls/peer-calls/v4/server/tracing"
+
+// nolint:gochecknoglobals
+var tracer = tracing.Tracer("github.com/peer-calls/peer-calls/v4/server/sfu")
@@ -1,12 +1,16 @@
 package sfu
 
 import (
+	"context"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/pubsub"
+	"github.com/peer-calls/peer-calls/v4/server/quota"
 	"github.com/peer-calls/peer-calls/v4/server/transport"
 )
 
@@ -17,13 +21,17 @@ type TracksManager struct {
 	mu                  sync.RWMutex
 	peerManagers        map[identifiers.RoomID]*PeerManager
 	jitterBufferEnabled bool
+	limits              Limits
+	quota               quota.Quota
 }
 
-func NewTracksManager(log logger.Logger, jitterBufferEnabled bool) *TracksManager {
+func NewTracksManager(log logger.Logger, jitterBufferEnabled bool, limits Limits, q quota.Quota) *TracksManager {
 	return &TracksManager{
 		log:                 log.WithNamespaceAppended("tracks_manager"),
 		peerManagers:        map[identifiers.RoomID]*PeerManager{},
 		jitterBufferEnabled: jitterBufferEnabled,
+		limits:              limits,
+		quota:               q,
 	}
 }
 
@@ -37,7 +45,12 @@ func NewTracksManager(log logger.Logger, jitterBufferEnabled bool) *TracksManage
 //  - When WebRTCTransports are created and peers join the room, or
 //  - When RoomManager event that a room was created: A server transport will
 //    be created for each configured node.
-func (m *TracksManager) Add(room identifiers.RoomID, tr transport.Transport) (<-chan pubsub.PubTrackEvent, error) {
+func (m *TracksManager) Add(
+	ctx context.Context,
+	room identifiers.RoomID,
+	tr transport.Transport,
+	onTrackRejected TrackRejectedFunc,
+) (<-chan pubsub.PubTrackEvent, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -53,7 +66,7 @@ func (m *TracksManager) Add(room identifiers.RoomID, tr transport.Transport) (<-
 			log,
 			m.jitterBufferEnabled,
 		)
-		peerManager = NewPeerManager(room, log, jitterHandler)
+		peerManager = NewPeerManager(room, log, jitterHandler, m.limits, m.quota)
 		m.peerManagers[room] = peerManager
 	}
 
@@ -63,7 +76,7 @@ func (m *TracksManager) Add(room identifiers.RoomID, tr transport.Transport) (<-
 
 	log.Info("Add peer", nil)
 
-	pubTrackEventsCh, err := peerManager.Add(tr)
+	pubTrackEventsCh, err := peerManager.Add(ctx, tr, onTrackRejected)
 	if err != nil {
 		return nil, errors.Annotatef(err, "add transport")
 	}
@@ -100,7 +113,7 @@ func (m *TracksManager) Add(room identifiers.RoomID, tr transport.Transport) (<-
 	return pubTrackEventsCh, nil
 }
 
-func (m *TracksManager) Sub(params SubParams) error {
+func (m *TracksManager) Sub(ctx context.Context, params SubParams) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -109,7 +122,23 @@ func (m *TracksManager) Sub(params SubParams) error {
 		return errors.Errorf("room not found: %s", params.Room)
 	}
 
-	err := peerManager.Sub(params)
+	err := peerManager.Sub(ctx, params)
+
+	return errors.Trace(err)
+}
+
+// Promote allows the viewer to publish tracks. The viewer must be connected
+// to this node.
+func (m *TracksManager) Promote(room identifiers.RoomID, clientID identifiers.ClientID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	peerManager, ok := m.peerManagers[room]
+	if !ok {
+		return errors.Errorf("room not found: %s", room)
+	}
+
+	err := peerManager.Promote(clientID)
 
 	return errors.Trace(err)
 }
@@ -127,3 +156,25 @@ func (m *TracksManager) Unsub(params SubParams) error {
 
 	return errors.Trace(err)
 }
+
+// Stats returns the quality statistics of the tracks in all rooms, sorted by
+// the room ID.
+func (m *TracksManager) Stats() []RoomStats {
+	now := time.Now()
+
+	m.mu.RLock()
+
+	roomStats := make([]RoomStats, 0, len(m.peerManagers))
+
+	for roomID, peerManager := range m.peerManagers {
+		roomStats = append(roomStats, newRoomStats(roomID, peerManager.Stats(now)))
+	}
+
+	m.mu.RUnlock()
+
+	sort.Slice(roomStats, func(i, j int) bool {
+		return roomStats[i].RoomID < roomStats[j].RoomID
+	})
+
+	return roomStats
+}
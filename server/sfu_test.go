@@ -13,11 +13,13 @@ import (
 
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
 	"github.com/peer-calls/peer-calls/v4/server/codecs"
 	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/message"
 	"github.com/peer-calls/peer-calls/v4/server/pionlogger"
+	"github.com/peer-calls/peer-calls/v4/server/quota"
 	"github.com/peer-calls/peer-calls/v4/server/sfu"
 	"github.com/peer-calls/peer-calls/v4/server/test"
 	"github.com/peer-calls/peer-calls/v4/server/transport"
@@ -30,14 +32,31 @@ import (
 )
 
 func setupSFUServer(rooms server.RoomManager, jitterBufferEnabled bool) (s *httptest.Server, url string) {
+	return setupSFUServerWithWebinar(rooms, jitterBufferEnabled, server.WebinarConfig{}, nil)
+}
+
+func setupSFUServerWithWebinar(
+	rooms server.RoomManager, jitterBufferEnabled bool, webinar server.WebinarConfig, breakouts *server.Breakouts,
+) (s *httptest.Server, url string) {
 	log := test.NewLogger()
 
 	handler := server.NewSFUHandler(
 		log,
-		server.NewWSS(log, rooms),
-		[]server.ICEServer{},
+		server.NewWSS(server.WSSParams{
+			Log:       log,
+			Rooms:     rooms,
+			Drain:     server.NewDrain(log, server.DrainConfig{}),
+			Heartbeat: server.HeartbeatConfig{},
+			Limits:    server.LimitsConfig{},
+			Webinar:   webinar,
+			Chat:      server.ChatConfig{},
+			Quota:     nil,
+			Breakouts: breakouts,
+		}),
+		func() []server.ICEServer { return nil },
 		server.NetworkConfigSFU{},
-		sfu.NewTracksManager(log, jitterBufferEnabled),
+		sfu.NewTracksManager(log, jitterBufferEnabled, sfu.Limits{}, quota.NewMemory()),
+		server.NewHealth(log, server.HealthConfig{}),
 	)
 	s = httptest.NewServer(handler)
 	url = "ws" + strings.TrimPrefix(s.URL, "http") + "/ws/"
@@ -179,8 +198,10 @@ func createPeerConnection(t *testing.T, ctx context.Context, url string, clientI
 	require.Nil(t, err, "error creating peer connection")
 
 	peerCtx.signaller, err = server.NewSignaller(
+		context.Background(),
 		log,
 		false,
+		false,
 		peerCtx.pc,
 	)
 	require.Nil(t, err, "error creating signaller")
@@ -249,6 +270,251 @@ func TestSFU_PeerConnection(t *testing.T) {
 	waitPeerConnected(t, ctx, peerCtx.pc)
 }
 
+func TestSFU_ErrorReply(t *testing.T) {
+	log := test.NewLogger()
+
+	defer goleak.VerifyNone(t)
+
+	newAdapter := server.NewAdapterFactory(log, server.StoreConfig{})
+	defer newAdapter.Close()
+
+	rooms := server.NewAdapterRoomManager(newAdapter.NewAdapter)
+	srv, wsBaseURL := setupSFUServer(rooms, false)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	wsc := mustDialWS(t, ctx, wsBaseURL+roomName.String()+"/"+clientID.String())
+	defer wsc.Close(websocket.StatusNormalClosure, "")
+
+	subTrack := message.NewSubTrack(roomName, message.SubTrack{
+		TrackID:     identifiers.TrackID{ID: "track", StreamID: "stream"},
+		PubClientID: clientID2,
+		Type:        transport.TrackEventTypeSub,
+	})
+	subTrack.RequestID = "1"
+
+	// The client has not sent ready yet.
+	mustWriteWS(t, ctx, wsc, subTrack)
+
+	msg := mustReadWS(t, ctx, wsc)
+	for msg.Type != message.TypeError {
+		msg = mustReadWS(t, ctx, wsc)
+	}
+
+	assert.Equal(t, message.NewError(roomName, "1", message.Error{
+		Code:        message.ErrorCodeUnexpectedMessage,
+		Message:     "sub track: webRTCTransport not initialized: unexpected message",
+		RequestType: message.TypeSubTrack,
+	}), msg)
+}
+
+func TestSFU_Webinar(t *testing.T) {
+	log := test.NewLogger()
+
+	defer goleak.VerifyNone(t)
+
+	newAdapter := server.NewAdapterFactory(log, server.StoreConfig{})
+	defer newAdapter.Close()
+
+	rooms := server.NewAdapterRoomManager(newAdapter.NewAdapter)
+	srv, wsBaseURL := setupSFUServerWithWebinar(rooms, false, server.WebinarConfig{
+		Rooms: map[identifiers.RoomID]server.WebinarRoomConfig{
+			roomName: {
+				Presenters: map[identifiers.ClientID]string{
+					"viewer3":    "viewer3-token",
+					"presenter4": "presenter4-token",
+				},
+				PresenterAccessToken: "presenter-token",
+			},
+		},
+	}, nil)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	roomURL := wsBaseURL + roomName.String() + "/"
+
+	viewerCtx := createPeerConnection(t, ctx, roomURL+clientID2.String(), clientID2)
+	defer viewerCtx.close()
+
+	waitPeerConnected(t, ctx, viewerCtx.pc)
+
+	// The viewer is only offered the data channel.
+	assert.Empty(t, viewerCtx.pc.GetTransceivers())
+
+	// readReply reads until the reply to the request with requestID.
+	readReply := func(wsc *websocket.Conn, requestID string) message.Message {
+		t.Helper()
+
+		msg := mustReadWS(t, ctx, wsc)
+		for msg.RequestID != requestID {
+			msg = mustReadWS(t, ctx, wsc)
+		}
+
+		return msg
+	}
+
+	promote := message.NewPromote(roomName, message.Promote{
+		ClientID: clientID2,
+	})
+	promote.RequestID = "1"
+
+	viewerWS := mustDialWS(t, ctx, roomURL+"viewer3")
+	defer viewerWS.Close(websocket.StatusNormalClosure, "")
+
+	mustWriteWS(t, ctx, viewerWS, promote)
+
+	msg := readReply(viewerWS, "1")
+	require.Equal(t, message.TypeError, msg.Type)
+	assert.Equal(t, message.ErrorCodeForbidden, msg.Payload.Error.Code)
+
+	presenterWS := mustDialWS(t, ctx, roomURL+clientID.String()+"?access_token=presenter-token")
+	defer presenterWS.Close(websocket.StatusNormalClosure, "")
+
+	mustWriteWS(t, ctx, presenterWS, promote)
+
+	msg = readReply(presenterWS, "1")
+	require.Equal(t, message.TypeAck, msg.Type, "reply: %+v", msg)
+
+	// The renegotiation adds the transceivers for publishing.
+	for len(viewerCtx.pc.GetTransceivers()) != 2 {
+		select {
+		case <-ctx.Done():
+			require.FailNow(t, "timed out waiting for transceivers")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// A speaker cannot be promoted again.
+	promote.RequestID = "2"
+	mustWriteWS(t, ctx, presenterWS, promote)
+
+	msg = readReply(presenterWS, "2")
+	require.Equal(t, message.TypeError, msg.Type)
+	assert.Equal(t, message.ErrorCodeInvalidMessage, msg.Payload.Error.Code)
+
+	// A configured presenter needs its own access token.
+	presenter4WS := mustDialWS(t, ctx, roomURL+"presenter4?access_token=presenter4-token")
+	defer presenter4WS.Close(websocket.StatusNormalClosure, "")
+
+	promote.RequestID = "3"
+	mustWriteWS(t, ctx, presenter4WS, promote)
+
+	msg = readReply(presenter4WS, "3")
+	require.Equal(t, message.TypeError, msg.Type)
+	assert.Equal(t, message.ErrorCodeInvalidMessage, msg.Payload.Error.Code, "should be allowed to promote")
+}
+
+func TestSFU_Webinar_Breakout(t *testing.T) {
+	log := test.NewLogger()
+
+	defer goleak.VerifyNone(t)
+
+	newAdapter := server.NewAdapterFactory(log, server.StoreConfig{})
+	defer newAdapter.Close()
+
+	rooms := server.NewAdapterRoomManager(newAdapter.NewAdapter)
+
+	breakouts := server.NewBreakouts(server.BreakoutsParams{
+		Log:        log,
+		Rooms:      rooms,
+		NewAdapter: newAdapter.NewAdapter,
+		Clock:      clock.New(),
+	})
+	defer breakouts.Close()
+
+	srv, wsBaseURL := setupSFUServerWithWebinar(rooms, false, server.WebinarConfig{
+		Rooms: map[identifiers.RoomID]server.WebinarRoomConfig{
+			roomName: {
+				Presenters:           nil,
+				PresenterAccessToken: "presenter-token",
+			},
+		},
+	}, breakouts)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	roomURL := wsBaseURL + roomName.String() + "/"
+
+	readReply := func(wsc *websocket.Conn, requestID string) message.Message {
+		t.Helper()
+
+		msg := mustReadWS(t, ctx, wsc)
+		for msg.RequestID != requestID {
+			msg = mustReadWS(t, ctx, wsc)
+		}
+
+		return msg
+	}
+
+	startBreakout := message.NewStartBreakout(roomName, message.StartBreakout{
+		Rooms: map[string][]identifiers.ClientID{
+			"g1": {clientID2},
+		},
+		Duration: time.Minute.Milliseconds(),
+	})
+	startBreakout.RequestID = "1"
+
+	viewerWS := mustDialWS(t, ctx, roomURL+clientID2.String())
+	defer viewerWS.Close(websocket.StatusNormalClosure, "")
+
+	mustWriteWS(t, ctx, viewerWS, startBreakout)
+
+	msg := readReply(viewerWS, "1")
+	require.Equal(t, message.TypeError, msg.Type)
+	assert.Equal(t, message.ErrorCodeForbidden, msg.Payload.Error.Code)
+
+	presenterWS := mustDialWS(t, ctx, roomURL+clientID.String()+"?access_token=presenter-token")
+	defer presenterWS.Close(websocket.StatusNormalClosure, "")
+
+	mustWriteWS(t, ctx, presenterWS, startBreakout)
+
+	msg = readReply(presenterWS, "1")
+	require.Equal(t, message.TypeAck, msg.Type, "reply: %+v", msg)
+
+	msg = mustReadWSType(t, ctx, viewerWS, message.TypeBreakout)
+	assert.Equal(t, server.BreakoutRoomID(roomName, "g1"), msg.Payload.Breakout.Room)
+	assert.Equal(t, roomName, msg.Payload.Breakout.Parent)
+	assert.Empty(t, msg.Payload.Breakout.Clients)
+
+	// The server hangs up the moved client and closes its connection.
+	_, _, err := viewerWS.Read(ctx)
+	assert.Equal(t, websocket.StatusNormalClosure, websocket.CloseStatus(err))
+
+	msg = mustReadWSType(t, ctx, presenterWS, message.TypeHangUp)
+	assert.Equal(t, clientID2, msg.Payload.HangUp.PeerID)
+
+	adapter, ok := rooms.Get(roomName)
+	require.True(t, ok)
+
+	// The moved client leaves the adapter after it is hung up.
+	assert.Eventually(t, func() bool {
+		size, err := adapter.Size()
+		return err == nil && size == 1
+	}, timeout, 10*time.Millisecond)
+
+	endBreakout := message.NewEndBreakout(roomName)
+	endBreakout.RequestID = "2"
+
+	mustWriteWS(t, ctx, presenterWS, endBreakout)
+
+	msg = readReply(presenterWS, "2")
+	require.Equal(t, message.TypeAck, msg.Type, "reply: %+v", msg)
+	assert.Empty(t, breakouts.State())
+
+	endBreakout.RequestID = "3"
+	mustWriteWS(t, ctx, presenterWS, endBreakout)
+
+	msg = readReply(presenterWS, "3")
+	require.Equal(t, message.TypeError, msg.Type)
+	assert.Equal(t, message.ErrorCodeNotFound, msg.Payload.Error.Code)
+}
+
 func TestSFU_PeerConnection_DuplicateClientID(t *testing.T) {
 	log := test.NewLogger()
 
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/peer-calls/peer-calls/v4/server/uuid"
+	"nhooyr.io/websocket"
+)
+
+// SSESessionHeader contains the session ID of the server-sent events stream
+// in the requests that post messages to it.
+const SSESessionHeader = "X-Peercalls-Session"
+
+// maxSSEMessageSize limits the size of the posted messages. The SDP of a
+// call with many tracks can be large.
+const maxSSEMessageSize = 1 << 20
+
+var (
+	// ErrSSEClosed is returned when reading from or writing to a closed
+	// server-sent events connection.
+	ErrSSEClosed = errors.New("sse connection closed")
+	// ErrSSESessionNotFound is returned when a message is posted to a session
+	// that does not exist.
+	ErrSSESessionNotFound = errors.New("sse session not found")
+	// ErrSSESessionOtherNode is returned when a message is posted to a
+	// session of another node, which happens when the load balancer does not
+	// use sticky sessions.
+	ErrSSESessionOtherNode = errors.New("sse session is on another node")
+)
+
+// isSSERequest returns true when the client requests a server-sent events
+// stream instead of a websocket connection. EventSource always sets the
+// Accept header.
+func isSSERequest(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// sseConn is a WSReadWriter for the clients that cannot use websockets. The
+// messages are written to the client as server-sent events, and the messages
+// from the client are posted in separate HTTP requests. The messages are
+// always JSON text messages.
+//
+// The response of the events stream is only valid until the handler of the
+// request returns, so the handler must call Close before returning.
+type sseConn struct {
+	sessionID string
+	rc        *http.ResponseController
+	w         io.Writer
+
+	// writeMu serializes the writes to the response.
+	writeMu sync.Mutex
+
+	// requestDone is closed when the client disconnects.
+	requestDone <-chan struct{}
+	messages    chan []byte
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+var _ WSReadWriter = &sseConn{}
+
+// acceptSSE starts the events stream. The first event contains the session
+// ID, which the client must send with the posted messages.
+func acceptSSE(w http.ResponseWriter, r *http.Request, sessionID string) (*sseConn, error) {
+	c := &sseConn{
+		sessionID:   sessionID,
+		rc:          http.NewResponseController(w),
+		w:           w,
+		requestDone: r.Context().Done(),
+		messages:    make(chan []byte),
+		closed:      make(chan struct{}),
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// Disable the response buffering in nginx.
+	header.Set("X-Accel-Buffering", "no")
+
+	w.WriteHeader(http.StatusOK)
+
+	if err := c.writeEvent("session", []byte(c.sessionID)); err != nil {
+		return nil, errors.Annotate(err, "write session event")
+	}
+
+	return c, nil
+}
+
+// writeEvent writes an event and flushes it. The data must not contain new
+// lines, which is true for the serialized JSON messages. The caller must
+// hold writeMu or own the connection exclusively.
+func (c *sseConn) writeEvent(event string, data []byte) error {
+	var err error
+
+	if event != "" {
+		_, err = fmt.Fprintf(c.w, "event: %s\n", event)
+	}
+
+	if err == nil {
+		_, err = fmt.Fprintf(c.w, "data: %s\n\n", data)
+	}
+
+	if err != nil {
+		return errors.Annotate(err, "write")
+	}
+
+	return errors.Annotate(c.rc.Flush(), "flush")
+}
+
+// Write implements WSWriter.
+func (c *sseConn) Write(ctx context.Context, typ websocket.MessageType, data []byte) error {
+	if typ != websocket.MessageText {
+		return errors.Errorf("unsupported message type: %s", typ)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	select {
+	case <-c.closed:
+		return errors.Trace(ErrSSEClosed)
+	case <-c.requestDone:
+		return errors.Trace(ErrSSEClosed)
+	default:
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		// Not all response writers support deadlines, the write will block
+		// until the client disconnects in that case.
+		_ = c.rc.SetWriteDeadline(deadline)
+	}
+
+	return errors.Trace(c.writeEvent("", data))
+}
+
+// Read implements WSReader. It returns the messages posted by the client.
+func (c *sseConn) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	select {
+	case data := <-c.messages:
+		return websocket.MessageText, data, nil
+	case <-c.closed:
+		return 0, nil, errors.Trace(ErrSSEClosed)
+	case <-c.requestDone:
+		return 0, nil, errors.Trace(ErrSSEClosed)
+	case <-ctx.Done():
+		return 0, nil, errors.Trace(ctx.Err())
+	}
+}
+
+// receive passes a posted message to Read. It blocks until the message is
+// read so that the messages are handled in the order they were posted.
+func (c *sseConn) receive(ctx context.Context, data []byte) error {
+	select {
+	case c.messages <- data:
+		return nil
+	case <-c.closed:
+		return errors.Trace(ErrSSEClosed)
+	case <-c.requestDone:
+		return errors.Trace(ErrSSEClosed)
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	}
+}
+
+// Close implements WSCloser. The status code and reason are not sent to the
+// client. It waits for the pending write to finish so the response is not
+// written to after Close returns.
+func (c *sseConn) Close(statusCode websocket.StatusCode, reason string) error {
+	c.closeOnce.Do(func() {
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+
+		close(c.closed)
+	})
+
+	return nil
+}
+
+// sseSession is a server-sent events connection of a client in a room.
+type sseSession struct {
+	roomID   identifiers.RoomID
+	clientID identifiers.ClientID
+	conn     *sseConn
+}
+
+// sseSessions contains the open server-sent events connections by session
+// ID.
+type sseSessions struct {
+	// nodeID prefixes the session IDs so that the messages posted to another
+	// node can be told apart from the ones posted to closed sessions.
+	nodeID string
+
+	mu       sync.Mutex
+	sessions map[string]sseSession
+}
+
+func newSSESessions() *sseSessions {
+	return &sseSessions{
+		nodeID:   uuid.New(),
+		sessions: map[string]sseSession{},
+	}
+}
+
+// newSessionID returns a new session ID of this node.
+func (s *sseSessions) newSessionID() string {
+	return s.nodeID + "." + uuid.New()
+}
+
+// otherNode returns true when the session ID was created by another node.
+func (s *sseSessions) otherNode(sessionID string) bool {
+	nodeID, _, ok := strings.Cut(sessionID, ".")
+
+	return ok && nodeID != s.nodeID
+}
+
+func (s *sseSessions) add(session sseSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.conn.sessionID] = session
+}
+
+func (s *sseSessions) remove(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sessionID)
+}
+
+func (s *sseSessions) get(sessionID string) (sseSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+
+	return session, ok
+}
+
+// ServeSSEMessage handles a message posted by a client connected to the
+// server-sent events stream. The URL has the same room and client IDs as the
+// stream.
+func (wss *WSS) ServeSSEMessage(w http.ResponseWriter, r *http.Request) {
+	clientID := identifiers.ClientID(path.Base(r.URL.Path))
+	room := identifiers.RoomID(path.Base(path.Dir(r.URL.Path)))
+
+	sessionID := r.Header.Get(SSESessionHeader)
+
+	session, ok := wss.sse.get(sessionID)
+	if !ok && wss.sse.otherNode(sessionID) {
+		// The sessions are only kept in memory, so all requests of a client
+		// must be routed to the same node.
+		wss.log.Warn("SSE message posted to another node, sticky sessions are required", logger.Ctx{
+			"room_id":   room,
+			"client_id": clientID,
+		})
+
+		http.Error(w, ErrSSESessionOtherNode.Error(), http.StatusMisdirectedRequest)
+
+		return
+	}
+
+	if !ok || session.roomID != room || session.clientID != clientID {
+		http.Error(w, ErrSSESessionNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSSEMessageSize))
+	if err != nil {
+		http.Error(w, "Read body", http.StatusBadRequest)
+		return
+	}
+
+	// Reject invalid messages here because the client read loop stops on the
+	// first invalid message.
+	if _, err := (ByteSerializer{}).Deserialize(data); err != nil {
+		http.Error(w, "Invalid message", http.StatusBadRequest)
+		return
+	}
+
+	if err := session.conn.receive(r.Context(), data); err != nil {
+		http.Error(w, ErrSSEClosed.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
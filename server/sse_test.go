@@ -0,0 +1,158 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/message"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func setupSSEServer(rooms server.RoomManager) (s *httptest.Server, url string) {
+	log := test.NewLogger()
+	wss := server.NewWSS(server.WSSParams{
+		Log:       log,
+		Rooms:     rooms,
+		Drain:     server.NewDrain(log, server.DrainConfig{}),
+		Heartbeat: server.HeartbeatConfig{},
+		Limits:    server.LimitsConfig{},
+		Quota:     nil,
+	})
+	handler := server.NewMeshHandler(log, wss)
+
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			wss.ServeSSEMessage(w, r)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+	url = s.URL + "/sse/" + roomName.String() + "/" + clientID.String()
+
+	return s, url
+}
+
+type sseEvent struct {
+	event string
+	data  string
+}
+
+func mustReadSSE(t *testing.T, scanner *bufio.Scanner) sseEvent {
+	t.Helper()
+
+	var event sseEvent
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			return event
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+
+	require.NoError(t, scanner.Err())
+	require.Fail(t, "events stream ended")
+
+	return event
+}
+
+func postSSE(t *testing.T, ctx context.Context, url string, sessionID string, msg message.Message) int {
+	t.Helper()
+
+	data, err := serializer.Serialize(msg)
+	require.NoError(t, err)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	req.Header.Set(server.SSESessionHeader, sessionID)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestSSE(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	newAdapter := server.NewAdapterFactory(test.NewLogger(), server.StoreConfig{})
+	defer newAdapter.Close()
+
+	rooms := server.NewAdapterRoomManager(newAdapter.NewAdapter)
+	srv, url := setupSSEServer(rooms)
+	defer srv.Close()
+	defer http.DefaultClient.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	defer cancelStream()
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	scanner := bufio.NewScanner(res.Body)
+
+	session := mustReadSSE(t, scanner)
+	assert.Equal(t, "session", session.event)
+	require.NotEmpty(t, session.data)
+
+	ready := message.NewReady(roomName, message.Ready{
+		Nickname: "abc",
+	})
+
+	assert.Equal(t, http.StatusNotFound, postSSE(t, ctx, url, "invalid", ready))
+	assert.Equal(t, http.StatusMisdirectedRequest, postSSE(t, ctx, url, "othernode.session", ready))
+	assert.Equal(t, http.StatusNoContent, postSSE(t, ctx, url, session.data, ready))
+
+	for {
+		event := mustReadSSE(t, scanner)
+		assert.Equal(t, "", event.event)
+
+		msg, err := serializer.Deserialize([]byte(event.data))
+		require.NoError(t, err)
+
+		if msg.Type == message.TypeUsers {
+			assert.Equal(t, clientID, msg.Payload.Users.Initiator)
+			assert.Equal(t, "abc", msg.Payload.Users.Nicknames[clientID])
+
+			break
+		}
+	}
+
+	cancelStream()
+
+	// The session is removed after the client disconnects.
+	assert.Eventually(t, func() bool {
+		return postSSE(t, ctx, url, session.data, ready) == http.StatusNotFound
+	}, timeout, 10*time.Millisecond)
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/peer-calls/peer-calls/v4/server/message"
+	"github.com/peer-calls/peer-calls/v4/server/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// nolint:gochecknoglobals
+var tracer = tracing.Tracer("github.com/peer-calls/peer-calls/v4/server")
+
+type TracingParams struct {
+	Log     logger.Logger
+	Config  TracingConfig
+	Version string
+	// Stdout is used by the stdout exporter.
+	Stdout io.Writer
+}
+
+// Tracing exports the spans created by the server when an exporter is
+// configured.
+type Tracing struct {
+	log      logger.Logger
+	provider *sdktrace.TracerProvider
+}
+
+func NewTracing(params TracingParams) (*Tracing, error) {
+	log := params.Log.WithNamespaceAppended("tracing")
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+
+	switch params.Config.Exporter {
+	case TracingExporterOTLP:
+		var opts []otlptracehttp.Option
+
+		if endpoint := params.Config.Endpoint; endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+		}
+
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	case TracingExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(params.Stdout))
+	default:
+		return &Tracing{
+			log:      log,
+			provider: nil,
+		}, nil
+	}
+
+	if err != nil {
+		return nil, errors.Annotatef(err, "create %s exporter", params.Config.Exporter)
+	}
+
+	res := resource.NewSchemaless(
+		semconv.ServiceName("peer-calls"),
+		semconv.ServiceVersion(params.Version),
+	)
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(params.Config.SampleRatio))),
+	)
+
+	log.Info("Tracing enabled", logger.Ctx{
+		"exporter":     params.Config.Exporter,
+		"sample_ratio": params.Config.SampleRatio,
+	})
+
+	return &Tracing{
+		log:      log,
+		provider: provider,
+	}, nil
+}
+
+// TracerProvider returns the provider of the tracers. It does not record
+// anything when tracing is disabled.
+func (t *Tracing) TracerProvider() trace.TracerProvider {
+	if t.provider == nil {
+		return noop.NewTracerProvider()
+	}
+
+	return t.provider
+}
+
+// SetGlobal makes the TracerProvider and the W3C trace context propagator
+// global, so they are used by all packages.
+func (t *Tracing) SetGlobal() {
+	otel.SetTracerProvider(t.TracerProvider())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// Shutdown exports the remaining spans.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if t.provider == nil {
+		return nil
+	}
+
+	return errors.Annotate(t.provider.Shutdown(ctx), "shutdown tracer provider")
+}
+
+// startHTTPSpan starts a span for r. The span is a child of the span from
+// the request headers, if any.
+func startHTTPSpan(r *http.Request, name string) (context.Context, trace.Span) {
+	ctx := tracing.ExtractHeaders(r.Context(), r.Header)
+
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// withTraceContext returns msg with the trace context of ctx, so the span
+// can be continued by the node which receives it.
+func withTraceContext(ctx context.Context, msg message.Message) message.Message {
+	msg.TraceContext = tracing.Inject(ctx)
+
+	return msg
+}
@@ -0,0 +1,87 @@
+// Package tracing contains helpers for the OpenTelemetry spans created by the
+// server. The spans are created by the tracers of the global TracerProvider,
+// which does not record anything until it is replaced.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// Carrier carries the trace context between nodes, for example in messages
+// published to Redis.
+type Carrier = propagation.MapCarrier
+
+// Tracer returns the tracer for the package with the import path name. The
+// spans are started by the TracerProvider which is global at the time, so the
+// provider can be replaced after the tracers were created, for example in
+// tests.
+func Tracer(name string) trace.Tracer {
+	return globalTracer{
+		Tracer: nil,
+		name:   name,
+	}
+}
+
+// globalTracer starts the spans with the tracer of the global TracerProvider.
+type globalTracer struct {
+	embedded.Tracer
+
+	name string
+}
+
+func (t globalTracer) Start(
+	ctx context.Context, spanName string, opts ...trace.SpanStartOption,
+) (context.Context, trace.Span) {
+	return otel.GetTracerProvider().Tracer(t.name).Start(ctx, spanName, opts...)
+}
+
+// End records err in span, when set, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Detach returns a background context that contains only the span from ctx.
+// It is used as the parent of spans started after ctx might be canceled.
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
+
+// Inject returns a Carrier with the trace context of ctx. It returns nil when
+// ctx does not contain a sampled span.
+func Inject(ctx context.Context) Carrier {
+	if !trace.SpanContextFromContext(ctx).IsSampled() {
+		return nil
+	}
+
+	carrier := Carrier{}
+
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return carrier
+}
+
+// Extract returns ctx with the remote span from carrier.
+func Extract(ctx context.Context, carrier Carrier) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// ExtractHeaders returns ctx with the remote span from the HTTP headers, if
+// any.
+func ExtractHeaders(ctx context.Context, headers map[string][]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(headers))
+}
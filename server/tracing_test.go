@@ -0,0 +1,67 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Tracing_disabled(t *testing.T) {
+	tracing, err := server.NewTracing(server.TracingParams{
+		Log:     test.NewLogger(),
+		Config:  server.TracingConfig{},
+		Version: "v0.0.0",
+		Stdout:  nil,
+	})
+	require.NoError(t, err)
+
+	_, span := tracing.TracerProvider().Tracer("test").Start(context.Background(), "test")
+	span.End()
+
+	assert.False(t, span.SpanContext().IsValid())
+	assert.NoError(t, tracing.Shutdown(context.Background()))
+}
+
+func Test_Tracing_routeCall(t *testing.T) {
+	var b bytes.Buffer
+
+	tracing, err := server.NewTracing(server.TracingParams{
+		Log: test.NewLogger(),
+		Config: server.TracingConfig{
+			Exporter:    server.TracingExporterStdout,
+			Endpoint:    "",
+			SampleRatio: 1,
+		},
+		Version: "v0.0.0",
+		Stdout:  &b,
+	})
+	require.NoError(t, err)
+
+	tracing.SetGlobal()
+
+	mrm := NewMockRoomManager()
+	trk := newMockTracksManager()
+	defer mrm.close()
+	mux := server.NewMux(newMuxParams(mrm, trk))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/test/call/abc", nil)
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	require.NoError(t, tracing.Shutdown(context.Background()))
+
+	assert.Contains(t, b.String(), `"Name":"Mux.routeCall"`)
+	assert.Contains(t, b.String(), traceID)
+	assert.Contains(t, b.String(), `"Value":"abc"`)
+}
@@ -35,6 +35,15 @@ type Transport interface {
 	Closable
 }
 
+// Promotable is implemented by the transports that can be negotiated as
+// viewers, which cannot publish tracks until they are promoted.
+type Promotable interface {
+	// Viewer returns true until the transport is promoted.
+	Viewer() bool
+	// Promote renegotiates the transport so that it can publish tracks.
+	Promote()
+}
+
 type Closable interface {
 	Close() error
 	Done() <-chan struct{}
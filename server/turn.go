@@ -0,0 +1,329 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/peer-calls/peer-calls/v4/server/pionlogger"
+	"github.com/pion/turn/v2"
+)
+
+const (
+	defaultTURNListenAddr            = "0.0.0.0:3478"
+	defaultTURNRealm                 = "peercalls"
+	defaultTURNUsername              = "peercalls"
+	defaultTURNMaxAllocationsPerUser = 10
+)
+
+// ErrInvalidTURNConfig is returned when the TURN server cannot be started
+// with the config.
+var ErrInvalidTURNConfig = errors.New("invalid turn config")
+
+// ICEServersWithTURN returns the servers with the embedded TURN server added
+// when it is enabled.
+func ICEServersWithTURN(servers []ICEServer, config TURNConfig) []ICEServer {
+	if !config.Enabled {
+		return servers
+	}
+
+	urls := config.URLs
+	if len(urls) == 0 {
+		hostPort := config.PublicIP
+
+		if _, port, err := net.SplitHostPort(config.ListenAddr); err == nil {
+			hostPort = net.JoinHostPort(config.PublicIP, port)
+		}
+
+		urls = []string{
+			"stun:" + hostPort,
+			"turn:" + hostPort + "?transport=udp",
+		}
+	}
+
+	ice := ICEServer{
+		URLs:     urls,
+		AuthType: AuthTypeSecret,
+	}
+	ice.AuthSecret.Username = config.Username
+	ice.AuthSecret.Secret = config.Secret
+
+	result := make([]ICEServer, 0, len(servers)+1)
+	result = append(result, servers...)
+
+	return append(result, ice)
+}
+
+// TURNServer is a TURN and STUN server which accepts the time-limited
+// credentials of the ICE servers with the secret auth type.
+type TURNServer struct {
+	params *TURNServerParams
+	server *turn.Server
+	conn   net.PacketConn
+
+	mu sync.Mutex
+	// allocations contains the client addresses with an allocation, by the
+	// username. The usernames issued for a call contain the client ID, so
+	// the allocations are counted per client.
+	allocations map[string]map[string]struct{}
+	// pending is the last authenticated client without an allocation.
+	pending *turnClient
+}
+
+type turnClient struct {
+	username string
+	addr     string
+}
+
+// TURNServerParams are parameters for TURNServer.
+type TURNServerParams struct {
+	Log    logger.Logger
+	Clock  clock.Clock
+	Config TURNConfig
+}
+
+func NewTURNServer(params TURNServerParams) (*TURNServer, error) {
+	params.Log = params.Log.WithNamespaceAppended("turn")
+
+	config := params.Config
+
+	if config.Secret == "" {
+		return nil, errors.Annotate(ErrInvalidTURNConfig, "secret is required")
+	}
+
+	publicIP := net.ParseIP(config.PublicIP)
+	if publicIP == nil {
+		return nil, errors.Annotatef(ErrInvalidTURNConfig, "public ip: %q", config.PublicIP)
+	}
+
+	if config.RelayPortMin > config.RelayPortMax {
+		return nil, errors.Annotatef(ErrInvalidTURNConfig, "relay ports: %d-%d", config.RelayPortMin, config.RelayPortMax)
+	}
+
+	var relayAddressGenerator turn.RelayAddressGenerator
+
+	if config.RelayPortMin == 0 && config.RelayPortMax == 0 {
+		// nolint:exhaustivestruct
+		relayAddressGenerator = &turn.RelayAddressGeneratorStatic{
+			RelayAddress: publicIP,
+			Address:      "0.0.0.0",
+		}
+	} else {
+		// nolint:exhaustivestruct
+		relayAddressGenerator = &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: publicIP,
+			MinPort:      config.RelayPortMin,
+			MaxPort:      config.RelayPortMax,
+			Address:      "0.0.0.0",
+		}
+	}
+
+	conn, err := net.ListenPacket("udp", config.ListenAddr)
+	if err != nil {
+		return nil, errors.Annotatef(err, "listen turn: %s", config.ListenAddr)
+	}
+
+	t := &TURNServer{
+		params:      &params,
+		server:      nil,
+		conn:        conn,
+		mu:          sync.Mutex{},
+		allocations: map[string]map[string]struct{}{},
+		pending:     nil,
+	}
+
+	// nolint:exhaustivestruct
+	t.server, err = turn.NewServer(turn.ServerConfig{
+		Realm:         config.Realm,
+		AuthHandler:   t.authenticate,
+		LoggerFactory: pionlogger.NewFactory(params.Log),
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn: conn,
+			RelayAddressGenerator: turnRelayAddressGenerator{
+				RelayAddressGenerator: relayAddressGenerator,
+				server:                t,
+			},
+			PermissionHandler: nil,
+		}},
+	})
+	if err != nil {
+		conn.Close()
+
+		return nil, errors.Annotate(err, "new turn server")
+	}
+
+	params.Log.Info("Listen turn", logger.Ctx{
+		"local_addr": conn.LocalAddr(),
+		"public_ip":  publicIP,
+	})
+
+	return t, nil
+}
+
+// authenticate returns the key of the user when the credentials have not
+// expired and the user has not reached the allocation quota.
+func (t *TURNServer) authenticate(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+	log := t.params.Log.WithCtx(logger.Ctx{
+		"username":    username,
+		"remote_addr": srcAddr,
+	})
+
+	expiresAt, _, ok := strings.Cut(username, ":")
+	if !ok {
+		prometheusTURNAuthTotal.WithLabelValues("invalid").Inc()
+		log.Warn("Invalid turn username", nil)
+
+		return nil, false
+	}
+
+	timestamp, err := strconv.ParseInt(expiresAt, 10, 64)
+	if err != nil {
+		prometheusTURNAuthTotal.WithLabelValues("invalid").Inc()
+		log.Warn("Invalid turn username", logger.Ctx{
+			"err": err,
+		})
+
+		return nil, false
+	}
+
+	if timestamp < t.params.Clock.Now().Unix() {
+		prometheusTURNAuthTotal.WithLabelValues("expired").Inc()
+		log.Warn("Expired turn credentials", nil)
+
+		return nil, false
+	}
+
+	if !t.authorize(username, srcAddr.String()) {
+		prometheusTURNAuthTotal.WithLabelValues("quota").Inc()
+		log.Warn("Turn allocation quota reached", nil)
+
+		return nil, false
+	}
+
+	prometheusTURNAuthTotal.WithLabelValues("success").Inc()
+
+	h := hmac.New(sha1.New, []byte(t.params.Config.Secret))
+
+	// Writes to hmac never fail.
+	_, _ = h.Write([]byte(username))
+
+	password := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	return turn.GenerateAuthKey(username, realm, password), true
+}
+
+// authorize returns false when the client has no allocation and the username
+// already has the maximum number of allocations. Otherwise the client becomes
+// the pending client when it has no allocation.
+func (t *TURNServer) authorize(username string, addr string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	addrs := t.allocations[username]
+
+	if _, ok := addrs[addr]; ok {
+		return true
+	}
+
+	if maxAllocations := t.params.Config.MaxAllocationsPerUser; maxAllocations > 0 && len(addrs) >= maxAllocations {
+		return false
+	}
+
+	t.pending = &turnClient{
+		username: username,
+		addr:     addr,
+	}
+
+	return true
+}
+
+// track counts the relay conn in the allocations of the pending client until
+// it is closed. The requests are handled one at a time, so the allocation
+// request being handled is the one of the last authenticated client.
+func (t *TURNServer) track(conn net.PacketConn) net.PacketConn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	client := t.pending
+	t.pending = nil
+
+	if client == nil {
+		return conn
+	}
+
+	addrs, ok := t.allocations[client.username]
+	if !ok {
+		addrs = map[string]struct{}{}
+		t.allocations[client.username] = addrs
+	}
+
+	addrs[client.addr] = struct{}{}
+
+	return &turnRelayConn{
+		PacketConn: conn,
+		once:       sync.Once{},
+		release: func() {
+			t.release(*client)
+		},
+	}
+}
+
+func (t *TURNServer) release(client turnClient) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	addrs := t.allocations[client.username]
+
+	delete(addrs, client.addr)
+
+	if len(addrs) == 0 {
+		delete(t.allocations, client.username)
+	}
+}
+
+// LocalAddr returns the address the TURN server listens on.
+func (t *TURNServer) LocalAddr() net.Addr {
+	return t.conn.LocalAddr()
+}
+
+// Close stops the TURN server and closes the allocations.
+func (t *TURNServer) Close() error {
+	return errors.Trace(t.server.Close())
+}
+
+// turnRelayAddressGenerator tracks the relay conns of the allocations.
+type turnRelayAddressGenerator struct {
+	turn.RelayAddressGenerator
+
+	server *TURNServer
+}
+
+func (g turnRelayAddressGenerator) AllocatePacketConn(network string, requestedPort int) (net.PacketConn, net.Addr, error) {
+	conn, addr, err := g.RelayAddressGenerator.AllocatePacketConn(network, requestedPort)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+
+	return g.server.track(conn), addr, nil
+}
+
+// turnRelayConn releases the allocation when the relay conn is closed.
+type turnRelayConn struct {
+	net.PacketConn
+
+	once    sync.Once
+	release func()
+}
+
+func (c *turnRelayConn) Close() error {
+	c.once.Do(c.release)
+
+	return errors.Trace(c.PacketConn.Close())
+}
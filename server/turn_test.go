@@ -0,0 +1,185 @@
+package server_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/pionlogger"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/pion/turn/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestICEServersWithTURN(t *testing.T) {
+	stun := server.ICEServer{
+		URLs: []string{"stun:stun.example.com"},
+	}
+
+	config := server.TURNConfig{
+		Enabled:               false,
+		ListenAddr:            "0.0.0.0:3478",
+		PublicIP:              "10.0.0.1",
+		URLs:                  nil,
+		Realm:                 "peercalls",
+		Username:              "peercalls",
+		Secret:                "sec",
+		RelayPortMin:          0,
+		RelayPortMax:          0,
+		MaxAllocationsPerUser: 0,
+	}
+
+	assert.Equal(t, []server.ICEServer{stun}, server.ICEServersWithTURN([]server.ICEServer{stun}, config))
+
+	config.Enabled = true
+
+	result := server.ICEServersWithTURN([]server.ICEServer{stun}, config)
+	require.Len(t, result, 2)
+	assert.Equal(t, stun, result[0])
+	assert.Equal(t, []string{"stun:10.0.0.1:3478", "turn:10.0.0.1:3478?transport=udp"}, result[1].URLs)
+	assert.Equal(t, server.AuthTypeSecret, result[1].AuthType)
+	assert.Equal(t, "peercalls", result[1].AuthSecret.Username)
+	assert.Equal(t, "sec", result[1].AuthSecret.Secret)
+
+	config.URLs = []string{"turn:turn.example.com"}
+
+	result = server.ICEServersWithTURN(nil, config)
+	require.Len(t, result, 1)
+	assert.Equal(t, config.URLs, result[0].URLs)
+}
+
+func TestTURNServer(t *testing.T) {
+	log := test.NewLogger()
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	config := server.TURNConfig{
+		Enabled:               true,
+		ListenAddr:            "127.0.0.1:0",
+		PublicIP:              "127.0.0.1",
+		URLs:                  nil,
+		Realm:                 "peercalls",
+		Username:              "peercalls",
+		Secret:                "sec",
+		RelayPortMin:          0,
+		RelayPortMax:          0,
+		MaxAllocationsPerUser: 1,
+	}
+
+	turnServer, err := server.NewTURNServer(server.TURNServerParams{
+		Log:    log,
+		Clock:  clk,
+		Config: config,
+	})
+	require.NoError(t, err)
+
+	defer turnServer.Close()
+
+	iceServers := server.ICEServersWithTURN(nil, config)
+	credentials := server.GetClientICEAuthServers(iceServers, "client1")[0]
+
+	// allocate returns a function which closes the allocation.
+	allocate := func(t *testing.T, username, password string) (func(), error) {
+		t.Helper()
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		client, err := turn.NewClient(&turn.ClientConfig{
+			STUNServerAddr: turnServer.LocalAddr().String(),
+			TURNServerAddr: turnServer.LocalAddr().String(),
+			Username:       username,
+			Password:       password,
+			Realm:          config.Realm,
+			Software:       "",
+			RTO:            0,
+			Conn:           conn,
+			Net:            nil,
+			LoggerFactory:  pionlogger.NewFactory(log),
+		})
+		require.NoError(t, err)
+
+		closeClient := func() {
+			client.Close()
+			conn.Close()
+		}
+
+		require.NoError(t, client.Listen())
+
+		relayConn, err := client.Allocate()
+		if err != nil {
+			closeClient()
+
+			return nil, err
+		}
+
+		return func() {
+			// Deletes the allocation on the server.
+			relayConn.Close()
+			closeClient()
+		}, nil
+	}
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		_, err := allocate(t, credentials.Username, "invalid")
+		assert.Error(t, err)
+
+		_, err = allocate(t, "peercalls", credentials.Credential)
+		assert.Error(t, err)
+	})
+
+	t.Run("allocation quota", func(t *testing.T) {
+		closeAllocation, err := allocate(t, credentials.Username, credentials.Credential)
+		require.NoError(t, err)
+
+		_, err = allocate(t, credentials.Username, credentials.Credential)
+		assert.Error(t, err)
+
+		// The credentials of another client issued at the same time have their
+		// own quota.
+		credentials2 := server.GetClientICEAuthServers(iceServers, "client2")[0]
+
+		closeAllocation2, err := allocate(t, credentials2.Username, credentials2.Credential)
+		require.NoError(t, err)
+
+		closeAllocation2()
+		closeAllocation()
+
+		closeAllocation, err = allocate(t, credentials.Username, credentials.Credential)
+		require.NoError(t, err)
+
+		closeAllocation()
+	})
+
+	t.Run("expired credentials", func(t *testing.T) {
+		clk.Add(48 * time.Hour)
+
+		_, err := allocate(t, credentials.Username, credentials.Credential)
+		assert.Error(t, err)
+	})
+}
+
+func TestNewTURNServer_invalid(t *testing.T) {
+	config := server.TURNConfig{
+		Enabled:               true,
+		ListenAddr:            "127.0.0.1:0",
+		PublicIP:              "",
+		URLs:                  nil,
+		Realm:                 "peercalls",
+		Username:              "peercalls",
+		Secret:                "sec",
+		RelayPortMin:          0,
+		RelayPortMax:          0,
+		MaxAllocationsPerUser: 0,
+	}
+
+	_, err := server.NewTURNServer(server.TURNServerParams{
+		Log:    test.NewLogger(),
+		Clock:  clock.New(),
+		Config: config,
+	})
+	assert.Error(t, err)
+}
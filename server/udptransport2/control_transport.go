@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 )
 
@@ -114,6 +115,11 @@ func (c *controlTransport) Events() <-chan controlEvent {
 	return c.readEventsCh
 }
 
+// ReadDone is closed once the remote side has closed the stream.
+func (c *controlTransport) ReadDone() <-chan struct{} {
+	return c.readLoopDone
+}
+
 func (c *controlTransport) Send(event controlEvent) error {
 	select {
 	case c.writeEventsCh <- event:
@@ -139,5 +145,27 @@ func (c *controlTransport) Close() error {
 
 type controlEvent struct {
 	RemoteControlEvent *remoteControlEvent `json:"remoteControlEvent"`
-	Ping               bool                `json:"ping"`
+	Interest           *interestEvent      `json:"interest"`
+	Bye                *byeEvent           `json:"bye"`
+}
+
+// byeEvent is sent before a node closes the factory on purpose, for example
+// when it is shutting down. The remote node should not try to reconnect, and
+// it should respond with an acknowledgement before closing the streams.
+type byeEvent struct {
+	Reason string `json:"reason"`
+	Ack    bool   `json:"ack"`
+}
+
+// interestEvent advertises whether the sending node has any local peers in a
+// room.
+type interestEvent struct {
+	StreamID   identifiers.RoomID `json:"streamId"`
+	Interested bool               `json:"interested"`
+	// Parent is true when the receiving node is the parent of the sending node
+	// in the room's relay tree.
+	Parent bool `json:"parent"`
+	// Tiebreaker decides which node initiates the creation and closing of room
+	// transports. The node with the larger value does.
+	Tiebreaker uint64 `json:"tiebreaker"`
 }
@@ -49,7 +49,7 @@ func TestControlTransport(t *testing.T) {
 			Type:     remoteControlEventTypeCreate,
 			StreamID: "a",
 		},
-		Ping: false,
+		Interest: nil,
 	}
 
 	err = c1.Send(send)
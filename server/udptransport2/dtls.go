@@ -0,0 +1,163 @@
+package udptransport2
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/pion/dtls/v2"
+)
+
+// defaultDTLSHandshakeTimeout is used when dtls.Config.ConnectContextMaker is
+// not set.
+const defaultDTLSHandshakeTimeout = 30 * time.Second
+
+// dtlsNudge is sent by the DTLS server to the remote node to make it start
+// the handshake in case the remote node is not connecting to this node on
+// its own. It is shorter than any DTLS record.
+// nolint:gochecknoglobals
+var dtlsNudge = []byte{0}
+
+// nudgeFilterConn discards the received nudges, because DTLS fails the
+// handshake when it receives a packet that is not a valid record.
+type nudgeFilterConn struct {
+	net.Conn
+}
+
+func (c nudgeFilterConn) Read(b []byte) (int, error) {
+	for {
+		i, err := c.Conn.Read(b)
+		if err != nil || !bytes.Equal(b[:i], dtlsNudge) {
+			return i, errors.Trace(err)
+		}
+	}
+}
+
+// isClient decides the DTLS or QUIC role of this node. Both nodes might try
+// to connect to each other at the same time, so the role cannot depend on who
+// initiated the connection.
+func isClient(laddr, raddr net.Addr) bool {
+	return laddr.String() < raddr.String()
+}
+
+// secureConn wraps conn with DTLS when it is enabled. The handshake fails
+// for nodes that cannot authenticate with the configured pre-shared keys or
+// certificates. The conn is closed on error.
+func (c *udpConnector) secureConn(conn net.Conn) (net.Conn, error) {
+	if c.params.DTLSConfig == nil {
+		return conn, nil
+	}
+
+	laddr := c.params.AdvertiseAddr
+	if laddr == nil {
+		laddr = conn.LocalAddr()
+	}
+
+	raddr := conn.RemoteAddr()
+	filteredConn := nudgeFilterConn{conn}
+
+	log := c.params.Log.WithCtx(logger.Ctx{
+		"remote_addr": raddr,
+	})
+
+	if isClient(laddr, raddr) {
+		log.Trace("DTLS client handshake", nil)
+
+		dtlsConn, err := c.handshake(conn, func(ctx context.Context) (*dtls.Conn, error) {
+			return dtls.ClientWithContext(ctx, filteredConn, c.params.DTLSConfig)
+		})
+		if err != nil {
+			conn.Close()
+
+			return nil, errors.Annotatef(err, "DTLS client handshake: %s", raddr)
+		}
+
+		return dtlsConn, nil
+	}
+
+	log.Trace("DTLS server handshake", nil)
+
+	done := make(chan struct{})
+	nudgeDone := make(chan struct{})
+
+	go func() {
+		defer close(nudgeDone)
+
+		ticker := c.params.Clock.NewTicker(c.params.PingTimeout)
+		defer ticker.Stop()
+
+		for {
+			if _, err := conn.Write(dtlsNudge); err != nil {
+				log.Error("Write DTLS nudge", errors.Trace(err), nil)
+
+				return
+			}
+
+			select {
+			case <-ticker.C():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	dtlsConn, err := c.handshake(conn, func(ctx context.Context) (*dtls.Conn, error) {
+		return dtls.ServerWithContext(ctx, filteredConn, c.params.DTLSConfig)
+	})
+
+	close(done)
+	<-nudgeDone
+
+	if err != nil {
+		conn.Close()
+
+		return nil, errors.Annotatef(err, "DTLS server handshake: %s", raddr)
+	}
+
+	return dtlsConn, nil
+}
+
+// handshake calls fn with a context created by the DTLS ConnectContextMaker
+// and closes conn when the context is done before the handshake completes.
+// This is necessary because the conns from udpmux do not support deadlines,
+// so DTLS would wait for the next packet indefinitely.
+func (c *udpConnector) handshake(
+	conn net.Conn,
+	fn func(ctx context.Context) (*dtls.Conn, error),
+) (*dtls.Conn, error) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	if c.params.DTLSConfig.ConnectContextMaker != nil {
+		ctx, cancel = c.params.DTLSConfig.ConnectContextMaker()
+	} else {
+		ctx, cancel = context.WithTimeout(context.Background(), defaultDTLSHandshakeTimeout)
+	}
+
+	defer cancel()
+
+	handshakeDone := make(chan struct{})
+	closeDone := make(chan struct{})
+
+	go func() {
+		defer close(closeDone)
+
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-handshakeDone:
+		}
+	}()
+
+	dtlsConn, err := fn(ctx)
+
+	close(handshakeDone)
+	<-closeDone
+
+	return dtlsConn, errors.Trace(err)
+}
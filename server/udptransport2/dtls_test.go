@@ -0,0 +1,260 @@
+package udptransport2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/peer-calls/peer-calls/v4/server/udptransport2"
+	"github.com/pion/dtls/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func newPSKConfig(identity string, keys map[string]string) *dtls.Config {
+	return &dtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			key, ok := keys[string(hint)]
+			if !ok {
+				return nil, errors.Errorf("unknown identity: %q", hint)
+			}
+
+			return []byte(key), nil
+		},
+		PSKIdentityHint: []byte(identity),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_GCM_SHA256},
+	}
+}
+
+func newDTLSManagers(
+	t *testing.T,
+	config1 *dtls.Config,
+	config2 *dtls.Config,
+) (*lossyPacketConn, *udptransport2.Manager, *lossyPacketConn, *udptransport2.Manager, func()) {
+	t.Helper()
+
+	log := test.NewLogger()
+
+	network := newMemNetwork()
+
+	conn1 := network.listen(5001)
+	conn2 := network.listen(5002)
+
+	tm1 := udptransport2.NewManager(udptransport2.ManagerParams{
+		Conn:           conn1,
+		Log:            log,
+		Clock:          clock.NewMock(),
+		PingTimeout:    time.Second,
+		DestroyTimeout: 3 * time.Second,
+		DTLSConfig:     config1,
+	})
+
+	tm2 := udptransport2.NewManager(udptransport2.ManagerParams{
+		Conn:           conn2,
+		Log:            log,
+		Clock:          clock.NewMock(),
+		PingTimeout:    time.Second,
+		DestroyTimeout: 3 * time.Second,
+		DTLSConfig:     config2,
+	})
+
+	return conn1, tm1, conn2, tm2, func() {
+		tm1.Close()
+		tm2.Close()
+		conn1.Close()
+		conn2.Close()
+	}
+}
+
+func TestManager_DTLS(t *testing.T) {
+	config1 := newPSKConfig("node1", map[string]string{"node2": "secret"})
+	config2 := newPSKConfig("node2", map[string]string{"node1": "secret"})
+
+	for _, tc := range []struct {
+		descr string
+		// dialFirst is true when the DTLS client initiates the connection.
+		dialFirst bool
+	}{
+		{"client dials", true},
+		{"server dials", false},
+	} {
+		tc := tc
+
+		t.Run(tc.descr, func(t *testing.T) {
+			goleak.VerifyNone(t)
+			defer goleak.VerifyNone(t)
+
+			conn1, tm1, conn2, tm2, cleanup := newDTLSManagers(t, config1, config2)
+			defer cleanup()
+
+			// tm1 has a smaller address so it will be the DTLS client.
+			dialer, dialAddr, acceptor := tm1, conn2.LocalAddr(), tm2
+			if !tc.dialFirst {
+				dialer, dialAddr, acceptor = tm2, conn1.LocalAddr(), tm1
+			}
+
+			f1, err := (<-dialer.GetFactory(dialAddr)).Result()
+			require.NoError(t, err)
+
+			var f2 *udptransport2.Factory
+
+			select {
+			case f2 = <-acceptor.FactoriesChannel():
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "Timed out waiting for factory")
+			}
+
+			require.NoError(t, f1.CreateTransport("test-stream"))
+			require.NoError(t, f2.CreateTransport("test-stream"))
+			require.NoError(t, f1.SetParent("test-stream", true))
+
+			var transport1, transport2 *udptransport2.Transport
+
+			for transport1 == nil || transport2 == nil {
+				select {
+				case transport1 = <-f1.TransportsChannel():
+				case transport2 = <-f2.TransportsChannel():
+				case <-time.After(time.Second):
+					require.Fail(t, "Timed out waiting for transports")
+				}
+			}
+
+			assert.NoError(t, transport1.Close())
+			assert.NoError(t, transport2.Close())
+		})
+	}
+}
+
+func TestManager_DTLS_UnknownNode(t *testing.T) {
+	goleak.VerifyNone(t)
+	defer goleak.VerifyNone(t)
+
+	config1 := newPSKConfig("node1", map[string]string{"node2": "secret"})
+	config1.ConnectContextMaker = func() (context.Context, func()) {
+		return context.WithTimeout(context.Background(), time.Second)
+	}
+
+	config2 := newPSKConfig("node3", map[string]string{"node1": "secret"})
+
+	_, tm1, conn2, _, cleanup := newDTLSManagers(t, config1, config2)
+	defer cleanup()
+
+	_, err := (<-tm1.GetFactory(conn2.LocalAddr())).Result()
+	assert.Error(t, err, "node3 is not a known identity")
+}
+
+func TestManager_DTLS_ReconnectRetry(t *testing.T) {
+	goleak.VerifyNone(t)
+	defer goleak.VerifyNone(t)
+
+	log := test.NewLogger()
+
+	connectContext := func() (context.Context, func()) {
+		return context.WithTimeout(context.Background(), 200*time.Millisecond)
+	}
+
+	config1 := newPSKConfig("node1", map[string]string{"node2": "secret"})
+	config1.ConnectContextMaker = connectContext
+
+	config2 := newPSKConfig("node2", map[string]string{"node1": "secret"})
+	config2.ConnectContextMaker = connectContext
+
+	network := newMemNetwork()
+
+	conn1 := network.listen(5001)
+	defer conn1.Close()
+
+	conn2 := network.listen(5002)
+	defer conn2.Close()
+
+	clock1 := clock.NewMock()
+	clock2 := clock.NewMock()
+
+	tm1 := udptransport2.NewManager(udptransport2.ManagerParams{
+		Conn:           conn1,
+		Log:            log,
+		Clock:          clock1,
+		PingTimeout:    time.Second,
+		DestroyTimeout: 3 * time.Second,
+		DTLSConfig:     config1,
+	})
+	defer tm1.Close()
+
+	tm2 := udptransport2.NewManager(udptransport2.ManagerParams{
+		Conn:           conn2,
+		Log:            log,
+		Clock:          clock2,
+		PingTimeout:    time.Second,
+		DestroyTimeout: 3 * time.Second,
+		DTLSConfig:     config2,
+	})
+	defer tm2.Close()
+
+	f1, err := (<-tm1.GetFactory(conn2.LocalAddr())).Result()
+	require.NoError(t, err)
+
+	f2 := <-tm2.FactoriesChannel()
+
+	conn1.SetDrop(true)
+	conn2.SetDrop(true)
+
+	timeout := time.After(5 * time.Second)
+
+	done1, done2 := f1.Done(), f2.Done()
+
+	for done1 != nil || done2 != nil {
+		clock1.Add(time.Second)
+		clock2.Add(time.Second)
+
+		select {
+		case <-done1:
+			done1 = nil
+		case <-done2:
+			done2 = nil
+		case <-time.After(20 * time.Millisecond):
+		case <-timeout:
+			require.Fail(t, "Timed out waiting for heartbeat timeout")
+		}
+	}
+
+	// Let the first reconnect time out while the nodes cannot reach each
+	// other.
+	time.Sleep(500 * time.Millisecond)
+
+	conn1.SetDrop(false)
+	conn2.SetDrop(false)
+
+	f1, f2 = nil, nil
+	timeout = time.After(10 * time.Second)
+
+	for f1 == nil || f2 == nil {
+		select {
+		case f1 = <-tm1.FactoriesChannel():
+		case f2 = <-tm2.FactoriesChannel():
+		case <-time.After(20 * time.Millisecond):
+			// Fire the retry timer.
+			clock1.Add(time.Second)
+		case <-timeout:
+			require.Fail(t, "Timed out waiting for the reconnect to be retried")
+		}
+	}
+
+	// The factory is not reconnected after it is removed.
+	tm1.RemoveFactory(conn2.LocalAddr())
+
+	select {
+	case <-f1.Done():
+	case <-time.After(time.Second):
+		require.Fail(t, "Timed out waiting for the factory to be closed")
+	}
+
+	select {
+	case <-tm1.FactoriesChannel():
+		assert.Fail(t, "factory1 should not have reconnected")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -1,8 +1,11 @@
 package udptransport2
 
 import (
+	"context"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/juju/errors"
@@ -13,6 +16,7 @@ import (
 	"github.com/peer-calls/peer-calls/v4/server/servertransport"
 	"github.com/peer-calls/peer-calls/v4/server/stringmux"
 	"github.com/pion/interceptor"
+	"github.com/pion/randutil"
 	"github.com/pion/sctp"
 )
 
@@ -20,20 +24,64 @@ const (
 	streamIndexControl uint16 = iota
 	streamIndexMetadata
 	streamIndexData
+	streamIndexHeartbeat
 )
 
+// errHeartbeatTimeout is set as the Factory error when the factory is torn
+// down because no heartbeats were received for DestroyTimeout.
+var errHeartbeatTimeout = errors.New("heartbeat timeout")
+
+// errConnectionLost is set as the Factory error when the underlying
+// connection was lost without the remote node closing it.
+var errConnectionLost = errors.New("connection lost")
+
+// byeTimeout is the maximum time to wait for the remote node to acknowledge
+// a bye. A real timer is used so that a mocked clock cannot block the
+// teardown.
+const byeTimeout = 2 * time.Second
+
+// isReconnectable returns true when the factory was torn down because the
+// remote node became unreachable, as opposed to being closed on purpose.
+func isReconnectable(err error) bool {
+	cause := errors.Cause(err)
+
+	return cause == errHeartbeatTimeout || cause == errConnectionLost // nolint:errorlint
+}
+
 type Factory struct {
 	params *FactoryParams
 
-	stringMux *stringmux.StringMux
-
 	transportsChannel  chan *Transport
 	localControlEvents chan localControlEvent
+	parentEvents       chan parentEvent
 
 	teardown chan struct{}
 	torndown chan struct{}
 
 	streams *factoryStreams
+
+	// err contains the reason the factory was torn down, if any. It is only
+	// safe to read after torndown is closed.
+	err error
+
+	// tiebreaker is a random number sent to the remote factory. The factory
+	// with the larger tiebreaker initiates the creation of room transports.
+	tiebreaker uint64
+
+	// rtt is the smoothed round trip time in nanoseconds measured using the
+	// heartbeats. It is zero until the first pong is received.
+	rtt int64
+
+	// lastHeartbeat is the time the last heartbeat was received at, in
+	// nanoseconds since the epoch.
+	lastHeartbeat int64
+
+	// remoteInterestsMu guards remoteInterests.
+	remoteInterestsMu sync.Mutex
+	// remoteInterests contains the rooms with peers on the remote node.
+	remoteInterests map[identifiers.RoomID]struct{}
+	// remoteInterestsChanged receives a value when remoteInterests change.
+	remoteInterestsChanged chan struct{}
 }
 
 type FactoryParams struct {
@@ -43,13 +91,26 @@ type FactoryParams struct {
 	// Clock is used for creating a ticker. A Clock interface is used to allow
 	// easier mocking.
 	Clock clock.Clock
-	// PingTimeout is the timeout after which a Ping event will be sent.
+	// PingTimeout is the interval at which heartbeats are sent.
 	PingTimeout time.Duration
+	// DestroyTimeout is the duration after which the factory will be torn down
+	// when no heartbeats are received from the remote side. It should be a few
+	// times larger than PingTimeout.
+	DestroyTimeout time.Duration
 
 	InterceptorRegistry *interceptor.Registry
 }
 
+// NewFactory creates a Factory that multiplexes the media and an SCTP
+// association over params.Conn.
 func NewFactory(params FactoryParams) (*Factory, error) {
+	return newFactory(params, newSCTPStreams)
+}
+
+func newFactory(
+	params FactoryParams,
+	newStreams func(params *FactoryParams) (*factoryStreams, error),
+) (*Factory, error) {
 	params.Log = params.Log.WithNamespaceAppended("factory").WithCtx(logger.Ctx{
 		"local_addr":  params.Conn.LocalAddr(),
 		"remote_addr": params.Conn.RemoteAddr(),
@@ -57,37 +118,38 @@ func NewFactory(params FactoryParams) (*Factory, error) {
 
 	params.Log.Trace("NewFactory", nil)
 
-	readChanSize := 100
+	tiebreaker, err := randutil.CryptoUint64()
+	if err != nil {
+		return nil, errors.Annotatef(err, "generate tiebreaker")
+	}
 
-	stringMux := stringmux.New(stringmux.Params{
-		Log:            params.Log,
-		Conn:           params.Conn,
-		MTU:            uint32(servertransport.ReceiveMTU), // TODO not sure if this is ok
-		ReadChanSize:   readChanSize,
-		ReadBufferSize: 0,
-	})
+	streams, err := newStreams(&params)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	f := &Factory{
 		params: &params,
 
-		stringMux: stringMux,
+		tiebreaker: tiebreaker,
 
 		transportsChannel:  make(chan *Transport),
 		localControlEvents: make(chan localControlEvent),
+		parentEvents:       make(chan parentEvent),
+
+		rtt:           0,
+		lastHeartbeat: params.Clock.Now().UnixNano(),
+
+		remoteInterestsMu:      sync.Mutex{},
+		remoteInterests:        map[identifiers.RoomID]struct{}{},
+		remoteInterestsChanged: make(chan struct{}, 1),
 
 		teardown: make(chan struct{}),
 		torndown: make(chan struct{}),
 
-		streams: nil,
-	}
-
-	streams, err := f.init()
-	if err != nil {
-		return nil, errors.Trace(err)
+		streams: streams,
 	}
 
-	f.streams = streams
-
 	pingTicker := f.params.Clock.NewTicker(f.params.PingTimeout)
 
 	go f.start(pingTicker)
@@ -95,8 +157,8 @@ func NewFactory(params FactoryParams) (*Factory, error) {
 	return f, nil
 }
 
-func (f *Factory) init() (*factoryStreams, error) {
-	f.params.Log.Trace("init start", nil)
+func newSCTPStreams(params *FactoryParams) (*factoryStreams, error) {
+	params.Log.Trace("init start", nil)
 
 	closers := make([]io.Closer, 0, 5)
 
@@ -112,17 +174,29 @@ func (f *Factory) init() (*factoryStreams, error) {
 		}
 	}()
 
+	readChanSize := 100
+
+	stringMux := stringmux.New(stringmux.Params{
+		Log:            params.Log,
+		Conn:           params.Conn,
+		MTU:            uint32(servertransport.ReceiveMTU), // TODO not sure if this is ok
+		ReadChanSize:   readChanSize,
+		ReadBufferSize: 0,
+	})
+
+	closers = append(closers, stringMux)
+
 	// FIXME stringmux never accepts anything therefore it could cause a deadlock
 	// if it receives a connection with another StreamID.
 
-	mediaConn, err := f.stringMux.GetConn("m")
+	mediaConn, err := stringMux.GetConn("m")
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
 	closers = append(closers, mediaConn)
 
-	sctpConn, err := f.stringMux.GetConn("s")
+	sctpConn, err := stringMux.GetConn("s")
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -131,7 +205,7 @@ func (f *Factory) init() (*factoryStreams, error) {
 
 	association, err := sctp.Client(sctp.Config{
 		NetConn:              sctpConn,
-		LoggerFactory:        pionlogger.NewFactory(f.params.Log),
+		LoggerFactory:        pionlogger.NewFactory(params.Log),
 		MaxMessageSize:       0,
 		MaxReceiveBufferSize: 0,
 	})
@@ -162,57 +236,94 @@ func (f *Factory) init() (*factoryStreams, error) {
 
 	closers = append(closers, dataStream)
 
-	laddr := f.params.Conn.LocalAddr()
-	raddr := f.params.Conn.RemoteAddr()
+	heartbeatStream, err := association.OpenStream(streamIndexHeartbeat, sctp.PayloadTypeWebRTCBinary)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	// Lost heartbeats should not be retransmitted.
+	heartbeatStream.SetReliabilityParams(true, sctp.ReliabilityTypeRexmit, 0)
+
+	closers = append(closers, heartbeatStream)
+
+	laddr := params.Conn.LocalAddr()
+	raddr := params.Conn.RemoteAddr()
 
 	dataConn := newStreamConn(dataStream, laddr, raddr)
 	metadataConn := newStreamConn(metadataStream, laddr, raddr)
 
+	params.Log.Trace("init done", nil)
+
+	streams := newFactoryStreams(params.Log, factoryConns{
+		control:   controlStream,
+		heartbeat: heartbeatStream,
+		data:      dataConn,
+		metadata:  metadataConn,
+		media:     mediaConn,
+	})
+
+	streams.abort = func() {
+		association.Abort("heartbeat timeout")
+	}
+
+	closers = append(closers, streams)
+
+	streams.close = close
+
+	// Do not close everything on defer.
+	close = nil
+
+	return streams, nil
+}
+
+// factoryConns contains the conns used by factoryStreams. The control and
+// heartbeat conns must preserve message boundaries.
+type factoryConns struct {
+	control   io.ReadWriteCloser
+	heartbeat io.ReadWriteCloser
+	data      net.Conn
+	metadata  net.Conn
+	media     net.Conn
+}
+
+// newFactoryStreams creates the transports and multiplexers on top of conns.
+// The close and abort functions must be set by the caller.
+func newFactoryStreams(log logger.Logger, conns factoryConns) *factoryStreams {
 	readBufferSize := 100
 
-	f.params.Log.Trace("init done", nil)
+	return &factoryStreams{
+		close:    nil,
+		abort:    nil,
+		closeErr: nil,
 
-	streams := &factoryStreams{
-		close: nil,
+		control: newControlTransport(log, conns.control),
 
-		control: newControlTransport(f.params.Log, controlStream),
+		heartbeat: newHeartbeatTransport(log, conns.heartbeat),
 
 		data: stringmux.New(stringmux.Params{
-			Log:            f.params.Log.WithNamespaceAppended("data"),
-			Conn:           dataConn,
+			Log:            log.WithNamespaceAppended("data"),
+			Conn:           conns.data,
 			MTU:            uint32(servertransport.ReceiveMTU),
 			ReadBufferSize: readBufferSize,
 			ReadChanSize:   0,
 		}),
 
 		metadata: stringmux.New(stringmux.Params{
-			Log:            f.params.Log.WithNamespaceAppended("metadata"),
-			Conn:           metadataConn,
+			Log:            log.WithNamespaceAppended("metadata"),
+			Conn:           conns.metadata,
 			MTU:            uint32(servertransport.ReceiveMTU),
 			ReadBufferSize: readBufferSize,
 			ReadChanSize:   0,
 		}),
 
 		media: stringmux.New(stringmux.Params{
-			Log:            f.params.Log.WithNamespaceAppended("media"),
-			Conn:           mediaConn,
+			Log:            log.WithNamespaceAppended("media"),
+			Conn:           conns.media,
 			MTU:            uint32(servertransport.ReceiveMTU),
 			ReadBufferSize: readBufferSize,
 			ReadChanSize:   0,
 		}),
 	}
-
-	closers = append(closers, streams.control)
-	closers = append(closers, streams.data)
-	closers = append(closers, streams.metadata)
-	closers = append(closers, streams.media)
-
-	streams.close = close
-
-	// Do not close everything on defer.
-	close = nil
-
-	return streams, nil
 }
 
 func (f *Factory) start(pingTicker clock.Ticker) {
@@ -236,9 +347,13 @@ func (f *Factory) start(pingTicker clock.Ticker) {
 			delete(transports, streamID)
 		}
 
-		f.streams.close()
+		if f.err != nil {
+			// The remote side is unresponsive so the streams cannot be closed
+			// gracefully.
+			f.streams.abort()
+		}
 
-		f.stringMux.Close()
+		f.streams.close()
 
 		close(f.torndown)
 	}()
@@ -275,6 +390,81 @@ func (f *Factory) start(pingTicker clock.Ticker) {
 		return transport, nil
 	}
 
+	getTransport := func(streamID identifiers.RoomID) *transportWithTracker {
+		t, ok := transports[streamID]
+		if !ok {
+			t = &transportWithTracker{
+				transport: nil,
+				tracker:   &controlStateTracker{},
+			}
+			transports[streamID] = t
+		}
+
+		return t
+	}
+
+	// removeIfClosed removes the tracker after the transport was closed, unless
+	// there is still something pending.
+	removeIfClosed := func(streamID identifiers.RoomID, t *transportWithTracker) {
+		if t.tracker.state == controlStateClosed && t.transport == nil {
+			delete(transports, streamID)
+		}
+	}
+
+	sendRemoteEvent := func(streamID identifiers.RoomID, typ remoteControlEventType) error {
+		err := f.streams.control.Send(controlEvent{
+			RemoteControlEvent: &remoteControlEvent{
+				StreamID: streamID,
+				Type:     typ,
+			},
+			Interest: nil,
+			Bye:      nil,
+		})
+
+		return errors.Trace(err)
+	}
+
+	// handleTrackerEvent acts on the event returned from the local state
+	// tracker and sends it to the remote side.
+	handleTrackerEvent := func(streamID identifiers.RoomID, t *transportWithTracker, remoteEvent remoteControlEventType) bool {
+		log := f.params.Log.WithCtx(logger.Ctx{
+			"stream_id":            streamID,
+			"remote_control_event": remoteEvent,
+		})
+
+		// nolint:exhaustive
+		switch remoteEvent {
+		case remoteControlEventTypeCreate:
+			transport, err := createTransport(streamID)
+			if err != nil {
+				log.Error("Create transport", errors.Trace(err), nil)
+
+				// Major error, teardown.
+				return false
+			}
+
+			t.transport = transport
+		case remoteControlEventTypeClose:
+			if t.transport == nil {
+				log.Error("Want close but transport is nil", nil, nil)
+
+				return false
+			}
+
+			t.transport.CloseWrite()
+		}
+
+		if remoteEvent != remoteControlEventTypeNone {
+			if err := sendRemoteEvent(streamID, remoteEvent); err != nil {
+				log.Error("Send remote control event", errors.Trace(err), nil)
+
+				return false
+			}
+		}
+
+		return true
+	}
+
 	handleRemoteEvent := func(event remoteControlEvent) bool {
 		streamID := event.StreamID
 
@@ -285,14 +475,7 @@ func (f *Factory) start(pingTicker clock.Ticker) {
 
 		log.Trace("Handle remote event", nil)
 
-		t, ok := transports[streamID]
-		if !ok {
-			t = &transportWithTracker{
-				transport: nil,
-				tracker:   &controlStateTracker{},
-			}
-			transports[event.StreamID] = t
-		}
+		t := getTransport(streamID)
 
 		responseEvent, stateChanged, err := t.tracker.handleRemoteEvent(event.Type)
 		if err != nil {
@@ -341,7 +524,7 @@ func (f *Factory) start(pingTicker clock.Ticker) {
 				// event.
 				t.transport.CloseWrite()
 				t.transport.Close()
-				delete(transports, streamID)
+				t.transport = nil
 			case remoteControlEventTypeCloseAck:
 				if t.transport == nil {
 					log.Error("Got create_ack but transport was nil", nil, nil)
@@ -350,29 +533,99 @@ func (f *Factory) start(pingTicker clock.Ticker) {
 				}
 
 				t.transport.Close()
-				delete(transports, streamID)
+				t.transport = nil
 			case remoteControlEventTypeNone:
 			}
 		}
 
 		if responseEvent != remoteControlEventTypeNone {
-			err := f.streams.control.Send(controlEvent{
-				RemoteControlEvent: &remoteControlEvent{
-					StreamID: streamID,
-					Type:     responseEvent,
-				},
-				Ping: false,
-			})
-			if err != nil {
+			if err := sendRemoteEvent(streamID, responseEvent); err != nil {
 				log.Error("Send control event response", errors.Trace(err), nil)
 
 				return false
 			}
 		}
 
+		if stateChanged && !handleTrackerEvent(streamID, t, t.tracker.handlePendingEvent()) {
+			return false
+		}
+
+		removeIfClosed(streamID, t)
+
 		return true
 	}
 
+	// interests contains the local and remote interest for each room. A room
+	// transport is only created when both sides have peers in the room and one
+	// of the nodes is the parent of the other in the room's relay tree.
+	interests := map[identifiers.RoomID]*roomInterest{}
+
+	var remoteTiebreaker uint64
+
+	getInterest := func(streamID identifiers.RoomID) *roomInterest {
+		in, ok := interests[streamID]
+		if !ok {
+			in = &roomInterest{}
+			interests[streamID] = in
+		}
+
+		return in
+	}
+
+	// updateTransport initiates the creation or closing of the room transport
+	// depending on the current interest. Only one of the nodes, the one with
+	// the larger tiebreaker, initiates the state changes to prevent both sides
+	// sending the create or close events at the same time.
+	updateTransport := func(streamID identifiers.RoomID) bool {
+		in := getInterest(streamID)
+		wantCreate := in.wantTransport()
+
+		if !in.local && !in.remote && !in.parent && !in.child {
+			delete(interests, streamID)
+		}
+
+		if f.tiebreaker <= remoteTiebreaker {
+			return true
+		}
+
+		localEvent := localControlEventTypeWantClose
+		if wantCreate {
+			localEvent = localControlEventTypeWantCreate
+		}
+
+		log := f.params.Log.WithCtx(logger.Ctx{
+			"stream_id":           streamID,
+			"local_control_event": localEvent,
+		})
+
+		log.Trace("Update transport", nil)
+
+		t := getTransport(streamID)
+
+		if !handleTrackerEvent(streamID, t, t.tracker.handleLocalEvent(localEvent)) {
+			return false
+		}
+
+		removeIfClosed(streamID, t)
+
+		return true
+	}
+
+	sendInterest := func(streamID identifiers.RoomID, in *roomInterest) error {
+		err := f.streams.control.Send(controlEvent{
+			RemoteControlEvent: nil,
+			Interest: &interestEvent{
+				StreamID:   streamID,
+				Interested: in.local,
+				Parent:     in.parent,
+				Tiebreaker: f.tiebreaker,
+			},
+			Bye: nil,
+		})
+
+		return errors.Trace(err)
+	}
+
 	handleLocalEvent := func(event localControlEvent) bool {
 		streamID := event.streamID
 
@@ -383,55 +636,69 @@ func (f *Factory) start(pingTicker clock.Ticker) {
 
 		log.Trace("Handle local event", nil)
 
-		t, ok := transports[streamID]
-		if !ok {
-			t = &transportWithTracker{
-				transport: nil,
-				tracker:   &controlStateTracker{},
-			}
-			transports[streamID] = t
+		in := getInterest(streamID)
+		in.local = event.typ == localControlEventTypeWantCreate
+
+		if err := sendInterest(streamID, in); err != nil {
+			log.Error("Send interest event", errors.Trace(err), nil)
+
+			return false
 		}
 
-		remoteEvent := t.tracker.handleLocalEvent(event.typ)
+		return updateTransport(streamID)
+	}
 
-		// nolint:exhaustive
-		switch remoteEvent {
-		case remoteControlEventTypeCreate:
-			transport, err := createTransport(streamID)
-			if err != nil {
-				log.Error("Create transport", errors.Trace(err), nil)
+	handleParentEvent := func(event parentEvent) bool {
+		streamID := event.streamID
 
-				// Major error, teardown.
-				return false
-			}
+		log := f.params.Log.WithCtx(logger.Ctx{
+			"stream_id": streamID,
+			"parent":    event.parent,
+		})
 
-			t.transport = transport
-		case remoteControlEventTypeClose:
-			if t.transport == nil {
-				log.Error("Want close but transport is nil", nil, nil)
+		log.Trace("Handle parent event", nil)
 
-				return false
-			}
+		in := getInterest(streamID)
+		in.parent = event.parent
 
-			t.transport.CloseWrite()
+		if err := sendInterest(streamID, in); err != nil {
+			log.Error("Send interest event", errors.Trace(err), nil)
+
+			return false
 		}
 
-		if remoteEvent != remoteControlEventTypeNone {
-			err := f.streams.control.Send(controlEvent{
-				RemoteControlEvent: &remoteControlEvent{
-					StreamID: streamID,
-					Type:     remoteEvent,
-				},
-				Ping: false,
-			})
-			if err != nil {
-				log.Error("Send remote control event", errors.Trace(err), nil)
+		return updateTransport(streamID)
+	}
 
-				return false
-			}
+	handleInterestEvent := func(event interestEvent) bool {
+		streamID := event.StreamID
+
+		log := f.params.Log.WithCtx(logger.Ctx{
+			"stream_id":  streamID,
+			"interested": event.Interested,
+			"parent":     event.Parent,
+		})
+
+		log.Trace("Handle interest event", nil)
+
+		if event.Tiebreaker == f.tiebreaker {
+			log.Error("Tiebreakers are equal", nil, nil)
+
+			return false
 		}
 
-		return true
+		remoteTiebreaker = event.Tiebreaker
+
+		in := getInterest(streamID)
+		in.child = event.Parent
+
+		if in.remote != event.Interested {
+			in.remote = event.Interested
+
+			f.setRemoteInterest(streamID, event.Interested)
+		}
+
+		return updateTransport(streamID)
 	}
 
 	handleUnexpectedConn := func(conn stringmux.Conn, typ string, ok bool) bool {
@@ -451,30 +718,68 @@ func (f *Factory) start(pingTicker clock.Ticker) {
 		return true
 	}
 
+	lastHeartbeat := f.params.Clock.Now()
+
 	for {
 		select {
-		case <-pingTicker.C():
-			err := f.streams.control.Send(controlEvent{
-				RemoteControlEvent: nil,
-				Ping:               true,
-			})
-			if err != nil {
-				f.params.Log.Error("Send ping", errors.Trace(err), nil)
+		case now := <-pingTicker.C():
+			if f.params.DestroyTimeout > 0 && now.Sub(lastHeartbeat) >= f.params.DestroyTimeout {
+				f.params.Log.Warn("Heartbeat timeout", logger.Ctx{
+					"last_heartbeat": lastHeartbeat,
+				})
+
+				f.err = errors.Trace(errHeartbeatTimeout)
 
 				return
 			}
+
+			if err := f.streams.heartbeat.Send(now); err != nil {
+				f.params.Log.Error("Send heartbeat", errors.Trace(err), nil)
+
+				return
+			}
+		case <-f.streams.heartbeat.Heartbeats():
+			lastHeartbeat = f.params.Clock.Now()
+
+			atomic.StoreInt64(&f.lastHeartbeat, lastHeartbeat.UnixNano())
+		case sent := <-f.streams.heartbeat.Pongs():
+			f.updateRTT(f.params.Clock.Now().Sub(sent))
 		case event, ok := <-f.streams.control.Events():
 			if !ok {
+				if f.streams.closeErr != nil {
+					f.err = f.streams.closeErr()
+				}
+
 				return
 			}
 
 			if rce := event.RemoteControlEvent; rce != nil && !handleRemoteEvent(*rce) {
 				return
 			}
+
+			if ie := event.Interest; ie != nil && !handleInterestEvent(*ie) {
+				return
+			}
+
+			if bye := event.Bye; bye != nil {
+				f.params.Log.Info("Remote node said bye", logger.Ctx{
+					"reason": bye.Reason,
+				})
+
+				if !bye.Ack {
+					f.ackBye()
+				}
+
+				return
+			}
 		case event := <-f.localControlEvents:
 			if !handleLocalEvent(event) {
 				return
 			}
+		case event := <-f.parentEvents:
+			if !handleParentEvent(event) {
+				return
+			}
 		case c, ok := <-f.streams.data.Conns():
 			if !handleUnexpectedConn(c, "data", ok) {
 				return
@@ -488,6 +793,79 @@ func (f *Factory) start(pingTicker clock.Ticker) {
 				return
 			}
 		case <-f.teardown:
+			f.sayBye()
+
+			return
+		}
+	}
+}
+
+func (f *Factory) sendBye(reason string, ack bool) bool {
+	err := f.streams.control.Send(controlEvent{
+		RemoteControlEvent: nil,
+		Interest:           nil,
+		Bye: &byeEvent{
+			Reason: reason,
+			Ack:    ack,
+		},
+	})
+	if err != nil {
+		f.params.Log.Error("Send bye", errors.Trace(err), nil)
+
+		return false
+	}
+
+	return true
+}
+
+// sayBye lets the remote node know that the factory is being closed on
+// purpose and waits for the acknowledgement, so that the bye is delivered
+// before the streams are closed.
+func (f *Factory) sayBye() {
+	if !f.sendBye("closed", false) {
+		return
+	}
+
+	timer := time.NewTimer(byeTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case event := <-f.streams.control.Events():
+			// Other events might have been sent before the remote node received
+			// the bye. The remote node might also be closing at the same time.
+			if event.Bye != nil {
+				return
+			}
+		case <-timer.C:
+			f.params.Log.Warn("Timed out waiting for bye", nil)
+
+			return
+		}
+	}
+}
+
+// ackBye acknowledges the bye and waits for the remote node to start closing
+// the streams, otherwise the acknowledgement might be lost. The heartbeat
+// stream is checked too because it is closed before the control stream.
+func (f *Factory) ackBye() {
+	if !f.sendBye("ack", true) {
+		return
+	}
+
+	timer := time.NewTimer(byeTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-f.streams.control.Events():
+		case <-f.streams.control.ReadDone():
+			return
+		case <-f.streams.heartbeat.ReadDone():
+			return
+		case <-timer.C:
+			f.params.Log.Warn("Timed out waiting for close after bye", nil)
+
 			return
 		}
 	}
@@ -497,6 +875,10 @@ func (f *Factory) TransportsChannel() <-chan *Transport {
 	return f.transportsChannel
 }
 
+// CreateTransport advertises to the remote node that there are local peers in
+// the room. The transport will be created and sent to TransportsChannel once
+// the remote node advertises the same, and one of the nodes has set the other
+// as its parent using SetParent.
 func (f *Factory) CreateTransport(streamID identifiers.RoomID) error {
 	f.params.Log.Trace("CreateTransport", logger.Ctx{
 		"stream_id": streamID,
@@ -515,6 +897,8 @@ func (f *Factory) CreateTransport(streamID identifiers.RoomID) error {
 	}
 }
 
+// CloseTransport advertises to the remote node that there are no more local
+// peers in the room. The transport will be closed if it was created.
 func (f *Factory) CloseTransport(streamID identifiers.RoomID) error {
 	f.params.Log.Trace("CloseTransport", logger.Ctx{
 		"stream_id": streamID,
@@ -533,6 +917,110 @@ func (f *Factory) CloseTransport(streamID identifiers.RoomID) error {
 	}
 }
 
+// SetParent advertises to the remote node whether it is the parent of this
+// node in the room's relay tree. A room transport is only created between a
+// node and its parent, so media is only relayed along the tree edges.
+func (f *Factory) SetParent(streamID identifiers.RoomID, parent bool) error {
+	f.params.Log.Trace("SetParent", logger.Ctx{
+		"stream_id": streamID,
+		"parent":    parent,
+	})
+
+	event := parentEvent{
+		streamID: streamID,
+		parent:   parent,
+	}
+
+	select {
+	case f.parentEvents <- event:
+		return nil
+	case <-f.torndown:
+		return errors.Annotatef(io.ErrClosedPipe, "set parent: %s", streamID)
+	}
+}
+
+// RemoteInterested returns true when the remote node has advertised that it
+// has peers in the room.
+func (f *Factory) RemoteInterested(streamID identifiers.RoomID) bool {
+	f.remoteInterestsMu.Lock()
+	defer f.remoteInterestsMu.Unlock()
+
+	_, ok := f.remoteInterests[streamID]
+
+	return ok
+}
+
+// RemoteInterestsChanged receives a value after the remote node has
+// advertised a change in interest. Multiple changes might be coalesced into
+// a single value, so RemoteInterested should be checked for all rooms.
+func (f *Factory) RemoteInterestsChanged() <-chan struct{} {
+	return f.remoteInterestsChanged
+}
+
+func (f *Factory) setRemoteInterest(streamID identifiers.RoomID, interested bool) {
+	f.remoteInterestsMu.Lock()
+
+	if interested {
+		f.remoteInterests[streamID] = struct{}{}
+	} else {
+		delete(f.remoteInterests, streamID)
+	}
+
+	f.remoteInterestsMu.Unlock()
+
+	select {
+	case f.remoteInterestsChanged <- struct{}{}:
+	default:
+	}
+}
+
+// RTT returns the smoothed round trip time to the remote node, or zero when
+// it has not been measured yet.
+func (f *Factory) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&f.rtt))
+}
+
+// updateRTT updates the smoothed RTT the same way TCP does (RFC 6298).
+func (f *Factory) updateRTT(rtt time.Duration) {
+	if rtt <= 0 {
+		// Clocks are mocked or not monotonic.
+		return
+	}
+
+	srtt := time.Duration(atomic.LoadInt64(&f.rtt))
+	if srtt == 0 {
+		srtt = rtt
+	} else {
+		srtt += (rtt - srtt) / 8
+	}
+
+	atomic.StoreInt64(&f.rtt, int64(srtt))
+}
+
+// CheckHealth returns an error when the factory has been torn down, or when
+// the remote node has missed more than one heartbeat. The factory will be
+// torn down when no heartbeats are received for DestroyTimeout.
+func (f *Factory) CheckHealth(ctx context.Context) error {
+	select {
+	case <-f.torndown:
+		return errors.Annotatef(io.ErrClosedPipe, "factory torn down")
+	default:
+	}
+
+	lastHeartbeat := time.Unix(0, atomic.LoadInt64(&f.lastHeartbeat))
+
+	if since := f.params.Clock.Now().Sub(lastHeartbeat); since > 2*f.params.PingTimeout {
+		return errors.Errorf("no heartbeat received for %s", since)
+	}
+
+	return nil
+}
+
+// RemoteAddr returns the address of the remote node.
+func (f *Factory) RemoteAddr() net.Addr {
+	return f.params.Conn.RemoteAddr()
+}
+
 func (f *Factory) Done() <-chan struct{} {
 	return f.torndown
 }
@@ -545,16 +1033,54 @@ func (f *Factory) Close() {
 	}
 }
 
+type roomInterest struct {
+	local  bool
+	remote bool
+	// parent is true when the remote node is the parent of this node.
+	parent bool
+	// child is true when the remote node is a child of this node.
+	child bool
+}
+
+// wantTransport returns true when the room transport should be created.
+func (in *roomInterest) wantTransport() bool {
+	return in.local && in.remote && (in.parent || in.child)
+}
+
+type parentEvent struct {
+	streamID identifiers.RoomID
+	parent   bool
+}
+
 type factoryStreams struct {
 	close func()
+	// abort aborts the association without waiting for the streams to be
+	// closed by the remote side.
+	abort func()
+	// closeErr returns the reason the control stream was closed by the remote
+	// side when it is known. Optional.
+	closeErr func() error
 
-	control *controlTransport
+	control   *controlTransport
+	heartbeat *heartbeatTransport
 
 	data     *stringmux.StringMux
 	metadata *stringmux.StringMux
 	media    *stringmux.StringMux
 }
 
+// Close closes all transports and multiplexers, but not the underlying
+// conns.
+func (s *factoryStreams) Close() error {
+	s.media.Close()
+	s.metadata.Close()
+	s.data.Close()
+	s.heartbeat.Close()
+	s.control.Close()
+
+	return nil
+}
+
 type associationCloser struct {
 	association *sctp.Association
 }
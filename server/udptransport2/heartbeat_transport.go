@@ -0,0 +1,143 @@
+package udptransport2
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+)
+
+type heartbeatType byte
+
+const (
+	heartbeatTypePing heartbeatType = iota + 1
+	heartbeatTypePong
+)
+
+// heartbeatSize is the size of a heartbeat: the type followed by the send
+// time in nanoseconds.
+const heartbeatSize = 9
+
+// heartbeatTransport sends and receives heartbeats over a dedicated SCTP
+// stream. The stream should be unordered and unreliable so that a lost
+// heartbeat is not retransmitted: the heartbeats should reflect the current
+// state of the connection.
+//
+// Every ping is answered with a pong containing the same send time so the
+// round trip time can be measured.
+type heartbeatTransport struct {
+	stream io.ReadWriteCloser
+
+	log logger.Logger
+
+	heartbeatsCh chan struct{}
+	pongsCh      chan time.Time
+
+	readLoopDone chan struct{}
+}
+
+func newHeartbeatTransport(
+	log logger.Logger,
+	stream io.ReadWriteCloser,
+) *heartbeatTransport {
+	h := &heartbeatTransport{
+		stream: stream,
+		log:    log.WithNamespaceAppended("heartbeat"),
+
+		// Heartbeats are dropped when the reader is too slow, only the fact that
+		// one was received is important.
+		heartbeatsCh: make(chan struct{}, 1),
+		// Same goes for pongs, only the latest round trip time is important.
+		pongsCh: make(chan time.Time, 1),
+
+		readLoopDone: make(chan struct{}),
+	}
+
+	go h.startReadLoop()
+
+	return h
+}
+
+func (h *heartbeatTransport) startReadLoop() {
+	defer func() {
+		close(h.readLoopDone)
+	}()
+
+	buf := make([]byte, 16)
+
+	for {
+		i, err := h.stream.Read(buf)
+		if err != nil {
+			h.log.Trace("Read", logger.Ctx{
+				"err": err,
+			})
+
+			return
+		}
+
+		select {
+		case h.heartbeatsCh <- struct{}{}:
+		default:
+		}
+
+		if i != heartbeatSize {
+			continue
+		}
+
+		switch heartbeatType(buf[0]) {
+		case heartbeatTypePing:
+			buf[0] = byte(heartbeatTypePong)
+
+			if _, err := h.stream.Write(buf[:heartbeatSize]); err != nil {
+				h.log.Trace("Write pong", logger.Ctx{
+					"err": err,
+				})
+			}
+		case heartbeatTypePong:
+			sent := time.Unix(0, int64(binary.BigEndian.Uint64(buf[1:heartbeatSize])))
+
+			select {
+			case h.pongsCh <- sent:
+			default:
+			}
+		}
+	}
+}
+
+// Heartbeats receives a value every time a heartbeat is received.
+func (h *heartbeatTransport) Heartbeats() <-chan struct{} {
+	return h.heartbeatsCh
+}
+
+// Pongs receives the send time of the ping every time a pong is received.
+func (h *heartbeatTransport) Pongs() <-chan time.Time {
+	return h.pongsCh
+}
+
+// ReadDone is closed once the remote side has closed the stream.
+func (h *heartbeatTransport) ReadDone() <-chan struct{} {
+	return h.readLoopDone
+}
+
+// Send sends a single heartbeat to the remote side. The remote side will
+// respond with a pong containing now.
+func (h *heartbeatTransport) Send(now time.Time) error {
+	buf := make([]byte, heartbeatSize)
+
+	buf[0] = byte(heartbeatTypePing)
+	binary.BigEndian.PutUint64(buf[1:], uint64(now.UnixNano()))
+
+	_, err := h.stream.Write(buf)
+
+	return errors.Trace(err)
+}
+
+func (h *heartbeatTransport) Close() error {
+	err := h.stream.Close()
+
+	<-h.readLoopDone
+
+	return errors.Trace(err)
+}
@@ -0,0 +1,221 @@
+package udptransport2_test
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// memNetwork delivers packets between lossyPacketConns in memory.
+type memNetwork struct {
+	mu    sync.Mutex
+	conns map[string]*lossyPacketConn
+}
+
+func newMemNetwork() *memNetwork {
+	return &memNetwork{
+		mu:    sync.Mutex{},
+		conns: map[string]*lossyPacketConn{},
+	}
+}
+
+func (n *memNetwork) listen(port int) *lossyPacketConn {
+	conn := &lossyPacketConn{
+		network: n,
+		laddr: &net.UDPAddr{
+			IP:   net.IP{127, 0, 0, 1},
+			Port: port,
+			Zone: "",
+		},
+		packets:   make(chan memPacket, 256),
+		closed:    make(chan struct{}),
+		closeOnce: sync.Once{},
+		drop:      0,
+	}
+
+	n.mu.Lock()
+	n.conns[conn.laddr.String()] = conn
+	n.mu.Unlock()
+
+	return conn
+}
+
+func (n *memNetwork) get(addr net.Addr) (*lossyPacketConn, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	conn, ok := n.conns[addr.String()]
+
+	return conn, ok
+}
+
+type memPacket struct {
+	buf  []byte
+	addr net.Addr
+}
+
+// lossyPacketConn is an in-memory net.PacketConn that drops all written
+// packets while SetDrop(true) is in effect.
+type lossyPacketConn struct {
+	network *memNetwork
+	laddr   *net.UDPAddr
+
+	packets   chan memPacket
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	drop int32
+}
+
+var _ net.PacketConn = &lossyPacketConn{}
+
+func (c *lossyPacketConn) SetDrop(drop bool) {
+	var value int32
+	if drop {
+		value = 1
+	}
+
+	atomic.StoreInt32(&c.drop, value)
+}
+
+func (c *lossyPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case packet := <-c.packets:
+		return copy(b, packet.buf), packet.addr, nil
+	case <-c.closed:
+		return 0, nil, io.EOF
+	}
+}
+
+func (c *lossyPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+
+	if atomic.LoadInt32(&c.drop) == 1 {
+		return len(b), nil
+	}
+
+	remote, ok := c.network.get(addr)
+	if !ok {
+		return len(b), nil
+	}
+
+	buf := make([]byte, len(b))
+	copy(buf, b)
+
+	select {
+	case remote.packets <- memPacket{buf: buf, addr: c.laddr}:
+	default:
+		// Buffer full, drop the packet just like UDP would.
+	}
+
+	return len(b), nil
+}
+
+func (c *lossyPacketConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
+	return nil
+}
+
+func (c *lossyPacketConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *lossyPacketConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *lossyPacketConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *lossyPacketConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// lossyUDPConn drops a fraction of the packets written to a real UDP socket.
+// All written packets are dropped while SetDrop(true) is in effect. The
+// *net.UDPConn is not embedded so that quic-go cannot bypass WriteTo.
+type lossyUDPConn struct {
+	conn *net.UDPConn
+
+	mu   sync.Mutex
+	rand *rand.Rand
+	loss float64
+
+	drop int32
+}
+
+var _ net.PacketConn = &lossyUDPConn{}
+
+func listenLossyUDP(loss float64) *lossyUDPConn {
+	return &lossyUDPConn{
+		conn: listenUDP(&net.UDPAddr{
+			IP:   net.IP{127, 0, 0, 1},
+			Port: 0,
+			Zone: "",
+		}),
+		mu:   sync.Mutex{},
+		rand: rand.New(rand.NewSource(1)), // nolint:gosec
+		loss: loss,
+		drop: 0,
+	}
+}
+
+func (c *lossyUDPConn) SetDrop(drop bool) {
+	var value int32
+	if drop {
+		value = 1
+	}
+
+	atomic.StoreInt32(&c.drop, value)
+}
+
+func (c *lossyUDPConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if atomic.LoadInt32(&c.drop) == 1 {
+		return len(b), nil
+	}
+
+	c.mu.Lock()
+	lost := c.rand.Float64() < c.loss
+	c.mu.Unlock()
+
+	if lost {
+		return len(b), nil
+	}
+
+	return c.conn.WriteTo(b, addr)
+}
+
+func (c *lossyUDPConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return c.conn.ReadFrom(b)
+}
+
+func (c *lossyUDPConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *lossyUDPConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *lossyUDPConn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *lossyUDPConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *lossyUDPConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
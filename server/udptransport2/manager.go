@@ -1,6 +1,7 @@
 package udptransport2
 
 import (
+	"crypto/tls"
 	"io"
 	"net"
 	"time"
@@ -8,16 +9,27 @@ import (
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server/clock"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
-	"github.com/peer-calls/peer-calls/v4/server/servertransport"
-	"github.com/peer-calls/peer-calls/v4/server/udpmux"
+	"github.com/peer-calls/peer-calls/v4/server/pionlogger"
+	"github.com/pion/dtls/v2"
 	"github.com/pion/interceptor"
 )
 
+const (
+	// reconnectMinDelay is the delay before the first retry of a failed
+	// reconnect. It is doubled after every failed retry.
+	reconnectMinDelay = time.Second
+	// reconnectMaxDelay is the maximum delay between the retries.
+	reconnectMaxDelay = 30 * time.Second
+)
+
 type Manager struct {
 	params *ManagerParams
 
+	connector connector
+
 	newFactoryRequests    chan newFactoryRequest
 	listFactoriesRequests chan listFactoriesRequest
+	removeFactoryRequests chan net.Addr
 
 	factoriesChannel chan *Factory
 
@@ -26,12 +38,40 @@ type Manager struct {
 }
 
 type ManagerParams struct {
-	Conn                net.PacketConn
-	Log                 logger.Logger
-	Clock               clock.Clock
-	PingTimeout         time.Duration
+	Conn  net.PacketConn
+	Log   logger.Logger
+	Clock clock.Clock
+	// PingTimeout is the interval at which factories send heartbeats.
+	PingTimeout time.Duration
+	// DestroyTimeout is the duration after which a factory is torn down when
+	// no heartbeats are received. Factories created by GetFactory will be
+	// reconnected and the new factories sent to FactoriesChannel.
 	DestroyTimeout      time.Duration
 	InterceptorRegistry *interceptor.Registry
+	// DTLSConfig enables DTLS for all connections between nodes when set.
+	// Connections from nodes that fail to authenticate are rejected.
+	DTLSConfig *dtls.Config
+	// TLSConfig is required by NewQUICManager. Unlike DTLSConfig it is used
+	// for both the client and the server side of the connections.
+	TLSConfig *tls.Config
+	// AdvertiseAddr is the address of this node as seen by the remote nodes.
+	// It is used for deciding the DTLS and QUIC roles. Conn.LocalAddr is used
+	// when not set.
+	AdvertiseAddr net.Addr
+}
+
+// connector establishes the connections between nodes and creates factories
+// from them.
+type connector interface {
+	// Conns contains the connections initiated by the remote nodes.
+	Conns() <-chan net.Conn
+	// GetConn returns a connection to raddr. The connection might only be
+	// established in NewFactory.
+	GetConn(raddr net.Addr) (net.Conn, error)
+	// NewFactory creates a factory from conn. It is called from a separate
+	// goroutine because it might block until the connection is established.
+	NewFactory(conn net.Conn, params FactoryParams) (*Factory, error)
+	Close() error
 }
 
 func NewManager(params ManagerParams) *Manager {
@@ -42,11 +82,45 @@ func NewManager(params ManagerParams) *Manager {
 
 	params.Log.Trace("NewManager", nil)
 
+	if params.DTLSConfig != nil && params.DTLSConfig.LoggerFactory == nil {
+		// Copy the config so the logs of the DTLS connections go through the
+		// same formatter as the rest of the logs.
+		dtlsConfig := *params.DTLSConfig
+		dtlsConfig.LoggerFactory = pionlogger.NewFactory(params.Log)
+		params.DTLSConfig = &dtlsConfig
+	}
+
+	return newManager(&params, newUDPConnector(&params))
+}
+
+// NewQUICManager creates a Manager that connects the nodes using QUIC. Media
+// is sent over unreliable datagrams and everything else over streams.
+// ManagerParams.TLSConfig is required.
+func NewQUICManager(params ManagerParams) (*Manager, error) {
+	params.Log = params.Log.WithNamespaceAppended("quictransport_manager")
+	params.Log = params.Log.WithCtx(logger.Ctx{
+		"local_addr": params.Conn.LocalAddr(),
+	})
+
+	params.Log.Trace("NewQUICManager", nil)
+
+	connector, err := newQUICConnector(&params)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return newManager(&params, connector), nil
+}
+
+func newManager(params *ManagerParams, connector connector) *Manager {
 	m := &Manager{
-		params: &params,
+		params: params,
+
+		connector: connector,
 
 		newFactoryRequests:    make(chan newFactoryRequest),
 		listFactoriesRequests: make(chan listFactoriesRequest),
+		removeFactoryRequests: make(chan net.Addr),
 
 		factoriesChannel: make(chan *Factory),
 
@@ -66,24 +140,28 @@ func (m *Manager) FactoriesChannel() <-chan *Factory {
 }
 
 func (m *Manager) start() {
-	readChanSize := 100
-
-	udpMux := udpmux.New(udpmux.Params{
-		Conn:           m.params.Conn,
-		MTU:            uint32(servertransport.ReceiveMTU),
-		Log:            m.params.Log,
-		ReadChanSize:   readChanSize,
-		ReadBufferSize: 0,
-	})
-
 	// factories indexes Factory by raddr string.
 	factories := map[string]*Factory{}
 
 	// pendingFactories indexes Factory by raddr string.
 	pendingFactoryRequests := map[string]newFactoryRequest{}
 
-	removeFactoriesChan := make(chan string)
+	// dialedFactories contains the remote addresses of factories created by
+	// GetFactory. These will be reconnected after a heartbeat timeout.
+	dialedFactories := map[string]net.Addr{}
+
+	// reconnectingFactories contains the remote addresses that are being
+	// reconnected.
+	reconnectingFactories := map[string]struct{}{}
+
+	// reconnectAttempts contains the number of failed reconnects since the
+	// last factory was created, by the remote address. A failed reconnect is
+	// retried until RemoveFactory is called.
+	reconnectAttempts := map[string]int{}
+
+	removeFactoriesChan := make(chan removedFactory)
 	createdFactoriesChan := make(chan NewFactoryResponse)
+	retryReconnectChan := make(chan string)
 
 	defer func() {
 		m.params.Log.Trace("Tearing down", nil)
@@ -101,7 +179,7 @@ func (m *Manager) start() {
 			}
 		}
 
-		udpMux.Close()
+		m.connector.Close()
 
 		// m.params.Conn.Close()
 
@@ -111,21 +189,24 @@ func (m *Manager) start() {
 
 	createFactoryAsync := func(conn net.Conn) {
 		go func() {
+			raddr := conn.RemoteAddr()
+
 			log := m.params.Log.WithCtx(logger.Ctx{
-				"remote_addr": conn.RemoteAddr(),
+				"remote_addr": raddr,
 			})
 
-			factory, err := NewFactory(FactoryParams{
+			factory, err := m.connector.NewFactory(conn, FactoryParams{
 				Log:                 log,
 				Conn:                conn,
 				Clock:               m.params.Clock,
 				PingTimeout:         m.params.PingTimeout,
+				DestroyTimeout:      m.params.DestroyTimeout,
 				InterceptorRegistry: m.params.InterceptorRegistry,
 			})
 
 			select {
 			case createdFactoriesChan <- NewFactoryResponse{
-				raddr:   conn.RemoteAddr().String(),
+				raddr:   raddr.String(),
 				factory: factory,
 				err:     errors.Trace(err),
 			}:
@@ -140,6 +221,8 @@ func (m *Manager) start() {
 	addFactory := func(raddrStr string, f *Factory) {
 		factories[raddrStr] = f
 
+		delete(reconnectAttempts, raddrStr)
+
 		go func() {
 			// Remove factory automatically after it tears down.
 			select {
@@ -149,12 +232,124 @@ func (m *Manager) start() {
 			}
 
 			select {
-			case removeFactoriesChan <- raddrStr:
+			case removeFactoriesChan <- removedFactory{
+				raddr:   raddrStr,
+				factory: f,
+			}:
 			case <-m.torndown:
 			}
 		}()
 	}
 
+	// scheduleReconnect retries the reconnect after a delay that grows with
+	// the number of failed attempts.
+	scheduleReconnect := func(raddrStr string) {
+		attempts := reconnectAttempts[raddrStr]
+		reconnectAttempts[raddrStr] = attempts + 1
+
+		delay := reconnectMaxDelay
+		if attempts < 5 {
+			delay = reconnectMinDelay << attempts
+		}
+
+		m.params.Log.Info("Retry reconnect", logger.Ctx{
+			"remote_addr": raddrStr,
+			"attempt":     attempts + 1,
+			"delay":       delay,
+		})
+
+		timer := m.params.Clock.NewTimer(delay)
+
+		go func() {
+			defer timer.Stop()
+
+			select {
+			case <-timer.C():
+			case <-m.torndown:
+				return
+			}
+
+			select {
+			case retryReconnectChan <- raddrStr:
+			case <-m.torndown:
+			}
+		}()
+	}
+
+	reconnect := func(raddr net.Addr) {
+		log := m.params.Log.WithCtx(logger.Ctx{
+			"remote_addr": raddr,
+		})
+
+		log.Info("Reconnect factory", nil)
+
+		conn, err := m.connector.GetConn(raddr)
+		if err != nil {
+			log.Error("Reconnect factory", errors.Trace(err), nil)
+
+			scheduleReconnect(raddr.String())
+
+			return
+		}
+
+		reconnectingFactories[raddr.String()] = struct{}{}
+
+		createFactoryAsync(conn)
+	}
+
+	handleRemovedFactory := func(removed removedFactory) {
+		if factories[removed.raddr] != removed.factory {
+			// A new factory has already been created.
+			return
+		}
+
+		delete(factories, removed.raddr)
+
+		raddr, ok := dialedFactories[removed.raddr]
+		if !ok {
+			return
+		}
+
+		if !isReconnectable(removed.factory.err) {
+			// The factory was closed on purpose.
+			delete(dialedFactories, removed.raddr)
+
+			return
+		}
+
+		reconnect(raddr)
+	}
+
+	handleRetryReconnect := func(raddrStr string) {
+		raddr, ok := dialedFactories[raddrStr]
+		if !ok {
+			// The factory was removed.
+			return
+		}
+
+		if _, ok := factories[raddrStr]; ok {
+			// The remote node has reconnected.
+			return
+		}
+
+		if _, ok := reconnectingFactories[raddrStr]; ok {
+			return
+		}
+
+		reconnect(raddr)
+	}
+
+	handleRemoveFactory := func(raddr net.Addr) {
+		raddrStr := raddr.String()
+
+		delete(dialedFactories, raddrStr)
+		delete(reconnectAttempts, raddrStr)
+
+		if f, ok := factories[raddrStr]; ok {
+			f.Close()
+		}
+	}
+
 	_handleNewFactoryRequest := func(req newFactoryRequest) error {
 		raddrStr := req.raddr.String()
 
@@ -166,7 +361,7 @@ func (m *Manager) start() {
 			return errors.Errorf("pending factory already exists: %s", req.raddr)
 		}
 
-		conn, err := udpMux.GetConn(req.raddr)
+		conn, err := m.connector.GetConn(req.raddr)
 		if err != nil {
 			return errors.Trace(err)
 		}
@@ -199,6 +394,8 @@ func (m *Manager) start() {
 			delete(pendingFactoryRequests, res.raddr)
 
 			if res.factory != nil {
+				dialedFactories[res.raddr] = req.raddr
+
 				addFactory(res.raddr, res.factory)
 			}
 
@@ -207,6 +404,27 @@ func (m *Manager) start() {
 			return true
 		}
 
+		if _, ok := reconnectingFactories[res.raddr]; ok {
+			delete(reconnectingFactories, res.raddr)
+
+			if _, ok := dialedFactories[res.raddr]; !ok {
+				// The factory was removed while reconnecting.
+				if res.factory != nil {
+					res.factory.Close()
+				}
+
+				return true
+			}
+
+			if res.err != nil {
+				log.Error("Reconnect factory", errors.Trace(res.err), nil)
+
+				scheduleReconnect(res.raddr)
+
+				return true
+			}
+		}
+
 		factoriesChannel := m.factoriesChannel
 
 		if res.err != nil {
@@ -232,6 +450,8 @@ func (m *Manager) start() {
 				}
 
 				if res.factory != nil {
+					dialedFactories[res.raddr] = req.raddr
+
 					addFactory(res.raddr, res.factory)
 				}
 
@@ -270,9 +490,9 @@ func (m *Manager) start() {
 
 	for {
 		select {
-		case conn, ok := <-udpMux.Conns():
+		case conn, ok := <-m.connector.Conns():
 			if !ok {
-				m.params.Log.Warn("UDPMux closed", nil)
+				m.params.Log.Warn("Connector closed", nil)
 
 				return
 			}
@@ -295,8 +515,12 @@ func (m *Manager) start() {
 
 			req.res <- res
 			close(req.res)
-		case raddr := <-removeFactoriesChan:
-			delete(factories, raddr)
+		case removed := <-removeFactoriesChan:
+			handleRemovedFactory(removed)
+		case raddrStr := <-retryReconnectChan:
+			handleRetryReconnect(raddrStr)
+		case raddr := <-m.removeFactoryRequests:
+			handleRemoveFactory(raddr)
 		case <-m.teardown:
 			return
 		}
@@ -340,6 +564,14 @@ func (m *Manager) Factories() []*Factory {
 	}
 }
 
+// RemoveFactory closes the factory of raddr and stops reconnecting to it.
+func (m *Manager) RemoveFactory(raddr net.Addr) {
+	select {
+	case m.removeFactoryRequests <- raddr:
+	case <-m.torndown:
+	}
+}
+
 func (m *Manager) Close() {
 	select {
 	case m.teardown <- struct{}{}:
@@ -363,6 +595,11 @@ func (r NewFactoryResponse) Result() (*Factory, error) {
 	return r.factory, errors.Trace(r.err)
 }
 
+type removedFactory struct {
+	raddr   string
+	factory *Factory
+}
+
 type listFactoriesRequest struct {
 	res chan []*Factory
 }
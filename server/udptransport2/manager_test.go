@@ -1,6 +1,7 @@
 package udptransport2_test
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"sync"
@@ -107,6 +108,15 @@ func TestManager_RTP(t *testing.T) {
 		fmt.Println("waiting for factory")
 		f1 = <-tm1.FactoriesChannel()
 
+		// Transports are only created after both nodes have local peers in the
+		// room.
+		err := f1.CreateTransport("test-stream")
+		require.NoError(t, err)
+
+		// And only between a node and its parent.
+		err = f1.SetParent("test-stream", true)
+		require.NoError(t, err)
+
 		fmt.Println("waiting for transport")
 
 		select {
@@ -158,6 +168,87 @@ func TestManager_RTP(t *testing.T) {
 	// f2.Close()
 }
 
+func TestManager_CreateTransport_NotInterested(t *testing.T) {
+	goleak.VerifyNone(t)
+	defer goleak.VerifyNone(t)
+
+	log := test.NewLogger()
+
+	udpConn1 := listenUDP(&net.UDPAddr{
+		IP:   net.IP{127, 0, 0, 1},
+		Port: 0,
+		Zone: "",
+	})
+	defer udpConn1.Close()
+
+	udpConn2 := listenUDP(&net.UDPAddr{
+		IP:   net.IP{127, 0, 0, 1},
+		Port: 0,
+		Zone: "",
+	})
+	defer udpConn2.Close()
+
+	tm1 := udptransport2.NewManager(udptransport2.ManagerParams{
+		Conn:           udpConn1,
+		Log:            log,
+		Clock:          clock.NewMock(),
+		PingTimeout:    3 * time.Second,
+		DestroyTimeout: 15 * time.Second,
+	})
+	defer tm1.Close()
+
+	tm2 := udptransport2.NewManager(udptransport2.ManagerParams{
+		Conn:           udpConn2,
+		Log:            log,
+		Clock:          clock.NewMock(),
+		PingTimeout:    3 * time.Second,
+		DestroyTimeout: 15 * time.Second,
+	})
+	defer tm2.Close()
+
+	f2, err := (<-tm2.GetFactory(udpConn1.LocalAddr())).Result()
+	require.NoError(t, err)
+
+	f1 := <-tm1.FactoriesChannel()
+
+	require.NoError(t, f2.CreateTransport("test-stream"))
+
+	select {
+	case <-f1.TransportsChannel():
+		assert.Fail(t, "transport1 should not have been created")
+	case <-f2.TransportsChannel():
+		assert.Fail(t, "transport2 should not have been created")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, f1.CreateTransport("test-stream"))
+
+	// Neither node is the parent of the other in the relay tree.
+	select {
+	case <-f1.TransportsChannel():
+		assert.Fail(t, "transport1 should not have been created")
+	case <-f2.TransportsChannel():
+		assert.Fail(t, "transport2 should not have been created")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, f2.SetParent("test-stream", true))
+
+	var transport1, transport2 *udptransport2.Transport
+
+	for transport1 == nil || transport2 == nil {
+		select {
+		case transport1 = <-f1.TransportsChannel():
+		case transport2 = <-f2.TransportsChannel():
+		case <-time.After(time.Second):
+			require.Fail(t, "Timed out waiting for transports")
+		}
+	}
+
+	assert.NoError(t, transport1.Close())
+	assert.NoError(t, transport2.Close())
+}
+
 // func TestManager_NewTransport_Cancel(t *testing.T) {
 // 	goleak.VerifyNone(t)
 // 	defer goleak.VerifyNone(t)
@@ -203,3 +294,178 @@ func TestManager_RTP(t *testing.T) {
 
 // 	wg.Wait()
 // }
+
+func TestManager_HeartbeatTimeout_Reconnect(t *testing.T) {
+	goleak.VerifyNone(t)
+	defer goleak.VerifyNone(t)
+
+	log := test.NewLogger()
+
+	network := newMemNetwork()
+
+	conn1 := network.listen(5001)
+	defer conn1.Close()
+
+	conn2 := network.listen(5002)
+	defer conn2.Close()
+
+	clock1 := clock.NewMock()
+	clock2 := clock.NewMock()
+
+	tm1 := udptransport2.NewManager(udptransport2.ManagerParams{
+		Conn:           conn1,
+		Log:            log,
+		Clock:          clock1,
+		PingTimeout:    time.Second,
+		DestroyTimeout: 3 * time.Second,
+	})
+	defer tm1.Close()
+
+	tm2 := udptransport2.NewManager(udptransport2.ManagerParams{
+		Conn:           conn2,
+		Log:            log,
+		Clock:          clock2,
+		PingTimeout:    time.Second,
+		DestroyTimeout: 3 * time.Second,
+	})
+	defer tm2.Close()
+
+	f1, err := (<-tm1.GetFactory(conn2.LocalAddr())).Result()
+	require.NoError(t, err)
+
+	f2 := <-tm2.FactoriesChannel()
+
+	// Heartbeats are exchanged while the connection works.
+	for i := 0; i < 5; i++ {
+		clock1.Add(time.Second)
+		clock2.Add(time.Second)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	select {
+	case <-f1.Done():
+		require.Fail(t, "factory1 should not have been torn down")
+	case <-f2.Done():
+		require.Fail(t, "factory2 should not have been torn down")
+	default:
+	}
+
+	conn1.SetDrop(true)
+	conn2.SetDrop(true)
+
+	timeout := time.After(5 * time.Second)
+
+	done1, done2 := f1.Done(), f2.Done()
+
+	for done1 != nil || done2 != nil {
+		clock1.Add(time.Second)
+		clock2.Add(time.Second)
+
+		select {
+		case <-done1:
+			done1 = nil
+		case <-done2:
+			done2 = nil
+		case <-time.After(20 * time.Millisecond):
+		case <-timeout:
+			require.Fail(t, "Timed out waiting for heartbeat timeout")
+		}
+	}
+
+	f1, f2 = nil, nil
+
+	conn1.SetDrop(false)
+	conn2.SetDrop(false)
+
+	// The factory created by GetFactory reconnects and the new factories are
+	// received by both sides.
+	timeout = time.After(20 * time.Second)
+
+	for f1 == nil || f2 == nil {
+		select {
+		case f1 = <-tm1.FactoriesChannel():
+		case f2 = <-tm2.FactoriesChannel():
+		case <-timeout:
+			require.Fail(t, "Timed out waiting for reconnect")
+		}
+	}
+
+	require.NoError(t, f1.CreateTransport("test-stream"))
+	require.NoError(t, f2.CreateTransport("test-stream"))
+	require.NoError(t, f1.SetParent("test-stream", true))
+
+	var transport1, transport2 *udptransport2.Transport
+
+	for transport1 == nil || transport2 == nil {
+		select {
+		case transport1 = <-f1.TransportsChannel():
+		case transport2 = <-f2.TransportsChannel():
+		case <-time.After(time.Second):
+			require.Fail(t, "Timed out waiting for transports")
+		}
+	}
+
+	assert.NoError(t, transport1.Close())
+	assert.NoError(t, transport2.Close())
+}
+
+func TestManager_Close_Bye(t *testing.T) {
+	goleak.VerifyNone(t)
+	defer goleak.VerifyNone(t)
+
+	log := test.NewLogger()
+
+	network := newMemNetwork()
+
+	conn1 := network.listen(5001)
+	defer conn1.Close()
+
+	conn2 := network.listen(5002)
+	defer conn2.Close()
+
+	tm1 := udptransport2.NewManager(udptransport2.ManagerParams{
+		Conn:           conn1,
+		Log:            log,
+		Clock:          clock.NewMock(),
+		PingTimeout:    time.Second,
+		DestroyTimeout: 3 * time.Second,
+	})
+	defer tm1.Close()
+
+	tm2 := udptransport2.NewManager(udptransport2.ManagerParams{
+		Conn:           conn2,
+		Log:            log,
+		Clock:          clock.NewMock(),
+		PingTimeout:    time.Second,
+		DestroyTimeout: 3 * time.Second,
+	})
+	defer tm2.Close()
+
+	f1, err := (<-tm1.GetFactory(conn2.LocalAddr())).Result()
+	require.NoError(t, err)
+
+	f2 := <-tm2.FactoriesChannel()
+
+	assert.NoError(t, f1.CheckHealth(context.Background()))
+
+	// The remote factory is torn down right away instead of waiting for the
+	// heartbeat timeout.
+	f2.Close()
+
+	select {
+	case <-f1.Done():
+	case <-time.After(time.Second):
+		require.Fail(t, "Timed out waiting for factory1 to be torn down")
+	}
+
+	assert.Error(t, f1.CheckHealth(context.Background()))
+
+	// The factory was closed on purpose so it does not reconnect.
+	select {
+	case <-tm1.FactoriesChannel():
+		assert.Fail(t, "factory1 should not have reconnected")
+	case <-tm2.FactoriesChannel():
+		assert.Fail(t, "factory2 should not have reconnected")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,764 @@
+package udptransport2
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/logger"
+	"github.com/peer-calls/peer-calls/v4/server/servertransport"
+	"github.com/peer-calls/peer-calls/v4/server/stringmux"
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// quicALPN is the application protocol negotiated between nodes.
+	quicALPN = "peer-calls-node"
+
+	// defaultQUICConnectTimeout is the time to wait for a connection to be
+	// established, either by dialing or by waiting for the remote node to dial
+	// back.
+	defaultQUICConnectTimeout = 30 * time.Second
+
+	quicErrorCodeClosed quic.ApplicationErrorCode = 0
+	quicErrorCodeAbort  quic.ApplicationErrorCode = 1
+)
+
+// quicNudge is sent by the QUIC server to ask the remote node to connect.
+// The first two bits are zero so that quic-go does not treat it as a QUIC
+// packet.
+// nolint:gochecknoglobals
+var quicNudge = []byte{0}
+
+// quicStreamType is written as the first byte of every stream so that the
+// accepting side knows what the stream is used for.
+type quicStreamType byte
+
+const (
+	quicStreamTypeControl quicStreamType = iota + 1
+	quicStreamTypeMetadata
+	quicStreamTypeData
+)
+
+// quicConnector establishes QUIC connections between nodes. Just like with
+// DTLS, the node with the smaller address always acts as the QUIC client, so
+// that there is only one connection between two nodes even when both nodes
+// connect at the same time. The server asks the client to connect by sending
+// nudges.
+type quicConnector struct {
+	params *ManagerParams
+
+	laddr net.Addr
+
+	transport *quic.Transport
+	listener  *quic.Listener
+
+	tlsConfig  *tls.Config
+	quicConfig *quic.Config
+
+	conns chan net.Conn
+
+	mu sync.Mutex
+	// waiting contains the channels of NewFactory calls waiting for a remote
+	// node to connect, indexed by raddr string.
+	waiting map[string]chan quic.Connection
+	// dialed contains the connections dialed by this node, indexed by raddr
+	// string. The value is nil while dialing.
+	dialed map[string]quic.Connection
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var _ connector = &quicConnector{}
+
+func newQUICConnector(params *ManagerParams) (*quicConnector, error) {
+	if params.TLSConfig == nil {
+		return nil, errors.Errorf("QUIC requires a TLS config")
+	}
+
+	tlsConfig := params.TLSConfig.Clone()
+	if len(tlsConfig.NextProtos) == 0 {
+		tlsConfig.NextProtos = []string{quicALPN}
+	}
+
+	// nolint:exhaustivestruct
+	quicConfig := &quic.Config{
+		EnableDatagrams: true,
+	}
+
+	if params.DestroyTimeout > 0 {
+		// Heartbeats should detect the timeout first because they lead to a
+		// reconnect.
+		quicConfig.MaxIdleTimeout = 2 * params.DestroyTimeout
+	}
+
+	// nolint:exhaustivestruct
+	transport := &quic.Transport{
+		Conn: params.Conn,
+	}
+
+	listener, err := transport.Listen(tlsConfig, quicConfig)
+	if err != nil {
+		transport.Close()
+
+		return nil, errors.Annotatef(err, "listen QUIC")
+	}
+
+	laddr := params.AdvertiseAddr
+	if laddr == nil {
+		laddr = params.Conn.LocalAddr()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := &quicConnector{
+		params: params,
+
+		laddr: laddr,
+
+		transport: transport,
+		listener:  listener,
+
+		tlsConfig:  tlsConfig,
+		quicConfig: quicConfig,
+
+		conns: make(chan net.Conn),
+
+		mu:      sync.Mutex{},
+		waiting: map[string]chan quic.Connection{},
+		dialed:  map[string]quic.Connection{},
+
+		ctx:    ctx,
+		cancel: cancel,
+		wg:     sync.WaitGroup{},
+	}
+
+	c.wg.Add(2)
+
+	go c.acceptLoop()
+	go c.nudgeLoop()
+
+	return c, nil
+}
+
+func (c *quicConnector) acceptLoop() {
+	defer c.wg.Done()
+
+	for {
+		conn, err := c.listener.Accept(c.ctx)
+		if err != nil {
+			c.params.Log.Trace("Accept", logger.Ctx{
+				"err": err,
+			})
+
+			return
+		}
+
+		raddr := conn.RemoteAddr()
+
+		c.params.Log.Trace("Accepted QUIC connection", logger.Ctx{
+			"remote_addr": raddr,
+		})
+
+		c.mu.Lock()
+		ch, ok := c.waiting[raddr.String()]
+		delete(c.waiting, raddr.String())
+		c.mu.Unlock()
+
+		if ok {
+			ch <- conn
+
+			continue
+		}
+
+		c.sendConn(newQUICConn(conn, false))
+	}
+}
+
+// nudgeLoop dials the remote nodes that sent a nudge.
+func (c *quicConnector) nudgeLoop() {
+	defer c.wg.Done()
+
+	buf := make([]byte, 16)
+
+	for {
+		i, raddr, err := c.transport.ReadNonQUICPacket(c.ctx, buf)
+		if err != nil {
+			c.params.Log.Trace("Read non-QUIC packet", logger.Ctx{
+				"err": err,
+			})
+
+			return
+		}
+
+		if !bytes.Equal(buf[:i], quicNudge) || !isClient(c.laddr, raddr) {
+			continue
+		}
+
+		if !c.reserveDial(raddr) {
+			// Already connected or connecting.
+			continue
+		}
+
+		c.wg.Add(1)
+
+		go func() {
+			defer c.wg.Done()
+
+			conn, err := c.dial(raddr)
+			if err != nil {
+				c.params.Log.Error("Dial nudging node", errors.Trace(err), logger.Ctx{
+					"remote_addr": raddr,
+				})
+
+				return
+			}
+
+			c.sendConn(newQUICConn(conn, true))
+		}()
+	}
+}
+
+func (c *quicConnector) sendConn(conn *quicConn) {
+	select {
+	case c.conns <- conn:
+	case <-c.ctx.Done():
+		conn.Close()
+	}
+}
+
+// reserveDial returns false when there is already an active connection to
+// raddr, or one is being dialed.
+func (c *quicConnector) reserveDial(raddr net.Addr) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conn, ok := c.dialed[raddr.String()]
+	if ok && (conn == nil || conn.Context().Err() == nil) {
+		return false
+	}
+
+	c.dialed[raddr.String()] = nil
+
+	return true
+}
+
+// dial connects to raddr. reserveDial must be called first.
+func (c *quicConnector) dial(raddr net.Addr) (quic.Connection, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, defaultQUICConnectTimeout)
+	defer cancel()
+
+	c.params.Log.Trace("Dial QUIC", logger.Ctx{
+		"remote_addr": raddr,
+	})
+
+	conn, err := c.transport.Dial(ctx, raddr, c.tlsConfig, c.quicConfig)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		delete(c.dialed, raddr.String())
+
+		return nil, errors.Annotatef(err, "dial QUIC: %s", raddr)
+	}
+
+	c.dialed[raddr.String()] = conn
+
+	return conn, nil
+}
+
+// waitForConn sends nudges to raddr until it connects to this node.
+func (c *quicConnector) waitForConn(raddr net.Addr) (quic.Connection, error) {
+	ch := make(chan quic.Connection, 1)
+
+	c.mu.Lock()
+
+	if _, ok := c.waiting[raddr.String()]; ok {
+		c.mu.Unlock()
+
+		return nil, errors.Errorf("already waiting for connection: %s", raddr)
+	}
+
+	c.waiting[raddr.String()] = ch
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(c.ctx, defaultQUICConnectTimeout)
+	defer cancel()
+
+	ticker := c.params.Clock.NewTicker(c.params.PingTimeout)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.transport.WriteTo(quicNudge, raddr); err != nil {
+			c.params.Log.Error("Write QUIC nudge", errors.Trace(err), logger.Ctx{
+				"remote_addr": raddr,
+			})
+		}
+
+		select {
+		case conn := <-ch:
+			return conn, nil
+		case <-ticker.C():
+		case <-ctx.Done():
+			c.mu.Lock()
+			delete(c.waiting, raddr.String())
+			c.mu.Unlock()
+
+			select {
+			case conn := <-ch:
+				// The connection was accepted in the meantime.
+				return conn, nil
+			default:
+			}
+
+			return nil, errors.Annotatef(ctx.Err(), "wait for QUIC connection: %s", raddr)
+		}
+	}
+}
+
+func (c *quicConnector) Conns() <-chan net.Conn {
+	return c.conns
+}
+
+// GetConn returns a conn that is not connected yet. The connection is
+// established in NewFactory.
+func (c *quicConnector) GetConn(raddr net.Addr) (net.Conn, error) {
+	return &quicConn{
+		conn:   nil,
+		laddr:  c.params.Conn.LocalAddr(),
+		raddr:  raddr,
+		dialed: false,
+	}, nil
+}
+
+func (c *quicConnector) NewFactory(conn net.Conn, params FactoryParams) (*Factory, error) {
+	qconn, ok := conn.(*quicConn)
+	if !ok {
+		return nil, errors.Errorf("unexpected conn type: %T", conn)
+	}
+
+	if qconn.conn == nil {
+		raddr := qconn.raddr
+
+		if isClient(c.laddr, raddr) {
+			if !c.reserveDial(raddr) {
+				return nil, errors.Errorf("QUIC connection already exists: %s", raddr)
+			}
+
+			conn, err := c.dial(raddr)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+
+			qconn = newQUICConn(conn, true)
+		} else {
+			conn, err := c.waitForConn(raddr)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+
+			qconn = newQUICConn(conn, false)
+		}
+	}
+
+	params.Conn = qconn
+
+	factory, err := newFactory(params, func(params *FactoryParams) (*factoryStreams, error) {
+		return newQUICStreams(params, qconn)
+	})
+	if err != nil {
+		qconn.Close()
+
+		return nil, errors.Trace(err)
+	}
+
+	return factory, nil
+}
+
+func (c *quicConnector) Close() error {
+	c.cancel()
+
+	err := c.listener.Close()
+
+	c.wg.Wait()
+
+	close(c.conns)
+
+	if err2 := c.transport.Close(); err == nil {
+		err = err2
+	}
+
+	return errors.Trace(err)
+}
+
+// newQUICStreams opens the streams when this node dialed the connection and
+// accepts them otherwise. The media and heartbeats are sent as datagrams.
+func newQUICStreams(params *FactoryParams, qconn *quicConn) (*factoryStreams, error) {
+	params.Log.Trace("init start", nil)
+
+	closers := make([]io.Closer, 0, 5)
+
+	close := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i].Close()
+		}
+	}
+
+	defer func() {
+		if close != nil {
+			close()
+		}
+	}()
+
+	readChanSize := 100
+
+	datagramMux := stringmux.New(stringmux.Params{
+		Log:            params.Log,
+		Conn:           qconn,
+		MTU:            uint32(servertransport.ReceiveMTU),
+		ReadChanSize:   readChanSize,
+		ReadBufferSize: 0,
+	})
+
+	closers = append(closers, datagramMux)
+
+	mediaConn, err := datagramMux.GetConn("m")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	closers = append(closers, mediaConn)
+
+	heartbeatConn, err := datagramMux.GetConn("h")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	closers = append(closers, heartbeatConn)
+
+	streams, err := qconn.streams()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for _, stream := range streams {
+		closers = append(closers, stream)
+	}
+
+	params.Log.Trace("init done", nil)
+
+	controlConn := streams[quicStreamTypeControl]
+
+	factoryStreams := newFactoryStreams(params.Log, factoryConns{
+		control:   controlConn,
+		heartbeat: heartbeatConn,
+		data:      streams[quicStreamTypeData],
+		metadata:  streams[quicStreamTypeMetadata],
+		media:     mediaConn,
+	})
+
+	factoryStreams.abort = func() {
+		_ = qconn.conn.CloseWithError(quicErrorCodeAbort, "heartbeat timeout")
+	}
+
+	factoryStreams.closeErr = func() error {
+		return quicCloseErr(controlConn.ReadErr())
+	}
+
+	closers = append(closers, factoryStreams)
+
+	factoryStreams.close = close
+
+	// Do not close everything on defer.
+	close = nil
+
+	return factoryStreams, nil
+}
+
+// quicCloseErr returns errConnectionLost when err says the connection was
+// lost rather than closed by one of the nodes.
+func quicCloseErr(err error) error {
+	switch err.(type) { // nolint:errorlint
+	case *quic.IdleTimeoutError, *quic.StatelessResetError:
+		return errors.Annotate(errConnectionLost, err.Error())
+	default:
+		return nil
+	}
+}
+
+// quicConn sends and receives QUIC datagrams. It is used for the media and
+// heartbeats, which should not be retransmitted.
+type quicConn struct {
+	conn quic.Connection
+
+	laddr net.Addr
+	raddr net.Addr
+
+	// dialed is true when this node is the QUIC client. The client opens the
+	// streams.
+	dialed bool
+}
+
+var _ net.Conn = &quicConn{}
+
+func newQUICConn(conn quic.Connection, dialed bool) *quicConn {
+	return &quicConn{
+		conn:   conn,
+		laddr:  conn.LocalAddr(),
+		raddr:  conn.RemoteAddr(),
+		dialed: dialed,
+	}
+}
+
+// streams opens or accepts the streams used by the factory.
+func (c *quicConn) streams() (map[quicStreamType]*quicStreamConn, error) {
+	streamTypes := []quicStreamType{
+		quicStreamTypeControl,
+		quicStreamTypeMetadata,
+		quicStreamTypeData,
+	}
+
+	ctx := c.conn.Context()
+
+	streams := make(map[quicStreamType]*quicStreamConn, len(streamTypes))
+
+	closeAll := func() {
+		for _, stream := range streams {
+			stream.Close()
+		}
+	}
+
+	for _, typ := range streamTypes {
+		if c.dialed {
+			stream, err := c.conn.OpenStreamSync(ctx)
+			if err != nil {
+				closeAll()
+
+				return nil, errors.Annotatef(err, "open stream: %d", typ)
+			}
+
+			streams[typ] = newQUICStreamConn(stream, c.laddr, c.raddr)
+
+			if _, err := stream.Write([]byte{byte(typ)}); err != nil {
+				closeAll()
+
+				return nil, errors.Annotatef(err, "write stream type: %d", typ)
+			}
+
+			continue
+		}
+
+		stream, err := c.conn.AcceptStream(ctx)
+		if err != nil {
+			closeAll()
+
+			return nil, errors.Annotatef(err, "accept stream")
+		}
+
+		streamConn := newQUICStreamConn(stream, c.laddr, c.raddr)
+
+		var b [1]byte
+
+		if _, err := io.ReadFull(stream, b[:]); err != nil {
+			streamConn.Close()
+			closeAll()
+
+			return nil, errors.Annotatef(err, "read stream type")
+		}
+
+		acceptedType := quicStreamType(b[0])
+
+		if _, ok := streams[acceptedType]; ok || acceptedType < quicStreamTypeControl || acceptedType > quicStreamTypeData {
+			streamConn.Close()
+			closeAll()
+
+			return nil, errors.Errorf("unexpected stream type: %d", acceptedType)
+		}
+
+		streams[acceptedType] = streamConn
+	}
+
+	return streams, nil
+}
+
+func (c *quicConn) Read(b []byte) (int, error) {
+	for {
+		data, err := c.conn.ReceiveDatagram(context.Background())
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+
+		// Datagrams larger than the buffer are dropped, just like with UDP.
+		if len(data) <= len(b) {
+			return copy(b, data), nil
+		}
+	}
+}
+
+func (c *quicConn) Write(b []byte) (int, error) {
+	// Datagrams that are larger than the current maximum datagram size are not
+	// sent, the error is returned to the caller.
+	if err := c.conn.SendDatagram(b); err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	return len(b), nil
+}
+
+// Close closes the whole QUIC connection.
+func (c *quicConn) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	return errors.Trace(c.conn.CloseWithError(quicErrorCodeClosed, "closed"))
+}
+
+func (c *quicConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *quicConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+func (c *quicConn) SetDeadline(t time.Time) error {
+	return errors.Errorf("not implemented")
+}
+
+func (c *quicConn) SetWriteDeadline(t time.Time) error {
+	return errors.Errorf("not implemented")
+}
+
+func (c *quicConn) SetReadDeadline(t time.Time) error {
+	return errors.Errorf("not implemented")
+}
+
+// quicStreamConn preserves message boundaries on top of a QUIC stream by
+// prefixing each message with its length.
+type quicStreamConn struct {
+	stream quic.Stream
+
+	laddr net.Addr
+	raddr net.Addr
+
+	writeMu sync.Mutex
+
+	readErrMu sync.Mutex
+	readErr   error
+}
+
+var _ net.Conn = &quicStreamConn{}
+
+func newQUICStreamConn(stream quic.Stream, laddr net.Addr, raddr net.Addr) *quicStreamConn {
+	return &quicStreamConn{
+		stream: stream,
+
+		laddr: laddr,
+		raddr: raddr,
+
+		writeMu: sync.Mutex{},
+
+		readErrMu: sync.Mutex{},
+		readErr:   nil,
+	}
+}
+
+func (s *quicStreamConn) Read(b []byte) (int, error) {
+	i, err := s.read(b)
+	if err != nil {
+		s.readErrMu.Lock()
+		s.readErr = err
+		s.readErrMu.Unlock()
+
+		return 0, errors.Trace(err)
+	}
+
+	return i, nil
+}
+
+func (s *quicStreamConn) read(b []byte) (int, error) {
+	var header [2]byte
+
+	if _, err := io.ReadFull(s.stream, header[:]); err != nil {
+		return 0, err // nolint:wrapcheck
+	}
+
+	size := int(binary.BigEndian.Uint16(header[:]))
+
+	if size > len(b) {
+		// Skip the message so the next read starts at the next header.
+		if _, err := io.CopyN(io.Discard, s.stream, int64(size)); err != nil {
+			return 0, err // nolint:wrapcheck
+		}
+
+		return 0, errors.Annotatef(io.ErrShortBuffer, "message size: %d", size)
+	}
+
+	return io.ReadFull(s.stream, b[:size]) // nolint:wrapcheck
+}
+
+// ReadErr returns the error that ended reading, if any.
+func (s *quicStreamConn) ReadErr() error {
+	s.readErrMu.Lock()
+	defer s.readErrMu.Unlock()
+
+	return s.readErr
+}
+
+func (s *quicStreamConn) Write(b []byte) (int, error) {
+	if len(b) > math.MaxUint16 {
+		return 0, errors.Errorf("message too large: %d", len(b))
+	}
+
+	buf := make([]byte, 2+len(b))
+
+	binary.BigEndian.PutUint16(buf, uint16(len(b)))
+	copy(buf[2:], b)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if _, err := s.stream.Write(buf); err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	return len(b), nil
+}
+
+// Close closes both directions of the stream so that pending reads return.
+func (s *quicStreamConn) Close() error {
+	s.stream.CancelRead(quic.StreamErrorCode(quicErrorCodeClosed))
+
+	return errors.Trace(s.stream.Close())
+}
+
+func (s *quicStreamConn) LocalAddr() net.Addr {
+	return s.laddr
+}
+
+func (s *quicStreamConn) RemoteAddr() net.Addr {
+	return s.raddr
+}
+
+func (s *quicStreamConn) SetDeadline(t time.Time) error {
+	return errors.Trace(s.stream.SetDeadline(t))
+}
+
+func (s *quicStreamConn) SetWriteDeadline(t time.Time) error {
+	return errors.Trace(s.stream.SetWriteDeadline(t))
+}
+
+func (s *quicStreamConn) SetReadDeadline(t time.Time) error {
+	return errors.Trace(s.stream.SetReadDeadline(t))
+}
@@ -0,0 +1,40 @@
+package udptransport2
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readStreamMock only implements the methods used by quicStreamConn.Read.
+type readStreamMock struct {
+	quic.Stream
+
+	reader io.Reader
+}
+
+func (s readStreamMock) Read(b []byte) (int, error) {
+	return s.reader.Read(b) // nolint:wrapcheck
+}
+
+func TestQUICStreamConn_Read_shortBuffer(t *testing.T) {
+	conn := newQUICStreamConn(readStreamMock{
+		Stream: nil,
+		reader: bytes.NewReader([]byte{0, 4, 1, 2, 3, 4, 0, 2, 5, 6}),
+	}, nil, nil)
+
+	buf := make([]byte, 3)
+
+	_, err := conn.Read(buf)
+	assert.Equal(t, io.ErrShortBuffer, errors.Cause(err))
+
+	// The oversized message is skipped.
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{5, 6}, buf[:n])
+}
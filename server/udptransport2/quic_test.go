@@ -0,0 +1,257 @@
+package udptransport2_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server/clock"
+	"github.com/peer-calls/peer-calls/v4/server/identifiers"
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/peer-calls/peer-calls/v4/server/transport"
+	"github.com/peer-calls/peer-calls/v4/server/udptransport2"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func newQUICTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{cert},
+			PrivateKey:  key,
+		}},
+		InsecureSkipVerify: true, // nolint:gosec
+	}
+}
+
+func newQUICManagers(
+	t *testing.T,
+	loss float64,
+) (*lossyUDPConn, *udptransport2.Manager, *lossyUDPConn, *udptransport2.Manager, func()) {
+	t.Helper()
+
+	log := test.NewLogger()
+
+	conn1 := listenLossyUDP(loss)
+	conn2 := listenLossyUDP(loss)
+
+	tm1, err := udptransport2.NewQUICManager(udptransport2.ManagerParams{
+		Conn:           conn1,
+		Log:            log,
+		Clock:          clock.New(),
+		PingTimeout:    100 * time.Millisecond,
+		DestroyTimeout: time.Second,
+		TLSConfig:      newQUICTLSConfig(t),
+	})
+	require.NoError(t, err)
+
+	tm2, err := udptransport2.NewQUICManager(udptransport2.ManagerParams{
+		Conn:           conn2,
+		Log:            log,
+		Clock:          clock.New(),
+		PingTimeout:    100 * time.Millisecond,
+		DestroyTimeout: time.Second,
+		TLSConfig:      newQUICTLSConfig(t),
+	})
+	require.NoError(t, err)
+
+	return conn1, tm1, conn2, tm2, func() {
+		tm1.Close()
+		tm2.Close()
+		conn1.Close()
+		conn2.Close()
+	}
+}
+
+func createQUICTransports(
+	t *testing.T,
+	f1 *udptransport2.Factory,
+	f2 *udptransport2.Factory,
+) (*udptransport2.Transport, *udptransport2.Transport) {
+	t.Helper()
+
+	require.NoError(t, f1.CreateTransport("test-stream"))
+	require.NoError(t, f2.CreateTransport("test-stream"))
+	require.NoError(t, f1.SetParent("test-stream", true))
+
+	var transport1, transport2 *udptransport2.Transport
+
+	timeout := time.After(5 * time.Second)
+
+	for transport1 == nil || transport2 == nil {
+		select {
+		case transport1 = <-f1.TransportsChannel():
+		case transport2 = <-f2.TransportsChannel():
+		case <-timeout:
+			require.Fail(t, "Timed out waiting for transports")
+		}
+	}
+
+	assert.Equal(t, identifiers.RoomID("test-stream"), transport1.StreamID())
+	assert.Equal(t, identifiers.RoomID("test-stream"), transport2.StreamID())
+
+	return transport1, transport2
+}
+
+func TestQUICManager_Loss(t *testing.T) {
+	goleak.VerifyNone(t)
+	defer goleak.VerifyNone(t)
+
+	conn1, tm1, conn2, tm2, cleanup := newQUICManagers(t, 0.1)
+	defer cleanup()
+
+	for _, tc := range []struct {
+		descr    string
+		dialer   *udptransport2.Manager
+		acceptor *udptransport2.Manager
+		raddr    *lossyUDPConn
+	}{
+		// The roles depend on the addresses so both directions are tested.
+		{"node1 dials", tm1, tm2, conn2},
+		{"node2 dials", tm2, tm1, conn1},
+	} {
+		t.Run(tc.descr, func(t *testing.T) {
+			f1, err := (<-tc.dialer.GetFactory(tc.raddr.LocalAddr())).Result()
+			require.NoError(t, err)
+
+			var f2 *udptransport2.Factory
+
+			select {
+			case f2 = <-tc.acceptor.FactoriesChannel():
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "Timed out waiting for factory")
+			}
+
+			defer f1.Close()
+			defer f2.Close()
+
+			transport1, transport2 := createQUICTransports(t, f1, f2)
+
+			codec := transport.Codec{
+				MimeType:    "audio/opus",
+				ClockRate:   48000,
+				Channels:    2,
+				SDPFmtpLine: "",
+			}
+
+			track := transport.NewSimpleTrack("trackID", "streamID", codec, "user1")
+
+			_, _, err = transport2.AddTrack(track)
+			require.NoError(t, err)
+
+			// Metadata is retransmitted.
+			select {
+			case trwr := <-transport1.RemoteTracksChannel():
+				assert.Equal(t, track, trwr.TrackRemote.Track())
+			case <-time.After(5 * time.Second):
+				assert.Fail(t, "Timed out waiting for track")
+			}
+
+			// Data messages are retransmitted and delivered in order.
+			count := 20
+
+			for i := 0; i < count; i++ {
+				transport2.Send(webrtc.DataChannelMessage{
+					IsString: true,
+					Data:     []byte(fmt.Sprintf("message %d", i)),
+				})
+			}
+
+			for i := 0; i < count; i++ {
+				select {
+				case msg := <-transport1.MessagesChannel():
+					assert.Equal(t, fmt.Sprintf("message %d", i), string(msg.Data))
+				case <-time.After(5 * time.Second):
+					require.Fail(t, "Timed out waiting for message")
+				}
+			}
+
+			assert.NoError(t, transport1.Close())
+			assert.NoError(t, transport2.Close())
+		})
+	}
+}
+
+func TestQUICManager_Reconnect(t *testing.T) {
+	goleak.VerifyNone(t)
+	defer goleak.VerifyNone(t)
+
+	conn1, tm1, conn2, tm2, cleanup := newQUICManagers(t, 0)
+	defer cleanup()
+
+	f1, err := (<-tm1.GetFactory(conn2.LocalAddr())).Result()
+	require.NoError(t, err)
+
+	var f2 *udptransport2.Factory
+
+	select {
+	case f2 = <-tm2.FactoriesChannel():
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "Timed out waiting for factory")
+	}
+
+	// The round trip time is measured using the heartbeats.
+	assert.Eventually(t, func() bool {
+		return f1.RTT() > 0 && f2.RTT() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	conn1.SetDrop(true)
+	conn2.SetDrop(true)
+
+	timeout := time.After(5 * time.Second)
+
+	for _, done := range []<-chan struct{}{f1.Done(), f2.Done()} {
+		select {
+		case <-done:
+		case <-timeout:
+			require.Fail(t, "Timed out waiting for heartbeat timeout")
+		}
+	}
+
+	f1, f2 = nil, nil
+
+	conn1.SetDrop(false)
+	conn2.SetDrop(false)
+
+	// The factory created by GetFactory reconnects and the new factories are
+	// received by both sides.
+	timeout = time.After(10 * time.Second)
+
+	for f1 == nil || f2 == nil {
+		select {
+		case f1 = <-tm1.FactoriesChannel():
+		case f2 = <-tm2.FactoriesChannel():
+		case <-timeout:
+			require.Fail(t, "Timed out waiting for reconnect")
+		}
+	}
+
+	transport1, transport2 := createQUICTransports(t, f1, f2)
+
+	assert.NoError(t, transport1.Close())
+	assert.NoError(t, transport2.Close())
+}
@@ -0,0 +1,93 @@
+package udptransport2
+
+import (
+	"net"
+
+	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/servertransport"
+	"github.com/peer-calls/peer-calls/v4/server/udpmux"
+)
+
+// udpConnector multiplexes the connections to all nodes over a single UDP
+// socket. The connections are secured with DTLS when it is enabled.
+type udpConnector struct {
+	params *ManagerParams
+	udpMux *udpmux.UDPMux
+
+	conns       chan net.Conn
+	forwardDone chan struct{}
+}
+
+var _ connector = &udpConnector{}
+
+func newUDPConnector(params *ManagerParams) *udpConnector {
+	readChanSize := 100
+
+	udpMux := udpmux.New(udpmux.Params{
+		Conn:           params.Conn,
+		MTU:            uint32(servertransport.ReceiveMTU),
+		Log:            params.Log,
+		ReadChanSize:   readChanSize,
+		ReadBufferSize: 0,
+	})
+
+	c := &udpConnector{
+		params: params,
+		udpMux: udpMux,
+
+		conns:       make(chan net.Conn),
+		forwardDone: make(chan struct{}),
+	}
+
+	go c.forwardConns()
+
+	return c
+}
+
+// forwardConns forwards the conns from udpmux because the channel types
+// differ.
+func (c *udpConnector) forwardConns() {
+	defer close(c.forwardDone)
+	defer close(c.conns)
+
+	for conn := range c.udpMux.Conns() {
+		select {
+		case c.conns <- conn:
+		case <-c.udpMux.Done():
+			conn.Close()
+
+			return
+		}
+	}
+}
+
+func (c *udpConnector) Conns() <-chan net.Conn {
+	return c.conns
+}
+
+func (c *udpConnector) GetConn(raddr net.Addr) (net.Conn, error) {
+	conn, err := c.udpMux.GetConn(raddr)
+
+	return conn, errors.Trace(err)
+}
+
+func (c *udpConnector) NewFactory(conn net.Conn, params FactoryParams) (*Factory, error) {
+	conn, err := c.secureConn(conn)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	params.Conn = conn
+
+	factory, err := NewFactory(params)
+
+	return factory, errors.Trace(err)
+}
+
+func (c *udpConnector) Close() error {
+	err := c.udpMux.Close()
+
+	<-c.forwardDone
+
+	return errors.Trace(err)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"net"
 	"strings"
 	"sync"
@@ -11,22 +12,62 @@ import (
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/message"
 	"github.com/peer-calls/peer-calls/v4/server/pionlogger"
+	"github.com/peer-calls/peer-calls/v4/server/tracing"
 	"github.com/peer-calls/peer-calls/v4/server/transport"
 	"github.com/pion/interceptor"
 	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v3"
 )
 
+// ICEServersFunc returns the current ICE servers, which can change when the
+// config is reloaded.
+type ICEServersFunc func() []ICEServer
+
 type WebRTCTransportFactory struct {
 	log           logger.Logger
-	iceServers    []ICEServer
+	iceServers    ICEServersFunc
 	codecRegistry *codecs.Registry
 	settingEngine webrtc.SettingEngine
+
+	// iceTCPEnabled is true when one of the TCP network types is enabled.
+	iceTCPEnabled bool
+	// iceTCPErr contains the error from starting the ICE TCP listener.
+	iceTCPErr error
+	// iceTCPListener is nil when the ICE TCP listener was not started.
+	iceTCPListener *iceTCPListener
+}
+
+// iceTCPListener keeps the error that stopped the ICE TCP mux from accepting
+// connections.
+type iceTCPListener struct {
+	net.Listener
+
+	mu  sync.Mutex
+	err error
+}
+
+func (l *iceTCPListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		l.mu.Lock()
+		l.err = err
+		l.mu.Unlock()
+	}
+
+	return conn, err // nolint:wrapcheck
+}
+
+// Err returns the error returned by Accept, if any.
+func (l *iceTCPListener) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
 }
 
 func NewWebRTCTransportFactory(
 	log logger.Logger,
-	iceServers []ICEServer,
+	iceServers ICEServersFunc,
 	sfuConfig NetworkConfigSFU,
 ) *WebRTCTransportFactory {
 	allowedInterfaces := map[string]struct{}{}
@@ -58,6 +99,11 @@ func NewWebRTCTransportFactory(
 		}
 	}
 
+	var (
+		tcpErr      error
+		tcpListener *iceTCPListener
+	)
+
 	tcpEnabled := false
 
 	for _, networkType := range networkTypes {
@@ -79,13 +125,21 @@ func NewWebRTCTransportFactory(
 			"remote_addr": tcpAddr,
 		}
 
-		tcpListener, err := net.ListenTCP("tcp", tcpAddr)
+		listener, err := net.ListenTCP("tcp", tcpAddr)
 
 		if err != nil {
+			tcpErr = errors.Annotatef(err, "listen ICE TCP: %s", tcpAddr)
+
 			log.Error("Start TCP listener", errors.Trace(err), logCtx)
 		} else {
 			log.Info("Start TCP listener", logCtx)
 
+			tcpListener = &iceTCPListener{
+				Listener: listener,
+				mu:       sync.Mutex{},
+				err:      nil,
+			}
+
 			logger := settingEngine.LoggerFactory.NewLogger("ice-tcp")
 			settingEngine.SetICETCPMux(webrtc.NewICETCPMux(logger, tcpListener, 32))
 		}
@@ -101,7 +155,31 @@ func NewWebRTCTransportFactory(
 		})
 	}
 
-	return &WebRTCTransportFactory{log, iceServers, registry, settingEngine}
+	return &WebRTCTransportFactory{log, iceServers, registry, settingEngine, tcpEnabled, tcpErr, tcpListener}
+}
+
+// RegisterHealthChecks registers the ICE TCP listener check when ICE TCP is
+// enabled.
+func (f *WebRTCTransportFactory) RegisterHealthChecks(health *Health) {
+	if !f.iceTCPEnabled {
+		return
+	}
+
+	health.Register(HealthCheck{
+		Name: "ice_tcp",
+		Type: HealthCheckTypeReadiness,
+		Check: func(ctx context.Context) error {
+			if f.iceTCPErr != nil {
+				return f.iceTCPErr
+			}
+
+			if err := f.iceTCPListener.Err(); err != nil {
+				return errors.Annotate(err, "accept ICE TCP")
+			}
+
+			return nil
+		},
+	})
 }
 
 func NewMediaEngine() *webrtc.MediaEngine {
@@ -185,14 +263,24 @@ type WebRTCTransport struct {
 	localTracks map[identifiers.TrackID]localTrack
 }
 
+// NewWebRTCTransport creates a new peer connection. The negotiation spans are
+// children of the span from ctx.
 func (f WebRTCTransportFactory) NewWebRTCTransport(
+	ctx context.Context,
 	roomID identifiers.RoomID,
 	clientID identifiers.ClientID,
 	peerID identifiers.PeerID,
-) (*WebRTCTransport, error) {
+	viewer bool,
+) (_ *WebRTCTransport, err error) {
+	ctx, span := tracer.Start(ctx, "WebRTCTransportFactory.NewWebRTCTransport")
+
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	webrtcICEServers := []webrtc.ICEServer{}
 
-	for _, iceServer := range GetICEAuthServers(f.iceServers) {
+	for _, iceServer := range GetClientICEAuthServers(f.iceServers(), clientID) {
 		var c webrtc.ICECredentialType
 		if iceServer.Username != "" && iceServer.Credential != "" {
 			c = webrtc.ICECredentialTypePassword
@@ -236,15 +324,17 @@ func (f WebRTCTransportFactory) NewWebRTCTransport(
 		return nil, errors.Annotate(err, "new peer connection")
 	}
 
-	return NewWebRTCTransport(f.log, roomID, clientID, peerID, true, peerConnection, f.codecRegistry)
+	return NewWebRTCTransport(ctx, f.log, roomID, clientID, peerID, true, viewer, peerConnection, f.codecRegistry)
 }
 
 func NewWebRTCTransport(
+	ctx context.Context,
 	log logger.Logger,
 	roomID identifiers.RoomID,
 	clientID identifiers.ClientID,
 	peerID identifiers.PeerID,
 	initiator bool,
+	viewer bool,
 	peerConnection *webrtc.PeerConnection,
 	codecRegistry *codecs.Registry,
 ) (*WebRTCTransport, error) {
@@ -283,8 +373,10 @@ func NewWebRTCTransport(
 	dataTransceiver := NewDataTransceiver(log, clientID, dataChannel, peerConnection)
 
 	signaller, err := NewSignaller(
+		ctx,
 		log,
 		initiator,
+		viewer,
 		peerConnection,
 	)
 
@@ -335,6 +427,16 @@ func (p *WebRTCTransport) Close() error {
 	return p.signaller.Close()
 }
 
+// Viewer returns true until the viewer is promoted.
+func (p *WebRTCTransport) Viewer() bool {
+	return p.signaller.Viewer()
+}
+
+// Promote renegotiates the connection so that the viewer can publish tracks.
+func (p *WebRTCTransport) Promote() {
+	p.signaller.Promote()
+}
+
 func (p *WebRTCTransport) ClientID() identifiers.ClientID {
 	return p.clientID
 }
@@ -388,6 +490,7 @@ func (p *WebRTCTransport) RemoveTrack(trackID identifiers.TrackID) error {
 }
 
 var _ transport.Transport = &WebRTCTransport{}
+var _ transport.Promotable = &WebRTCTransport{}
 
 func (p *WebRTCTransport) AddTrack(t transport.Track) (transport.TrackLocal, transport.RTCPReader, error) {
 	codec := t.Codec()
@@ -410,11 +513,13 @@ func (p *WebRTCTransport) AddTrack(t transport.Track) (transport.TrackLocal, tra
 
 	trackID := t.TrackID()
 
-	track, err := webrtc.NewTrackLocalStaticRTP(capability, trackID.ID, trackID.StreamID)
+	staticTrack, err := webrtc.NewTrackLocalStaticRTP(capability, trackID.ID, trackID.StreamID)
 	if err != nil {
 		return nil, nil, errors.Annotate(err, "new track")
 	}
 
+	track := newBoundTrackLocal(staticTrack)
+
 	sender, err := p.peerConnection.AddTrack(track)
 	if err != nil {
 		return nil, nil, errors.Annotate(err, "add track")
@@ -442,12 +547,13 @@ func (p *WebRTCTransport) AddTrack(t transport.Track) (transport.TrackLocal, tra
 	trackInfo := transport.NewTrackWithMID(t, mid)
 
 	p.mu.Lock()
-	p.localTracks[t.TrackID()] = localTrack{trackInfo, transceiver, sender, track}
+	p.localTracks[t.TrackID()] = localTrack{trackInfo, transceiver, sender, staticTrack}
 	p.mu.Unlock()
 
 	tt := LocalTrack{
-		TrackLocalStaticRTP: track,
+		TrackLocalStaticRTP: staticTrack,
 		track:               t,
+		bound:               track.bound,
 	}
 
 	return tt, sender, nil
@@ -523,12 +629,49 @@ func (p *WebRTCTransport) Send(message webrtc.DataChannelMessage) <-chan error {
 type LocalTrack struct {
 	*webrtc.TrackLocalStaticRTP
 	track transport.Track
+	bound <-chan struct{}
 }
 
 func (t LocalTrack) Track() transport.Track {
 	return t.track
 }
 
+// Bound returns a channel that will be closed once the track has been bound
+// to the peer connection, after which the written packets will be sent.
+func (t LocalTrack) Bound() <-chan struct{} {
+	return t.bound
+}
+
+// boundTrackLocal notifies when the TrackLocalStaticRTP is bound for the first
+// time. Any packets written to the TrackLocalStaticRTP before that are
+// dropped.
+type boundTrackLocal struct {
+	*webrtc.TrackLocalStaticRTP
+
+	once  sync.Once
+	bound chan struct{}
+}
+
+func newBoundTrackLocal(track *webrtc.TrackLocalStaticRTP) *boundTrackLocal {
+	return &boundTrackLocal{
+		TrackLocalStaticRTP: track,
+		bound:               make(chan struct{}),
+	}
+}
+
+// Bind implements webrtc.TrackLocal.
+func (t *boundTrackLocal) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	codec, err := t.TrackLocalStaticRTP.Bind(ctx)
+	if err == nil {
+		t.once.Do(func() {
+			close(t.bound)
+		})
+	}
+
+	// Do not wrap the error since pion/webrtc might compare it.
+	return codec, err // nolint:wrapcheck
+}
+
 type RemoteTrack struct {
 	*webrtc.TrackRemote
 	track transport.Track
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/peer-calls/peer-calls/v4/server/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCTransportFactory_iceTCPHealth(t *testing.T) {
+	var sfuConfig NetworkConfigSFU
+
+	sfuConfig.Protocols = []string{"tcp4"}
+	sfuConfig.TCPBindAddr = "127.0.0.1"
+
+	f := NewWebRTCTransportFactory(test.NewLogger(), func() []ICEServer { return nil }, sfuConfig)
+	require.NotNil(t, f.iceTCPListener)
+
+	health := NewHealth(test.NewLogger(), HealthConfig{
+		Timeout:       time.Second,
+		MaxGoroutines: 0,
+		MaxRooms:      0,
+	})
+
+	f.RegisterHealthChecks(health)
+
+	report := health.Report(context.Background())
+	assert.True(t, report.Ready)
+
+	require.NoError(t, f.iceTCPListener.Listener.Close())
+
+	assert.Eventually(t, func() bool {
+		return !health.Report(context.Background()).Ready
+	}, time.Second, 10*time.Millisecond, "should fail once the listener stops accepting")
+}
@@ -1,11 +1,13 @@
 package server
 
 import (
+	"context"
 	"sync"
 
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/pion/webrtc/v3"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type TransceiverRequest struct {
@@ -18,21 +20,31 @@ type Negotiator struct {
 
 	initiator            bool
 	peerConnection       *webrtc.PeerConnection
-	onOffer              func(webrtc.SessionDescription, error)
+	onOffer              func(context.Context, webrtc.SessionDescription, error)
 	onRequestNegotiation func()
 
 	negotiationDone   chan struct{}
 	mu                sync.Mutex
 	queuedNegotiation bool
 
+	// traceCtx is the parent of the negotiation spans.
+	traceCtx context.Context
+	// negotiationSpan lasts until the current negotiation is done.
+	negotiationSpan trace.Span
+	// negotiationCtx contains the negotiationSpan.
+	negotiationCtx context.Context
+
 	queuedTransceiverRequests []TransceiverRequest
 }
 
+// NewNegotiator creates a new Negotiator. Each negotiation is recorded as a
+// child span of the span from ctx.
 func NewNegotiator(
+	ctx context.Context,
 	log logger.Logger,
 	initiator bool,
 	peerConnection *webrtc.PeerConnection,
-	onOffer func(webrtc.SessionDescription, error),
+	onOffer func(context.Context, webrtc.SessionDescription, error),
 	onRequestNegotiation func(),
 ) *Negotiator {
 	n := &Negotiator{
@@ -41,6 +53,8 @@ func NewNegotiator(
 		peerConnection:       peerConnection,
 		onOffer:              onOffer,
 		onRequestNegotiation: onRequestNegotiation,
+		traceCtx:             ctx,
+		negotiationCtx:       ctx,
 	}
 
 	peerConnection.OnSignalingStateChange(n.handleSignalingStateChange)
@@ -67,9 +81,22 @@ func (n *Negotiator) closeDoneChannel() {
 	if n.negotiationDone != nil {
 		close(n.negotiationDone)
 		n.negotiationDone = nil
+
+		n.negotiationSpan.End()
+		n.negotiationSpan = nil
+		n.negotiationCtx = n.traceCtx
 	}
 }
 
+// TraceContext returns the context with the span of the current negotiation,
+// or the parent context when there is no negotiation in progress.
+func (n *Negotiator) TraceContext() context.Context {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.negotiationCtx
+}
+
 func (n *Negotiator) Done() <-chan struct{} {
 	n.mu.Lock()
 	defer n.mu.Unlock()
@@ -122,6 +149,7 @@ func (n *Negotiator) Negotiate() (done <-chan struct{}) {
 
 	n.log.Info("Negotiate: start", nil)
 	n.negotiationDone = make(chan struct{})
+	n.negotiationCtx, n.negotiationSpan = tracer.Start(n.traceCtx, "Negotiator.negotiate")
 
 	n.negotiate()
 	return n.negotiationDone
@@ -158,7 +186,7 @@ func (n *Negotiator) negotiate() {
 
 	offer, err := n.peerConnection.CreateOffer(nil)
 
-	n.onOffer(offer, errors.Annotate(err, "create offer"))
+	n.onOffer(n.negotiationCtx, offer, errors.Annotate(err, "create offer"))
 }
 
 func (n *Negotiator) requestNegotiation() {
@@ -1,13 +1,18 @@
 package server
 
 import (
+	"context"
 	"sync"
+	"sync/atomic"
 
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/message"
+	"github.com/peer-calls/peer-calls/v4/server/tracing"
 	"github.com/peer-calls/peer-calls/v4/server/transport"
 	"github.com/pion/webrtc/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Signaller struct {
@@ -17,6 +22,10 @@ type Signaller struct {
 	initiator      bool
 	negotiator     *Negotiator
 
+	// viewer is set until the webinar viewer is promoted. The transceivers for
+	// receiving the tracks of the remote peer are not added to viewers.
+	viewer atomic.Bool
+
 	signalMu      sync.Mutex
 	closed        bool
 	signalChannel chan message.Signal
@@ -25,15 +34,30 @@ type Signaller struct {
 
 	descriptionSent     chan struct{}
 	descriptionSentOnce sync.Once
+
+	// traceCtx is the parent of the spans started by the signaller.
+	traceCtx context.Context
+	// iceSpan lasts until the ICE connection is established or fails.
+	iceSpan        trace.Span
+	iceSpanEndOnce sync.Once
 }
 
+// NewSignaller creates a new Signaller. The spans of the ICE connection and
+// of the offer/answer rounds are children of the span from ctx. The remote
+// peer of a viewer Signaller can only receive tracks until Promote is called.
 func NewSignaller(
+	ctx context.Context,
 	log logger.Logger,
 	initiator bool,
+	viewer bool,
 	peerConnection *webrtc.PeerConnection,
 ) (*Signaller, error) {
 	log = log.WithNamespaceAppended("signaller")
 
+	traceCtx := tracing.Detach(ctx)
+
+	_, iceSpan := tracer.Start(traceCtx, "Signaller.connectICE")
+
 	s := &Signaller{
 		log:             log,
 		initiator:       initiator,
@@ -41,9 +65,14 @@ func NewSignaller(
 		signalChannel:   make(chan message.Signal),
 		closeChannel:    make(chan struct{}),
 		descriptionSent: make(chan struct{}),
+		traceCtx:        traceCtx,
+		iceSpan:         iceSpan,
 	}
 
+	s.viewer.Store(viewer)
+
 	negotiator := NewNegotiator(
+		traceCtx,
 		log,
 		initiator,
 		peerConnection,
@@ -70,6 +99,13 @@ func (s *Signaller) SignalChannel() <-chan message.Signal {
 }
 
 func (s *Signaller) initialize() error {
+	if s.initiator && s.viewer.Load() {
+		s.log.Info("Negotiate as viewer", nil)
+		s.negotiator.Negotiate()
+
+		return nil
+	}
+
 	if s.initiator {
 		s.log.Debug("Pre-add video transceiver", nil)
 		_, err := s.peerConnection.AddTransceiverFromKind(
@@ -104,11 +140,50 @@ func (s *Signaller) Initiator() bool {
 	return s.initiator
 }
 
+// Viewer returns true until the viewer is promoted.
+func (s *Signaller) Viewer() bool {
+	return s.viewer.Load()
+}
+
+// Promote adds the transceivers for receiving the tracks of the viewer and
+// renegotiates. It does nothing when the remote peer is not a viewer.
+func (s *Signaller) Promote() {
+	if !s.viewer.CompareAndSwap(true, false) {
+		return
+	}
+
+	s.log.Info("Promote viewer", nil)
+
+	for _, codecType := range []webrtc.RTPCodecType{
+		webrtc.RTPCodecTypeVideo,
+		webrtc.RTPCodecTypeAudio,
+	} {
+		s.negotiator.AddTransceiverFromKind(TransceiverRequest{
+			CodecType: codecType,
+			Init: webrtc.RtpTransceiverInit{
+				Direction: webrtc.RTPTransceiverDirectionRecvonly,
+			},
+		})
+	}
+}
+
 func (s *Signaller) handleICEConnectionStateChange(connectionState webrtc.ICEConnectionState) {
 	s.log.Info("Peer connection state changed", logger.Ctx{
 		"connection_state": connectionState,
 	})
 
+	s.iceSpan.AddEvent("ICE connection state changed", trace.WithAttributes(
+		attribute.String("connection_state", connectionState.String()),
+	))
+
+	// nolint:exhaustive
+	switch connectionState {
+	case webrtc.ICEConnectionStateConnected, webrtc.ICEConnectionStateCompleted:
+		s.endICESpan(nil)
+	case webrtc.ICEConnectionStateFailed:
+		s.endICESpan(errors.Errorf("ICE connection failed"))
+	}
+
 	if connectionState == webrtc.ICEConnectionStateClosed ||
 		connectionState == webrtc.ICEConnectionStateDisconnected ||
 		connectionState == webrtc.ICEConnectionStateFailed {
@@ -116,6 +191,12 @@ func (s *Signaller) handleICEConnectionStateChange(connectionState webrtc.ICECon
 	}
 }
 
+func (s *Signaller) endICESpan(err error) {
+	s.iceSpanEndOnce.Do(func() {
+		tracing.End(s.iceSpan, err)
+	})
+}
+
 func (s *Signaller) onSignal(payload message.Signal) {
 	s.signalMu.Lock()
 
@@ -158,6 +239,7 @@ func (s *Signaller) Close() (err error) {
 		err = errors.Annotate(s.peerConnection.Close(), "close")
 	})
 	s.closeDescriptionSent()
+	s.endICESpan(nil)
 	return
 }
 
@@ -211,6 +293,11 @@ func (s *Signaller) Signal(signal message.Signal) error {
 		s.log.Trace("Remote transceiver request", logger.Ctx{
 			"transceiver_kind": signal.TransceiverRequest.Kind,
 		})
+
+		if s.viewer.Load() {
+			return errors.Annotatef(ErrForbidden, "transceiver request from viewer")
+		}
+
 		s.handleTransceiverRequest(*signal.TransceiverRequest)
 		return nil
 	case sdpTypeOK:
@@ -253,6 +340,12 @@ func (s *Signaller) handleRemoteSDP(sessionDescription webrtc.SessionDescription
 }
 
 func (s *Signaller) handleRemoteOffer(sessionDescription webrtc.SessionDescription) (err error) {
+	_, span := tracer.Start(s.traceCtx, "Signaller.handleRemoteOffer")
+
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	if err = s.peerConnection.SetRemoteDescription(sessionDescription); err != nil {
 		return errors.Annotate(err, "set remote description")
 	}
@@ -292,7 +385,13 @@ func (s *Signaller) handleLocalRequestNegotiation() {
 	})
 }
 
-func (s *Signaller) handleLocalOffer(offer webrtc.SessionDescription, err error) {
+func (s *Signaller) handleLocalOffer(ctx context.Context, offer webrtc.SessionDescription, err error) {
+	_, span := tracer.Start(ctx, "Signaller.handleLocalOffer")
+
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	if err != nil {
 		s.log.Error("Local signal", errors.Trace(err), nil)
 		// TODO abort connection
@@ -313,7 +412,8 @@ func (s *Signaller) handleLocalOffer(offer webrtc.SessionDescription, err error)
 
 	signalType, ok := message.NewSignalTypeFromSDPType(offer.Type)
 	if !ok {
-		s.log.Error("Unfamiliar offer type", errors.Errorf("type: %s", offer.Type.String()), nil)
+		err = errors.Errorf("type: %s", offer.Type.String())
+		s.log.Error("Unfamiliar offer type", err, nil)
 		return
 	}
 
@@ -358,6 +458,12 @@ func (s *Signaller) Negotiate() <-chan struct{} {
 }
 
 func (s *Signaller) handleRemoteAnswer(sessionDescription webrtc.SessionDescription) (err error) {
+	_, span := tracer.Start(s.negotiator.TraceContext(), "Signaller.handleRemoteAnswer")
+
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	if err = s.peerConnection.SetRemoteDescription(sessionDescription); err != nil {
 		return errors.Annotate(err, "set remote description")
 	}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"time"
+
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 	"github.com/peer-calls/peer-calls/v4/server/message"
@@ -22,6 +24,19 @@ type Adapter interface {
 	Emit(clientID identifiers.ClientID, msg message.Message) error
 	Clients() (map[identifiers.ClientID]string, error)
 	Size() (int, error)
+	// AddChat adds the chat message to the history of the room, keeping at
+	// most maxLen messages. The messages older than maxAge may be removed
+	// when it is set.
+	AddChat(chat message.Chat, maxLen int, maxAge time.Duration) error
+	// ChatHistory returns the chat messages of the room, oldest first.
+	ChatHistory() ([]message.Chat, error)
+	// Network returns the network of the room in the hybrid network, or an
+	// empty string when it is not set.
+	Network() (string, error)
+	// SetNetwork sets the network of the room in the hybrid network and
+	// returns the previous one. An empty network removes it. The network is
+	// shared by all nodes, so only one of them sees each switch.
+	SetNetwork(network string) (string, error)
 	Close() error
 }
 
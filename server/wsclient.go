@@ -34,10 +34,10 @@ type WSReadWriter interface {
 
 // An abstraction for sending out to websocket using channels.
 type Client struct {
-	id         identifiers.ClientID
-	conn       WSReadWriter
-	metadata   string
-	serializer ByteSerializer
+	id       identifiers.ClientID
+	conn     WSReadWriter
+	metadata string
+	format   WireFormat
 
 	messages  chan message.Message
 	closed    chan struct{}
@@ -53,6 +53,12 @@ func NewClient(conn WSReadWriter) *Client {
 }
 
 func NewClientWithID(conn WSReadWriter, id identifiers.ClientID) *Client {
+	return NewClientWithWireFormat(conn, id, JSONWireFormat)
+}
+
+// NewClientWithWireFormat creates a new websocket client that sends and
+// receives the messages in the format, see NewWireFormat.
+func NewClientWithWireFormat(conn WSReadWriter, id identifiers.ClientID, format WireFormat) *Client {
 	if id == "" {
 		id = identifiers.ClientID(uuid.New())
 	}
@@ -60,6 +66,7 @@ func NewClientWithID(conn WSReadWriter, id identifiers.ClientID) *Client {
 	c := &Client{
 		id:       id,
 		conn:     conn,
+		format:   format,
 		messages: make(chan message.Message),
 		closed:   make(chan struct{}),
 	}
@@ -79,12 +86,15 @@ func (c *Client) Metadata() string {
 
 // Writes a message to websocket.
 func (c *Client) WriteCtx(ctx context.Context, msg message.Message) error {
-	data, err := c.serializer.Serialize(msg)
+	// The trace context is only used between nodes.
+	msg.TraceContext = nil
+
+	data, err := c.format.Serializer.Serialize(msg)
 	if err != nil {
 		return errors.Annotate(err, "serialize")
 	}
 
-	err = c.conn.Write(ctx, websocket.MessageText, data)
+	err = c.conn.Write(ctx, c.format.MessageType, data)
 	return errors.Annotate(err, "write")
 }
 
@@ -111,13 +121,13 @@ func (c *Client) read(ctx context.Context) (msg message.Message, err error) {
 		return msg, errors.Annotate(err, "read")
 	}
 
-	msg, err = c.serializer.Deserialize(data)
+	msg, err = c.format.Deserializer.Deserialize(data)
 	if err != nil {
 		return msg, errors.Annotate(err, "deserialize")
 	}
 
-	if typ != websocket.MessageText {
-		return msg, errors.Errorf("unexpected text message type, but got %s", typ)
+	if typ != c.format.MessageType {
+		return msg, errors.Errorf("expected %s message type, but got %s", c.format.MessageType, typ)
 	}
 
 	return msg, nil
@@ -2,11 +2,26 @@ package server
 
 import (
 	"encoding/json"
+	"strings"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/juju/errors"
 	"github.com/peer-calls/peer-calls/v4/server/message"
+	"nhooyr.io/websocket"
 )
 
+const (
+	// SubprotocolJSON is the websocket subprotocol for JSON text messages. It
+	// is also used when the client does not request a subprotocol.
+	SubprotocolJSON = "peercalls.json"
+	// SubprotocolCBOR is the websocket subprotocol for CBOR binary messages.
+	SubprotocolCBOR = "peercalls.cbor"
+)
+
+// Subprotocols lists the supported websocket subprotocols in the order of
+// preference.
+var Subprotocols = []string{SubprotocolCBOR, SubprotocolJSON}
+
 type Serializer interface {
 	Serialize(message.Message) ([]byte, error)
 }
@@ -15,6 +30,7 @@ type Deserializer interface {
 	Deserialize([]byte) (message.Message, error)
 }
 
+// ByteSerializer serializes the messages to JSON.
 type ByteSerializer struct{}
 
 func (s ByteSerializer) Serialize(m message.Message) ([]byte, error) {
@@ -26,3 +42,65 @@ func (s ByteSerializer) Deserialize(data []byte) (msg message.Message, err error
 	err = json.Unmarshal(data, &msg)
 	return msg, errors.Annotate(err, "deserialize")
 }
+
+// CBORSerializer serializes the messages to CBOR, which is more compact than
+// JSON.
+type CBORSerializer struct{}
+
+func (s CBORSerializer) Serialize(m message.Message) ([]byte, error) {
+	b, err := cbor.Marshal(m)
+	return b, errors.Annotate(err, "serialize")
+}
+
+func (s CBORSerializer) Deserialize(data []byte) (msg message.Message, err error) {
+	err = cbor.Unmarshal(data, &msg)
+	return msg, errors.Annotate(err, "deserialize")
+}
+
+// AnyDeserializer deserializes both JSON and CBOR messages. A JSON message
+// is always an object, while a CBOR message is always an array, so the
+// format is detected from the first byte. This allows reading the messages
+// published by the nodes that have not been upgraded yet.
+type AnyDeserializer struct{}
+
+func (s AnyDeserializer) Deserialize(data []byte) (message.Message, error) {
+	if len(data) > 0 && data[0] == '{' {
+		msg, err := ByteSerializer{}.Deserialize(data)
+		return msg, errors.Trace(err)
+	}
+
+	msg, err := CBORSerializer{}.Deserialize(data)
+
+	return msg, errors.Trace(err)
+}
+
+// WireFormat defines how the messages are sent over the websocket.
+type WireFormat struct {
+	Serializer   Serializer
+	Deserializer Deserializer
+	MessageType  websocket.MessageType
+}
+
+// JSONWireFormat sends JSON text messages.
+var JSONWireFormat = WireFormat{
+	Serializer:   ByteSerializer{},
+	Deserializer: ByteSerializer{},
+	MessageType:  websocket.MessageText,
+}
+
+// CBORWireFormat sends CBOR binary messages.
+var CBORWireFormat = WireFormat{
+	Serializer:   CBORSerializer{},
+	Deserializer: CBORSerializer{},
+	MessageType:  websocket.MessageBinary,
+}
+
+// NewWireFormat returns the WireFormat for the negotiated websocket
+// subprotocol. JSONWireFormat is used for an empty or unknown subprotocol.
+func NewWireFormat(subprotocol string) WireFormat {
+	if strings.EqualFold(subprotocol, SubprotocolCBOR) {
+		return CBORWireFormat
+	}
+
+	return JSONWireFormat
+}
@@ -0,0 +1,38 @@
+package server_test
+
+import (
+	"testing"
+
+	"github.com/peer-calls/peer-calls/v4/server"
+	"github.com/peer-calls/peer-calls/v4/server/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+)
+
+func TestAnyDeserializer(t *testing.T) {
+	msg := message.NewReady("test-room", message.Ready{
+		Nickname: "abc",
+	})
+
+	serializers := []server.Serializer{
+		server.ByteSerializer{},
+		server.CBORSerializer{},
+	}
+
+	for _, s := range serializers {
+		data, err := s.Serialize(msg)
+		require.NoError(t, err)
+
+		msg2, err := server.AnyDeserializer{}.Deserialize(data)
+		require.NoError(t, err)
+
+		assert.Equal(t, msg, msg2)
+	}
+}
+
+func TestNewWireFormat(t *testing.T) {
+	assert.Equal(t, websocket.MessageBinary, server.NewWireFormat(server.SubprotocolCBOR).MessageType)
+	assert.Equal(t, websocket.MessageText, server.NewWireFormat(server.SubprotocolJSON).MessageType)
+	assert.Equal(t, websocket.MessageText, server.NewWireFormat("").MessageType)
+}
@@ -1,29 +1,130 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
 	"net/http"
 	"path"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/juju/errors"
+	"github.com/peer-calls/peer-calls/v4/server/clock"
 	"github.com/peer-calls/peer-calls/v4/server/identifiers"
 	"github.com/peer-calls/peer-calls/v4/server/logger"
 	"github.com/peer-calls/peer-calls/v4/server/message"
 	"github.com/peer-calls/peer-calls/v4/server/multierr"
+	"github.com/peer-calls/peer-calls/v4/server/quota"
+	"github.com/peer-calls/peer-calls/v4/server/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"nhooyr.io/websocket"
 )
 
+// StatusPongTimeout is the close status of the connections that did not
+// respond to the pings in time.
+const StatusPongTimeout websocket.StatusCode = 4000
+
+var (
+	// ErrRoomFull is returned when the room already has the maximum number of
+	// clients.
+	ErrRoomFull = errors.New("room is full")
+	// ErrTooManyRooms is returned when a new room cannot be created because
+	// the node already has the maximum number of rooms.
+	ErrTooManyRooms = errors.New("too many rooms")
+)
+
 type WSS struct {
-	log   logger.Logger
-	rooms RoomManager
+	params *WSSParams
+	log    logger.Logger
+	clock  clock.Clock
+	sse    *sseSessions
+
+	// activeRooms is the number of rooms on this node.
+	activeRooms atomic.Int64
 }
 
-func NewWSS(log logger.Logger, rooms RoomManager) *WSS {
+// WSSParams are parameters for WSS.
+type WSSParams struct {
+	Log       logger.Logger
+	Rooms     RoomManager
+	Drain     *Drain
+	Heartbeat HeartbeatConfig
+	Limits    LimitsConfig
+	Webinar   WebinarConfig
+	Chat      ChatConfig
+	// Quota counts the clients in the rooms. The clients are only counted on
+	// this node when it is nil.
+	Quota quota.Quota
+	// Breakouts handles the breakout messages of the presenters. The messages
+	// are rejected when it is nil.
+	Breakouts *Breakouts
+}
+
+func NewWSS(params WSSParams) *WSS {
+	if params.Quota == nil {
+		params.Quota = quota.NewMemory()
+	}
+
 	return &WSS{
-		log:   log.WithNamespaceAppended("wss"),
-		rooms: rooms,
+		params: &params,
+		log:    params.Log.WithNamespaceAppended("wss"),
+		clock:  clock.New(),
+		sse:    newSSESessions(),
+	}
+}
+
+// enterRoom enters the room and counts the rooms on this node.
+func (wss *WSS) enterRoom(room identifiers.RoomID) (adapter Adapter, isNew bool) {
+	adapter, isNew = wss.params.Rooms.Enter(room)
+	if isNew {
+		wss.activeRooms.Add(1)
+	}
+
+	return adapter, isNew
+}
+
+// exitRoom exits the room entered by enterRoom.
+func (wss *WSS) exitRoom(room identifiers.RoomID) {
+	if wss.params.Rooms.Exit(room) {
+		wss.activeRooms.Add(-1)
+	}
+}
+
+// clientsQuotaKey returns the quota key of the clients in the room.
+func clientsQuotaKey(room identifiers.RoomID) string {
+	return "room:" + room.String() + ":clients"
+}
+
+// clientRole returns the role of the client in a webinar room. The client is
+// a presenter when it has the access token configured for its ID, or the
+// presenter access token of the room. The role is empty for other rooms.
+func (wss *WSS) clientRole(r *http.Request, room identifiers.RoomID, clientID identifiers.ClientID) message.ClientRole {
+	config, ok := wss.params.Webinar.Rooms[room]
+	if !ok {
+		return ""
+	}
+
+	token := []byte(accessToken(r))
+
+	for _, want := range []string{config.Presenters[clientID], config.PresenterAccessToken} {
+		if want != "" && subtle.ConstantTimeCompare(token, []byte(want)) == 1 {
+			return message.ClientRolePresenter
+		}
+	}
+
+	return message.ClientRoleViewer
+}
+
+// rejectClient sends msg to the client before closing the connection. It is
+// used before the client has been added to the room.
+func rejectClient(log logger.Logger, client *Client, msg message.Message, reason error) {
+	if err := client.Write(msg); err != nil {
+		log.Error("Write reject message", errors.Trace(err), nil)
 	}
+
+	client.Close(websocket.StatusTryAgainLater, reason.Error())
 }
 
 type WebsocketContext struct {
@@ -32,6 +133,14 @@ type WebsocketContext struct {
 	client    *Client
 	onClose   func()
 	closeOnce sync.Once
+
+	log         logger.Logger
+	clock       clock.Clock
+	heartbeat   HeartbeatConfig
+	chat        ChatConfig
+	breakouts   *Breakouts
+	role        message.ClientRole
+	spanContext trace.SpanContext
 }
 
 // NewWebsocketContext initializes the new websocket context. Users must call
@@ -57,6 +166,23 @@ func (w *WebsocketContext) RoomID() identifiers.RoomID {
 	return w.roomID
 }
 
+// SpanContext returns the span of the websocket accept, which should be the
+// parent of the spans started while handling the messages.
+func (w *WebsocketContext) SpanContext() trace.SpanContext {
+	return w.spanContext
+}
+
+// Role returns the role of the client in a webinar room. It is empty for
+// other rooms.
+func (w *WebsocketContext) Role() message.ClientRole {
+	return w.role
+}
+
+// Breakouts returns the breakouts the presenters can start and end, or nil.
+func (w *WebsocketContext) Breakouts() *Breakouts {
+	return w.breakouts
+}
+
 // ClientID return sthe client identifier.
 func (w *WebsocketContext) ClientID() identifiers.ClientID {
 	return w.client.ID()
@@ -67,6 +193,58 @@ func (w *WebsocketContext) Messages() <-chan message.Message {
 	return w.client.Messages()
 }
 
+// StartHeartbeat starts sending pings to the client until ctx is done. The
+// connection is closed with StatusPongTimeout when the client stops
+// responding, which closes the Messages channel. The handlers must pass the
+// pongs to the returned Pinger.
+func (w *WebsocketContext) StartHeartbeat(ctx context.Context) *Pinger {
+	interval := w.heartbeat.Interval
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+
+	return NewPinger(ctx, PingerParams{
+		Clock:    w.clock,
+		Interval: interval,
+		Timeout:  w.heartbeat.Timeout,
+		Ping: func() {
+			if err := w.adapter.Emit(w.ClientID(), message.NewPing(w.roomID)); err != nil {
+				w.log.Error("Send ping", errors.Trace(err), nil)
+			}
+		},
+		OnTimeout: func() {
+			w.log.Warn("Pong timeout, closing connection", logger.Ctx{
+				"timeout": w.heartbeat.Timeout,
+			})
+
+			// Only the connection is closed here. The handler still does the
+			// cleanup after the Messages channel is closed.
+			if err := w.client.Close(StatusPongTimeout, "pong timeout"); err != nil {
+				w.log.Error("Close on pong timeout", errors.Trace(err), nil)
+			}
+		},
+	})
+}
+
+// StartChat sends the chat history of the room to the client. The handlers
+// must pass the chat messages to the returned Chat.
+func (w *WebsocketContext) StartChat() *Chat {
+	chat := NewChat(ChatParams{
+		Log:      w.log,
+		Clock:    w.clock,
+		Adapter:  w.adapter,
+		RoomID:   w.roomID,
+		ClientID: w.ClientID(),
+		Config:   w.chat,
+	})
+
+	if err := chat.SendHistory(); err != nil {
+		w.log.Error("Send chat history", errors.Trace(err), nil)
+	}
+
+	return chat
+}
+
 // Close invokes the Close method on the underlying connection. It also invokes
 // the onClose handler.
 func (w *WebsocketContext) Close(statusCode websocket.StatusCode, reason string) error {
@@ -80,30 +258,135 @@ func (w *WebsocketContext) Close(statusCode websocket.StatusCode, reason string)
 // NewWebsocketContext initializes a new websocket connection. Users must
 // remember to call WebsocketContext.Close after they are done with the
 // connection.
-func (wss *WSS) NewWebsocketContext(w http.ResponseWriter, r *http.Request) (*WebsocketContext, error) {
-	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
-		CompressionMode: websocket.CompressionDisabled,
-	})
-	if err != nil {
-		prometheusWSConnErrTotal.Inc()
+func (wss *WSS) NewWebsocketContext(w http.ResponseWriter, r *http.Request) (_ *WebsocketContext, err error) {
+	ctx, span := startHTTPSpan(r, "WSS.NewWebsocketContext")
+
+	defer func() {
+		tracing.End(span, err)
+	}()
 
-		w.WriteHeader(http.StatusInternalServerError)
+	var (
+		conn    WSReadWriter
+		format  WireFormat
+		sseConn *sseConn
+	)
 
-		return nil, errors.Annotatef(err, "accept websocket connection")
+	if isSSERequest(r) {
+		sseConn, err = acceptSSE(w, r, wss.sse.newSessionID())
+		if err != nil {
+			prometheusWSConnErrTotal.Inc()
+
+			return nil, errors.Annotatef(err, "accept sse connection")
+		}
+
+		conn = sseConn
+		format = JSONWireFormat
+
+		span.SetAttributes(attribute.String("transport", "sse"))
+	} else {
+		var c *websocket.Conn
+
+		c, err = websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols:    Subprotocols,
+			CompressionMode: websocket.CompressionDisabled,
+		})
+		if err != nil {
+			prometheusWSConnErrTotal.Inc()
+
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return nil, errors.Annotatef(err, "accept websocket connection")
+		}
+
+		conn = c
+		format = NewWireFormat(c.Subprotocol())
+
+		span.SetAttributes(
+			attribute.String("transport", "websocket"),
+			attribute.String("subprotocol", c.Subprotocol()),
+		)
 	}
 
 	clientID := identifiers.ClientID(path.Base(r.URL.Path))
 	room := identifiers.RoomID(path.Base(path.Dir(r.URL.Path)))
 
+	span.SetAttributes(
+		attribute.String("room_id", room.String()),
+		attribute.String("client_id", clientID.String()),
+	)
+
 	log := wss.log.WithCtx(logger.Ctx{
 		"client_id": clientID,
 		"room_id":   room,
 	})
 
 	log.Info("Enter", nil)
-	adapter, _ := wss.rooms.Enter(room)
+	adapter, isNew := wss.enterRoom(room)
 
-	client := NewClientWithID(c, clientID)
+	client := NewClientWithWireFormat(conn, clientID, format)
+
+	if isNew && wss.params.Drain.Draining() {
+		log.Info("Reject new room while draining", nil)
+
+		wss.exitRoom(room)
+
+		// Let the client know where to reconnect before closing.
+		rejectClient(log, client, message.NewDrain(room, message.Drain{
+			URL: wss.params.Drain.AlternateURL(),
+		}), ErrDraining)
+
+		return nil, errors.Annotatef(ErrDraining, "enter room: %s", room)
+	}
+
+	limits := wss.params.Limits
+
+	if isNew && limits.MaxRooms > 0 && wss.activeRooms.Load() > int64(limits.MaxRooms) {
+		log.Info("Reject new room, too many rooms", nil)
+
+		wss.exitRoom(room)
+
+		rejectClient(log, client, message.NewError(room, "", message.Error{
+			Code:        message.ErrorCodeQuotaExceeded,
+			Message:     ErrTooManyRooms.Error(),
+			RequestType: "",
+		}), ErrTooManyRooms)
+
+		return nil, errors.Annotatef(ErrTooManyRooms, "enter room: %s: limit %d", room, limits.MaxRooms)
+	}
+
+	if limits.MaxClientsPerRoom > 0 {
+		err = wss.params.Quota.Acquire(clientsQuotaKey(room), clientID.String(), limits.MaxClientsPerRoom)
+		if errors.Cause(err) == quota.ErrExceeded {
+			err = errors.Annotatef(ErrRoomFull, "enter room: %s: limit %d", room, limits.MaxClientsPerRoom)
+		}
+
+		if err != nil {
+			log.Info("Reject client", logger.Ctx{
+				"err": err,
+			})
+
+			wss.exitRoom(room)
+
+			rejectClient(log, client, message.NewError(room, "", message.Error{
+				Code:        errorCode(err),
+				Message:     ErrRoomFull.Error(),
+				RequestType: "",
+			}), ErrRoomFull)
+
+			return nil, errors.Trace(err)
+		}
+	}
+
+	// releaseClient releases the quota acquired above, if any.
+	releaseClient := func() {
+		if limits.MaxClientsPerRoom == 0 {
+			return
+		}
+
+		if err := wss.params.Quota.Release(clientsQuotaKey(room), clientID.String()); err != nil {
+			log.Error("Release client quota", errors.Trace(err), nil)
+		}
+	}
 
 	log.Info("New websocket connection", nil)
 
@@ -111,16 +394,42 @@ func (wss *WSS) NewWebsocketContext(w http.ResponseWriter, r *http.Request) (*We
 	prometheusWSConnActive.Inc()
 	start := time.Now()
 
-	err = adapter.Add(client)
+	err = adapter.Add(newBreakoutWriter(log, client))
 	if multierr.Is(err, ErrDuplicateClientID) {
+		// The quota is not released because the client ID is still used by the
+		// existing connection.
 		client.Close(websocket.StatusPolicyViolation, ErrDuplicateClientID.Error())
 		return nil, errors.Annotatef(err, "adapter add - duplicate client id")
 	} else if err != nil {
+		releaseClient()
 		client.Close(websocket.StatusInternalError, "internal error")
 		return nil, errors.Annotatef(err, "adapter add")
 	}
 
+	if sseConn != nil {
+		wss.sse.add(sseSession{
+			roomID:   room,
+			clientID: clientID,
+			conn:     sseConn,
+		})
+	}
+
+	removeCall := wss.params.Drain.AddCall(func(alternateURL string) {
+		err := adapter.Emit(clientID, message.NewDrain(room, message.Drain{
+			URL: alternateURL,
+		}))
+		if err != nil {
+			log.Error("Emit drain", errors.Trace(err), nil)
+		}
+	})
+
 	websocketCtx := NewWebsocketContext(adapter, client, room, func() {
+		removeCall()
+
+		if sseConn != nil {
+			wss.sse.remove(sseConn.sessionID)
+		}
+
 		prometheusWSConnActive.Dec()
 		duration := time.Since(start)
 		prometheusWSConnDuration.Observe(duration.Seconds())
@@ -132,9 +441,19 @@ func (wss *WSS) NewWebsocketContext(w http.ResponseWriter, r *http.Request) (*We
 			log.Info("Remove", nil)
 		}
 
+		releaseClient()
+
 		log.Info("Exit", nil)
-		wss.rooms.Exit(room)
+		wss.exitRoom(room)
 	})
 
+	websocketCtx.log = log
+	websocketCtx.clock = wss.clock
+	websocketCtx.heartbeat = wss.params.Heartbeat
+	websocketCtx.chat = wss.params.Chat
+	websocketCtx.breakouts = wss.params.Breakouts
+	websocketCtx.role = wss.clientRole(r, room, clientID)
+	websocketCtx.spanContext = trace.SpanContextFromContext(ctx)
+
 	return websocketCtx, nil
 }
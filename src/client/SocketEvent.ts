@@ -59,4 +59,90 @@ export interface SocketEvent {
   connect: undefined
   disconnect: undefined
   ready: Ready
+  // drain is sent when the server is shutting down.
+  drain: {
+    // url is the origin of the node to reconnect to, if any.
+    url: string
+  }
+  // promote is sent by a presenter to let a viewer publish in a webinar room.
+  promote: {
+    peerId: string
+  }
+  // role is sent in webinar rooms when a client is ready or promoted.
+  role: {
+    peerId: string
+    role: ClientRole
+  }
+  // switchNetwork is sent in hybrid rooms on connect and when the room
+  // switches between mesh and SFU.
+  switchNetwork: {
+    network: Network
+  }
+  // chat is sent to the server with the message only, and broadcast to the
+  // room with the other fields set by the server.
+  chat: ChatMessage
+  // chatHistory is sent by the server when the client connects.
+  chatHistory: {
+    messages: ChatMessage[]
+  }
+  // breakout is sent when the client is moved to a breakout room, or back to
+  // the parent room.
+  breakout: {
+    room: string
+    parent: string
+    // endsAt is the unix time in milliseconds, 0 when moving back to the
+    // parent room.
+    endsAt: number
+  }
+  // startBreakout is sent by a presenter to move the clients of a webinar
+  // room to breakout rooms.
+  startBreakout: {
+    // rooms contains the peer IDs moved to each breakout room, keyed by the
+    // name of the room.
+    rooms: Record<string, string[]>
+    // duration is in milliseconds.
+    duration: number
+  }
+  // endBreakout is sent by a presenter to bring the clients back from the
+  // breakout rooms.
+  endBreakout: Record<string, never>
+  // error is sent when the server failed to handle a message.
+  error: {
+    code: ErrorCode
+    message: string
+    requestType: string
+  }
 }
+
+// ChatMessage maps to message.Chat.
+export interface ChatMessage {
+  peerId: string
+  nickname: string
+  message: string
+  // timestamp is the unix time in milliseconds.
+  timestamp: number
+}
+
+// DataEnvelope maps to sfu.DataEnvelope. It is sent as a text message on the
+// SFU data channel.
+export interface DataEnvelope {
+  type: 'all' | 'peer' | 'topic' | 'sub' | 'unsub'
+  // to is the peer ID for 'peer', and the topic for the other types.
+  to?: string
+  // from is set by the server.
+  from?: string
+  data?: unknown
+}
+
+// ErrorCode maps to message.ErrorCode.
+export type ErrorCode =
+  'invalidMessage' | 'unexpectedMessage' | 'notFound' | 'quotaExceeded' |
+  'forbidden' | 'internal'
+
+// Network maps to server.NetworkType, except for the hybrid network which is
+// always either mesh or SFU for a single room.
+export type Network = 'mesh' | 'sfu'
+
+// ClientRole maps to message.ClientRole.
+export type ClientRole = 'presenter' | 'speaker' | 'viewer'
+
@@ -77,6 +77,8 @@ window.navigator.mediaDevices.getUserMedia = async () => {
 
 export class RTCRtpReceiver {}
 
+export const navigate = jest.fn()
+
 // export const play = jest.fn()
 
 export const valueOf = jest.fn()
@@ -90,6 +92,7 @@ export const config: ClientConfig = {
     encodedInsertableStreams: true,
   },
   network: 'sfu',
+  signaling: 'auto',
   nickname: 'nick1234',
 }
 
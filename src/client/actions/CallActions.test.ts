@@ -9,6 +9,7 @@ import socket from '../socket'
 import { bindActionCreators, createStore, AnyAction, combineReducers, applyMiddleware } from 'redux'
 import { middlewares } from '../middlewares'
 
+import network from '../reducers/network'
 import { Nicknames } from '../reducers/nicknames'
 
 jest.useFakeTimers()
@@ -50,7 +51,7 @@ describe('CallActions', () => {
   }
 
   const configureStore = () => createStore(
-    combineReducers({ media, nicknames, allActions }),
+    combineReducers({ media, network, nicknames, allActions }),
     applyMiddleware(...middlewares),
   )
 
@@ -167,6 +168,121 @@ describe('CallActions', () => {
       })
     })
 
+    describe('switchNetwork', () => {
+      async function connect() {
+        setup()
+
+        const promise = callActions.init()
+        socket.emit('connect', undefined)
+        await promise
+
+        ;(SocketActions.handshake as jest.Mock).mockClear()
+      }
+
+      function switchNetwork(network: 'mesh' | 'sfu') {
+        socket.emit(constants.SOCKET_EVENT_SWITCH_NETWORK, { network })
+      }
+
+      function countActions(type: string) {
+        return store.getState().allActions.filter(a => a.type === type).length
+      }
+
+      it('only sets the network before the call is dialled', async () => {
+        await connect()
+
+        switchNetwork('mesh')
+        expect(store.getState().network).toBe('mesh')
+        expect(countActions(constants.PEER_REMOVE_ALL)).toBe(0)
+        expect(SocketActions.handshake).not.toHaveBeenCalled()
+      })
+
+      it('rejoins the call when switched to SFU and back', async () => {
+        mediaState = {
+          dialState: constants.DIAL_STATE_IN_CALL,
+        }
+
+        await connect()
+
+        // The call was dialled again after the socket connected.
+        const removeAll = countActions(constants.PEER_REMOVE_ALL)
+
+        switchNetwork('mesh')
+        expect(store.getState().network).toBe('mesh')
+        expect(countActions(constants.PEER_REMOVE_ALL)).toBe(removeAll + 1)
+        expect(SocketActions.handshake).toHaveBeenCalledTimes(1)
+
+        switchNetwork('sfu')
+        expect(store.getState().network).toBe('sfu')
+        expect(countActions(constants.PEER_REMOVE_ALL)).toBe(removeAll + 2)
+        expect(SocketActions.handshake).toHaveBeenCalledTimes(2)
+        expect(SocketActions.handshake).toHaveBeenLastCalledWith({
+          nickname: 'local-user',
+          socket,
+          roomName: 'call1234',
+          peerId: 'user1234',
+          store: jasmine.any(Object),
+        })
+
+        // The network did not change.
+        switchNetwork('sfu')
+        expect(SocketActions.handshake).toHaveBeenCalledTimes(2)
+
+        switchNetwork('mesh')
+        expect(store.getState().network).toBe('mesh')
+        expect(countActions(constants.PEER_REMOVE_ALL)).toBe(removeAll + 3)
+        expect(SocketActions.handshake).toHaveBeenCalledTimes(3)
+      })
+    })
+
+    describe('chat', () => {
+      const chat = {
+        peerId: 'user2',
+        nickname: 'nick2',
+        message: 'hello',
+        timestamp: 1000,
+      }
+
+      function chatActions() {
+        return store.getState().allActions.filter(
+          a => a.type === constants.CHAT_ADD ||
+            a.type === constants.CHAT_HISTORY,
+        )
+      }
+
+      it('dispatches the chat history and messages', async () => {
+        setup()
+
+        const promise = callActions.init()
+        socket.emit('connect', undefined)
+        socket.emit(constants.SOCKET_EVENT_CHAT_HISTORY, { messages: [chat] })
+        await promise
+        socket.emit(constants.SOCKET_EVENT_CHAT, chat)
+
+        expect(chatActions()).toEqual([{
+          type: constants.CHAT_HISTORY,
+          payload: [chat],
+        }, {
+          type: constants.CHAT_ADD,
+          payload: chat,
+        }])
+      })
+
+      it('sends the chat message to the server', () => {
+        setup()
+
+        const listener = jest.fn()
+        socket.on(constants.SOCKET_EVENT_CHAT, listener)
+        callActions.sendChat('hi')
+
+        expect(listener.mock.calls).toEqual([[{
+          peerId: 'user1234',
+          nickname: 'local-user',
+          timestamp: jasmine.any(Number),
+          message: 'hi',
+        }]])
+      })
+    })
+
   })
 
 })
@@ -1,8 +1,10 @@
 import { GetAsyncAction, makeAction } from '../async'
-import { DIAL, HANG_UP, ME, SOCKET_CONNECTED, SOCKET_DISCONNECTED, SOCKET_EVENT_HANG_UP, SOCKET_EVENT_USERS } from '../constants'
+import { DIAL, DIAL_STATE_HUNG_UP, HANG_UP, ME, NETWORK_SET, SOCKET_CONNECTED, SOCKET_DISCONNECTED, SOCKET_EVENT_CHAT, SOCKET_EVENT_CHAT_HISTORY, SOCKET_EVENT_HANG_UP, SOCKET_EVENT_SWITCH_NETWORK, SOCKET_EVENT_USERS } from '../constants'
 import socket from '../socket'
+import { Network } from '../SocketEvent'
 import store, { ThunkResult } from '../store'
 import { config } from '../window'
+import { addChat, addChatHistory } from './ChatActions'
 import * as NotifyActions from './NotifyActions'
 import { removeAllPeers } from './PeerActions'
 import * as SocketActions from './SocketActions'
@@ -25,6 +27,20 @@ const disconnected = (): DisconnectedAction => ({
   type: SOCKET_DISCONNECTED,
 })
 
+export interface SetNetworkAction {
+  type: 'NETWORK_SET'
+  payload: {
+    network: Network
+  }
+}
+
+export const setNetwork = (network: Network): SetNetworkAction => ({
+  type: NETWORK_SET,
+  payload: {
+    network,
+  },
+})
+
 export const init = (): ThunkResult<Promise<void>> => async (
   dispatch, getState,
 ) => {
@@ -64,6 +80,44 @@ export const init = (): ThunkResult<Promise<void>> => async (
       dispatch(NotifyActions.error('Server socket disconnected'))
       dispatch(disconnected())
     })
+    socket.on(SOCKET_EVENT_CHAT, chat => {
+      dispatch(addChat(chat))
+    })
+    // The chat history is sent when the socket connects.
+    socket.on(SOCKET_EVENT_CHAT_HISTORY, ({ messages }) => {
+      dispatch(addChatHistory(messages))
+    })
+    // The server of a hybrid room sends the network when the socket connects,
+    // so the handler has to be added before the call is dialled.
+    socket.on(SOCKET_EVENT_SWITCH_NETWORK, ({ network }) => {
+      const state = getState()
+
+      if (state.network === network) {
+        return
+      }
+
+      dispatch(setNetwork(network))
+
+      if (state.media.dialState === DIAL_STATE_HUNG_UP) {
+        return
+      }
+
+      // The server only moves the client to the new network after it sends
+      // ready again, so the peers of the old network are destroyed and the
+      // call is dialled again.
+      dispatch(removeAllPeers())
+
+      dispatch(NotifyActions.info('Switching to the {0} network...', network))
+
+      dispatch(
+        dial({
+          nickname: state.nicknames[ME],
+        }),
+      )
+      .catch(() => {
+        dispatch(NotifyActions.error('Dial timed out.'))
+      })
+    })
   })
 }
 
@@ -88,6 +142,20 @@ export const dial = makeAction(
   }),
 )
 
+// sendChat sends the chat message to the server, which relays it to the room
+// and keeps it in the history.
+export const sendChat = (message: string): ThunkResult<void> => (
+  dispatch, getState,
+) => {
+  socket.emit(SOCKET_EVENT_CHAT, {
+    // The server sets these fields.
+    peerId,
+    nickname: getState().nicknames[ME],
+    timestamp: Date.now(),
+    message,
+  })
+}
+
 export type HangUpAction = {
   type: 'HANG_UP'
 }
@@ -1,6 +1,7 @@
 import * as NotifyActions from './NotifyActions'
 import { Dispatch, GetState } from '../store'
-import { MESSAGE_ADD, MESSAGE_SEND } from '../constants'
+import { CHAT_ADD, CHAT_HISTORY, MESSAGE_ADD, MESSAGE_SEND } from '../constants'
+import { ChatMessage } from '../SocketEvent'
 import { config } from '../window'
 
 const { peerId } = config
@@ -15,6 +16,31 @@ export const addMessage = (message: MessageType): MessageAddAction => ({
   payload: message,
 })
 
+export interface ChatAddAction {
+  type: 'CHAT_ADD'
+  payload: ChatMessage
+}
+
+// addChat adds a chat message relayed by the server.
+export const addChat = (chat: ChatMessage): ChatAddAction => ({
+  type: CHAT_ADD,
+  payload: chat,
+})
+
+export interface ChatHistoryAction {
+  type: 'CHAT_HISTORY'
+  payload: ChatMessage[]
+}
+
+// addChatHistory adds the chat messages which the server sends when the
+// socket connects.
+export const addChatHistory = (
+  messages: ChatMessage[],
+): ChatHistoryAction => ({
+  type: CHAT_HISTORY,
+  payload: messages,
+})
+
 export interface TextMessage {
   peerId: string
   type: 'text'
@@ -3,6 +3,7 @@ import Peer, { SignalData } from 'simple-peer'
 import { Decoder } from '../codec'
 import * as constants from '../constants'
 import { ClientSocket } from '../socket'
+import { PubTrackEvent, TrackEventType, TrackKind } from '../SocketEvent'
 import { Dispatch, GetState } from '../store'
 import { TextDecoder } from '../textcodec'
 import { config } from '../window'
@@ -71,11 +72,31 @@ class PeerHandler {
     stream: MediaStream,
     transceiver: RTCRtpTransceiver,
   ) => {
-    const { peer, dispatch } = this
+    const { peer, dispatch, getState } = this
     const peerId = peer.id
     const streamId = stream.id
     const mid = transceiver.mid!
 
+    // For mesh network, we don't need any special PubTrackEvent, so just act
+    // as if we received the PubTrackEvent so we can associate the track with
+    // the correct peer.
+    function meshPubTrackEvent(type: PubTrackEvent['type']) {
+      if (getState().network !== 'mesh') {
+        return
+      }
+
+      dispatch(StreamActions.pubTrackEvent({
+        peerId,
+        pubClientId: peerId,
+        trackId: {
+          id: track.id,
+          streamId,
+        },
+        kind: track.kind as TrackKind,
+        type,
+      }))
+    }
+
     debug('peer: %s, track: %s, stream: %s, mid: %s',
           peerId, track.id, stream.id, mid)
 
@@ -85,6 +106,7 @@ class PeerHandler {
       debug(
         'peer: %s, track mute (id: %s, stream.id: %s)',
         peerId, track.id, stream.id)
+      meshPubTrackEvent(TrackEventType.Remove)
       dispatch(StreamActions.removeTrack({ peerId, track, streamId }))
     }
 
@@ -92,6 +114,7 @@ class PeerHandler {
       debug(
         'peer: %s, track unmute (id: %s, stream.id: %s)',
         peerId, track.id, stream.id)
+      meshPubTrackEvent(TrackEventType.Add)
       dispatch(StreamActions.addTrack({
         streamId,
         peerId,
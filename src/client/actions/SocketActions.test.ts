@@ -5,12 +5,13 @@ jest.mock('simple-peer')
 
 import * as NicknameActions from './NicknameActions'
 import * as SocketActions from './SocketActions'
+import { StreamTypeCamera } from './StreamActions'
 import * as constants from '../constants'
 import Peer from 'simple-peer'
 import { EventEmitter } from 'events'
 import { createStore, Store } from '../store'
 import { ClientSocket } from '../socket'
-import { MediaStream, MediaStreamTrack } from '../window'
+import { MediaStream, MediaStreamTrack, navigate } from '../window'
 import { SocketEvent } from '../SocketEvent'
 import { StreamsState } from '../reducers/streams'
 
@@ -103,6 +104,83 @@ describe('SocketActions', () => {
         expect((instances[0].signal as jest.Mock).mock.calls.length).toBe(0)
       })
     })
+
+    describe('role', () => {
+      let stream: MediaStream
+      let track: MediaStreamTrack
+      beforeEach(() => {
+        SocketActions.handshake({ nickname, socket, roomName, peerId, store })
+        socket.emit('users', {
+          initiator: peerA,
+          peerIds: [peerA, peerB],
+          nicknames,
+        })
+
+        stream = new MediaStream()
+        track = new MediaStreamTrack()
+        stream.addTrack(track)
+      })
+
+      afterEach(() => {
+        // Resets the local streams kept by the peers reducer.
+        store.dispatch({ type: constants.HANG_UP })
+      })
+
+      it('sends the local tracks after the viewer is promoted', () => {
+        socket.emit(constants.SOCKET_EVENT_ROLE, { peerId, role: 'viewer' })
+        expect(store.getState().role).toBe('viewer')
+
+        store.dispatch({
+          type: constants.MEDIA_STREAM,
+          payload: {
+            stream,
+            type: StreamTypeCamera,
+          },
+          status: 'resolved',
+        })
+        instances[0].emit(constants.PEER_EVENT_CONNECT)
+
+        const addTrack = instances[0].addTrack as jest.Mock
+        expect(addTrack.mock.calls).toEqual([])
+
+        // The roles of the other clients are ignored.
+        socket.emit(constants.SOCKET_EVENT_ROLE, {
+          peerId: peerB,
+          role: 'speaker',
+        })
+        expect(store.getState().role).toBe('viewer')
+        expect(addTrack.mock.calls).toEqual([])
+
+        socket.emit(constants.SOCKET_EVENT_ROLE, { peerId, role: 'speaker' })
+        expect(store.getState().role).toBe('speaker')
+        expect(addTrack.mock.calls).toEqual([[ track, stream ]])
+      })
+    })
+
+    describe('breakout', () => {
+      beforeEach(() => {
+        SocketActions.handshake({ nickname, socket, roomName, peerId, store })
+        ;(navigate as jest.Mock).mockClear()
+      })
+
+      it('rejoins the call in the breakout room and back', () => {
+        socket.emit(constants.SOCKET_EVENT_BREAKOUT, {
+          room: roomName + '~g1',
+          parent: roomName,
+          endsAt: Date.now() + 60000,
+        })
+        socket.emit(constants.SOCKET_EVENT_BREAKOUT, {
+          room: roomName,
+          parent: roomName,
+          endsAt: 0,
+        })
+
+        expect((navigate as jest.Mock).mock.calls).toEqual([
+          [ '/call/bla~g1' ],
+          [ '/call/bla' ],
+        ])
+      })
+    })
   })
 
   describe('peer events', () => {
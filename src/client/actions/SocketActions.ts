@@ -1,16 +1,31 @@
 import _debug from 'debug'
-import { SocketEvent, TrackEventType } from '../SocketEvent'
+import { ClientRole, SocketEvent, TrackEventType } from '../SocketEvent'
 import * as NotifyActions from '../actions/NotifyActions'
 import * as PeerActions from '../actions/PeerActions'
 import * as constants from '../constants'
 import { ClientSocket } from '../socket'
 import { Dispatch, GetState, Store } from '../store'
+import { config, navigate } from '../window'
 import { removeNickname, setNicknames } from './NicknameActions'
 import { pubTrackEvent } from './StreamActions'
 
 const debug = _debug('peercalls')
 const sdpDebug = _debug('peercalls:sdp')
 
+export interface SetRoleAction {
+  type: 'ROLE_SET'
+  payload: {
+    role: ClientRole
+  }
+}
+
+export const setRole = (role: ClientRole): SetRoleAction => ({
+  type: constants.ROLE_SET,
+  payload: {
+    role,
+  },
+})
+
 export interface SocketHandlerOptions {
   socket: ClientSocket
   roomName: string
@@ -88,6 +103,59 @@ class SocketHandler {
       })
     }
   }
+  handleDrain = ({ url }: SocketEvent['drain']) => {
+    const { dispatch } = this
+    debug('socket drain, url: %s', url)
+
+    if (!url) {
+      dispatch(NotifyActions.warning(
+        'The server is shutting down. Please rejoin the call later.'))
+      return
+    }
+
+    dispatch(NotifyActions.warning(
+      'The server is shutting down. Reconnecting to another server...'))
+    navigate(new URL(window.location.pathname, url).toString())
+  }
+  // The server closes the connection after the breakout message, so the call
+  // is rejoined in the other room, like after a drain.
+  handleBreakout = ({ room, parent, endsAt }: SocketEvent['breakout']) => {
+    const { dispatch } = this
+    debug('socket breakout, room: %s, parent: %s', room, parent)
+
+    if (room === parent) {
+      dispatch(NotifyActions.info(
+        'The breakout has ended. Moving back to the room...'))
+    } else {
+      dispatch(NotifyActions.info(
+        'Moving to a breakout room until {0}...',
+        new Date(endsAt).toLocaleTimeString()))
+    }
+
+    navigate(config.baseUrl + '/call/' + encodeURIComponent(room))
+  }
+  // The role of every client in a webinar room is broadcast to the room.
+  handleRole = ({ peerId, role }: SocketEvent['role']) => {
+    const { dispatch, getState } = this
+    debug('socket role, peerId: %s, role: %s', peerId, role)
+
+    if (peerId !== this.peerId) {
+      return
+    }
+
+    const prevRole = getState().role
+    dispatch(setRole(role))
+
+    if (prevRole === 'viewer' && role !== 'viewer') {
+      dispatch(NotifyActions.info('You can now share your camera and mic.'))
+    }
+  }
+  handleError = ({ code, message, requestType }: SocketEvent['error']) => {
+    const { dispatch } = this
+    debug('socket error: %s, %s: %s', requestType, code, message)
+
+    dispatch(NotifyActions.error('Server error: {0}', message))
+  }
 }
 
 export interface HandshakeOptions {
@@ -118,6 +186,10 @@ export function handshake (options: HandshakeOptions) {
   socket.on(constants.SOCKET_EVENT_USERS, handler.handleUsers)
   socket.on(constants.SOCKET_EVENT_HANG_UP, handler.handleHangUp)
   socket.on(constants.SOCKET_EVENT_PUB_TRACK, handler.handlePub)
+  socket.on(constants.SOCKET_EVENT_DRAIN, handler.handleDrain)
+  socket.on(constants.SOCKET_EVENT_BREAKOUT, handler.handleBreakout)
+  socket.on(constants.SOCKET_EVENT_ROLE, handler.handleRole)
+  socket.on(constants.SOCKET_EVENT_ERROR, handler.handleError)
 
   debug('peerId: %s', peerId)
   socket.emit(constants.SOCKET_EVENT_READY, {
@@ -132,4 +204,8 @@ export function removeEventListeners (socket: ClientSocket) {
   socket.removeAllListeners(constants.SOCKET_EVENT_USERS)
   socket.removeAllListeners(constants.SOCKET_EVENT_HANG_UP)
   socket.removeAllListeners(constants.SOCKET_EVENT_PUB_TRACK)
+  socket.removeAllListeners(constants.SOCKET_EVENT_DRAIN)
+  socket.removeAllListeners(constants.SOCKET_EVENT_BREAKOUT)
+  socket.removeAllListeners(constants.SOCKET_EVENT_ROLE)
+  socket.removeAllListeners(constants.SOCKET_EVENT_ERROR)
 }
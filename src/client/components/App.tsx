@@ -21,6 +21,7 @@ import Videos from './Videos'
 
 export interface AppProps {
   dialState: constants.DialState
+  canPublish: boolean
   dismissNotification: typeof dismissNotification
   init: () => void
   nicknames: Nicknames
@@ -89,6 +90,7 @@ export default class App extends React.PureComponent<AppProps> {
           sidebarPanel={this.props.sidebarPanel}
           sidebarVisible={this.props.sidebarVisible}
           dialState={this.props.dialState}
+          canPublish={this.props.canPublish}
           messagesCount={messagesCount}
           nickname={nicknames[constants.ME]}
           onToggleSidebar={this.sidebarShowChat}
@@ -84,7 +84,8 @@ export default class Chat extends React.PureComponent<ChatProps> {
                   <div className='chat-item chat-item-me'>
                     <div className='message'>
                       <span className='message-user-name'>
-                        {getNickname(this.props.nicknames, message.peerId)}
+                        {message.nickname ||
+                          getNickname(this.props.nicknames, message.peerId)}
                       </span>
                       <time className='message-time'>{message.timestamp}</time>
                       <MessageEntry message={message} />
@@ -100,7 +101,8 @@ export default class Chat extends React.PureComponent<ChatProps> {
                     </span>
                     <div className='message'>
                       <span className='message-user-name'>
-                        {getNickname(this.props.nicknames, message.peerId)}
+                        {message.nickname ||
+                          getNickname(this.props.nicknames, message.peerId)}
                       </span>
                       <time className='message-time'>{message.timestamp}</time>
                       <MessageEntry message={message} />
@@ -37,6 +37,7 @@ class ToolbarWrapper extends React.PureComponent<ToolbarProps, StreamState> {
       sidebarPanel={this.props.sidebarPanel}
       sidebarVisible={this.props.sidebarVisible}
       dialState={this.props.dialState}
+      canPublish={this.props.canPublish}
       nickname={this.props.nickname}
       onToggleSidebar={this.props.onToggleSidebar}
       onHangup={this.props.onHangup}
@@ -56,7 +57,7 @@ let onRemoveLocalStream: jest.MockedFunction<typeof removeLocalStream>
 let desktopStream: LocalStream | undefined
 let dialState: DialState
 const nickname = 'john'
-async function render (store: Store) {
+async function render (store: Store, canPublish = true) {
   dialState = DIAL_STATE_IN_CALL
   onToggleChat = jest.fn()
   onHangup = jest.fn()
@@ -69,6 +70,7 @@ async function render (store: Store) {
         <ToolbarWrapper
           ref={instance => resolve(instance!)}
           dialState={dialState}
+          canPublish={canPublish}
           sidebarVisible
           sidebarPanel={sidebarPanelChat}
           onHangup={onHangup}
@@ -103,6 +105,23 @@ describe('components/Toolbar', () => {
     })
   })
 
+  describe('publish controls', () => {
+    it('are shown to the clients that can publish', () => {
+      expect(node.querySelector('.stream-desktop')).toBeTruthy()
+      expect(node.querySelector('.dropdown .video')).toBeTruthy()
+      expect(node.querySelector('.dropdown .audio')).toBeTruthy()
+    })
+
+    it('are hidden from the viewers', async () => {
+      await render(store, false)
+
+      expect(node.querySelector('.stream-desktop')).toBeNull()
+      expect(node.querySelector('.dropdown .video')).toBeNull()
+      expect(node.querySelector('.dropdown .audio')).toBeNull()
+      expect(node.querySelector('.hangup')).toBeTruthy()
+    })
+  })
+
   describe('handleFullscreenClick', () => {
     it('toggle fullscreen', () => {
       const button = node.querySelector('.fullscreen')!
@@ -18,6 +18,8 @@ const { callId } = config
 
 export interface ToolbarProps {
   dialState: DialState
+  // canPublish is false for the viewers in a webinar room.
+  canPublish: boolean
   nickname: string
   messagesCount: number
   desktopStream: LocalStream | undefined
@@ -238,18 +240,22 @@ export default class Toolbar extends React.PureComponent<
 
         {isInCall && (
           <div className={'toolbar-call ' + className}>
-            <ShareDesktopDropdown
-              className='stream-desktop'
-              icon={MdScreenShare}
-              offIcon={MdStopScreenShare}
-              key='stream-desktop'
-              title='Share Desktop'
-              desktopStream={this.props.desktopStream}
-              onGetDesktopStream={this.props.onGetDesktopStream}
-              onRemoveLocalStream={this.props.onRemoveLocalStream}
-            />
+            {this.props.canPublish && (
+              <React.Fragment>
+                <ShareDesktopDropdown
+                  className='stream-desktop'
+                  icon={MdScreenShare}
+                  offIcon={MdStopScreenShare}
+                  key='stream-desktop'
+                  title='Share Desktop'
+                  desktopStream={this.props.desktopStream}
+                  onGetDesktopStream={this.props.onGetDesktopStream}
+                  onRemoveLocalStream={this.props.onRemoveLocalStream}
+                />
 
-            <VideoDropdown />
+                <VideoDropdown />
+              </React.Fragment>
+            )}
 
             <ToolbarButton
               onClick={this.props.onHangup}
@@ -259,7 +265,7 @@ export default class Toolbar extends React.PureComponent<
               title='Hang Up'
             />
 
-            <AudioDropdown />
+            {this.props.canPublish && <AudioDropdown />}
 
             <ToolbarButton
               onClick={this.handleFullscreenClick}
@@ -27,6 +27,9 @@ export const NOTIFY_CLEAR = 'NOTIFY_CLEAR'
 export const MESSAGE_ADD = 'MESSAGE_ADD'
 export const MESSAGE_SEND = 'MESSAGE_SEND'
 
+export const CHAT_ADD = 'CHAT_ADD'
+export const CHAT_HISTORY = 'CHAT_HISTORY'
+
 export const MEDIA_ENUMERATE = 'MEDIA_ENUMERATE'
 export const MEDIA_STREAM = 'MEDIA_STREAM'
 export const MEDIA_TRACK = 'MEDIA_TRACK'
@@ -36,6 +39,8 @@ export const MEDIA_DEVICE_ID = 'MEDIA_DEVICE_ID'
 export const MEDIA_DEVICE_TOGGLE = 'MEDIA_DEVICE_TOGGLE'
 export const MEDIA_PLAY = 'MEDIA_PLAY'
 
+export const NETWORK_SET = 'NETWORK_SET'
+
 export const NICKNAMES_SET = 'NICKNAMES_SET'
 export const NICKNAME_REMOVE = 'NICKNAME_REMOVE'
 
@@ -57,6 +62,8 @@ export const PEER_EVENT_DATA = 'data'
 
 export const PUB_TRACK_EVENT = 'PUB_TRACK_EVENT'
 
+export const ROLE_SET = 'ROLE_SET'
+
 export const SETTINGS_SHOW_MINIMIZED_TOOLBAR_TOGGLE =
   'SETTINGS_SHOW_MINIMIZED_TOOLBAR_TOGGLE'
 export const SETTINGS_GRID_SET =
@@ -80,6 +87,13 @@ export const SOCKET_EVENT_USERS = 'users'
 export const SOCKET_EVENT_HANG_UP = 'hangUp'
 export const SOCKET_EVENT_PUB_TRACK = 'pubTrack'
 export const SOCKET_EVENT_SUB_TRACK = 'subTrack'
+export const SOCKET_EVENT_DRAIN = 'drain'
+export const SOCKET_EVENT_BREAKOUT = 'breakout'
+export const SOCKET_EVENT_CHAT = 'chat'
+export const SOCKET_EVENT_CHAT_HISTORY = 'chatHistory'
+export const SOCKET_EVENT_ROLE = 'role'
+export const SOCKET_EVENT_SWITCH_NETWORK = 'switchNetwork'
+export const SOCKET_EVENT_ERROR = 'error'
 
 export const STREAM_ADD = 'PEER_STREAM_ADD'
 export const STREAM_REMOVE = 'PEER_STREAM_REMOVE'
@@ -1,6 +1,6 @@
 import { connect } from 'react-redux'
-import { hangUp, init } from '../actions/CallActions'
-import { sendFile, sendText } from '../actions/ChatActions'
+import { hangUp, init, sendChat } from '../actions/CallActions'
+import { sendFile } from '../actions/ChatActions'
 import { getDesktopStream, play } from '../actions/MediaActions'
 import { dismissNotification } from '../actions/NotifyActions'
 import { sidebarHide, sidebarShow, sidebarToggle } from '../actions/SidebarActions'
@@ -11,6 +11,7 @@ import { State } from '../store'
 function mapStateToProps (state: State) {
   return {
     dialState: state.media.dialState,
+    canPublish: state.role !== 'viewer',
     streams: state.streams,
     peers: state.peers,
     notifications: state.notifications,
@@ -28,7 +29,7 @@ const mapDispatchToProps = {
   hangUp,
   minimizeToggle,
   maximize,
-  sendText,
+  sendText: sendChat,
   dismissNotification,
   getDesktopStream,
   removeLocalStream,
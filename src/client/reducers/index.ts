@@ -1,10 +1,12 @@
 import { combineReducers } from 'redux'
 import media from './media'
 import messages from './messages'
+import network from './network'
 import nicknames from './nicknames'
 import notifications from './notifications'
 import peers from './peers'
 import receivers from './receivers'
+import role from './role'
 import settings from './settings'
 import sidebar from './sidebar'
 import streams from './streams'
@@ -14,9 +16,11 @@ export default combineReducers({
   notifications,
   messages,
   media,
+  network,
   nicknames,
   peers,
   receivers,
+  role,
   settings,
   sidebar,
   streams,
@@ -1,6 +1,7 @@
 jest.mock('../window')
 
-import { addMessage, MessageType } from '../actions/ChatActions'
+import { addChat, addChatHistory, addMessage, MessageType } from '../actions/ChatActions'
+import { ME } from '../constants'
 import messages, { Message } from './messages'
 
 describe('reducers/messages', () => {
@@ -24,4 +25,43 @@ describe('reducers/messages', () => {
     })
   })
 
+  describe('chat', () => {
+    function chat(peerId: string, timestamp: number) {
+      return {
+        peerId,
+        nickname: 'nick-' + peerId,
+        message: 'message ' + timestamp,
+        timestamp,
+      }
+    }
+
+    function message(peerId: string, nickname: string, timestamp: number) {
+      return {
+        peerId,
+        nickname,
+        message: 'message ' + timestamp,
+        timestamp: new Date(timestamp).toLocaleString(),
+      }
+    }
+
+    it('adds the chat messages without the history added before', () => {
+      let state = messages(undefined, {type: 'test'} as any)
+      state = messages(state, addChatHistory([ chat('user2', 1000) ]))
+      state = messages(state, addChat(chat('user1234', 2000)))
+      // The socket reconnected.
+      state = messages(state, addChatHistory([
+        chat('user2', 1000),
+        chat('user1234', 2000),
+        chat('user3', 3000),
+      ]))
+
+      expect(state.list).toEqual([
+        message('user2', 'nick-user2', 1000),
+        message(ME, 'nick-user1234', 2000),
+        message('user3', 'nick-user3', 3000),
+      ])
+      expect(state.count).toBe(3)
+    })
+  })
+
 })
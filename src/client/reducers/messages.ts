@@ -1,9 +1,16 @@
 import * as constants from '../constants'
-import { MessageAddAction, MessageSendAction } from '../actions/ChatActions'
+import { ChatAddAction, ChatHistoryAction, MessageAddAction, MessageSendAction } from '../actions/ChatActions'
 import { NotificationAddAction } from '../actions/NotifyActions'
+import { ChatMessage } from '../SocketEvent'
+import { config } from '../window'
+
+const { peerId } = config
 
 export interface Message {
   peerId: string
+  // nickname is set by the server for the chat messages, so that it is known
+  // after the sender has left.
+  nickname?: string
   message: string
   timestamp: string
   data?: string
@@ -15,11 +22,16 @@ export interface Message {
 export interface MessagesState {
   list: Message[]
   count: number
+  // chatTimestamp is the timestamp of the last chat message relayed by the
+  // server. The older messages in the history are skipped because they were
+  // already added, for example before the socket reconnected.
+  chatTimestamp: number
 }
 
 const defaultState: MessagesState = {
   list: [],
   count: 0,
+  chatTimestamp: 0,
 }
 
 function convertNotificationToMessage(action: NotificationAddAction): Message {
@@ -69,9 +81,52 @@ function handleMessage(
   }
 }
 
+function convertChatToMessage(chat: ChatMessage): Message {
+  return {
+    peerId: chat.peerId === peerId ? constants.ME : chat.peerId,
+    nickname: chat.nickname,
+    message: chat.message,
+    timestamp: new Date(chat.timestamp).toLocaleString(),
+  }
+}
+
+function handleChat(
+  state: MessagesState,
+  chats: ChatMessage[],
+): MessagesState {
+  if (chats.length === 0) {
+    return state
+  }
+
+  return {
+    ...state,
+    count: state.count + chats.length,
+    chatTimestamp: Math.max(
+      state.chatTimestamp,
+      chats[chats.length - 1].timestamp,
+    ),
+    list: [...state.list, ...chats.map(convertChatToMessage)],
+  }
+}
+
+function handleChatHistory(
+  state: MessagesState,
+  action: ChatHistoryAction,
+): MessagesState {
+  return handleChat(
+    state,
+    action.payload.filter(chat => chat.timestamp > state.chatTimestamp),
+  )
+}
+
 export default function messages (
   state = defaultState,
-    action: MessageAddAction | MessageSendAction | NotificationAddAction,
+    action:
+      MessageAddAction |
+      MessageSendAction |
+      ChatAddAction |
+      ChatHistoryAction |
+      NotificationAddAction,
 ): MessagesState {
   switch (action.type) {
     case constants.NOTIFY:
@@ -81,6 +136,10 @@ export default function messages (
       }
     case constants.MESSAGE_ADD:
       return handleMessage(state, action)
+    case constants.CHAT_ADD:
+      return handleChat(state, [action.payload])
+    case constants.CHAT_HISTORY:
+      return handleChatHistory(state, action)
     default:
       return state
   }
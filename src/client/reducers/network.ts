@@ -0,0 +1,21 @@
+import { SetNetworkAction } from '../actions/CallActions'
+import { NETWORK_SET } from '../constants'
+import { Network } from '../SocketEvent'
+import { config } from '../window'
+
+export type NetworkState = Network
+
+// The hybrid rooms start as mesh, until the server switches them to the SFU.
+const defaultState: NetworkState = config.network === 'sfu' ? 'sfu' : 'mesh'
+
+export default function network(
+  state = defaultState,
+  action: SetNetworkAction,
+): NetworkState {
+  switch (action.type) {
+  case NETWORK_SET:
+    return action.payload.network
+  default:
+    return state
+  }
+}
@@ -8,6 +8,7 @@ import * as constants from '../constants'
 import { MediaStreamAction, MediaTrackAction, MediaTrackEnableAction, getTracksByKind } from '../actions/MediaActions'
 import { RemoveLocalStreamAction, StreamType } from '../actions/StreamActions'
 import { HangUpAction } from '../actions/CallActions'
+import { SetRoleAction } from '../actions/SocketActions'
 import { insertableStreamsCodec } from '../insertable-streams'
 
 const debug = _debug('peercalls')
@@ -27,6 +28,10 @@ let localStreams: Record<StreamType, MediaStream | undefined> = {
   desktop: undefined,
 }
 
+// publish is false while the local user is a viewer in a webinar room. The
+// local tracks are only sent to the peers after the viewer is promoted.
+let publish = true
+
 function removeTrackFromPeer(
   peer: PeerState,
   track: MediaStreamTrack,
@@ -52,6 +57,10 @@ function addTrackToPeer(
   track: MediaStreamTrack,
   stream: MediaStream,
 ): PeerState {
+  if (!publish || track.id in peer.senders) {
+    return peer
+  }
+
   debug(
     'Add track to peer, id: %s, kind: %s, label: %s',
     track.id, track.kind, track.label,
@@ -143,6 +152,11 @@ export function handleLocalMediaTrack(
   if (oldTrack) {
     if (newTrack) {
       const newState = mapValues(state, peer => {
+        if (!(oldTrack.id in peer.senders)) {
+          // The track is not sent to the peer, for example by a viewer.
+          return peer
+        }
+
         peer.instance.replaceTrack(oldTrack, newTrack, localStream)
 
         const sender = peer.senders[oldTrack.id]
@@ -197,6 +211,33 @@ export function handleLocalMediaTrackEnable(
   return state
 }
 
+// setRole starts sending the local tracks to all peers when the viewer is
+// promoted, and stops sending them when the local user becomes a viewer.
+export function setRole(
+  state: PeersState,
+  action: SetRoleAction,
+): PeersState {
+  const canPublish = action.payload.role !== 'viewer'
+
+  if (canPublish === publish) {
+    return state
+  }
+
+  publish = canPublish
+
+  return mapValues(state, peer => {
+    forEach(localStreams, stream => {
+      stream && stream.getTracks().forEach(track => {
+        peer = publish
+          ? addTrackToPeer(peer, track, stream)
+          : removeTrackFromPeer(peer, track, stream)
+      })
+    })
+
+    return peer
+  })
+}
+
 export function removeAllPeers(state: PeersState): PeersState {
   forEach(state, peer => peer.instance.destroy())
 
@@ -233,6 +274,7 @@ export default function peers(
     MediaTrackAction |
     MediaTrackEnableAction |
     RemoveLocalStreamAction |
+    SetRoleAction |
     HangUpAction,
 ): PeersState {
   switch (action.type) {
@@ -253,6 +295,7 @@ export default function peers(
         camera: undefined,
         desktop: undefined,
       }
+      publish = true
 
       return removeAllPeers(state)
     case constants.PEER_REMOVE_ALL:
@@ -265,6 +308,8 @@ export default function peers(
       return handleLocalMediaTrack(state, action)
     case constants.MEDIA_TRACK_ENABLE:
       return handleLocalMediaTrackEnable(state, action)
+    case constants.ROLE_SET:
+      return setRole(state, action)
     default:
       return state
   }
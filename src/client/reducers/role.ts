@@ -0,0 +1,24 @@
+import { HangUpAction } from '../actions/CallActions'
+import { SetRoleAction } from '../actions/SocketActions'
+import { HANG_UP, ROLE_SET } from '../constants'
+import { ClientRole } from '../SocketEvent'
+
+// RoleState is the role of the local user in a webinar room, and null in the
+// other rooms.
+export type RoleState = ClientRole | null
+
+const defaultState: RoleState = null
+
+export default function role(
+  state: RoleState = defaultState,
+  action: SetRoleAction | HangUpAction,
+): RoleState {
+  switch (action.type) {
+  case ROLE_SET:
+    return action.payload.role
+  case HANG_UP:
+    return defaultState
+  default:
+    return state
+  }
+}
@@ -11,7 +11,7 @@ import { HANG_UP, MEDIA_STREAM, MEDIA_TRACK, PEER_REMOVE, PUB_TRACK_EVENT, STREA
 import { Dim } from '../frame'
 import { insertableStreamsCodec } from '../insertable-streams'
 import { PubTrack, PubTrackEvent, TrackEventType, TrackKind } from '../SocketEvent'
-import { config, createObjectURL, MediaStream, revokeObjectURL } from '../window'
+import { createObjectURL, MediaStream, revokeObjectURL } from '../window'
 import { RecordSet, removeChild, setChild } from './recordSet'
 
 const debug = _debug('peercalls')
@@ -160,22 +160,6 @@ function removeTrack (
   const { streamId, peerId, track } = payload
   debug('streams removeTrack', streamId, track.id)
 
-  if (config.network === 'mesh') {
-    // For mesh network, we don't need any special PubTrackEvent, so just act
-    // as if we received the PubTrackEvent so we can associate the track with
-    // the correct peer.
-    state = pubTrack(state, {
-      peerId,
-      pubClientId: peerId,
-      trackId: {
-        id: track.id,
-        streamId,
-      },
-      kind: track.kind as TrackKind,
-      type: TrackEventType.Remove,
-    })
-  }
-
   const remoteStream = state.remoteStreams[streamId]
   if (!remoteStream) {
     debug('streams removeTrack stream not found', streamId)
@@ -221,22 +205,6 @@ function addTrack (
 
   let remoteStream = state.remoteStreams[streamId]
 
-  if (config.network === 'mesh') {
-    // For mesh network, we don't need any special PubTrackEvent, so just act
-    // as if we received the PubTrackEvent so we can associate the track with
-    // the correct peer.
-    state = pubTrack(state, {
-      peerId,
-      pubClientId: peerId,
-      trackId: {
-        id: track.id,
-        streamId,
-      },
-      kind: track.kind as TrackKind,
-      type: TrackEventType.Add,
-    })
-  }
-
   const pubStream = state.pubStreams[streamId]
 
   const originalPeerId = pubStream ? pubStream.peerId : peerId
@@ -1,4 +1,5 @@
 import { SocketEvent } from './SocketEvent'
+import { AutoClient, SSEClient } from './sse'
 import { config } from './window'
 import { SocketClient, TypedEmitter } from './ws'
 export type ClientSocket = TypedEmitter<SocketEvent>
@@ -6,4 +7,18 @@ export type ClientSocket = TypedEmitter<SocketEvent>
 const wsUrl = location.origin.replace(/^http/, 'ws') +
   config.baseUrl + '/ws/' + config.callId + '/' + config.peerId
 
-export default new SocketClient<SocketEvent>(wsUrl)
+const sseUrl = location.origin +
+  config.baseUrl + '/sse/' + config.callId + '/' + config.peerId
+
+function createSocket(): ClientSocket {
+  switch (config.signaling) {
+  case 'websocket':
+    return new SocketClient<SocketEvent>(wsUrl)
+  case 'sse':
+    return new SSEClient<SocketEvent>(sseUrl)
+  default:
+    return new AutoClient<SocketEvent>(wsUrl, sseUrl)
+  }
+}
+
+export default createSocket()
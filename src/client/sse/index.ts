@@ -0,0 +1,134 @@
+import { Events, SimpleEmitter } from '../emitter'
+import { EventEmitter } from 'events'
+import _debug from 'debug'
+import { Message, SocketClient } from '../ws'
+
+const debug = _debug('peercalls')
+
+// SESSION_HEADER maps to server.SSESessionHeader.
+export const SESSION_HEADER = 'X-Peercalls-Session'
+
+// SSEClient receives the messages as server-sent events and sends them in
+// HTTP POST requests, for networks where websockets are blocked.
+export class SSEClient<E extends Events> extends SimpleEmitter<E> {
+
+  protected es!: EventSource
+  protected sessionId = ''
+  protected connected = false
+  // pending keeps the posted messages in order.
+  protected pending = Promise.resolve()
+  reconnectTimeout = 2000
+
+  constructor(
+    readonly url: string,
+    protected readonly emitter = new EventEmitter(),
+  ) {
+    super()
+    this.connect()
+  }
+
+  protected connect() {
+    debug('connecting to: %s', this.url)
+    const es = this.es = new EventSource(this.url)
+
+    es.addEventListener('session', this.sseHandleSession)
+    es.addEventListener('message', this.sseHandleMessage)
+    es.addEventListener('error', this.sseHandleError)
+  }
+
+  protected sseHandleSession = (e: MessageEvent) => {
+    debug('events stream connected')
+    this.sessionId = e.data
+    this.connected = true
+    this.emitter.emit('connect')
+  }
+
+  protected sseHandleError = () => {
+    // EventSource would reconnect by itself, but the new stream has a new
+    // session, so reconnect the same way as the websocket client does.
+    this.es.close()
+    this.sessionId = ''
+
+    if (this.connected) {
+      debug('events stream closed')
+      this.emitter.emit('disconnect')
+      this.connected = false
+    } else {
+      debug('events stream failed to connect')
+    }
+
+    if (this.reconnectTimeout) {
+      setTimeout(() => this.connect(), this.reconnectTimeout)
+    }
+  }
+
+  protected sseHandleMessage = (e: MessageEvent) => {
+    const message: Message = JSON.parse(e.data)
+
+    if (message.type === 'ping') {
+      this.send({
+        ...message,
+        type: 'pong',
+      })
+      return
+    }
+
+    if (message.type === 'error' && !this.emitter.listenerCount('error')) {
+      // EventEmitter throws on error events without listeners.
+      debug('events stream message error: %o', message.payload)
+      return
+    }
+
+    this.emitter.emit(message.type, message.payload)
+  }
+
+  protected send(message: Message) {
+    const { sessionId } = this
+
+    this.pending = this.pending
+    .then(() => fetch(this.url, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        [SESSION_HEADER]: sessionId,
+      },
+      body: JSON.stringify(message),
+    }))
+    .then(res => {
+      if (!res.ok) {
+        debug('post message failed: %s', res.status)
+      }
+    })
+    .catch(err => debug('post message error: %o', err))
+  }
+
+  emit<K extends keyof E>(name: K, value: E[K]): void {
+    this.send({
+      type: name as string,
+      payload: value,
+    })
+  }
+}
+
+// AutoClient uses websockets, and switches to server-sent events when the
+// first websocket connection fails, for example because a proxy blocks it.
+export class AutoClient<E extends Events> extends SimpleEmitter<E> {
+
+  protected client: SocketClient<E> | SSEClient<E>
+
+  constructor(wsUrl: string, sseUrl: string) {
+    super()
+
+    const ws = new SocketClient<E>(wsUrl, this.emitter)
+    ws.onConnectFailed = () => {
+      debug('falling back to server-sent events')
+      this.client = new SSEClient<E>(sseUrl, this.emitter)
+    }
+
+    this.client = ws
+  }
+
+  emit<K extends keyof E>(name: K, value: E[K]): void {
+    this.client.emit(name, value)
+  }
+}
@@ -13,7 +13,8 @@ export interface ClientConfig {
   callId: string
   peerId: string
   peerConfig: PeerConfig
-  network: 'mesh' | 'sfu'
+  network: 'mesh' | 'sfu' | 'hybrid'
+  signaling: 'auto' | 'websocket' | 'sse'
 }
 
 export interface PeerConfig {
@@ -36,6 +37,11 @@ export const AudioWorkletNode = window.AudioWorkletNode
 
 export const localStorage = window.localStorage
 
+// navigate loads the url, for example to rejoin the call in another room.
+export const navigate = (url: string) => {
+  window.location.href = url
+}
+
 // createBlackVideoTrack is in window so it can be easily mocked, for example
 // jest requires canvas, which requires python to be installed, and that's
 // just too much for a simple workaround.
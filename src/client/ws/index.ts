@@ -6,7 +6,7 @@ const debug = _debug('peercalls')
 
 export { TypedEmitter }
 
-interface Message {
+export interface Message {
   type: string
   // room string
   payload: unknown
@@ -14,12 +14,18 @@ interface Message {
 
 export class SocketClient<E extends Events> extends SimpleEmitter<E> {
 
-  protected readonly emitter = new EventEmitter()
   protected ws!: WebSocket
   protected connected = false
+  protected hasConnected = false
   reconnectTimeout = 2000
-
-  constructor(readonly url: string) {
+  // onConnectFailed is called instead of reconnecting when the websocket has
+  // never connected.
+  onConnectFailed?: () => void
+
+  constructor(
+    readonly url: string,
+    protected readonly emitter = new EventEmitter(),
+  ) {
     super()
     this.connect()
   }
@@ -40,6 +46,11 @@ export class SocketClient<E extends Events> extends SimpleEmitter<E> {
       this.connected = false
     } else {
       debug('websocket failed to connect')
+
+      if (!this.hasConnected && this.onConnectFailed) {
+        this.onConnectFailed()
+        return
+      }
     }
 
     if (this.reconnectTimeout) {
@@ -50,6 +61,7 @@ export class SocketClient<E extends Events> extends SimpleEmitter<E> {
   protected wsHandleOpen = () => {
     debug('websocket connected')
     this.connected = true
+    this.hasConnected = true
     this.emitter.emit('connect')
   }
 
@@ -70,6 +82,12 @@ export class SocketClient<E extends Events> extends SimpleEmitter<E> {
       return
     }
 
+    if (message.type === 'error' && !this.emitter.listenerCount('error')) {
+      // EventEmitter throws on error events without listeners.
+      debug('websocket message error: %o', message.payload)
+      return
+    }
+
     this.emitter.emit(message.type, message.payload)
   }
 